@@ -13,7 +13,9 @@ import (
 	"github.com/vitortenor/lead-stream-service/internal/api"
 	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
 	"github.com/vitortenor/lead-stream-service/internal/configuration"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
 	"github.com/vitortenor/lead-stream-service/internal/infrastructure"
+	"github.com/vitortenor/lead-stream-service/internal/messaging"
 	"github.com/vitortenor/lead-stream-service/internal/repositories"
 	"github.com/vitortenor/lead-stream-service/internal/services"
 	"github.com/vitortenor/lead-stream-service/internal/tools"
@@ -38,29 +40,358 @@ func main() {
 	}
 	log.Println("Connected to database")
 
+	tenantDbs := infrastructure.CreateTenantDatabases(envConfig, db)
+
 	defer func() {
 		if err := db.Client().Disconnect(ctx); err != nil {
 			log.Println("Failed to disconnect from database: ", err)
 		}
 	}()
 
+	var leadCipher *services.LeadCipher
+	if envConfig.Encryption.KeyManager != "" {
+		keyManager, err := infrastructure.CreateKeyManager(envConfig)
+		if err != nil {
+			log.Fatal("Failed to load encryption key manager: ", err)
+		}
+		leadCipher = services.NewLeadCipher(
+			keyManager,
+			repositories.NewEncryptionKeyRepository(envConfig.Database.Collection["encryption_keys"], db),
+		)
+	}
+
+	auditService := services.NewAuditService(
+		repositories.NewAuditRepository(envConfig.Database.Collection["audit"], db),
+		services.AuditOptions{HashChain: envConfig.Audit.HashChain},
+	)
+	auditHandler := handlers.NewAuditHandler(auditService)
+
 	schemaHandler := handlers.NewSchemaHandler(
 		services.NewSchemaService(
-			repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], db),
+			repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+			leadCipher,
+			auditService,
 		),
 	)
 
-	fileHandler := handlers.NewFileHandler(
-		services.NewFileService(
-			repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], db),
-			repositories.NewLeadRepository(envConfig.Database.Collection["leads"], db),
+	webhookService := services.NewWebhookService(
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewWebhookRepository(envConfig.Database.Collection["webhooks"], db),
+		repositories.NewWebhookDeliveryRepository(envConfig.Database.Collection["webhook_deliveries"], db),
+		leadCipher,
+		services.WebhookOptions{
+			Timeout:     envConfig.Webhooks.Timeout.Std(),
+			MaxAttempts: envConfig.Webhooks.MaxAttempts,
+			Backoff:     envConfig.Webhooks.Backoff.Std(),
+			MaxBackoff:  envConfig.Webhooks.MaxBackoff.Std(),
+			Workers:     envConfig.Webhooks.Workers,
+
+			AllowPrivateNetworks: envConfig.Webhooks.AllowPrivateNetworks,
+		},
+	)
+	webhookService.RunDispatcher(&ctx, envConfig.Webhooks.PollInterval.Std())
+
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+
+	quotaTenants := make(map[string]domain.Limits, len(envConfig.Limits.Tenants))
+	for tenant := range envConfig.Limits.Tenants {
+		quotaTenants[tenant] = domain.Limits(envConfig.LimitsOf(tenant))
+	}
+
+	quotaService := services.NewQuotaService(
+		repositories.NewUsageRepository(envConfig.Database.Collection["usage"], db),
+		repositories.NewImportRepository(envConfig.Database.Collection["imports"], tenantDbs),
+		services.QuotaOptions{
+			Defaults:         domain.Limits(envConfig.Limits.Default),
+			Tenants:          quotaTenants,
+			RateByTenant:     envConfig.Limits.RateBy == "tenant",
+			StaleImportAfter: envConfig.Limits.StaleImportAfter.Std(),
+		},
+	)
+
+	var notifier services.EventNotifier = webhookService
+	var publisher messaging.EventPublisher
+	if envConfig.Events.Broker != "" {
+		publisher, err = infrastructure.CreateEventPublisher(envConfig)
+		if err != nil {
+			log.Fatal("Failed to connect to events broker: ", err)
+		}
+		defer func() {
+			if err := publisher.Close(); err != nil {
+				log.Println("Failed to close events broker connection: ", err)
+			}
+		}()
+
+		outboxService := services.NewOutboxService(
+			repositories.NewOutboxRepository(envConfig.Database.Collection["outbox"], db),
+			publisher,
+			services.OutboxOptions{
+				Topic:       envConfig.Events.Topic,
+				Topics:      envConfig.Events.Topics,
+				Lease:       envConfig.Events.Outbox.Lease.Std(),
+				Backoff:     envConfig.Events.Outbox.Backoff.Std(),
+				MaxBackoff:  envConfig.Events.Outbox.MaxBackoff.Std(),
+				MaxAttempts: envConfig.Events.Outbox.MaxAttempts,
+			},
+		)
+		go outboxService.RunRelay(&ctx, envConfig.Events.Outbox.PollInterval.Std())
+
+		notifier = services.Notifiers{webhookService, outboxService}
+	}
+
+	if len(envConfig.Consumers.Subscriptions) > 0 {
+		leadConsumerService := services.NewLeadConsumerService(
+			repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+			repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+			repositories.NewSuppressionRepository(envConfig.Database.Collection["suppressions"], db),
+			publisher,
+			notifier,
+			quotaService,
+			leadCipher,
+			services.LeadConsumerOptions{
+				Backoff:    envConfig.Consumers.Backoff.Std(),
+				MaxBackoff: envConfig.Consumers.MaxBackoff.Std(),
+			},
+		)
+
+		for _, subscription := range envConfig.Consumers.Subscriptions {
+			consumer, err := infrastructure.CreateEventConsumer(envConfig, subscription.Topic)
+			if err != nil {
+				log.Fatal("Failed to subscribe to "+subscription.Topic+": ", err)
+			}
+			defer func() {
+				if err := consumer.Close(); err != nil {
+					log.Println("Failed to close consumer: ", err)
+				}
+			}()
+
+			deadLetterTopic := subscription.DeadLetterTopic
+			if deadLetterTopic == "" {
+				deadLetterTopic = subscription.Topic + ".dlq"
+			}
+
+			go leadConsumerService.Consume(&ctx, &services.LeadSubscription{
+				TenantId:        subscription.TenantId,
+				SchemaId:        subscription.SchemaId,
+				Topic:           subscription.Topic,
+				DeadLetterTopic: deadLetterTopic,
+				Consumer:        consumer,
+			})
+		}
+	}
+
+	fileService := services.NewFileService(
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+		repositories.NewImportRepository(envConfig.Database.Collection["imports"], tenantDbs),
+		repositories.NewSuppressionRepository(envConfig.Database.Collection["suppressions"], db),
+		notifier,
+		quotaService,
+		leadCipher,
+		auditService,
+		services.IngestionOptions{
+			BatchSize:            envConfig.Ingestion.BatchSize,
+			Transactional:        envConfig.Ingestion.Transaction.Enabled,
+			TransactionMaxSize:   envConfig.Ingestion.Transaction.MaxSize,
+			IdempotencyRetention: envConfig.Ingestion.Idempotency.Retention.Std(),
+			StaleImportAfter:     envConfig.Limits.StaleImportAfter.Std(),
+			MaxUncompressedSize:  envConfig.Ingestion.Compression.MaxUncompressedSize,
+			MaxArchiveEntries:    envConfig.Ingestion.Compression.MaxArchiveEntries,
+			ProgressInterval:     envConfig.Ingestion.Progress.Interval.Std(),
+		},
+	)
+
+	fileHandler := handlers.NewFileHandler(fileService)
+
+	importService := services.NewImportService(
+		repositories.NewTenantRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+		repositories.NewImportRepository(envConfig.Database.Collection["imports"], tenantDbs),
+		auditService,
+	)
+
+	go importService.RunRecovery(&ctx, envConfig.Limits.StaleImportAfter.Std())
+
+	importHandler := handlers.NewImportHandler(importService, envConfig.Ingestion.Progress.Interval.Std())
+
+	uploadService := services.NewUploadService(
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewUploadRepository(envConfig.Database.Collection["uploads"], db),
+		fileService,
+		services.UploadOptions{
+			Dir:     envConfig.Uploads.Dir,
+			Timeout: envConfig.Uploads.Timeout.Std(),
+		},
+	)
+	go uploadService.RunCleanup(&ctx, envConfig.Uploads.CleanupInterval.Std())
+
+	uploadHandler := handlers.NewUploadHandler(uploadService, envConfig.Uploads.MaxChunkSize)
+
+	importSourceService := services.NewImportSourceService(
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewImportSourceRepository(envConfig.Database.Collection["import_sources"], db),
+		repositories.NewImportRepository(envConfig.Database.Collection["imports"], tenantDbs),
+		fileService,
+		importService,
+		leadCipher,
+		services.ImportSourceOptions{
+			Dir:                  envConfig.ImportSources.Dir,
+			Timeout:              envConfig.ImportSources.Timeout.Std(),
+			MaxSize:              envConfig.ImportSources.MaxSize,
+			AllowPrivateNetworks: envConfig.ImportSources.AllowPrivateNetworks,
+		},
+	)
+	go importSourceService.RunScheduler(&ctx, envConfig.ImportSources.PollInterval.Std())
+
+	importSourceHandler := handlers.NewImportSourceHandler(importSourceService)
+
+	if len(envConfig.ObjectStorage.Watches) > 0 {
+		storageClient, err := infrastructure.CreateObjectStorageClient(ctx, envConfig)
+		if err != nil {
+			log.Fatal("Failed to connect to object storage: ", err)
+		}
+		log.Println("Connected to object storage")
+
+		watches := make([]services.BucketWatch, 0, len(envConfig.ObjectStorage.Watches))
+		for _, watch := range envConfig.ObjectStorage.Watches {
+			watches = append(watches, services.BucketWatch{
+				TenantId: watch.TenantId,
+				SchemaId: watch.SchemaId,
+				Bucket:   watch.Bucket,
+				Prefix:   watch.Prefix,
+			})
+		}
+
+		bucketWatchService := services.NewBucketWatchService(
+			repositories.NewObjectRepository(storageClient),
+			repositories.NewObjectIngestionRepository(envConfig.Database.Collection["object_ingestions"], db),
+			fileService,
+			services.BucketWatchOptions{
+				Dir:     envConfig.ObjectStorage.Dir,
+				Lease:   envConfig.ObjectStorage.Lease.Std(),
+				Watches: watches,
+			},
+		)
+		go bucketWatchService.Run(&ctx, envConfig.ObjectStorage.PollInterval.Std())
+	}
+
+	if len(envConfig.DropFolders.Folders) > 0 {
+		folders := make([]services.DropFolder, 0, len(envConfig.DropFolders.Folders))
+		for _, folder := range envConfig.DropFolders.Folders {
+			folders = append(folders, services.DropFolder{
+				TenantId: folder.TenantId,
+				SchemaId: folder.SchemaId,
+				Path:     folder.Path,
+				Marker:   folder.Marker,
+			})
+		}
+
+		dropFolderService := services.NewDropFolderService(fileService, services.DropFolderOptions{
+			StableFor: envConfig.DropFolders.StableFor.Std(),
+			Folders:   folders,
+		})
+		go dropFolderService.Run(&ctx, envConfig.DropFolders.PollInterval.Std())
+	}
+
+	leadHandler := handlers.NewLeadHandler(
+		services.NewLeadService(
+			repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+			repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+			leadCipher,
+			auditService,
 		),
+		envConfig.Server.AllowedOrigins,
+	)
+
+	exportService := services.NewExportService(
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+		repositories.NewExportRepository(envConfig.Database.Collection["exports"], db),
+		leadCipher,
+		services.ExportOptions{
+			Dir:       envConfig.Exports.Dir,
+			Lease:     envConfig.Exports.Lease.Std(),
+			Retention: envConfig.Exports.Retention.Std(),
+		},
 	)
+	go exportService.RunWorker(&ctx, envConfig.Exports.PollInterval.Std())
+	go exportService.RunCleanup(&ctx, envConfig.Exports.CleanupInterval.Std())
+
+	retentionService := services.NewRetentionService(
+		repositories.NewTenantRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewSchemaRepository(envConfig.Database.Collection["schemas"], tenantDbs),
+		repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+		auditService,
+	)
+	go retentionService.RunPurge(&ctx, envConfig.Retention.PurgeInterval.Std())
+
+	exportHandler := handlers.NewExportHandler(exportService)
+
+	dataSubjectHandler := handlers.NewDataSubjectHandler(
+		services.NewDataSubjectService(
+			repositories.NewLeadRepository(envConfig.Database.Collection["leads"], tenantDbs),
+			repositories.NewSuppressionRepository(envConfig.Database.Collection["suppressions"], db),
+			repositories.NewErasureRepository(envConfig.Database.Collection["erasures"], db),
+			repositories.NewOutboxRepository(envConfig.Database.Collection["outbox"], db),
+			repositories.NewWebhookDeliveryRepository(envConfig.Database.Collection["webhook_deliveries"], db),
+			leadCipher,
+			auditService,
+		),
+	)
+
+	suppressionHandler := handlers.NewSuppressionHandler(
+		services.NewSuppressionService(
+			repositories.NewSuppressionRepository(envConfig.Database.Collection["suppressions"], db),
+			leadCipher,
+		),
+	)
+
+	apiKeyService := services.NewAPIKeyService(
+		repositories.NewAPIKeyRepository(envConfig.Database.Collection["api_keys"], db),
+	)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	usageHandler := handlers.NewUsageHandler(quotaService)
+
+	var authService *services.AuthService
+	if envConfig.Auth.Enabled {
+		if envConfig.Auth.BootstrapKey != "" {
+			err = apiKeyService.EnsureAdminKey(&ctx, "bootstrap", envConfig.Auth.BootstrapKey)
+			if err != nil {
+				log.Fatal("Failed to store bootstrap API key: ", err)
+			}
+		}
+
+		var tokenService *services.TokenService
+		if envConfig.Auth.JWT.JWKSURL != "" || envConfig.Auth.JWT.PublicKey != "" {
+			tokenService, err = services.NewTokenService(services.TokenOptions{
+				JWKSURL:         envConfig.Auth.JWT.JWKSURL,
+				PublicKey:       envConfig.Auth.JWT.PublicKey,
+				Issuer:          envConfig.Auth.JWT.Issuer,
+				Audience:        envConfig.Auth.JWT.Audience,
+				RefreshInterval: envConfig.Auth.JWT.RefreshInterval.Std(),
+				RolesClaim:      envConfig.Auth.JWT.RolesClaim,
+				GroupsClaim:     envConfig.Auth.JWT.GroupsClaim,
+				TenantClaim:     envConfig.Auth.JWT.TenantClaim,
+				Roles:           envConfig.Auth.JWT.Roles,
+				Groups:          envConfig.Auth.JWT.Groups,
+			})
+			if err != nil {
+				log.Fatal("Failed to configure bearer tokens: ", err)
+			}
+		}
+
+		authService = services.NewAuthService(apiKeyService, tokenService)
+	}
 
 	e := echo.New()
 	humaApi := humaecho.New(e, huma.DefaultConfig(envConfig.Server.API.Name, envConfig.Server.API.Version))
 
-	api.InitRoutes(humaApi, schemaHandler, fileHandler)
+	api.InitRequestId(humaApi)
+	api.InitAuth(humaApi, authService)
+	api.InitRateLimit(humaApi, quotaService)
+	api.InitRoutes(humaApi, apiKeyHandler, usageHandler, schemaHandler, fileHandler, importHandler, uploadHandler, importSourceHandler, webhookHandler, leadHandler, exportHandler, dataSubjectHandler, suppressionHandler, auditHandler)
+	api.InitWebSocketRoutes(e, leadHandler, authService, quotaService)
 
 	address := fmt.Sprintf("%s:%d", envConfig.Server.Host, envConfig.Server.Port)
 	log.Println("Server started on " + address)
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func InitAPIKeyRoutes(humaApi huma.API, apiKeyHandler *APIKeyHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/api-keys",
+		OperationID:   "create-api-key",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Summary:       "Create an API key",
+		Description:   "Create an API key with the given scopes, the key itself is only returned here. Callers of the default tenant can create keys for other tenants",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, apiKeyHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/api-keys",
+		OperationID:   "list-api-keys",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List API keys",
+		Description:   "List every API key, revoked and expired ones included",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, apiKeyHandler.List)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/api-keys/{keyId}",
+		OperationID:   "get-api-key",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get an API key",
+		Description:   "Get the settings of the given API key",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, apiKeyHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/api-keys/{keyId}",
+		OperationID:   "revoke-api-key",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Revoke an API key",
+		Description:   "Revoke the given API key, which is rejected from then on",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, apiKeyHandler.Revoke)
+}
+
+type APIKeyHandler struct {
+	service *services.APIKeyService
+}
+
+func NewAPIKeyHandler(service *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		service: service,
+	}
+}
+
+func (ah *APIKeyHandler) Create(ctx context.Context, ar *APIKeyCreateRequest) (*APIKeyResponse, error) {
+	key, err := ar.Body.toDomain()
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	key, err = ah.service.Create(&ctx, key)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &APIKeyResponse{Body: apiKeyToResponse(key)}
+	response.Body.Key = key.Key
+	return response, nil
+}
+
+func (ah *APIKeyHandler) List(ctx context.Context, _ *struct{}) (*APIKeyListResponse, error) {
+	keys, err := ah.service.FindAll(&ctx)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &APIKeyListResponse{}
+	response.Body.APIKeys = make([]APIKeyResponseBody, 0, len(keys))
+	for _, key := range keys {
+		response.Body.APIKeys = append(response.Body.APIKeys, apiKeyToResponse(key))
+	}
+	return response, nil
+}
+
+func (ah *APIKeyHandler) Get(ctx context.Context, ar *APIKeyRequest) (*APIKeyResponse, error) {
+	key, err := ah.service.FindById(&ctx, ar.KeyId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &APIKeyResponse{Body: apiKeyToResponse(key)}, nil
+}
+
+func (ah *APIKeyHandler) Revoke(ctx context.Context, ar *APIKeyRequest) (*APIKeyResponse, error) {
+	key, err := ah.service.Revoke(&ctx, ar.KeyId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &APIKeyResponse{Body: apiKeyToResponse(key)}, nil
+}
+
+type APIKeyRequest struct {
+	KeyId string `path:"keyId" required:"true"`
+}
+
+type APIKeyCreateRequest struct {
+	Body APIKeyCreateRequestBody
+}
+
+type APIKeyCreateRequestBody struct {
+	Name      string   `json:"name" minLength:"1" description:"What the key is used for"`
+	Scopes    []string `json:"scopes" minItems:"1" enum:"schema:write,leads:upload,leads:read,pii:read,admin" description:"The scopes granted to the key"`
+	ExpiresAt string   `json:"expires_at,omitempty" required:"false" description:"When the key expires, as an RFC 3339 time. Keys without one never expire"`
+	TenantId  string   `json:"tenant_id,omitempty" required:"false" description:"The tenant whose data the key reaches, the tenant of the caller by default"`
+}
+
+func (ab *APIKeyCreateRequestBody) toDomain() (*domain.APIKey, error) {
+	key := &domain.APIKey{
+		Name:     ab.Name,
+		Scopes:   ab.Scopes,
+		TenantId: ab.TenantId,
+	}
+
+	if ab.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, ab.ExpiresAt)
+		if err != nil {
+			return nil, domain.ErrInvalidAPIKeySettings
+		}
+		key.ExpiresAt = primitive.NewDateTimeFromTime(expiresAt)
+	}
+
+	return key, nil
+}
+
+type APIKeyResponse struct {
+	Body APIKeyResponseBody
+}
+
+type APIKeyListResponse struct {
+	Body struct {
+		APIKeys []APIKeyResponseBody `json:"api_keys" description:"The API keys"`
+	}
+}
+
+type APIKeyResponseBody struct {
+	ID        string   `json:"id" description:"The ID of the API key"`
+	TenantId  string   `json:"tenant_id" description:"The tenant whose data the key reaches"`
+	Name      string   `json:"name" description:"What the key is used for"`
+	Prefix    string   `json:"prefix" description:"The first characters of the key"`
+	Key       string   `json:"key,omitempty" description:"The key, only returned when it is created"`
+	Scopes    []string `json:"scopes" description:"The scopes granted to the key"`
+	ExpiresAt string   `json:"expires_at,omitempty" description:"When the key expires"`
+	RevokedAt string   `json:"revoked_at,omitempty" description:"When the key was revoked"`
+	CreatedAt string   `json:"created_at" description:"When the key was created"`
+}
+
+func apiKeyToResponse(key *domain.APIKey) APIKeyResponseBody {
+	body := APIKeyResponseBody{
+		ID:        key.ID.Hex(),
+		TenantId:  key.TenantId,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Time().Format(time.DateTime),
+	}
+
+	if key.ExpiresAt != 0 {
+		body.ExpiresAt = key.ExpiresAt.Time().Format(time.DateTime)
+	}
+
+	if key.RevokedAt != 0 {
+		body.RevokedAt = key.RevokedAt.Time().Format(time.DateTime)
+	}
+
+	return body
+}
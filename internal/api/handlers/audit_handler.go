@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitAuditRoutes(humaApi huma.API, auditHandler *AuditHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/audit",
+		OperationID:   "list-audit-entries",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List audit entries",
+		Description:   "List the audit trail of the tenant, newest first: who changed which schema, import or lead, in which request, and the values of the fields it changed",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, auditHandler.List)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/audit/verify",
+		OperationID:   "verify-audit-chain",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Verify the audit chain",
+		Description:   "Check that no entry of the hash chain of the tenant was changed or removed since it was recorded",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, auditHandler.Verify)
+}
+
+type AuditHandler struct {
+	service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		service: service,
+	}
+}
+
+func (ah *AuditHandler) List(ctx context.Context, ar *AuditListRequest) (*AuditListResponse, error) {
+	entries, err := ah.service.List(&ctx, services.AuditQuery{
+		Actor:      ar.Actor,
+		Action:     ar.Action,
+		EntityType: ar.EntityType,
+		EntityId:   ar.EntityId,
+		RequestId:  ar.RequestId,
+		From:       ar.From,
+		To:         ar.To,
+		After:      ar.After,
+		Limit:      ar.Limit,
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &AuditListResponse{}
+	response.Body.Entries = make([]AuditEntryResponseBody, 0, len(entries))
+	for _, entry := range entries {
+		response.Body.Entries = append(response.Body.Entries, auditEntryToResponse(entry))
+	}
+	if len(entries) > 0 && int64(len(entries)) == ar.Limit {
+		response.Body.Next = entries[len(entries)-1].ID.Hex()
+	}
+
+	return response, nil
+}
+
+func (ah *AuditHandler) Verify(ctx context.Context, _ *struct{}) (*AuditVerifyResponse, error) {
+	verification, err := ah.service.Verify(&ctx)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &AuditVerifyResponse{}
+	response.Body.Entries = verification.Entries
+	response.Body.Valid = verification.Valid
+	response.Body.BrokenAt = verification.BrokenAt
+	return response, nil
+}
+
+type AuditListRequest struct {
+	Actor      string `query:"actor" required:"false" description:"Only the entries of this caller, system for the background workers"`
+	Action     string `query:"action" required:"false" description:"Only the entries of this action, as schema.created"`
+	EntityType string `query:"entity_type" required:"false" enum:"schema,import,lead,erasure" description:"Only the entries of this kind of entity"`
+	EntityId   string `query:"entity_id" required:"false" description:"Only the entries of this entity"`
+	RequestId  string `query:"request_id" required:"false" description:"Only the entries of the request with this X-Request-Id"`
+	From       string `query:"from" required:"false" description:"Only the entries recorded at or after this RFC 3339 time"`
+	To         string `query:"to" required:"false" description:"Only the entries recorded before this RFC 3339 time"`
+	After      string `query:"after" required:"false" description:"The next cursor of the previous page"`
+	Limit      int64  `query:"limit" required:"false" minimum:"1" maximum:"1000" default:"100" description:"How many entries to list"`
+}
+
+type AuditListResponse struct {
+	Body struct {
+		Entries []AuditEntryResponseBody `json:"entries" description:"The entries, newest first"`
+		Next    string                   `json:"next,omitempty" description:"The cursor of the next page, as the after query, when there may be one"`
+	}
+}
+
+type AuditVerifyResponse struct {
+	Body struct {
+		Entries  int64 `json:"entries" description:"The number of chained entries checked"`
+		Valid    bool  `json:"valid" description:"Whether every chained entry follows the one before it unchanged"`
+		BrokenAt int64 `json:"broken_at,omitempty" description:"The sequence number of the first entry that does not, when the chain is broken"`
+	}
+}
+
+type AuditEntryResponseBody struct {
+	ID         string                `json:"id" description:"The ID of the entry"`
+	Seq        int64                 `json:"seq,omitempty" description:"The position of the entry in the hash chain of the tenant, when chained"`
+	Actor      string                `json:"actor" description:"Who made the change, system for the background workers"`
+	Action     string                `json:"action" description:"What was done"`
+	EntityType string                `json:"entity_type" description:"The kind of entity changed"`
+	EntityId   string                `json:"entity_id" description:"The ID of the entity changed"`
+	Changes    []AuditChangeResponse `json:"changes" description:"The fields changed, with their values before and after the change"`
+	RequestId  string                `json:"request_id,omitempty" description:"The X-Request-Id of the request that made the change"`
+	CreatedAt  string                `json:"created_at" description:"When the change was made"`
+	PrevHash   string                `json:"prev_hash,omitempty" description:"The hash of the previous entry of the chain"`
+	Hash       string                `json:"hash,omitempty" description:"The SHA-256 of the entry and of the hash of the previous one"`
+}
+
+type AuditChangeResponse struct {
+	Field  string `json:"field" description:"The field changed"`
+	Before any    `json:"before,omitempty" description:"The value of the field before the change, missing when it had none"`
+	After  any    `json:"after,omitempty" description:"The value of the field after the change, missing when it has none"`
+}
+
+func auditEntryToResponse(entry *domain.AuditEntry) AuditEntryResponseBody {
+	changes := make([]AuditChangeResponse, 0, len(entry.Changes))
+	for _, change := range entry.Changes {
+		changes = append(changes, AuditChangeResponse{
+			Field:  change.Field,
+			Before: auditValueToResponse(change.Before),
+			After:  auditValueToResponse(change.After),
+		})
+	}
+
+	return AuditEntryResponseBody{
+		ID:         entry.ID.Hex(),
+		Seq:        entry.Seq,
+		Actor:      entry.Actor,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityId:   entry.EntityId,
+		Changes:    changes,
+		RequestId:  entry.RequestId,
+		CreatedAt:  entry.CreatedAt.Time().Format(time.DateTime),
+		PrevHash:   entry.PrevHash,
+		Hash:       entry.Hash,
+	}
+}
+
+// auditValueToResponse answers the JSON values of a change as they were, not
+// as strings.
+func auditValueToResponse(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	var decoded any
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+const (
+	APIKeySecurityScheme = "apiKey"
+	BearerSecurityScheme = "bearer"
+	APIKeyHeader         = "X-API-Key"
+	// APIKeyQuery and AccessTokenQuery carry the credentials for the clients
+	// that can not set headers, such as EventSource and WebSocket in browsers.
+	APIKeyQuery      = "api_key"
+	AccessTokenQuery = "access_token"
+)
+
+// requireScopes declares the scopes an operation requires, with either an API
+// key or a bearer token, which the auth middleware enforces and the OpenAPI
+// spec documents.
+func requireScopes(scopes ...string) []map[string][]string {
+	return []map[string][]string{{APIKeySecurityScheme: scopes}, {BearerSecurityScheme: scopes}}
+}
+
+// InitAuth declares the security schemes and, when service is set, checks the
+// credentials of every request to an operation registered afterwards against
+// the scopes the operation requires. The request is then scoped to the caller
+// and its tenant, or to the default tenant when service is nil.
+func InitAuth(humaApi huma.API, service *services.AuthService) {
+	components := humaApi.OpenAPI().Components
+	if components.SecuritySchemes == nil {
+		components.SecuritySchemes = make(map[string]*huma.SecurityScheme)
+	}
+	components.SecuritySchemes[APIKeySecurityScheme] = &huma.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        APIKeyHeader,
+		Description: "An API key, also accepted in the `api_key` query parameter by the streaming endpoints",
+	}
+	components.SecuritySchemes[BearerSecurityScheme] = &huma.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "A JWT of the OIDC provider, also accepted in the `access_token` query parameter by the streaming endpoints",
+	}
+
+	if service == nil {
+		humaApi.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
+			next(huma.WithContext(ctx, domain.ContextWithTenant(ctx.Context(), domain.DefaultTenant)))
+		})
+		return
+	}
+
+	humaApi.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
+		scopes, secured := operationScopes(ctx.Operation())
+		if !secured {
+			next(huma.WithContext(ctx, domain.ContextWithTenant(ctx.Context(), domain.DefaultTenant)))
+			return
+		}
+
+		credentials := credentialsOf(ctx.Header, ctx.Query)
+		reqCtx := ctx.Context()
+		principal, err := service.Authenticate(&reqCtx, credentials, scopes)
+		if err != nil {
+			var statusErr huma.StatusError
+			if errors.As(handleError(err), &statusErr) {
+				_ = huma.WriteErr(humaApi, ctx, statusErr.GetStatus(), err.Error())
+			}
+			return
+		}
+
+		next(huma.WithContext(ctx, principal.Context(reqCtx)))
+	})
+}
+
+// NewEchoAuthMiddleware checks the credentials of the routes registered on the
+// router itself, which huma does not see. A nil service scopes them to the
+// default tenant.
+func NewEchoAuthMiddleware(service *services.AuthService, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if service == nil {
+				c.SetRequest(c.Request().WithContext(domain.ContextWithTenant(c.Request().Context(), domain.DefaultTenant)))
+				return next(c)
+			}
+
+			credentials := credentialsOf(c.Request().Header.Get, c.QueryParam)
+			ctx := c.Request().Context()
+			principal, err := service.Authenticate(&ctx, credentials, scopes)
+			if err != nil {
+				var statusErr huma.StatusError
+				if errors.As(handleError(err), &statusErr) {
+					return c.JSON(statusErr.GetStatus(), statusErr)
+				}
+				return c.NoContent(http.StatusInternalServerError)
+			}
+
+			c.SetRequest(c.Request().WithContext(principal.Context(ctx)))
+			return next(c)
+		}
+	}
+}
+
+func credentialsOf(header, query func(string) string) services.Credentials {
+	credentials := services.Credentials{
+		APIKey:      header(APIKeyHeader),
+		BearerToken: query(AccessTokenQuery),
+	}
+
+	if scheme, token, ok := strings.Cut(header("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		credentials.BearerToken = strings.TrimSpace(token)
+	}
+	if credentials.APIKey == "" {
+		credentials.APIKey = query(APIKeyQuery)
+	}
+
+	return credentials
+}
+
+func operationScopes(op *huma.Operation) ([]string, bool) {
+	for _, requirement := range op.Security {
+		if scopes, ok := requirement[APIKeySecurityScheme]; ok {
+			return scopes, true
+		}
+	}
+	return nil, false
+}
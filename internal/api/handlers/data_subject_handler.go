@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitDataSubjectRoutes(humaApi huma.API, dataSubjectHandler *DataSubjectHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/data-subjects/export",
+		OperationID:   "export-data-subject",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Export the leads of a data subject",
+		Description:   "Find the leads of every schema whose email or phone matches the data subject and return them as JSON",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, dataSubjectHandler.Export)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/data-subjects/erase",
+		OperationID:   "erase-data-subject",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Erase the leads of a data subject",
+		Description:   "Delete or anonymize the leads of every schema whose email or phone matches the data subject, and suppress the subject from future imports",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, dataSubjectHandler.Erase)
+}
+
+type DataSubjectHandler struct {
+	service *services.DataSubjectService
+}
+
+func NewDataSubjectHandler(service *services.DataSubjectService) *DataSubjectHandler {
+	return &DataSubjectHandler{
+		service: service,
+	}
+}
+
+func (dh *DataSubjectHandler) Export(ctx context.Context, dr *DataSubjectExportRequest) (*DataSubjectExportResponse, error) {
+	leads, err := dh.service.Export(&ctx, dr.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &DataSubjectExportResponse{}
+	response.Body.Count = len(leads)
+	response.Body.Leads = make([]map[string]any, 0, len(leads))
+	for _, lead := range leads {
+		response.Body.Leads = append(response.Body.Leads, lead)
+	}
+
+	return response, nil
+}
+
+func (dh *DataSubjectHandler) Erase(ctx context.Context, dr *DataSubjectEraseRequest) (*DataSubjectEraseResponse, error) {
+	erasure, err := dh.service.Erase(&ctx, dr.Body.toDomain(), dr.Body.Mode)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &DataSubjectEraseResponse{Body: erasureToResponse(erasure)}, nil
+}
+
+type DataSubjectRequestBody struct {
+	Email string `json:"email,omitempty" description:"The email of the data subject"`
+	Phone string `json:"phone,omitempty" description:"The phone of the data subject"`
+}
+
+func (b *DataSubjectRequestBody) toDomain() *domain.DataSubject {
+	return &domain.DataSubject{Email: b.Email, Phone: b.Phone}
+}
+
+type DataSubjectExportRequest struct {
+	Body DataSubjectRequestBody
+}
+
+type DataSubjectEraseRequest struct {
+	Body struct {
+		DataSubjectRequestBody
+		Mode string `json:"mode,omitempty" enum:"delete,anonymize" default:"delete" description:"Whether the leads are deleted or stripped of everything but their IDs and timestamps"`
+	}
+}
+
+type DataSubjectExportResponse struct {
+	Body struct {
+		Leads []map[string]any `json:"leads" description:"The leads of the data subject, across every schema"`
+		Count int              `json:"count" description:"The number of leads found"`
+	}
+}
+
+type DataSubjectEraseResponse struct {
+	Body ErasureResponseBody
+}
+
+type ErasureResponseBody struct {
+	ID          string `json:"id" description:"The ID of the erasure record, which keeps only hashes of the data subject"`
+	Mode        string `json:"mode" description:"Whether the leads were deleted or anonymized"`
+	LeadsErased int64  `json:"leads_erased" description:"The number of leads deleted or anonymized"`
+	CreatedAt   string `json:"created_at" description:"When the data subject was erased"`
+}
+
+func erasureToResponse(erasure *domain.Erasure) ErasureResponseBody {
+	return ErasureResponseBody{
+		ID:          erasure.ID.Hex(),
+		Mode:        erasure.Mode,
+		LeadsErased: erasure.Leads,
+		CreatedAt:   erasure.CreatedAt.Time().Format(time.DateTime),
+	}
+}
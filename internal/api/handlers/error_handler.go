@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"archive/zip"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/danielgtaylor/huma/v2"
 
@@ -20,15 +24,68 @@ func handleError(err error) error {
 		errors.Is(err, domain.ErrInvalidFieldValues),
 		errors.Is(err, domain.ErrDuplicatedValue),
 		errors.Is(err, domain.ErrRequiredFieldsNotPresent),
-		errors.Is(err, domain.ErrDuplicatedFields):
+		errors.Is(err, domain.ErrDuplicatedFields),
+		errors.Is(err, domain.ErrInvalidUploadSession),
+		errors.Is(err, domain.ErrEmptyArchive),
+		errors.Is(err, domain.ErrFileMissing),
+		errors.Is(err, domain.ErrInvalidImportSource),
+		errors.Is(err, domain.ErrInvalidWebhook),
+		errors.Is(err, domain.ErrInvalidResumeToken),
+		errors.Is(err, domain.ErrInvalidLeadFilter),
+		errors.Is(err, domain.ErrInvalidExport),
+		errors.Is(err, domain.ErrInvalidAPIKeySettings),
+		errors.Is(err, domain.ErrInvalidTenant),
+		errors.Is(err, domain.ErrTenantRequired),
+		errors.Is(err, domain.ErrEncryptionDisabled),
+		errors.Is(err, domain.ErrInvalidDataSubject),
+		errors.Is(err, domain.ErrInvalidRetention),
+		errors.Is(err, domain.ErrInvalidSuppression),
+		errors.Is(err, domain.ErrInvalidAuditQuery),
+		errors.Is(err, zip.ErrFormat),
+		errors.Is(err, gzip.ErrHeader):
 		return huma.NewError(http.StatusBadRequest, err.Error())
 
 	case errors.Is(err, domain.ErrRequiredFieldsMissing):
 		return huma.NewError(http.StatusBadRequest, err.Error())
 
+	case errors.Is(err, domain.ErrUploadSizeExceeded),
+		errors.Is(err, domain.ErrUncompressedSizeExceeded),
+		errors.Is(err, domain.ErrTooManyArchiveEntries),
+		errors.Is(err, domain.ErrExportTooLarge):
+		return huma.NewError(http.StatusRequestEntityTooLarge, err.Error())
+
+	case errors.Is(err, domain.ErrIdempotencyKeyReused):
+		return huma.NewError(http.StatusUnprocessableEntity, err.Error())
+
+	case errors.Is(err, domain.ErrUnauthorized):
+		return huma.NewError(http.StatusUnauthorized, err.Error())
+
+	case errors.Is(err, domain.ErrForbidden):
+		return huma.NewError(http.StatusForbidden, err.Error())
+
+	case errors.Is(err, domain.ErrRateLimited),
+		errors.Is(err, domain.ErrQuotaExceeded):
+		statusErr := huma.NewError(http.StatusTooManyRequests, err.Error())
+		if seconds, ok := retryAfter(err); ok {
+			return huma.ErrorWithHeaders(statusErr, http.Header{"Retry-After": {seconds}})
+		}
+		return statusErr
+
+	case errors.Is(err, domain.ErrResumeTokenExpired):
+		return huma.NewError(http.StatusGone, err.Error())
+
 	case errors.Is(err, mongo.ErrNoDocuments):
 		return huma.NewError(http.StatusNotFound, err.Error())
 
+	case errors.Is(err, domain.ErrImportInProgress),
+		errors.Is(err, domain.ErrImportAlreadyRolledBack),
+		errors.Is(err, domain.ErrUploadClosed),
+		errors.Is(err, domain.ErrUploadOffsetMismatch),
+		errors.Is(err, domain.ErrUploadIncomplete),
+		errors.Is(err, domain.ErrWebhookDeliveryNotDead),
+		errors.Is(err, domain.ErrExportNotReady):
+		return huma.NewError(http.StatusConflict, err.Error())
+
 	case mongo.IsDuplicateKeyError(err):
 		return huma.NewError(http.StatusConflict, err.Error())
 
@@ -37,3 +94,13 @@ func handleError(err error) error {
 			fmt.Sprintf("Internal server error: %s", err.Error()))
 	}
 }
+
+// retryAfter returns the Retry-After header, in whole seconds, of a rate limit
+// or a quota that was reached.
+func retryAfter(err error) (string, bool) {
+	var limitErr *domain.LimitError
+	if !errors.As(err, &limitErr) {
+		return "", false
+	}
+	return strconv.FormatInt(int64(math.Ceil(limitErr.RetryAfter.Seconds())), 10), true
+}
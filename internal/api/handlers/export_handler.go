@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitExportRoutes(humaApi huma.API, exportHandler *ExportHandler) {
+	exportResponses := map[string]*huma.Response{
+		"200": {
+			Description: "The leads in the requested format",
+			Content: map[string]*huma.MediaType{
+				"text/csv":             {Schema: &huma.Schema{Type: huma.TypeString}},
+				"application/x-ndjson": {Schema: &huma.Schema{Type: huma.TypeString}},
+				domain.ExportContentType(domain.ExportFormatXLSX):    {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+				domain.ExportContentType(domain.ExportFormatParquet): {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+			},
+		},
+	}
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/leads/export",
+		OperationID:   "export-leads",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Export leads",
+		Description:   "Stream the leads of the given schema that match the filters as CSV, NDJSON, XLSX or Parquet",
+		Responses:     exportResponses,
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, exportHandler.Export)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/leads/exports",
+		OperationID:   "create-export",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusAccepted,
+		Summary:       "Create a background export",
+		Description:   "Queue an export of the leads of the given schema that match the filters, to download once it completes",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, exportHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/exports/{exportId}",
+		OperationID:   "get-export",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get an export",
+		Description:   "Get the status of the given background export",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, exportHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/exports/{exportId}/download",
+		OperationID:   "download-export",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Download an export",
+		Description:   "Download the file of the given completed export",
+		Responses:     exportResponses,
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, exportHandler.Download)
+}
+
+type ExportHandler struct {
+	service *services.ExportService
+}
+
+func NewExportHandler(service *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		service: service,
+	}
+}
+
+func (eh *ExportHandler) Export(ctx context.Context, er *ExportRequest) (*huma.StreamResponse, error) {
+	export, err := eh.service.Prepare(&ctx, er.SchemaId, er.Format, er.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		streamCtx := hctx.Context()
+
+		hctx.SetHeader("Content-Type", domain.ExportContentType(export.Format))
+		hctx.SetHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="leads-%s%s"`, er.SchemaId, domain.ExportExtension(export.Format)))
+		hctx.SetStatus(http.StatusOK)
+
+		// the status is already sent, so a failure can only leave the file
+		// without its end
+		if _, err := eh.service.Write(&streamCtx, export, hctx.BodyWriter()); err != nil && streamCtx.Err() == nil {
+			log.Println("Failed to export leads: ", err)
+		}
+	}}, nil
+}
+
+func (eh *ExportHandler) Create(ctx context.Context, er *ExportCreateRequest) (*ExportResponse, error) {
+	exp, err := eh.service.Create(&ctx, er.SchemaId, er.Body.Format, er.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ExportResponse{Body: exportToResponse(exp)}, nil
+}
+
+func (eh *ExportHandler) Get(ctx context.Context, er *ExportIdRequest) (*ExportResponse, error) {
+	exp, err := eh.service.FindById(&ctx, er.ExportId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ExportResponse{Body: exportToResponse(exp)}, nil
+}
+
+func (eh *ExportHandler) Download(ctx context.Context, er *ExportIdRequest) (*huma.StreamResponse, error) {
+	exp, file, err := eh.service.Open(&ctx, er.ExportId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		defer file.Close()
+
+		hctx.SetHeader("Content-Type", domain.ExportContentType(exp.Format))
+		hctx.SetHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exp.FileName()))
+		hctx.SetHeader("Content-Length", fmt.Sprint(exp.Size))
+		hctx.SetStatus(http.StatusOK)
+
+		_, _ = io.Copy(hctx.BodyWriter(), file)
+	}}, nil
+}
+
+type ExportRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+	Format   string `query:"format" required:"true" enum:"csv,ndjson,xlsx,parquet" description:"The format of the file"`
+	LeadQueryParams
+}
+
+// LeadQueryParams are the filters of a lead query.
+type LeadQueryParams struct {
+	ImportId      string   `query:"import_id" required:"false" description:"Only the leads written by this import"`
+	CreatedFrom   string   `query:"created_from" required:"false" description:"Only the leads created at or after this RFC 3339 time"`
+	CreatedTo     string   `query:"created_to" required:"false" description:"Only the leads created before this RFC 3339 time"`
+	ConsentedFrom string   `query:"consented_from" required:"false" description:"Only the leads whose consent was given at or after this RFC 3339 time"`
+	ConsentedTo   string   `query:"consented_to" required:"false" description:"Only the leads whose consent was given before this RFC 3339 time"`
+	Filters       []string `query:"filter,explode" required:"false" description:"Only the leads whose field, or consent field, equals the value, as field:value, written as in an uploaded file. Repeat to combine"`
+}
+
+func (lq *LeadQueryParams) toDomain() domain.LeadQuery {
+	return domain.LeadQuery{
+		ImportId:      lq.ImportId,
+		CreatedFrom:   lq.CreatedFrom,
+		CreatedTo:     lq.CreatedTo,
+		ConsentedFrom: lq.ConsentedFrom,
+		ConsentedTo:   lq.ConsentedTo,
+		Filters:       lq.Filters,
+	}
+}
+
+type ExportCreateRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+	Body     ExportCreateRequestBody
+}
+
+type ExportCreateRequestBody struct {
+	Format        string   `json:"format" enum:"csv,ndjson,xlsx,parquet" description:"The format of the file"`
+	ImportId      string   `json:"import_id,omitempty" required:"false" description:"Only the leads written by this import"`
+	CreatedFrom   string   `json:"created_from,omitempty" required:"false" description:"Only the leads created at or after this RFC 3339 time"`
+	CreatedTo     string   `json:"created_to,omitempty" required:"false" description:"Only the leads created before this RFC 3339 time"`
+	ConsentedFrom string   `json:"consented_from,omitempty" required:"false" description:"Only the leads whose consent was given at or after this RFC 3339 time"`
+	ConsentedTo   string   `json:"consented_to,omitempty" required:"false" description:"Only the leads whose consent was given before this RFC 3339 time"`
+	Filters       []string `json:"filters,omitempty" required:"false" description:"Only the leads whose field, or consent field, equals the value, as field:value"`
+}
+
+func (eb *ExportCreateRequestBody) toDomain() domain.LeadQuery {
+	return domain.LeadQuery{
+		ImportId:      eb.ImportId,
+		CreatedFrom:   eb.CreatedFrom,
+		CreatedTo:     eb.CreatedTo,
+		ConsentedFrom: eb.ConsentedFrom,
+		ConsentedTo:   eb.ConsentedTo,
+		Filters:       eb.Filters,
+	}
+}
+
+type ExportIdRequest struct {
+	ExportId string `path:"exportId" required:"true"`
+}
+
+type ExportResponse struct {
+	Body ExportResponseBody
+}
+
+type ExportResponseBody struct {
+	ID         string `json:"id" description:"The ID of the export"`
+	SchemaId   string `json:"schema_id" description:"The ID of the schema whose leads are exported"`
+	Format     string `json:"format" description:"The format of the file"`
+	Status     string `json:"status" description:"pending, running, completed or failed"`
+	Rows       int64  `json:"rows" description:"The number of leads exported"`
+	Size       int64  `json:"size" description:"The size of the file in bytes"`
+	PII        bool   `json:"pii" description:"Whether the file holds the decrypted sensitive fields, which requires the pii:read scope to download"`
+	Error      string `json:"error,omitempty" description:"The reason the export failed"`
+	CreatedAt  string `json:"created_at" description:"When the export was requested"`
+	FinishedAt string `json:"finished_at,omitempty" description:"When the export finished"`
+}
+
+func exportToResponse(exp *domain.Export) ExportResponseBody {
+	body := ExportResponseBody{
+		ID:        exp.ID.Hex(),
+		SchemaId:  exp.SchemaId.Hex(),
+		Format:    exp.Format,
+		Status:    exp.Status,
+		Rows:      exp.Rows,
+		Size:      exp.Size,
+		PII:       exp.PII,
+		Error:     exp.Error,
+		CreatedAt: exp.CreatedAt.Time().Format(time.DateTime),
+	}
+
+	if exp.FinishedAt != 0 {
+		body.FinishedAt = exp.FinishedAt.Time().Format(time.DateTime)
+	}
+
+	return body
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	"maps"
 	"mime/multipart"
 	"net/http"
+	"slices"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/vitortenor/lead-stream-service/internal/domain"
@@ -16,8 +18,9 @@ func InitFileRoutes(humaApi huma.API, fileHandler *FileHandler) {
 		OperationID:   "upload-file",
 		Method:        http.MethodPost,
 		DefaultStatus: http.StatusOK,
-		Summary:       "Upload a file",
-		Description:   "Upload a file to the given schema",
+		Summary:       "Upload files",
+		Description:   "Upload one or more files to the given schema",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
 	}, fileHandler.Upload)
 }
 
@@ -31,31 +34,136 @@ func NewFileHandler(service *services.FileService) *FileHandler {
 	}
 }
 
+// Upload answers a single file with its outcome, failures included, as the
+// status of the response. Several files are each processed on their own and
+// their failures are only reported in their results.
 func (fh *FileHandler) Upload(ctx context.Context, fr *FileRequest) (*FileResponse, error) {
-	err := fh.service.ProcessAndSave(&ctx, fr.toDomain())
+	files := fr.toDomain()
+	if len(files) == 1 {
+		imports, err := fh.service.ProcessAndSave(&ctx, files[0])
+		if err != nil {
+			return nil, handleError(err)
+		}
+
+		return importsToFileResponse(imports), nil
+	}
+
+	outcomes, err := fh.service.ProcessAndSaveAll(&ctx, files)
 	if err != nil {
 		return nil, handleError(err)
 	}
 
-	response := &FileResponse{}
-	response.Body.Message = "File uploaded successfully"
-	return response, nil
+	return outcomesToFileResponse(outcomes), nil
 }
 
 type FileRequest struct {
-	SchemaId string `path:"schemaId" required:"true"`
-	RawBody  multipart.Form
+	SchemaId       string `path:"schemaId" required:"true"`
+	Uploader       string `header:"X-Uploader" required:"false" doc:"Who is uploading the file, recorded in the import history. Defaults to the authenticated caller"`
+	IdempotencyKey string `header:"Idempotency-Key" required:"false" doc:"Repeating a request with the same key returns the original import instead of processing the file again"`
+	RawBody        multipart.Form
 }
 
-func (fr *FileRequest) toDomain() *domain.File {
-	return &domain.File{
-		SchemaId: fr.SchemaId,
-		File:     fr.RawBody.File["file"][0],
+// toDomain returns every file part of the form, those of the file field
+// first and then the others by field name.
+func (fr *FileRequest) toDomain() []*domain.File {
+	fields := slices.Sorted(maps.Keys(fr.RawBody.File))
+	if i := slices.Index(fields, "file"); i > 0 {
+		fields = slices.Insert(slices.Delete(fields, i, i+1), 0, "file")
+	}
+
+	var files []*domain.File
+	for _, field := range fields {
+		for _, header := range fr.RawBody.File[field] {
+			file := domain.NewMultipartFile(fr.SchemaId, header)
+			file.Uploader = fr.Uploader
+			file.IdempotencyKey = fr.IdempotencyKey
+			files = append(files, file)
+		}
 	}
+
+	return files
 }
 
 type FileResponse struct {
 	Body struct {
-		Message string `json:"message" description:"The message of the response"`
+		Message  string       `json:"message" description:"The message of the response"`
+		ImportId string       `json:"import_id,omitempty" description:"The ID of the import created for the file, when it produced a single import"`
+		Replayed bool         `json:"replayed,omitempty" description:"Indicates the file was already uploaded and the original import was returned"`
+		Results  []FileResult `json:"results" description:"The import created for each file, or for each entry of an archive"`
+	}
+}
+
+type FileResult struct {
+	FileName       string `json:"file_name" description:"The name of the uploaded file"`
+	Entry          string `json:"entry,omitempty" description:"The name of the archive entry"`
+	ImportId       string `json:"import_id,omitempty" description:"The ID of the import, absent when the file was rejected before one was recorded"`
+	Status         string `json:"status" description:"The outcome of the import"`
+	RowsRead       int    `json:"rows_read" description:"The number of data rows read"`
+	RowsInserted   int    `json:"rows_inserted" description:"The number of leads inserted"`
+	RowsSuppressed int    `json:"rows_suppressed,omitempty" description:"The number of valid rows left out because their email or phone is suppressed"`
+	Replayed       bool   `json:"replayed,omitempty" description:"Indicates the file was already uploaded and the original import was returned"`
+	Error          string `json:"error,omitempty" description:"The reason the import failed"`
+}
+
+func importsToFileResponse(imports []*domain.Import) *FileResponse {
+	response := &FileResponse{}
+	response.Body.Message = "File uploaded successfully"
+	response.Body.Results = make([]FileResult, 0, len(imports))
+
+	for _, imp := range imports {
+		response.Body.Results = append(response.Body.Results, importToFileResult(imp))
+	}
+
+	if len(imports) == 1 {
+		response.Body.ImportId = imports[0].ID.Hex()
+	}
+	response.Body.Replayed = allReplayed(response.Body.Results)
+
+	return response
+}
+
+func outcomesToFileResponse(outcomes []*services.FileOutcome) *FileResponse {
+	response := &FileResponse{}
+	response.Body.Message = "Files processed"
+	response.Body.Results = make([]FileResult, 0, len(outcomes))
+
+	for _, outcome := range outcomes {
+		for _, imp := range outcome.Imports {
+			response.Body.Results = append(response.Body.Results, importToFileResult(imp))
+		}
+
+		if len(outcome.Imports) == 0 && outcome.Err != nil {
+			response.Body.Results = append(response.Body.Results, FileResult{
+				FileName: outcome.File.Name,
+				Status:   domain.ImportStatusFailed,
+				Error:    outcome.Err.Error(),
+			})
+		}
+	}
+	response.Body.Replayed = allReplayed(response.Body.Results)
+
+	return response
+}
+
+func importToFileResult(imp *domain.Import) FileResult {
+	return FileResult{
+		FileName:       imp.FileName,
+		Entry:          imp.Entry,
+		ImportId:       imp.ID.Hex(),
+		Status:         imp.Status,
+		RowsRead:       imp.RowsRead,
+		RowsInserted:   imp.RowsInserted,
+		RowsSuppressed: imp.RowsSuppressed,
+		Replayed:       imp.Replayed,
+		Error:          imp.Error,
+	}
+}
+
+func allReplayed(results []FileResult) bool {
+	for _, result := range results {
+		if !result.Replayed {
+			return false
+		}
 	}
+	return len(results) > 0
 }
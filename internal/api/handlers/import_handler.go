@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitImportRoutes(humaApi huma.API, importHandler *ImportHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/imports",
+		OperationID:   "list-schema-imports",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List imports of a schema",
+		Description:   "List the import history of the given schema, newest first",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, importHandler.ListBySchema)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/imports/{importId}",
+		OperationID:   "get-import",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get an import",
+		Description:   "Get the history record of the given import",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, importHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/imports/{importId}/progress",
+		OperationID:   "stream-import-progress",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Stream the progress of an import",
+		Description:   "Follow the progress of the given import as Server-Sent Events until it finishes",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "A `progress` event with the import every time its progress changes",
+				Content: map[string]*huma.MediaType{
+					"text/event-stream": {Schema: &huma.Schema{Type: huma.TypeString}},
+				},
+			},
+		},
+	}, importHandler.StreamProgress)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/imports/{importId}/rollback",
+		OperationID:   "rollback-import",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Roll back an import",
+		Description:   "Remove every lead created by the given import and mark it as rolled back",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, importHandler.Rollback)
+}
+
+type ImportHandler struct {
+	service          *services.ImportService
+	progressInterval time.Duration
+}
+
+func NewImportHandler(service *services.ImportService, progressInterval time.Duration) *ImportHandler {
+	return &ImportHandler{
+		service:          service,
+		progressInterval: progressInterval,
+	}
+}
+
+func (ih *ImportHandler) Get(ctx context.Context, ir *ImportRequest) (*ImportResponse, error) {
+	imp, err := ih.service.FindById(&ctx, ir.ImportId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ImportResponse{Body: importToResponse(imp)}, nil
+}
+
+func (ih *ImportHandler) StreamProgress(ctx context.Context, ir *ImportRequest) (*huma.StreamResponse, error) {
+	imp, err := ih.service.FindById(&ctx, ir.ImportId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		streamCtx := hctx.Context()
+
+		hctx.SetHeader("Content-Type", "text/event-stream")
+		hctx.SetHeader("Cache-Control", "no-cache")
+		hctx.SetHeader("X-Accel-Buffering", "no")
+		hctx.SetStatus(http.StatusOK)
+
+		w := hctx.BodyWriter()
+		err := ih.service.FollowProgress(&streamCtx, imp, ih.progressInterval, func(imp *domain.Import) error {
+			data, _ := json.Marshal(importToResponse(imp))
+			if _, err := fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data); err != nil {
+				return err
+			}
+			flush(w)
+			return nil
+		})
+		if err != nil && streamCtx.Err() == nil {
+			data, _ := json.Marshal(map[string]string{"message": err.Error()})
+			_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+			flush(w)
+		}
+	}}, nil
+}
+
+func (ih *ImportHandler) Rollback(ctx context.Context, ir *ImportRequest) (*ImportResponse, error) {
+	imp, err := ih.service.Rollback(&ctx, ir.ImportId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ImportResponse{Body: importToResponse(imp)}, nil
+}
+
+func (ih *ImportHandler) ListBySchema(ctx context.Context, ir *ImportListRequest) (*ImportListResponse, error) {
+	imports, err := ih.service.FindBySchemaId(&ctx, ir.SchemaId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &ImportListResponse{}
+	response.Body.Imports = make([]ImportResponseBody, 0, len(imports))
+	for _, imp := range imports {
+		response.Body.Imports = append(response.Body.Imports, importToResponse(imp))
+	}
+	return response, nil
+}
+
+type ImportRequest struct {
+	ImportId string `path:"importId" required:"true"`
+}
+
+type ImportListRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+}
+
+type ImportResponse struct {
+	Body ImportResponseBody
+}
+
+type ImportListResponse struct {
+	Body struct {
+		Imports []ImportResponseBody `json:"imports" description:"The imports of the schema"`
+	}
+}
+
+type ImportResponseBody struct {
+	ID             string                      `json:"id" description:"The ID of the import"`
+	SchemaId       string                      `json:"schema_id" description:"The ID of the schema the file was uploaded to"`
+	SourceId       string                      `json:"source_id,omitempty" description:"The ID of the import source whose scheduled run created the import"`
+	FileName       string                      `json:"file_name" description:"The original name of the uploaded file"`
+	Entry          string                      `json:"entry,omitempty" description:"The name of the archive entry the import was created for"`
+	Size           int64                       `json:"size" description:"The size of the uploaded file in bytes"`
+	Checksum       string                      `json:"checksum" description:"The SHA-256 checksum of the uploaded file"`
+	Uploader       string                      `json:"uploader,omitempty" description:"Who uploaded the file"`
+	Status         string                      `json:"status" description:"The outcome of the import"`
+	RowsRead       int                         `json:"rows_read" description:"The number of data rows read from the file"`
+	RowsInserted   int                         `json:"rows_inserted" description:"The number of leads inserted"`
+	RowsSuppressed int                         `json:"rows_suppressed,omitempty" description:"The number of valid rows left out because their email or phone is suppressed"`
+	Error          string                      `json:"error,omitempty" description:"The reason the import failed"`
+	StartedAt      string                      `json:"started_at" description:"When the import started"`
+	FinishedAt     string                      `json:"finished_at,omitempty" description:"When the import finished"`
+	RolledBackAt   string                      `json:"rolled_back_at,omitempty" description:"When the import was rolled back"`
+	RowsDeleted    int64                       `json:"rows_deleted,omitempty" description:"The number of leads removed by the rollback"`
+	Progress       *ImportProgressResponseBody `json:"progress,omitempty" description:"How far the file was read, saved while the import is processing"`
+}
+
+type ImportProgressResponseBody struct {
+	RowsRead                  int    `json:"rows_read" description:"The number of data rows read so far"`
+	RowsValid                 int    `json:"rows_valid" description:"The number of rows that passed validation"`
+	RowsRejected              int    `json:"rows_rejected" description:"The number of rows that failed validation"`
+	BytesRead                 int64  `json:"bytes_read" description:"The number of bytes of the file read so far"`
+	BytesTotal                int64  `json:"bytes_total" description:"The size of the file in bytes"`
+	EstimatedSecondsRemaining int64  `json:"estimated_seconds_remaining" description:"The estimated time left to read the file"`
+	UpdatedAt                 string `json:"updated_at" description:"When the progress was saved"`
+}
+
+func importToResponse(imp *domain.Import) ImportResponseBody {
+	body := ImportResponseBody{
+		ID:             imp.ID.Hex(),
+		SchemaId:       imp.SchemaId.Hex(),
+		FileName:       imp.FileName,
+		Entry:          imp.Entry,
+		Size:           imp.Size,
+		Checksum:       imp.Checksum,
+		Uploader:       imp.Uploader,
+		Status:         imp.Status,
+		RowsRead:       imp.RowsRead,
+		RowsInserted:   imp.RowsInserted,
+		RowsSuppressed: imp.RowsSuppressed,
+		Error:          imp.Error,
+		RowsDeleted:    imp.RowsDeleted,
+		StartedAt:      imp.StartedAt.Time().Format(time.DateTime),
+	}
+
+	if !imp.SourceId.IsZero() {
+		body.SourceId = imp.SourceId.Hex()
+	}
+
+	if imp.FinishedAt != 0 {
+		body.FinishedAt = imp.FinishedAt.Time().Format(time.DateTime)
+	}
+
+	if imp.RolledBackAt != 0 {
+		body.RolledBackAt = imp.RolledBackAt.Time().Format(time.DateTime)
+	}
+
+	if imp.Progress != nil {
+		body.Progress = &ImportProgressResponseBody{
+			RowsRead:                  imp.Progress.RowsRead,
+			RowsValid:                 imp.Progress.RowsValid,
+			RowsRejected:              imp.Progress.RowsRejected,
+			BytesRead:                 imp.Progress.BytesRead,
+			BytesTotal:                imp.Progress.BytesTotal,
+			EstimatedSecondsRemaining: imp.Progress.EstimatedSecondsRemaining,
+			UpdatedAt:                 imp.Progress.UpdatedAt.Time().Format(time.DateTime),
+		}
+	}
+
+	return body
+}
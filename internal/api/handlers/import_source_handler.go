@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitImportSourceRoutes(humaApi huma.API, importSourceHandler *ImportSourceHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/import-sources",
+		OperationID:   "create-import-source",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Summary:       "Create an import source",
+		Description:   "Create a remote file imported into the given schema on a cron schedule",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, importSourceHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/import-sources",
+		OperationID:   "list-import-sources",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List import sources of a schema",
+		Description:   "List the import sources of the given schema",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, importSourceHandler.ListBySchema)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/import-sources/{sourceId}",
+		OperationID:   "get-import-source",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get an import source",
+		Description:   "Get the settings and the last run of the given import source",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+	}, importSourceHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/import-sources/{sourceId}",
+		OperationID:   "update-import-source",
+		Method:        http.MethodPut,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Update an import source",
+		Description:   "Replace the settings of the given import source",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, importSourceHandler.Update)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/import-sources/{sourceId}",
+		OperationID:   "delete-import-source",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusNoContent,
+		Summary:       "Delete an import source",
+		Description:   "Stop importing the given source, the imports of its past runs are kept",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, importSourceHandler.Delete)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/import-sources/{sourceId}/run",
+		OperationID:   "run-import-source",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Run an import source",
+		Description:   "Fetch and import the given source right away, regardless of its schedule",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, importSourceHandler.Run)
+}
+
+type ImportSourceHandler struct {
+	service *services.ImportSourceService
+}
+
+func NewImportSourceHandler(service *services.ImportSourceService) *ImportSourceHandler {
+	return &ImportSourceHandler{
+		service: service,
+	}
+}
+
+func (sh *ImportSourceHandler) Create(ctx context.Context, sr *ImportSourceCreateRequest) (*ImportSourceResponse, error) {
+	source, err := sh.service.Create(&ctx, sr.SchemaId, sr.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ImportSourceResponse{Body: importSourceToResponse(source)}, nil
+}
+
+func (sh *ImportSourceHandler) ListBySchema(ctx context.Context, sr *ImportSourceListRequest) (*ImportSourceListResponse, error) {
+	sources, err := sh.service.FindBySchemaId(&ctx, sr.SchemaId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &ImportSourceListResponse{}
+	response.Body.ImportSources = make([]ImportSourceResponseBody, 0, len(sources))
+	for _, source := range sources {
+		response.Body.ImportSources = append(response.Body.ImportSources, importSourceToResponse(source))
+	}
+	return response, nil
+}
+
+func (sh *ImportSourceHandler) Get(ctx context.Context, sr *ImportSourceRequest) (*ImportSourceResponse, error) {
+	source, err := sh.service.FindById(&ctx, sr.SourceId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ImportSourceResponse{Body: importSourceToResponse(source)}, nil
+}
+
+func (sh *ImportSourceHandler) Update(ctx context.Context, sr *ImportSourceUpdateRequest) (*ImportSourceResponse, error) {
+	source, err := sh.service.Update(&ctx, sr.SourceId, sr.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &ImportSourceResponse{Body: importSourceToResponse(source)}, nil
+}
+
+func (sh *ImportSourceHandler) Delete(ctx context.Context, sr *ImportSourceRequest) (*struct{}, error) {
+	err := sh.service.Delete(&ctx, sr.SourceId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return nil, nil
+}
+
+func (sh *ImportSourceHandler) Run(ctx context.Context, sr *ImportSourceRequest) (*FileResponse, error) {
+	imports, err := sh.service.Run(&ctx, sr.SourceId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return importsToFileResponse(imports), nil
+}
+
+type ImportSourceRequestBody struct {
+	URL        string `json:"url" required:"true" format:"uri" description:"The HTTPS URL of the CSV file"`
+	AuthHeader string `json:"auth_header,omitempty" required:"false" description:"The name of the header sent to authenticate, such as Authorization"`
+	AuthValue  string `json:"auth_value,omitempty" required:"false" description:"The value of the auth header, kept when omitted on update"`
+	Schedule   string `json:"schedule" required:"true" description:"When to fetch the file, as a standard five-field cron expression"`
+	Mode       string `json:"mode" required:"true" enum:"append,replace" description:"Whether each run adds to or replaces the leads of the previous runs"`
+	Enabled    bool   `json:"enabled" required:"true" description:"Whether the source runs on its schedule"`
+}
+
+func (sb *ImportSourceRequestBody) toDomain() *domain.ImportSource {
+	return &domain.ImportSource{
+		URL:        sb.URL,
+		AuthHeader: sb.AuthHeader,
+		AuthValue:  sb.AuthValue,
+		Schedule:   sb.Schedule,
+		Mode:       sb.Mode,
+		Enabled:    sb.Enabled,
+	}
+}
+
+type ImportSourceCreateRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+	Body     ImportSourceRequestBody
+}
+
+type ImportSourceUpdateRequest struct {
+	SourceId string `path:"sourceId" required:"true"`
+	Body     ImportSourceRequestBody
+}
+
+type ImportSourceRequest struct {
+	SourceId string `path:"sourceId" required:"true"`
+}
+
+type ImportSourceListRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+}
+
+type ImportSourceResponse struct {
+	Body ImportSourceResponseBody
+}
+
+type ImportSourceListResponse struct {
+	Body struct {
+		ImportSources []ImportSourceResponseBody `json:"import_sources" description:"The import sources of the schema"`
+	}
+}
+
+type ImportSourceResponseBody struct {
+	ID           string `json:"id" description:"The ID of the import source"`
+	SchemaId     string `json:"schema_id" description:"The ID of the schema the file is imported into"`
+	URL          string `json:"url" description:"The URL of the file"`
+	AuthHeader   string `json:"auth_header,omitempty" description:"The name of the header sent to authenticate, its value is never returned"`
+	Schedule     string `json:"schedule" description:"When the file is fetched, as a cron expression"`
+	Mode         string `json:"mode" description:"Whether each run adds to or replaces the leads of the previous runs"`
+	Enabled      bool   `json:"enabled" description:"Whether the source runs on its schedule"`
+	ETag         string `json:"etag,omitempty" description:"The ETag of the last file imported"`
+	LastModified string `json:"last_modified,omitempty" description:"The Last-Modified date of the last file imported"`
+	LastRunAt    string `json:"last_run_at,omitempty" description:"When the source last ran"`
+	LastImportId string `json:"last_import_id,omitempty" description:"The ID of the import recorded by the last run"`
+	NextRunAt    string `json:"next_run_at" description:"When the source runs next"`
+}
+
+func importSourceToResponse(source *domain.ImportSource) ImportSourceResponseBody {
+	body := ImportSourceResponseBody{
+		ID:           source.ID.Hex(),
+		SchemaId:     source.SchemaId.Hex(),
+		URL:          source.URL,
+		AuthHeader:   source.AuthHeader,
+		Schedule:     source.Schedule,
+		Mode:         source.Mode,
+		Enabled:      source.Enabled,
+		ETag:         source.ETag,
+		LastModified: source.LastModified,
+		NextRunAt:    source.NextRunAt.Time().Format(time.DateTime),
+	}
+
+	if source.LastRunAt != 0 {
+		body.LastRunAt = source.LastRunAt.Time().Format(time.DateTime)
+	}
+
+	if !source.LastImportId.IsZero() {
+		body.LastImportId = source.LastImportId.Hex()
+	}
+
+	return body
+}
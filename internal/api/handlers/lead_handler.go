@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitLeadRoutes(humaApi huma.API, leadHandler *LeadHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/leads/stream",
+		OperationID:   "stream-leads",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Stream leads",
+		Description:   "Follow the leads written to the given schema as Server-Sent Events, resuming after the Last-Event-ID header or the resume_token query",
+		Security:      requireScopes(domain.ScopeLeadsRead),
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "A `lead` event per lead written, whose ID is the resume token of the change",
+				Content: map[string]*huma.MediaType{
+					"text/event-stream": {Schema: &huma.Schema{Type: huma.TypeString}},
+				},
+			},
+		},
+	}, leadHandler.Stream)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/leads/{leadId}/legal-hold",
+		OperationID:   "place-legal-hold",
+		Method:        http.MethodPut,
+		DefaultStatus: http.StatusNoContent,
+		Summary:       "Place a lead under legal hold",
+		Description:   "Keep the given lead from being deleted by the retention of its schema or the erasure of its data subject",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, leadHandler.PlaceLegalHold)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/leads/{leadId}/legal-hold",
+		OperationID:   "release-legal-hold",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusNoContent,
+		Summary:       "Release the legal hold of a lead",
+		Description:   "Let the given lead be deleted by the retention of its schema or the erasure of its data subject again",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, leadHandler.ReleaseLegalHold)
+}
+
+// InitLeadWebSocketRoutes registers the WebSocket variant of the lead stream
+// on the router, as huma can not describe connections that are upgraded.
+func InitLeadWebSocketRoutes(e *echo.Echo, leadHandler *LeadHandler, middlewares ...echo.MiddlewareFunc) {
+	e.GET("/schema/:schemaId/leads/ws", leadHandler.StreamWebSocket, middlewares...)
+}
+
+type LeadHandler struct {
+	service  *services.LeadService
+	upgrader websocket.Upgrader
+}
+
+// NewLeadHandler accepts WebSocket connections from pages of the service and
+// of the allowedOrigins, so other sites can not open the stream with the
+// credentials of their visitors.
+func NewLeadHandler(service *services.LeadService, allowedOrigins []string) *LeadHandler {
+	return &LeadHandler{
+		service: service,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkOrigin(allowedOrigins),
+		},
+	}
+}
+
+// checkOrigin accepts requests without an Origin header, which browsers
+// always send, from the same host or from one of the allowed origins.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return slices.ContainsFunc(allowedOrigins, func(allowed string) bool {
+			return strings.EqualFold(allowed, origin)
+		})
+	}
+}
+
+func (lh *LeadHandler) Stream(ctx context.Context, lr *LeadStreamRequest) (*huma.StreamResponse, error) {
+	resumeToken := lr.LastEventId
+	if resumeToken == "" {
+		resumeToken = lr.ResumeToken
+	}
+
+	stream, err := lh.service.Watch(&ctx, lr.SchemaId, resumeToken)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		streamCtx := hctx.Context()
+		defer closeLeadStream(stream)
+
+		hctx.SetHeader("Content-Type", "text/event-stream")
+		hctx.SetHeader("Cache-Control", "no-cache")
+		hctx.SetHeader("X-Accel-Buffering", "no")
+		hctx.SetStatus(http.StatusOK)
+
+		w := hctx.BodyWriter()
+		for {
+			change, err := stream.Next(&streamCtx)
+			if err != nil {
+				if streamCtx.Err() == nil {
+					data, _ := json.Marshal(map[string]string{"message": err.Error()})
+					_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+					flush(w)
+				}
+				return
+			}
+
+			switch {
+			case change == nil:
+				// keeps proxies from closing an idle connection
+				_, err = io.WriteString(w, ": keep-alive\n\n")
+			case change.Lead != nil:
+				data, _ := json.Marshal(leadChangeToResponse(change))
+				_, err = fmt.Fprintf(w, "id: %s\nevent: lead\ndata: %s\n\n", change.ResumeToken, data)
+			}
+			if err != nil {
+				return
+			}
+			flush(w)
+		}
+	}}, nil
+}
+
+func (lh *LeadHandler) StreamWebSocket(c echo.Context) error {
+	// refused before the stream is opened, the upgrader would check it again
+	if !lh.upgrader.CheckOrigin(c.Request()) {
+		return c.JSON(http.StatusForbidden, huma.Error403Forbidden("origin not allowed"))
+	}
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	stream, err := lh.service.Watch(&ctx, c.Param("schemaId"), c.QueryParam("resume_token"))
+	if err != nil {
+		var statusErr huma.StatusError
+		if errors.As(handleError(err), &statusErr) {
+			return c.JSON(statusErr.GetStatus(), statusErr)
+		}
+		return err
+	}
+	defer closeLeadStream(stream)
+
+	conn, err := lh.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader already answered the request
+		return nil
+	}
+	defer conn.Close()
+
+	// reading handles the pings and the close of the client, which ends the
+	// stream
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		change, err := stream.Next(&ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "lead stream failed")
+				_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			}
+			return nil
+		}
+
+		deadline := time.Now().Add(10 * time.Second)
+		switch {
+		case change == nil:
+			err = conn.WriteControl(websocket.PingMessage, nil, deadline)
+		case change.Lead != nil:
+			_ = conn.SetWriteDeadline(deadline)
+			err = conn.WriteJSON(leadChangeToResponse(change))
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (lh *LeadHandler) PlaceLegalHold(ctx context.Context, lr *LeadIdRequest) (*struct{}, error) {
+	if err := lh.service.SetLegalHold(&ctx, lr.SchemaId, lr.LeadId, true); err != nil {
+		return nil, handleError(err)
+	}
+	return nil, nil
+}
+
+func (lh *LeadHandler) ReleaseLegalHold(ctx context.Context, lr *LeadIdRequest) (*struct{}, error) {
+	if err := lh.service.SetLegalHold(&ctx, lr.SchemaId, lr.LeadId, false); err != nil {
+		return nil, handleError(err)
+	}
+	return nil, nil
+}
+
+type LeadIdRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+	LeadId   string `path:"leadId" required:"true"`
+}
+
+type LeadStreamRequest struct {
+	SchemaId    string `path:"schemaId" required:"true"`
+	LastEventId string `header:"Last-Event-ID" required:"false" description:"The ID of the last event received, sent by browsers when they reconnect"`
+	ResumeToken string `query:"resume_token" required:"false" description:"The resume token of the last lead received"`
+}
+
+type LeadChangeResponseBody struct {
+	ResumeToken string         `json:"resume_token" description:"Resumes the stream right after this lead"`
+	Operation   string         `json:"operation" description:"How the lead was written: insert, update or replace"`
+	Lead        map[string]any `json:"lead" description:"The lead as stored"`
+}
+
+func leadChangeToResponse(change *domain.LeadChange) LeadChangeResponseBody {
+	return LeadChangeResponseBody{
+		ResumeToken: change.ResumeToken,
+		Operation:   change.Operation,
+		Lead:        change.Lead,
+	}
+}
+
+func closeLeadStream(stream interface {
+	Close(ctx *context.Context) error
+}) {
+	ctx := context.Background()
+	_ = stream.Close(&ctx)
+}
+
+func flush(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
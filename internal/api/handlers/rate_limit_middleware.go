@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+// InitRateLimit takes every request to an operation registered afterwards from
+// the bucket of its caller, once the auth middleware identified it, and
+// answers 429 Too Many Requests with a Retry-After header when it is empty. A
+// nil service leaves the requests unlimited.
+func InitRateLimit(humaApi huma.API, service *services.QuotaService) {
+	if service == nil {
+		return
+	}
+
+	humaApi.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
+		reqCtx := ctx.Context()
+		if err := service.AllowRequest(&reqCtx, clientAddress(ctx.RemoteAddr())); err != nil {
+			if seconds, ok := retryAfter(err); ok {
+				ctx.SetHeader("Retry-After", seconds)
+			}
+			_ = huma.WriteErr(humaApi, ctx, http.StatusTooManyRequests, err.Error())
+			return
+		}
+
+		next(ctx)
+	})
+}
+
+// NewEchoRateLimitMiddleware limits the routes registered on the router
+// itself, which huma does not see. It must run after the auth middleware.
+func NewEchoRateLimitMiddleware(service *services.QuotaService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if service == nil {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			if err := service.AllowRequest(&ctx, c.RealIP()); err != nil {
+				if seconds, ok := retryAfter(err); ok {
+					c.Response().Header().Set("Retry-After", seconds)
+				}
+				return c.JSON(http.StatusTooManyRequests, huma.NewError(http.StatusTooManyRequests, err.Error()))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// clientAddress drops the port of the remote address.
+func clientAddress(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
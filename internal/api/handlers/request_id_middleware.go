@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+// InitRequestId tags every request to an operation registered afterwards with
+// the ID of its X-Request-Id header, or with a new one when it is missing or
+// not valid, and answers it in the same header, so the changes of a request
+// can be found in the audit trail.
+func InitRequestId(humaApi huma.API) {
+	humaApi.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
+		requestId := ctx.Header(RequestIdHeader)
+		if !domain.ValidateRequestId(requestId) {
+			requestId = primitive.NewObjectID().Hex()
+		}
+
+		ctx.SetHeader(RequestIdHeader, requestId)
+		next(huma.WithContext(ctx, domain.ContextWithRequestId(ctx.Context(), requestId)))
+	})
+}
@@ -18,7 +18,28 @@ func InitSchemaRoutes(humaApi huma.API, schemaHandler *SchemaHandler) {
 		DefaultStatus: http.StatusCreated,
 		Summary:       "Create a new schema",
 		Description:   "Create a new schema with the given fields",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
 	}, schemaHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/retention",
+		OperationID:   "set-schema-retention",
+		Method:        http.MethodPut,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Set the retention of a schema",
+		Description:   "Set how many days the leads of the given schema are kept, counted from their creation or from one of their datetime fields",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, schemaHandler.SetRetention)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/retention",
+		OperationID:   "delete-schema-retention",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Remove the retention of a schema",
+		Description:   "Keep the leads of the given schema indefinitely",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, schemaHandler.DeleteRetention)
 }
 
 type SchemaHandler struct {
@@ -40,14 +61,55 @@ func (sh *SchemaHandler) Create(ctx context.Context, sr *SchemaRequest) (*Schema
 	return schemaToResponse(schema), nil
 }
 
+func (sh *SchemaHandler) SetRetention(ctx context.Context, rr *RetentionRequest) (*SchemaResponse, error) {
+	schema, err := sh.service.UpdateRetention(&ctx, rr.SchemaId, rr.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return schemaToResponse(schema), nil
+}
+
+func (sh *SchemaHandler) DeleteRetention(ctx context.Context, sr *SchemaIdRequest) (*SchemaResponse, error) {
+	schema, err := sh.service.UpdateRetention(&ctx, sr.SchemaId, nil)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return schemaToResponse(schema), nil
+}
+
+type SchemaIdRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+}
+
+type RetentionRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+	Body     RetentionBody
+}
+
+type RetentionBody struct {
+	Days  int    `json:"days" required:"true" description:"How many days the leads are kept"`
+	Field string `json:"field,omitempty" description:"The datetime field the days are counted from, created_at when empty"`
+}
+
+func (rb *RetentionBody) toDomain() *domain.Retention {
+	if rb == nil {
+		return nil
+	}
+	return &domain.Retention{Days: rb.Days, Field: rb.Field}
+}
+
 type SchemaRequest struct {
 	Body struct {
 		Fields []struct {
-			Name     string `json:"name" required:"true" default:"name" description:"The name of the field"`
-			Type     string `json:"type" required:"true" default:"string" description:"The type of the field"`
-			Required bool   `json:"required,omitempty" optional:"true" default:"false" description:"Indicates if the field is required"`
-			Unique   bool   `json:"unique,omitempty" optional:"true" default:"false" description:"Indicates if the field is unique"`
+			Name      string `json:"name" required:"true" default:"name" description:"The name of the field"`
+			Type      string `json:"type" required:"true" default:"string" description:"The type of the field"`
+			Required  bool   `json:"required,omitempty" optional:"true" default:"false" description:"Indicates if the field is required"`
+			Unique    bool   `json:"unique,omitempty" optional:"true" default:"false" description:"Indicates if the field is unique"`
+			Sensitive bool   `json:"sensitive,omitempty" optional:"true" default:"false" description:"Indicates if the values of the field are encrypted, and only returned to callers with the pii:read scope"`
 		} `json:"fields" required:"true" description:"The fields of the schema"`
+		Retention *RetentionBody `json:"retention,omitempty" description:"How long the leads are kept, indefinitely when absent"`
 	}
 }
 
@@ -56,15 +118,17 @@ func (sr *SchemaRequest) toDomain() *domain.Schema {
 
 	for _, f := range sr.Body.Fields {
 		fields = append(fields, domain.SchemaField{
-			Name:     f.Name,
-			Type:     f.Type,
-			Required: f.Required,
-			Unique:   f.Unique,
+			Name:      f.Name,
+			Type:      f.Type,
+			Required:  f.Required,
+			Unique:    f.Unique,
+			Sensitive: f.Sensitive,
 		})
 	}
 
 	return &domain.Schema{
-		Fields: fields,
+		Fields:    fields,
+		Retention: sr.Body.Retention.toDomain(),
 	}
 }
 
@@ -72,16 +136,18 @@ type SchemaResponse struct {
 	Body struct {
 		ID        string                 `json:"id" description:"The ID of the schema"`
 		Fields    []SchemaResponseFields `json:"fields" description:"The fields of the schema"`
+		Retention *RetentionBody         `json:"retention,omitempty" description:"How long the leads are kept, indefinitely when absent"`
 		CreatedAt string                 `json:"created_at" description:"The creation date of the schema"`
 		UpdatedAt string                 `json:"updated_at" description:"The last update date of the schema"`
 	}
 }
 
 type SchemaResponseFields struct {
-	Name     string `json:"name" description:"The name of the field"`
-	Type     string `json:"type" description:"The type of the field"`
-	Required bool   `json:"required" description:"Indicates if the field is required"`
-	Unique   bool   `json:"unique" description:"Indicates if the field is unique"`
+	Name      string `json:"name" description:"The name of the field"`
+	Type      string `json:"type" description:"The type of the field"`
+	Required  bool   `json:"required" description:"Indicates if the field is required"`
+	Unique    bool   `json:"unique" description:"Indicates if the field is unique"`
+	Sensitive bool   `json:"sensitive" description:"Indicates if the values of the field are encrypted"`
 }
 
 func schemaToResponse(schema *domain.Schema) *SchemaResponse {
@@ -89,22 +155,30 @@ func schemaToResponse(schema *domain.Schema) *SchemaResponse {
 
 	for _, f := range schema.Fields {
 		fields = append(fields, SchemaResponseFields{
-			Name:     f.Name,
-			Type:     f.Type,
-			Required: f.Required,
-			Unique:   f.Unique,
+			Name:      f.Name,
+			Type:      f.Type,
+			Required:  f.Required,
+			Unique:    f.Unique,
+			Sensitive: f.Sensitive,
 		})
 	}
 
+	var retention *RetentionBody
+	if schema.Retention != nil {
+		retention = &RetentionBody{Days: schema.Retention.Days, Field: schema.Retention.Field}
+	}
+
 	return &SchemaResponse{
 		Body: struct {
 			ID        string                 `json:"id" description:"The ID of the schema"`
 			Fields    []SchemaResponseFields `json:"fields" description:"The fields of the schema"`
+			Retention *RetentionBody         `json:"retention,omitempty" description:"How long the leads are kept, indefinitely when absent"`
 			CreatedAt string                 `json:"created_at" description:"The creation date of the schema"`
 			UpdatedAt string                 `json:"updated_at" description:"The last update date of the schema"`
 		}{
 			ID:        schema.ID.Hex(),
 			Fields:    fields,
+			Retention: retention,
 			CreatedAt: schema.CreatedAt.Time().Format(time.DateTime),
 			UpdatedAt: schema.UpdatedAt.Time().Format(time.DateTime),
 		},
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitSuppressionRoutes(humaApi huma.API, suppressionHandler *SuppressionHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/suppressions",
+		OperationID:   "create-suppression",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Summary:       "Suppress an email or a phone",
+		Description:   "Add an email or a phone to the suppression list, so the leads holding it are left out of every import. A value suppressed already answers its suppression with 200",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, suppressionHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/suppressions/bulk",
+		OperationID:   "upload-suppressions",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Upload a suppression list",
+		Description:   "Suppress the emails and phones of a CSV file with an email column, a phone column or both",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, suppressionHandler.Upload)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/suppressions",
+		OperationID:   "list-suppressions",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List suppressions",
+		Description:   "List the suppression list of the tenant, newest first. Only hashes are stored, so an email or a phone is found by its value and kind",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, suppressionHandler.List)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/suppressions/{suppressionId}",
+		OperationID:   "get-suppression",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get a suppression",
+		Description:   "Get the given suppression",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, suppressionHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/suppressions/{suppressionId}",
+		OperationID:   "delete-suppression",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusNoContent,
+		Summary:       "Delete a suppression",
+		Description:   "Lift the given suppression, so the leads holding its email or phone are imported again",
+		Security:      requireScopes(domain.ScopeAdmin),
+	}, suppressionHandler.Delete)
+}
+
+type SuppressionHandler struct {
+	service *services.SuppressionService
+}
+
+func NewSuppressionHandler(service *services.SuppressionService) *SuppressionHandler {
+	return &SuppressionHandler{
+		service: service,
+	}
+}
+
+func (sh *SuppressionHandler) Create(ctx context.Context, sr *SuppressionCreateRequest) (*SuppressionResponse, error) {
+	suppression, created, err := sh.service.Create(&ctx, sr.Body.Kind, sr.Body.Value, sr.Body.Reason)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &SuppressionResponse{Status: http.StatusCreated, Body: suppressionToResponse(suppression)}
+	if !created {
+		response.Status = http.StatusOK
+	}
+	return response, nil
+}
+
+func (sh *SuppressionHandler) Upload(ctx context.Context, sr *SuppressionUploadRequest) (*SuppressionUploadResponse, error) {
+	files := sr.RawBody.File["file"]
+	if len(files) != 1 {
+		return nil, handleError(domain.ErrFileMissing)
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, handleError(err)
+	}
+	defer file.Close()
+
+	var reason string
+	if reasons := sr.RawBody.Value["reason"]; len(reasons) > 0 {
+		reason = reasons[0]
+	}
+
+	result, err := sh.service.Import(&ctx, file, reason)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &SuppressionUploadResponse{}
+	response.Body.RowsRead = result.RowsRead
+	response.Body.RowsRejected = result.RowsRejected
+	response.Body.Suppressed = result.Suppressed
+	response.Body.AlreadyListed = result.AlreadyListed
+	return response, nil
+}
+
+func (sh *SuppressionHandler) List(ctx context.Context, sr *SuppressionListRequest) (*SuppressionListResponse, error) {
+	suppressions, err := sh.service.List(&ctx, services.SuppressionQuery{
+		Kind:   sr.Kind,
+		Value:  sr.Value,
+		Reason: sr.Reason,
+		After:  sr.After,
+		Limit:  sr.Limit,
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &SuppressionListResponse{}
+	response.Body.Suppressions = make([]SuppressionResponseBody, 0, len(suppressions))
+	for _, suppression := range suppressions {
+		response.Body.Suppressions = append(response.Body.Suppressions, suppressionToResponse(suppression))
+	}
+	if len(suppressions) > 0 && int64(len(suppressions)) == sr.Limit {
+		response.Body.Next = suppressions[len(suppressions)-1].ID.Hex()
+	}
+
+	return response, nil
+}
+
+func (sh *SuppressionHandler) Get(ctx context.Context, sr *SuppressionIdRequest) (*SuppressionResponse, error) {
+	suppression, err := sh.service.FindById(&ctx, sr.SuppressionId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &SuppressionResponse{Status: http.StatusOK, Body: suppressionToResponse(suppression)}, nil
+}
+
+func (sh *SuppressionHandler) Delete(ctx context.Context, sr *SuppressionIdRequest) (*struct{}, error) {
+	if err := sh.service.Delete(&ctx, sr.SuppressionId); err != nil {
+		return nil, handleError(err)
+	}
+	return nil, nil
+}
+
+type SuppressionCreateRequest struct {
+	Body struct {
+		Kind   string `json:"kind" enum:"email,phone" description:"Whether the value is an email or a phone"`
+		Value  string `json:"value" minLength:"1" description:"The email or phone to suppress, normalized before it is hashed"`
+		Reason string `json:"reason,omitempty" enum:"opt_out,bounce,complaint,other" default:"opt_out" description:"Why the value is suppressed"`
+	}
+}
+
+type SuppressionUploadRequest struct {
+	RawBody multipart.Form
+}
+
+type SuppressionListRequest struct {
+	Kind   string `query:"kind" required:"false" enum:"email,phone" description:"Only the suppressions of this kind, required to look a value up"`
+	Value  string `query:"value" required:"false" description:"Only the suppression of this email or phone"`
+	Reason string `query:"reason" required:"false" enum:"erasure,opt_out,bounce,complaint,other" description:"Only the suppressions for this reason"`
+	After  string `query:"after" required:"false" description:"The next cursor of the previous page"`
+	Limit  int64  `query:"limit" required:"false" minimum:"1" maximum:"1000" default:"100" description:"How many suppressions to list"`
+}
+
+type SuppressionIdRequest struct {
+	SuppressionId string `path:"suppressionId" required:"true"`
+}
+
+type SuppressionResponse struct {
+	Status int
+	Body   SuppressionResponseBody
+}
+
+type SuppressionUploadResponse struct {
+	Body struct {
+		RowsRead      int   `json:"rows_read" description:"The number of rows read from the file"`
+		RowsRejected  int   `json:"rows_rejected" description:"The number of rows left out for holding no valid email nor phone"`
+		Suppressed    int64 `json:"suppressed" description:"The number of emails and phones added to the suppression list"`
+		AlreadyListed int64 `json:"already_listed" description:"The number of emails and phones that were suppressed already or repeated in the file"`
+	}
+}
+
+type SuppressionListResponse struct {
+	Body struct {
+		Suppressions []SuppressionResponseBody `json:"suppressions" description:"The suppressions, newest first"`
+		Next         string                    `json:"next,omitempty" description:"The cursor of the next page, as the after query, when there may be one"`
+	}
+}
+
+type SuppressionResponseBody struct {
+	ID        string `json:"id" description:"The ID of the suppression"`
+	Kind      string `json:"kind" description:"Whether an email or a phone is suppressed"`
+	Hash      string `json:"hash" description:"The SHA-256 of the kind and the normalized value, as only the hash is stored"`
+	Reason    string `json:"reason" description:"Why the value is suppressed"`
+	CreatedBy string `json:"created_by,omitempty" description:"Who suppressed the value"`
+	CreatedAt string `json:"created_at" description:"When the value was suppressed"`
+}
+
+func suppressionToResponse(suppression *domain.Suppression) SuppressionResponseBody {
+	return SuppressionResponseBody{
+		ID:        suppression.ID.Hex(),
+		Kind:      suppression.Kind,
+		Hash:      suppression.Hash,
+		Reason:    suppression.Reason,
+		CreatedBy: suppression.CreatedBy,
+		CreatedAt: suppression.CreatedAt.Time().Format(time.DateTime),
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitUploadRoutes(humaApi huma.API, uploadHandler *UploadHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/uploads",
+		OperationID:   "create-upload",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Summary:       "Create a resumable upload",
+		Description:   "Create an upload session to send a large file to the given schema in chunks",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, uploadHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/uploads/{uploadId}",
+		OperationID:   "get-upload",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get a resumable upload",
+		Description:   "Get the current offset and status of the given upload session",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, uploadHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/uploads/{uploadId}",
+		OperationID:   "write-upload-chunk",
+		Method:        http.MethodPut,
+		DefaultStatus: http.StatusOK,
+		MaxBodyBytes:  uploadHandler.maxChunkSize,
+		Summary:       "Upload a chunk",
+		Description:   "Write the request body at the given offset of the upload session",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, uploadHandler.WriteChunk)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/uploads/{uploadId}/finalize",
+		OperationID:   "finalize-upload",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Finalize a resumable upload",
+		Description:   "Process the uploaded file once every chunk has arrived",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, uploadHandler.Finalize)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/uploads/{uploadId}",
+		OperationID:   "cancel-upload",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusNoContent,
+		Summary:       "Cancel a resumable upload",
+		Description:   "Discard the given upload session and the chunks received so far",
+		Security:      requireScopes(domain.ScopeLeadsUpload),
+	}, uploadHandler.Cancel)
+}
+
+type UploadHandler struct {
+	service      *services.UploadService
+	maxChunkSize int64
+}
+
+func NewUploadHandler(service *services.UploadService, maxChunkSize int64) *UploadHandler {
+	return &UploadHandler{
+		service:      service,
+		maxChunkSize: maxChunkSize,
+	}
+}
+
+func (uh *UploadHandler) Create(ctx context.Context, ur *UploadCreateRequest) (*UploadResponse, error) {
+	upload, err := uh.service.Create(&ctx, ur.SchemaId, ur.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return uploadToResponse(upload), nil
+}
+
+func (uh *UploadHandler) Get(ctx context.Context, ur *UploadRequest) (*UploadResponse, error) {
+	upload, err := uh.service.FindById(&ctx, ur.UploadId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return uploadToResponse(upload), nil
+}
+
+func (uh *UploadHandler) WriteChunk(ctx context.Context, ur *UploadChunkRequest) (*UploadResponse, error) {
+	upload, err := uh.service.WriteChunk(&ctx, ur.UploadId, ur.Offset, ur.RawBody)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return uploadToResponse(upload), nil
+}
+
+func (uh *UploadHandler) Finalize(ctx context.Context, ur *UploadRequest) (*FileResponse, error) {
+	imports, err := uh.service.Finalize(&ctx, ur.UploadId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return importsToFileResponse(imports), nil
+}
+
+func (uh *UploadHandler) Cancel(ctx context.Context, ur *UploadRequest) (*struct{}, error) {
+	err := uh.service.Cancel(&ctx, ur.UploadId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return nil, nil
+}
+
+type UploadCreateRequest struct {
+	SchemaId       string `path:"schemaId" required:"true"`
+	Uploader       string `header:"X-Uploader" required:"false" doc:"Who is uploading the file, recorded in the import history. Defaults to the authenticated caller"`
+	IdempotencyKey string `header:"Idempotency-Key" required:"false" doc:"Repeating the upload with the same key returns the original import"`
+	Body           struct {
+		FileName string `json:"file_name" required:"true" minLength:"1" description:"The name of the file being uploaded"`
+		Size     int64  `json:"size" required:"true" minimum:"1" description:"The total size of the file in bytes"`
+	}
+}
+
+func (ur *UploadCreateRequest) toDomain() *domain.UploadSession {
+	return &domain.UploadSession{
+		FileName:       ur.Body.FileName,
+		Size:           ur.Body.Size,
+		Uploader:       ur.Uploader,
+		IdempotencyKey: ur.IdempotencyKey,
+	}
+}
+
+type UploadRequest struct {
+	UploadId string `path:"uploadId" required:"true"`
+}
+
+type UploadChunkRequest struct {
+	UploadId string `path:"uploadId" required:"true"`
+	Offset   int64  `header:"Upload-Offset" required:"true" minimum:"0" doc:"The byte offset the chunk starts at, must match the current offset of the upload"`
+	RawBody  []byte `contentType:"application/octet-stream"`
+}
+
+type UploadResponse struct {
+	Body struct {
+		ID        string   `json:"id" description:"The ID of the upload session"`
+		SchemaId  string   `json:"schema_id" description:"The ID of the schema the file is uploaded to"`
+		FileName  string   `json:"file_name" description:"The name of the file being uploaded"`
+		Size      int64    `json:"size" description:"The total size of the file in bytes"`
+		Offset    int64    `json:"offset" description:"The number of bytes received so far"`
+		Status    string   `json:"status" description:"The status of the upload session"`
+		ImportIds []string `json:"import_ids,omitempty" description:"The IDs of the imports created when the upload was finalized"`
+		ExpiresAt string   `json:"expires_at" description:"When the upload session is discarded if not finalized"`
+	}
+}
+
+func uploadToResponse(upload *domain.UploadSession) *UploadResponse {
+	response := &UploadResponse{}
+	response.Body.ID = upload.ID.Hex()
+	response.Body.SchemaId = upload.SchemaId.Hex()
+	response.Body.FileName = upload.FileName
+	response.Body.Size = upload.Size
+	response.Body.Offset = upload.Offset
+	response.Body.Status = upload.Status
+	response.Body.ExpiresAt = upload.ExpiresAt.Time().Format(time.DateTime)
+
+	for _, id := range upload.ImportIds {
+		response.Body.ImportIds = append(response.Body.ImportIds, id.Hex())
+	}
+
+	return response
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitUsageRoutes(humaApi huma.API, usageHandler *UsageHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/usage",
+		OperationID:   "get-usage",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get the usage of the tenant",
+		Description:   "Get the limits of the tenant of the caller and how much of them it used today",
+		Security:      requireScopes(),
+	}, usageHandler.Get)
+}
+
+type UsageHandler struct {
+	service *services.QuotaService
+}
+
+func NewUsageHandler(service *services.QuotaService) *UsageHandler {
+	return &UsageHandler{
+		service: service,
+	}
+}
+
+func (uh *UsageHandler) Get(ctx context.Context, _ *struct{}) (*UsageResponse, error) {
+	usage, err := uh.service.Usage(&ctx)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &UsageResponse{Body: usageToResponse(usage)}, nil
+}
+
+type UsageResponse struct {
+	Body UsageResponseBody
+}
+
+type UsageResponseBody struct {
+	TenantId          string             `json:"tenant_id" description:"The tenant of the caller"`
+	Limits            LimitsResponseBody `json:"limits" description:"The limits of the tenant, zero meaning no limit"`
+	Day               string             `json:"day" description:"The day the rows are counted in, in UTC"`
+	RowsIngested      int64              `json:"rows_ingested" description:"The leads ingested from files today"`
+	ResetsAt          string             `json:"resets_at" description:"When the rows ingested are counted from zero again"`
+	RunningImports    int64              `json:"running_imports" description:"The imports of the tenant processing right now"`
+	RequestsAvailable *float64           `json:"requests_available,omitempty" description:"The requests left in the bucket of the caller, when requests are limited"`
+}
+
+type LimitsResponseBody struct {
+	RequestsPerSecond    float64 `json:"requests_per_second" description:"The requests refilled every second"`
+	Burst                int     `json:"burst" description:"The requests that can be sent at once"`
+	MaxRowsPerDay        int64   `json:"max_rows_per_day" description:"The leads that can be ingested from files a day"`
+	MaxFileSize          int64   `json:"max_file_size" description:"The size of the largest file that can be uploaded, in bytes"`
+	MaxConcurrentImports int     `json:"max_concurrent_imports" description:"The imports that can be processing at a time"`
+}
+
+func usageToResponse(usage *domain.TenantUsage) UsageResponseBody {
+	return UsageResponseBody{
+		TenantId: usage.Tenant,
+		Limits: LimitsResponseBody{
+			RequestsPerSecond:    usage.Limits.RequestsPerSecond,
+			Burst:                usage.Limits.Burst,
+			MaxRowsPerDay:        usage.Limits.MaxRowsPerDay,
+			MaxFileSize:          usage.Limits.MaxFileSize,
+			MaxConcurrentImports: usage.Limits.MaxConcurrentImports,
+		},
+		Day:               usage.Day,
+		RowsIngested:      usage.Rows,
+		ResetsAt:          usage.ResetsAt.Format(time.DateTime),
+		RunningImports:    usage.RunningImports,
+		RequestsAvailable: usage.RequestsAvailable,
+	}
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
+)
+
+func InitWebhookRoutes(humaApi huma.API, webhookHandler *WebhookHandler) {
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/webhooks",
+		OperationID:   "create-webhook",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusCreated,
+		Summary:       "Create a webhook",
+		Description:   "Subscribe a URL to events of the given schema, the secret used to sign payloads is only returned here",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.Create)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/schema/{schemaId}/webhooks",
+		OperationID:   "list-webhooks",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List webhooks of a schema",
+		Description:   "List the webhooks subscribed to events of the given schema",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.ListBySchema)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/webhooks/{webhookId}",
+		OperationID:   "get-webhook",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Get a webhook",
+		Description:   "Get the settings of the given webhook",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.Get)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/webhooks/{webhookId}",
+		OperationID:   "update-webhook",
+		Method:        http.MethodPut,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Update a webhook",
+		Description:   "Replace the settings of the given webhook",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.Update)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/webhooks/{webhookId}",
+		OperationID:   "delete-webhook",
+		Method:        http.MethodDelete,
+		DefaultStatus: http.StatusNoContent,
+		Summary:       "Delete a webhook",
+		Description:   "Unsubscribe the given webhook, its pending deliveries are abandoned",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.Delete)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/webhooks/{webhookId}/deliveries",
+		OperationID:   "list-webhook-deliveries",
+		Method:        http.MethodGet,
+		DefaultStatus: http.StatusOK,
+		Summary:       "List deliveries of a webhook",
+		Description:   "List the newest deliveries of the given webhook with their attempts",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.ListDeliveries)
+
+	huma.Register(humaApi, huma.Operation{
+		Path:          "/webhook-deliveries/{deliveryId}/retry",
+		OperationID:   "retry-webhook-delivery",
+		Method:        http.MethodPost,
+		DefaultStatus: http.StatusOK,
+		Summary:       "Retry a dead delivery",
+		Description:   "Queue a delivery that ran out of attempts for a new round of attempts",
+		Security:      requireScopes(domain.ScopeSchemaWrite),
+	}, webhookHandler.Retry)
+}
+
+type WebhookHandler struct {
+	service *services.WebhookService
+}
+
+func NewWebhookHandler(service *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		service: service,
+	}
+}
+
+func (wh *WebhookHandler) Create(ctx context.Context, wr *WebhookCreateRequest) (*WebhookResponse, error) {
+	webhook, err := wh.service.Create(&ctx, wr.SchemaId, wr.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &WebhookResponse{Body: webhookToResponse(webhook)}
+	response.Body.Secret = webhook.Secret
+	return response, nil
+}
+
+func (wh *WebhookHandler) ListBySchema(ctx context.Context, wr *WebhookListRequest) (*WebhookListResponse, error) {
+	webhooks, err := wh.service.FindBySchemaId(&ctx, wr.SchemaId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &WebhookListResponse{}
+	response.Body.Webhooks = make([]WebhookResponseBody, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response.Body.Webhooks = append(response.Body.Webhooks, webhookToResponse(webhook))
+	}
+	return response, nil
+}
+
+func (wh *WebhookHandler) Get(ctx context.Context, wr *WebhookRequest) (*WebhookResponse, error) {
+	webhook, err := wh.service.FindById(&ctx, wr.WebhookId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &WebhookResponse{Body: webhookToResponse(webhook)}, nil
+}
+
+func (wh *WebhookHandler) Update(ctx context.Context, wr *WebhookUpdateRequest) (*WebhookResponse, error) {
+	webhook, err := wh.service.Update(&ctx, wr.WebhookId, wr.Body.toDomain())
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &WebhookResponse{Body: webhookToResponse(webhook)}, nil
+}
+
+func (wh *WebhookHandler) Delete(ctx context.Context, wr *WebhookRequest) (*struct{}, error) {
+	err := wh.service.Delete(&ctx, wr.WebhookId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return nil, nil
+}
+
+func (wh *WebhookHandler) ListDeliveries(ctx context.Context, wr *WebhookDeliveryListRequest) (*WebhookDeliveryListResponse, error) {
+	deliveries, err := wh.service.FindDeliveries(&ctx, wr.WebhookId, wr.Status, wr.Limit)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	response := &WebhookDeliveryListResponse{}
+	response.Body.Deliveries = make([]WebhookDeliveryResponseBody, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response.Body.Deliveries = append(response.Body.Deliveries, webhookDeliveryToResponse(delivery))
+	}
+	return response, nil
+}
+
+func (wh *WebhookHandler) Retry(ctx context.Context, wr *WebhookDeliveryRequest) (*WebhookDeliveryResponse, error) {
+	delivery, err := wh.service.Retry(&ctx, wr.DeliveryId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &WebhookDeliveryResponse{Body: webhookDeliveryToResponse(delivery)}, nil
+}
+
+type WebhookRequestBody struct {
+	URL     string   `json:"url" required:"true" format:"uri" description:"The URL the events are posted to"`
+	Secret  string   `json:"secret,omitempty" required:"false" description:"The secret payloads are signed with, generated on create and kept on update when omitted"`
+	Events  []string `json:"events" required:"true" minItems:"1" enum:"lead.created,import.completed,import.failed" description:"The events the webhook is subscribed to"`
+	Enabled bool     `json:"enabled" required:"true" description:"Whether events are delivered to the webhook"`
+}
+
+func (wb *WebhookRequestBody) toDomain() *domain.Webhook {
+	return &domain.Webhook{
+		URL:     wb.URL,
+		Secret:  wb.Secret,
+		Events:  wb.Events,
+		Enabled: wb.Enabled,
+	}
+}
+
+type WebhookCreateRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+	Body     WebhookRequestBody
+}
+
+type WebhookUpdateRequest struct {
+	WebhookId string `path:"webhookId" required:"true"`
+	Body      WebhookRequestBody
+}
+
+type WebhookRequest struct {
+	WebhookId string `path:"webhookId" required:"true"`
+}
+
+type WebhookListRequest struct {
+	SchemaId string `path:"schemaId" required:"true"`
+}
+
+type WebhookDeliveryListRequest struct {
+	WebhookId string `path:"webhookId" required:"true"`
+	Status    string `query:"status" required:"false" enum:"pending,delivered,dead" description:"Only list deliveries with this status"`
+	Limit     int64  `query:"limit" required:"false" minimum:"1" maximum:"500" default:"50" description:"How many deliveries to list"`
+}
+
+type WebhookDeliveryRequest struct {
+	DeliveryId string `path:"deliveryId" required:"true"`
+}
+
+type WebhookResponse struct {
+	Body WebhookResponseBody
+}
+
+type WebhookListResponse struct {
+	Body struct {
+		Webhooks []WebhookResponseBody `json:"webhooks" description:"The webhooks of the schema"`
+	}
+}
+
+type WebhookResponseBody struct {
+	ID        string   `json:"id" description:"The ID of the webhook"`
+	SchemaId  string   `json:"schema_id" description:"The ID of the schema whose events are delivered"`
+	URL       string   `json:"url" description:"The URL the events are posted to"`
+	Secret    string   `json:"secret,omitempty" description:"The secret payloads are signed with, only returned on create"`
+	Events    []string `json:"events" description:"The events the webhook is subscribed to"`
+	Enabled   bool     `json:"enabled" description:"Whether events are delivered to the webhook"`
+	CreatedAt string   `json:"created_at" description:"When the webhook was created"`
+	UpdatedAt string   `json:"updated_at" description:"When the webhook was last updated"`
+}
+
+func webhookToResponse(webhook *domain.Webhook) WebhookResponseBody {
+	return WebhookResponseBody{
+		ID:        webhook.ID.Hex(),
+		SchemaId:  webhook.SchemaId.Hex(),
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		Enabled:   webhook.Enabled,
+		CreatedAt: webhook.CreatedAt.Time().Format(time.DateTime),
+		UpdatedAt: webhook.UpdatedAt.Time().Format(time.DateTime),
+	}
+}
+
+type WebhookDeliveryResponse struct {
+	Body WebhookDeliveryResponseBody
+}
+
+type WebhookDeliveryListResponse struct {
+	Body struct {
+		Deliveries []WebhookDeliveryResponseBody `json:"deliveries" description:"The deliveries of the webhook, newest first"`
+	}
+}
+
+type WebhookDeliveryResponseBody struct {
+	ID            string                       `json:"id" description:"The ID of the delivery, also sent in the X-Webhook-Delivery header"`
+	WebhookId     string                       `json:"webhook_id" description:"The ID of the webhook"`
+	EventId       string                       `json:"event_id" description:"The ID of the event delivered"`
+	Event         string                       `json:"event" description:"The type of the event delivered"`
+	Status        string                       `json:"status" description:"The status of the delivery: pending, delivered or dead"`
+	Attempts      []WebhookAttemptResponseBody `json:"attempts" description:"Every attempt to deliver the event"`
+	NextAttemptAt string                       `json:"next_attempt_at,omitempty" description:"When the next attempt is made, while pending"`
+	CreatedAt     string                       `json:"created_at" description:"When the event was queued"`
+	DeliveredAt   string                       `json:"delivered_at,omitempty" description:"When the event was delivered"`
+}
+
+type WebhookAttemptResponseBody struct {
+	At         string `json:"at" description:"When the attempt was made"`
+	StatusCode int    `json:"status_code,omitempty" description:"The status code answered by the webhook"`
+	Error      string `json:"error,omitempty" description:"Why the attempt failed"`
+	DurationMs int64  `json:"duration_ms" description:"How long the webhook took to answer, in milliseconds"`
+}
+
+func webhookDeliveryToResponse(delivery *domain.WebhookDelivery) WebhookDeliveryResponseBody {
+	body := WebhookDeliveryResponseBody{
+		ID:        delivery.ID.Hex(),
+		WebhookId: delivery.WebhookId.Hex(),
+		EventId:   delivery.EventId.Hex(),
+		Event:     delivery.Event,
+		Status:    delivery.Status,
+		Attempts:  make([]WebhookAttemptResponseBody, 0, len(delivery.Attempts)),
+		CreatedAt: delivery.CreatedAt.Time().Format(time.DateTime),
+	}
+
+	for _, attempt := range delivery.Attempts {
+		body.Attempts = append(body.Attempts, WebhookAttemptResponseBody{
+			At:         attempt.At.Time().Format(time.DateTime),
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			DurationMs: attempt.Duration.Milliseconds(),
+		})
+	}
+
+	if delivery.Status == domain.WebhookDeliveryStatusPending {
+		body.NextAttemptAt = delivery.NextAttemptAt.Time().Format(time.DateTime)
+	}
+
+	if delivery.DeliveredAt != 0 {
+		body.DeliveredAt = delivery.DeliveredAt.Time().Format(time.DateTime)
+	}
+
+	return body
+}
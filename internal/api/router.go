@@ -2,10 +2,51 @@ package api
 
 import (
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/labstack/echo/v4"
 	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/services"
 )
 
-func InitRoutes(humaApi huma.API, sh *handlers.SchemaHandler, fh *handlers.FileHandler) {
+// InitRequestId must be called before the routes are registered, as huma
+// binds the middlewares of an operation when it is registered.
+func InitRequestId(humaApi huma.API) {
+	handlers.InitRequestId(humaApi)
+}
+
+// InitAuth must be called before the routes are registered, as huma binds
+// the middlewares of an operation when it is registered. A nil service leaves
+// the routes open to the default tenant.
+func InitAuth(humaApi huma.API, as *services.AuthService) {
+	handlers.InitAuth(humaApi, as)
+}
+
+// InitRateLimit must be called after InitAuth, to limit the requests of the
+// callers it identified, and before the routes are registered. A nil service
+// leaves the requests unlimited.
+func InitRateLimit(humaApi huma.API, qs *services.QuotaService) {
+	handlers.InitRateLimit(humaApi, qs)
+}
+
+func InitRoutes(humaApi huma.API, akh *handlers.APIKeyHandler, ush *handlers.UsageHandler, sh *handlers.SchemaHandler, fh *handlers.FileHandler, ih *handlers.ImportHandler, uh *handlers.UploadHandler, ish *handlers.ImportSourceHandler, whh *handlers.WebhookHandler, lh *handlers.LeadHandler, eh *handlers.ExportHandler, dsh *handlers.DataSubjectHandler, sph *handlers.SuppressionHandler, auh *handlers.AuditHandler) {
+	handlers.InitAPIKeyRoutes(humaApi, akh)
+	handlers.InitUsageRoutes(humaApi, ush)
 	handlers.InitSchemaRoutes(humaApi, sh)
 	handlers.InitFileRoutes(humaApi, fh)
+	handlers.InitImportRoutes(humaApi, ih)
+	handlers.InitUploadRoutes(humaApi, uh)
+	handlers.InitImportSourceRoutes(humaApi, ish)
+	handlers.InitWebhookRoutes(humaApi, whh)
+	handlers.InitLeadRoutes(humaApi, lh)
+	handlers.InitExportRoutes(humaApi, eh)
+	handlers.InitDataSubjectRoutes(humaApi, dsh)
+	handlers.InitSuppressionRoutes(humaApi, sph)
+	handlers.InitAuditRoutes(humaApi, auh)
+}
+
+// InitWebSocketRoutes registers the routes that upgrade the connection, which
+// huma can not describe. A nil auth service leaves them open to the default
+// tenant and a nil quota service leaves them unlimited.
+func InitWebSocketRoutes(e *echo.Echo, lh *handlers.LeadHandler, as *services.AuthService, qs *services.QuotaService) {
+	handlers.InitLeadWebSocketRoutes(e, lh, handlers.NewEchoAuthMiddleware(as, domain.ScopeLeadsRead), handlers.NewEchoRateLimitMiddleware(qs))
 }
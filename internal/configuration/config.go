@@ -3,9 +3,13 @@ package configuration
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"time"
 
+	"github.com/vitortenor/lead-stream-service/internal/domain"
 	"gopkg.in/yaml.v2"
 )
 
@@ -17,12 +21,224 @@ type Config struct {
 		} `yaml:"api"`
 		Host string `yaml:"host"`
 		Port int    `yaml:"port"`
+		// AllowedOrigins are the origins of the pages, besides the service
+		// itself, that can open WebSocket connections
+		AllowedOrigins []string `yaml:"allowed_origins"`
 	} `yaml:"server"`
 	Database struct {
 		URI        string            `yaml:"uri"`
 		Name       string            `yaml:"name"`
 		Collection map[string]string `yaml:"collection"`
 	} `yaml:"database"`
+	Ingestion struct {
+		BatchSize   int `yaml:"batch_size"`
+		Transaction struct {
+			Enabled bool  `yaml:"enabled"`
+			MaxSize int64 `yaml:"max_size"`
+		} `yaml:"transaction"`
+		Idempotency struct {
+			Retention Duration `yaml:"retention"`
+		} `yaml:"idempotency"`
+		Compression struct {
+			MaxUncompressedSize int64 `yaml:"max_uncompressed_size"`
+			MaxArchiveEntries   int   `yaml:"max_archive_entries"`
+		} `yaml:"compression"`
+		Progress struct {
+			Interval Duration `yaml:"interval"`
+		} `yaml:"progress"`
+	} `yaml:"ingestion"`
+	Uploads struct {
+		Dir             string   `yaml:"dir"`
+		MaxChunkSize    int64    `yaml:"max_chunk_size"`
+		Timeout         Duration `yaml:"timeout"`
+		CleanupInterval Duration `yaml:"cleanup_interval"`
+	} `yaml:"uploads"`
+	Tenancy struct {
+		Mode           string `yaml:"mode"`
+		DatabasePrefix string `yaml:"database_prefix"`
+	} `yaml:"tenancy"`
+	Limits struct {
+		RateBy           string                    `yaml:"rate_by"`
+		StaleImportAfter Duration                  `yaml:"stale_import_after"`
+		Default          Limits                    `yaml:"default"`
+		Tenants          map[string]LimitOverrides `yaml:"tenants"`
+	} `yaml:"limits"`
+	Encryption struct {
+		KeyManager string `yaml:"key_manager"`
+		KeyFile    string `yaml:"key_file"`
+	} `yaml:"encryption"`
+	Auth struct {
+		Enabled      bool   `yaml:"enabled"`
+		BootstrapKey string `yaml:"bootstrap_key"`
+		JWT          struct {
+			JWKSURL         string              `yaml:"jwks_url"`
+			PublicKey       string              `yaml:"public_key"`
+			Issuer          string              `yaml:"issuer"`
+			Audience        string              `yaml:"audience"`
+			RefreshInterval Duration            `yaml:"refresh_interval"`
+			RolesClaim      string              `yaml:"roles_claim"`
+			GroupsClaim     string              `yaml:"groups_claim"`
+			TenantClaim     string              `yaml:"tenant_claim"`
+			Roles           map[string][]string `yaml:"roles"`
+			Groups          map[string][]string `yaml:"groups"`
+		} `yaml:"jwt"`
+	} `yaml:"auth"`
+	Exports struct {
+		Dir             string   `yaml:"dir"`
+		PollInterval    Duration `yaml:"poll_interval"`
+		Lease           Duration `yaml:"lease"`
+		Retention       Duration `yaml:"retention"`
+		CleanupInterval Duration `yaml:"cleanup_interval"`
+	} `yaml:"exports"`
+	Retention struct {
+		PurgeInterval Duration `yaml:"purge_interval"`
+	} `yaml:"retention"`
+	Audit struct {
+		HashChain bool `yaml:"hash_chain"`
+	} `yaml:"audit"`
+	ObjectStorage struct {
+		Endpoint        string   `yaml:"endpoint"`
+		AccessKeyId     string   `yaml:"access_key_id"`
+		SecretAccessKey string   `yaml:"secret_access_key"`
+		Region          string   `yaml:"region"`
+		UseSSL          bool     `yaml:"use_ssl"`
+		Dir             string   `yaml:"dir"`
+		PollInterval    Duration `yaml:"poll_interval"`
+		Lease           Duration `yaml:"lease"`
+		Watches         []struct {
+			TenantId string `yaml:"tenant_id"`
+			SchemaId string `yaml:"schema_id"`
+			Bucket   string `yaml:"bucket"`
+			Prefix   string `yaml:"prefix"`
+		} `yaml:"watches"`
+	} `yaml:"object_storage"`
+	DropFolders struct {
+		PollInterval Duration `yaml:"poll_interval"`
+		StableFor    Duration `yaml:"stable_for"`
+		Folders      []struct {
+			TenantId string `yaml:"tenant_id"`
+			SchemaId string `yaml:"schema_id"`
+			Path     string `yaml:"path"`
+			Marker   bool   `yaml:"marker"`
+		} `yaml:"folders"`
+	} `yaml:"drop_folders"`
+	ImportSources struct {
+		Dir          string   `yaml:"dir"`
+		Timeout      Duration `yaml:"timeout"`
+		MaxSize      int64    `yaml:"max_size"`
+		PollInterval Duration `yaml:"poll_interval"`
+		// AllowPrivateNetworks lets sources fetch files from loopback,
+		// link-local and private addresses.
+		AllowPrivateNetworks bool `yaml:"allow_private_networks"`
+	} `yaml:"import_sources"`
+	Webhooks struct {
+		Timeout      Duration `yaml:"timeout"`
+		MaxAttempts  int      `yaml:"max_attempts"`
+		Backoff      Duration `yaml:"backoff"`
+		MaxBackoff   Duration `yaml:"max_backoff"`
+		PollInterval Duration `yaml:"poll_interval"`
+		Workers      int      `yaml:"workers"`
+		// AllowPrivateNetworks lets webhooks deliver to loopback, link-local
+		// and private addresses.
+		AllowPrivateNetworks bool `yaml:"allow_private_networks"`
+	} `yaml:"webhooks"`
+	Events struct {
+		Broker string            `yaml:"broker"`
+		Topic  string            `yaml:"topic"`
+		Topics map[string]string `yaml:"topics"`
+		Kafka  struct {
+			Brokers []string `yaml:"brokers"`
+		} `yaml:"kafka"`
+		Nats struct {
+			URL string `yaml:"url"`
+		} `yaml:"nats"`
+		Outbox struct {
+			PollInterval Duration `yaml:"poll_interval"`
+			Lease        Duration `yaml:"lease"`
+			Backoff      Duration `yaml:"backoff"`
+			MaxBackoff   Duration `yaml:"max_backoff"`
+			MaxAttempts  int      `yaml:"max_attempts"`
+			Retention    Duration `yaml:"retention"`
+		} `yaml:"outbox"`
+	} `yaml:"events"`
+	Consumers struct {
+		Group         string   `yaml:"group"`
+		Backoff       Duration `yaml:"backoff"`
+		MaxBackoff    Duration `yaml:"max_backoff"`
+		Subscriptions []struct {
+			TenantId        string `yaml:"tenant_id"`
+			SchemaId        string `yaml:"schema_id"`
+			Topic           string `yaml:"topic"`
+			DeadLetterTopic string `yaml:"dead_letter_topic"`
+		} `yaml:"subscriptions"`
+	} `yaml:"consumers"`
+}
+
+// Limits caps the requests and the ingestion of a tenant. Zero means no limit.
+type Limits struct {
+	RequestsPerSecond    float64 `yaml:"requests_per_second"`
+	Burst                int     `yaml:"burst"`
+	MaxRowsPerDay        int64   `yaml:"max_rows_per_day"`
+	MaxFileSize          int64   `yaml:"max_file_size"`
+	MaxConcurrentImports int     `yaml:"max_concurrent_imports"`
+}
+
+// LimitOverrides replaces the default limits it sets for a tenant, so a
+// tenant can also be given no limit where the default has one.
+type LimitOverrides struct {
+	RequestsPerSecond    *float64 `yaml:"requests_per_second"`
+	Burst                *int     `yaml:"burst"`
+	MaxRowsPerDay        *int64   `yaml:"max_rows_per_day"`
+	MaxFileSize          *int64   `yaml:"max_file_size"`
+	MaxConcurrentImports *int     `yaml:"max_concurrent_imports"`
+}
+
+// LimitsOf returns the default limits with the overrides of the tenant.
+func (c *Config) LimitsOf(tenant string) Limits {
+	limits := c.Limits.Default
+	overrides, ok := c.Limits.Tenants[tenant]
+	if !ok {
+		return limits
+	}
+
+	if overrides.RequestsPerSecond != nil {
+		limits.RequestsPerSecond = *overrides.RequestsPerSecond
+	}
+	if overrides.Burst != nil {
+		limits.Burst = *overrides.Burst
+	}
+	if overrides.MaxRowsPerDay != nil {
+		limits.MaxRowsPerDay = *overrides.MaxRowsPerDay
+	}
+	if overrides.MaxFileSize != nil {
+		limits.MaxFileSize = *overrides.MaxFileSize
+	}
+	if overrides.MaxConcurrentImports != nil {
+		limits.MaxConcurrentImports = *overrides.MaxConcurrentImports
+	}
+	return limits
+}
+
+// Duration reads values such as "90s" or "24h" from the configuration file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
 }
 
 func InitConfig(_ context.Context, path string) (*Config, error) {
@@ -57,6 +273,11 @@ func validateConfig(config *Config) error {
 	if config.Server.Port == 0 {
 		return errors.New("server port is required")
 	}
+	for _, origin := range config.Server.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("server allowed origin %q must be a scheme and a host", origin)
+		}
+	}
 	if config.Database.URI == "" {
 		return errors.New("database URI is required")
 	}
@@ -66,5 +287,217 @@ func validateConfig(config *Config) error {
 	if len(config.Database.Collection) == 0 {
 		return errors.New("at least one database collection is required")
 	}
+	if config.Ingestion.BatchSize < 0 {
+		return errors.New("ingestion batch size must not be negative")
+	}
+	if config.Ingestion.Idempotency.Retention < 0 {
+		return errors.New("ingestion idempotency retention must not be negative")
+	}
+	if config.Ingestion.Progress.Interval <= 0 {
+		return errors.New("ingestion progress interval must be positive")
+	}
+	if config.Uploads.Dir == "" {
+		return errors.New("uploads directory is required")
+	}
+	if config.Uploads.MaxChunkSize <= 0 {
+		return errors.New("uploads max chunk size must be positive")
+	}
+	if config.Uploads.Timeout <= 0 || config.Uploads.CleanupInterval <= 0 {
+		return errors.New("uploads timeout and cleanup interval must be positive")
+	}
+	if config.Tenancy.Mode != "" && config.Tenancy.Mode != "shared" && config.Tenancy.Mode != "database" {
+		return errors.New("tenancy mode must be shared or database")
+	}
+	if config.Tenancy.Mode == "database" && config.Tenancy.DatabasePrefix == "" {
+		return errors.New("tenancy database prefix is required in database mode")
+	}
+	if err := validateLimits(config); err != nil {
+		return err
+	}
+	switch config.Encryption.KeyManager {
+	case "":
+	case "local":
+		if config.Encryption.KeyFile == "" {
+			return errors.New("encryption key file is required by the local key manager")
+		}
+	default:
+		return errors.New("encryption key manager must be local")
+	}
+	if config.Auth.Enabled {
+		if err := validateAuth(config); err != nil {
+			return err
+		}
+	}
+	if config.Exports.Dir == "" {
+		return errors.New("exports directory is required")
+	}
+	if config.Exports.PollInterval <= 0 || config.Exports.Lease <= 0 || config.Exports.Retention <= 0 || config.Exports.CleanupInterval <= 0 {
+		return errors.New("exports poll interval, lease, retention and cleanup interval must be positive")
+	}
+	if config.Retention.PurgeInterval <= 0 {
+		return errors.New("retention purge interval must be positive")
+	}
+	if len(config.ObjectStorage.Watches) > 0 {
+		if config.ObjectStorage.Endpoint == "" || config.ObjectStorage.Dir == "" {
+			return errors.New("object storage endpoint and directory are required to watch buckets")
+		}
+		if config.ObjectStorage.PollInterval <= 0 || config.ObjectStorage.Lease <= 0 {
+			return errors.New("object storage poll interval and lease must be positive")
+		}
+		for _, watch := range config.ObjectStorage.Watches {
+			if watch.SchemaId == "" || watch.Bucket == "" {
+				return errors.New("object storage watches require a schema id and a bucket")
+			}
+			if err := validateTenant(watch.TenantId); err != nil {
+				return err
+			}
+		}
+	}
+	if len(config.DropFolders.Folders) > 0 {
+		if config.DropFolders.PollInterval <= 0 || config.DropFolders.StableFor < 0 {
+			return errors.New("drop folders poll interval must be positive and stable for must not be negative")
+		}
+		for _, folder := range config.DropFolders.Folders {
+			if folder.SchemaId == "" || folder.Path == "" {
+				return errors.New("drop folders require a schema id and a path")
+			}
+			if err := validateTenant(folder.TenantId); err != nil {
+				return err
+			}
+		}
+	}
+	if config.ImportSources.Dir == "" {
+		return errors.New("import sources directory is required")
+	}
+	if config.ImportSources.Timeout <= 0 || config.ImportSources.PollInterval <= 0 {
+		return errors.New("import sources timeout and poll interval must be positive")
+	}
+	if config.ImportSources.MaxSize < 0 {
+		return errors.New("import sources max size must not be negative")
+	}
+	if config.Webhooks.Timeout <= 0 || config.Webhooks.PollInterval <= 0 {
+		return errors.New("webhooks timeout and poll interval must be positive")
+	}
+	if config.Webhooks.MaxAttempts <= 0 || config.Webhooks.Workers <= 0 {
+		return errors.New("webhooks max attempts and workers must be positive")
+	}
+	if config.Webhooks.Backoff <= 0 || config.Webhooks.MaxBackoff < config.Webhooks.Backoff {
+		return errors.New("webhooks backoff must be positive and not above max backoff")
+	}
+	if config.Events.Broker != "" {
+		if err := validateEvents(config); err != nil {
+			return err
+		}
+	}
+	if len(config.Consumers.Subscriptions) > 0 {
+		if err := validateConsumers(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAuth(config *Config) error {
+	jwt := config.Auth.JWT
+	if jwt.JWKSURL != "" && jwt.PublicKey != "" {
+		return errors.New("auth jwt takes either a JWKS URL or a public key")
+	}
+	if jwt.JWKSURL != "" && jwt.RefreshInterval <= 0 {
+		return errors.New("auth jwt refresh interval must be positive")
+	}
+	if config.Auth.BootstrapKey == "" && jwt.JWKSURL == "" && jwt.PublicKey == "" {
+		return errors.New("auth requires a bootstrap key or jwt settings")
+	}
+	if config.Auth.BootstrapKey != "" && len(config.Auth.BootstrapKey) < 32 {
+		return errors.New("auth bootstrap key must be at least 32 characters long")
+	}
+	return nil
+}
+
+func validateEvents(config *Config) error {
+	events := config.Events
+	switch events.Broker {
+	case "kafka":
+		if len(events.Kafka.Brokers) == 0 {
+			return errors.New("events kafka brokers are required")
+		}
+	case "nats":
+		if events.Nats.URL == "" {
+			return errors.New("events nats url is required")
+		}
+	case "memory":
+	default:
+		return errors.New("events broker must be kafka, nats or memory")
+	}
+	if events.Topic == "" {
+		return errors.New("events topic is required")
+	}
+	if events.Outbox.PollInterval <= 0 || events.Outbox.Lease <= 0 {
+		return errors.New("events outbox poll interval and lease must be positive")
+	}
+	if events.Outbox.Backoff <= 0 || events.Outbox.MaxBackoff < events.Outbox.Backoff {
+		return errors.New("events outbox backoff must be positive and not above max backoff")
+	}
+	if events.Outbox.MaxAttempts <= 0 {
+		return errors.New("events outbox max attempts must be positive")
+	}
+	if events.Outbox.Retention < 0 {
+		return errors.New("events outbox retention must not be negative")
+	}
+	return nil
+}
+
+func validateLimits(config *Config) error {
+	if config.Limits.RateBy != "" && config.Limits.RateBy != "caller" && config.Limits.RateBy != "tenant" {
+		return errors.New("limits rate by must be caller or tenant")
+	}
+	if config.Limits.StaleImportAfter <= 0 {
+		return errors.New("limits stale import after must be positive")
+	}
+
+	tenants := []string{""}
+	for tenant := range config.Limits.Tenants {
+		if err := validateTenant(tenant); err != nil || tenant == "" {
+			return fmt.Errorf("invalid tenant id %q", tenant)
+		}
+		tenants = append(tenants, tenant)
+	}
+	for _, tenant := range tenants {
+		limits := config.LimitsOf(tenant)
+		if limits.RequestsPerSecond < 0 || limits.Burst < 0 || limits.MaxRowsPerDay < 0 || limits.MaxFileSize < 0 || limits.MaxConcurrentImports < 0 {
+			return errors.New("limits must not be negative")
+		}
+	}
+	return nil
+}
+
+// validateTenant checks the tenant of the background ingestion, which may be
+// left empty for the default tenant.
+func validateTenant(tenant string) error {
+	if tenant != "" && domain.ValidateTenant(tenant) != nil {
+		return fmt.Errorf("invalid tenant id %q", tenant)
+	}
+	return nil
+}
+
+func validateConsumers(config *Config) error {
+	consumers := config.Consumers
+	if config.Events.Broker == "" {
+		return errors.New("events broker is required to consume leads")
+	}
+	if consumers.Group == "" {
+		return errors.New("consumers group is required")
+	}
+	if consumers.Backoff <= 0 || consumers.MaxBackoff < consumers.Backoff {
+		return errors.New("consumers backoff must be positive and not above max backoff")
+	}
+	for _, subscription := range consumers.Subscriptions {
+		if subscription.SchemaId == "" || subscription.Topic == "" {
+			return errors.New("consumers subscriptions require a schema id and a topic")
+		}
+		if err := validateTenant(subscription.TenantId); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ScopeSchemaWrite = "schema:write"
+	ScopeLeadsUpload = "leads:upload"
+	ScopeLeadsRead   = "leads:read"
+	// ScopePIIRead grants the decrypted values of the sensitive fields.
+	ScopePIIRead = "pii:read"
+	// ScopeAdmin grants every other scope and the management of API keys.
+	ScopeAdmin = "admin"
+)
+
+var Scopes = []string{ScopeSchemaWrite, ScopeLeadsUpload, ScopeLeadsRead, ScopePIIRead, ScopeAdmin}
+
+// APIKey grants its scopes to the requests that send it. Only the SHA-256
+// hash of the key is stored, and Prefix keeps its first characters so it can
+// be told apart from the others.
+type APIKey struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	TenantId  string             `bson:"tenant_id"`
+	Name      string             `bson:"name"`
+	Prefix    string             `bson:"prefix"`
+	Hash      string             `bson:"hash"`
+	Scopes    []string           `bson:"scopes"`
+	ExpiresAt primitive.DateTime `bson:"expires_at,omitempty"`
+	RevokedAt primitive.DateTime `bson:"revoked_at,omitempty"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+
+	// Key is the key itself, only known when the key is created.
+	Key string `bson:"-"`
+}
+
+func (k *APIKey) Validate(now time.Time) error {
+	if k.Name == "" || len(k.Scopes) == 0 {
+		return ErrInvalidAPIKeySettings
+	}
+
+	for _, scope := range k.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return ErrInvalidAPIKeySettings
+		}
+	}
+
+	if k.ExpiresAt != 0 && !k.ExpiresAt.Time().After(now) {
+		return ErrInvalidAPIKeySettings
+	}
+
+	return nil
+}
+
+// IsActive reports whether the key was neither revoked nor expired at now.
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != 0 {
+		return false
+	}
+	return k.ExpiresAt == 0 || k.ExpiresAt.Time().After(now)
+}
+
+// HasScopes reports whether the key grants every one of the scopes.
+func (k *APIKey) HasScopes(scopes []string) bool {
+	return grantsScopes(k.Scopes, scopes)
+}
+
+// Principal returns the key as the caller of a request.
+func (k *APIKey) Principal() *Principal {
+	tenant := k.TenantId
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return &Principal{
+		Subject: "api-key:" + k.ID.Hex(),
+		Name:    k.Name,
+		Method:  AuthMethodAPIKey,
+		Scopes:  k.Scopes,
+		Tenant:  tenant,
+	}
+}
+
+func (k *APIKey) Revoke() {
+	k.RevokedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+// grantsScopes reports whether the granted scopes include every required one,
+// which admin always does.
+func grantsScopes(granted, required []string) bool {
+	if slices.Contains(granted, ScopeAdmin) {
+		return true
+	}
+
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditActionSchemaCreated          = "schema.created"
+	AuditActionSchemaRetentionSet     = "schema.retention_set"
+	AuditActionSchemaRetentionDeleted = "schema.retention_deleted"
+	AuditActionLeadsImported          = "leads.imported"
+	AuditActionLeadsPurged            = "leads.purged"
+	AuditActionImportRolledBack       = "import.rolled_back"
+	AuditActionImportInterrupted      = "import.interrupted"
+	AuditActionLegalHoldPlaced        = "lead.legal_hold_placed"
+	AuditActionLegalHoldReleased      = "lead.legal_hold_released"
+	AuditActionDataSubjectErased      = "data_subject.erased"
+)
+
+const (
+	AuditEntitySchema  = "schema"
+	AuditEntityImport  = "import"
+	AuditEntityLead    = "lead"
+	AuditEntityErasure = "erasure"
+)
+
+// AuditActorSystem is the actor of the changes made by the background workers
+// and by requests that were not authenticated.
+const AuditActorSystem = "system"
+
+// AuditEntry records a change to a schema or to leads: who made it, in which
+// request, and the values of the fields it changed. Entries are only ever
+// appended. Chained entries are numbered by Seq within their tenant and hold
+// the hash of the previous entry, so changing or removing one breaks the hash
+// of those after it.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	TenantId   string             `bson:"tenant_id"`
+	Seq        int64              `bson:"seq,omitempty"`
+	Actor      string             `bson:"actor"`
+	Action     string             `bson:"action"`
+	EntityType string             `bson:"entity_type"`
+	EntityId   string             `bson:"entity_id"`
+	Changes    []AuditChange      `bson:"changes,omitempty"`
+	RequestId  string             `bson:"request_id,omitempty"`
+	CreatedAt  primitive.DateTime `bson:"created_at"`
+	PrevHash   string             `bson:"prev_hash,omitempty"`
+	Hash       string             `bson:"hash,omitempty"`
+}
+
+// AuditChange is a field changed by an audited action, with its values before
+// and after it as JSON, or empty when the field had no value.
+type AuditChange struct {
+	Field  string `bson:"field" json:"field"`
+	Before string `bson:"before,omitempty" json:"before,omitempty"`
+	After  string `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// NewAuditEntry records the action on the entity with the fields whose value
+// differs between before and after, either of which may be nil.
+func NewAuditEntry(actor, action, entityType, entityId string, before, after map[string]interface{}) *AuditEntry {
+	if actor == "" {
+		actor = AuditActorSystem
+	}
+
+	return &AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Changes:    DiffAudit(before, after),
+		CreatedAt:  primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+// DiffAudit returns the fields whose value differs between before and after,
+// sorted by name.
+func DiffAudit(before, after map[string]interface{}) []AuditChange {
+	var changes []AuditChange
+	for field, value := range after {
+		if previous, ok := before[field]; !ok || !reflect.DeepEqual(previous, value) {
+			changes = append(changes, AuditChange{Field: field, Before: auditValue(before[field]), After: auditValue(value)})
+		}
+	}
+	for field, value := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, AuditChange{Field: field, Before: auditValue(value)})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b AuditChange) int { return strings.Compare(a.Field, b.Field) })
+	return changes
+}
+
+// auditValue keeps the value as JSON, so it is hashed the same way when the
+// entry is read back. Nil values, typed or not, are left empty.
+func auditValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+// Chain numbers the entry after the previous entry of its tenant, nil for the
+// first one, and seals it with its hash.
+func (e *AuditEntry) Chain(previous *AuditEntry) {
+	e.Seq, e.PrevHash = 1, ""
+	if previous != nil {
+		e.Seq, e.PrevHash = previous.Seq+1, previous.Hash
+	}
+	e.Hash = e.ComputeHash()
+}
+
+// ComputeHash is the SHA-256 of the content of the entry and of the hash of
+// the previous one.
+func (e *AuditEntry) ComputeHash() string {
+	data, _ := json.Marshal(struct {
+		TenantId   string
+		Seq        int64
+		Actor      string
+		Action     string
+		EntityType string
+		EntityId   string
+		Changes    []AuditChange
+		RequestId  string
+		CreatedAt  int64
+		PrevHash   string
+	}{e.TenantId, e.Seq, e.Actor, e.Action, e.EntityType, e.EntityId, e.Changes, e.RequestId, int64(e.CreatedAt), e.PrevHash})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter selects the entries of a tenant, newest first. Zero fields do
+// not filter, and After resumes the list after the given ID.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityId   string
+	RequestId  string
+	From       time.Time
+	To         time.Time
+	After      primitive.ObjectID
+	Limit      int64
+}
+
+// AuditVerification is the outcome of checking the chain of a tenant. BrokenAt
+// is the Seq of the first entry whose hash or position does not match the
+// entries before it.
+type AuditVerification struct {
+	Entries  int64
+	Valid    bool
+	BrokenAt int64
+}
+
+// requestIdPattern keeps the request IDs sent by callers short and printable.
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func ValidateRequestId(requestId string) bool {
+	return requestIdPattern.MatchString(requestId)
+}
+
+type requestIdKey struct{}
+
+// ContextWithRequestId tags the work done with the context with the ID of the
+// request that started it, so the audit trail can tell requests apart.
+func ContextWithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
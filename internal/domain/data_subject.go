@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ErasureModeDelete    = "delete"
+	ErasureModeAnonymize = "anonymize"
+)
+
+var ErasureModes = []string{ErasureModeDelete, ErasureModeAnonymize}
+
+// DataSubject is the person a data subject request is about, identified by
+// the email or phone of their leads.
+type DataSubject struct {
+	Email string
+	Phone string
+}
+
+func (s *DataSubject) Validate() error {
+	if strings.TrimSpace(s.Email) == "" && strings.TrimSpace(s.Phone) == "" {
+		return ErrInvalidDataSubject
+	}
+	return nil
+}
+
+// Suppressions returns the entries of the suppression list that keep the
+// subject from being imported again.
+func (s *DataSubject) Suppressions(hash SuppressionHasher) []*Suppression {
+	var suppressions []*Suppression
+	if email := NormalizeEmail(s.Email); email != "" {
+		suppressions = append(suppressions, NewSuppression(hash, SuppressionKindEmail, email))
+	}
+	if phone := NormalizePhone(s.Phone); phone != "" {
+		suppressions = append(suppressions, NewSuppression(hash, SuppressionKindPhone, phone))
+	}
+	return suppressions
+}
+
+// Filter returns the values the leads of the subject may hold, as written or
+// normalized, and as a number for phones.
+func (s *DataSubject) Filter() *SubjectFilter {
+	filter := &SubjectFilter{}
+
+	if email := strings.TrimSpace(s.Email); email != "" {
+		filter.Emails = append(filter.Emails, email)
+		if normalized := NormalizeEmail(email); normalized != email {
+			filter.Emails = append(filter.Emails, normalized)
+		}
+	}
+
+	if phone := strings.TrimSpace(s.Phone); phone != "" {
+		filter.Phones = append(filter.Phones, phone)
+		digits := NormalizePhone(phone)
+		if digits != "" && digits != phone {
+			filter.Phones = append(filter.Phones, digits)
+		}
+		if number, err := strconv.Atoi(digits); err == nil {
+			filter.Phones = append(filter.Phones, number)
+		}
+	}
+
+	return filter
+}
+
+// SubjectFilter matches the leads holding any of the values in their email or
+// phone field, in every schema of the tenant.
+type SubjectFilter struct {
+	Emails []interface{}
+	Phones []interface{}
+}
+
+// Erasure is the tombstone of an erased data subject. It only holds the
+// hashes of the subject, so it records the erasure without identifying them.
+type Erasure struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	TenantId    string             `bson:"tenant_id"`
+	Hashes      []string           `bson:"hashes"`
+	Mode        string             `bson:"mode"`
+	Leads       int64              `bson:"leads"`
+	RequestedBy string             `bson:"requested_by,omitempty"`
+	CreatedAt   primitive.DateTime `bson:"created_at"`
+}
+
+func NewErasure(mode string, suppressions []*Suppression) *Erasure {
+	hashes := make([]string, 0, len(suppressions))
+	for _, suppression := range suppressions {
+		hashes = append(hashes, suppression.Hash)
+	}
+	return &Erasure{
+		Hashes:    hashes,
+		Mode:      mode,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func ValidateErasureMode(mode string) error {
+	if !slices.Contains(ErasureModes, mode) {
+		return ErrInvalidDataSubject
+	}
+	return nil
+}
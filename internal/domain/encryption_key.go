@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const EncryptionKeyPurposeBlindIndex = "blind_index"
+
+// EncryptionKey is a key of a tenant, stored wrapped by the key manager so it
+// is useless without it, e.g. the key of the blind indexes of its leads.
+type EncryptionKey struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	TenantId  string             `bson:"tenant_id"`
+	Purpose   string             `bson:"purpose"`
+	Key       []byte             `bson:"key"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
+
+// SealedSecret is a secret the service reads back, such as the credentials of
+// an import source, encrypted with a data key stored alongside, wrapped by the
+// key manager.
+type SealedSecret struct {
+	Key        []byte `bson:"key"`
+	Ciphertext []byte `bson:"ciphertext"`
+}
+
+func NewEncryptionKey(purpose string, key []byte) *EncryptionKey {
+	return &EncryptionKey{
+		Purpose:   purpose,
+		Key:       key,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
@@ -10,4 +10,44 @@ var (
 	ErrDuplicatedValue          = errors.New("duplicated value")
 	ErrRequiredFieldsNotPresent = errors.New("required fields not present")
 	ErrDuplicatedFields         = errors.New("duplicated fields")
+	ErrImportInProgress         = errors.New("import in progress")
+	ErrImportAlreadyRolledBack  = errors.New("import already rolled back")
+	ErrImportInterrupted        = errors.New("import interrupted before it finished")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused with a different file")
+	ErrInvalidUploadSession     = errors.New("invalid upload session")
+	ErrUploadClosed             = errors.New("upload session is closed")
+	ErrUploadOffsetMismatch     = errors.New("upload offset mismatch")
+	ErrUploadSizeExceeded       = errors.New("upload size exceeded")
+	ErrUploadIncomplete         = errors.New("upload incomplete")
+	ErrUncompressedSizeExceeded = errors.New("uncompressed size exceeded")
+	ErrTooManyArchiveEntries    = errors.New("too many archive entries")
+	ErrEmptyArchive             = errors.New("archive has no files")
+	ErrFileMissing              = errors.New("file missing")
+	ErrObjectClaimed            = errors.New("object already claimed")
+	ErrInvalidImportSource      = errors.New("invalid import source")
+	ErrRemoteFileUnavailable    = errors.New("remote file unavailable")
+	ErrRemoteAddressDenied      = errors.New("remote address is loopback, link-local or private")
+	ErrInvalidWebhook           = errors.New("invalid webhook")
+	ErrWebhookDeliveryNotDead   = errors.New("webhook delivery is not dead")
+	ErrInvalidLeadMessage       = errors.New("invalid lead message")
+	ErrLeadMessageConsumed      = errors.New("lead message already consumed")
+	ErrInvalidResumeToken       = errors.New("invalid resume token")
+	ErrResumeTokenExpired       = errors.New("resume token expired")
+	ErrInvalidLeadFilter        = errors.New("invalid lead filter")
+	ErrInvalidExport            = errors.New("invalid export")
+	ErrExportNotReady           = errors.New("export is not ready")
+	ErrExportTooLarge           = errors.New("export too large for its format")
+	ErrInvalidAPIKeySettings    = errors.New("invalid api key settings")
+	ErrUnauthorized             = errors.New("missing or invalid credentials")
+	ErrForbidden                = errors.New("insufficient scope")
+	ErrInvalidTenant            = errors.New("invalid tenant")
+	ErrTenantRequired           = errors.New("no tenant to scope the data to")
+	ErrRateLimited              = errors.New("rate limit exceeded")
+	ErrQuotaExceeded            = errors.New("quota exceeded")
+	ErrEncryptionDisabled       = errors.New("sensitive fields require encryption to be configured")
+	ErrInvalidCiphertext        = errors.New("invalid ciphertext")
+	ErrInvalidDataSubject       = errors.New("invalid data subject request")
+	ErrInvalidRetention         = errors.New("invalid retention settings")
+	ErrInvalidSuppression       = errors.New("invalid suppression")
+	ErrInvalidAuditQuery        = errors.New("invalid audit query")
 )
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	EventLeadCreated     = "lead.created"
+	EventImportCompleted = "import.completed"
+	EventImportFailed    = "import.failed"
+)
+
+// EventTypes lists every event a subscriber may ask for.
+var EventTypes = []string{EventLeadCreated, EventImportCompleted, EventImportFailed}
+
+// Event is something that happened to the leads or imports of a schema, as
+// sent to subscribers.
+type Event struct {
+	ID         primitive.ObjectID `json:"id"`
+	Type       string             `json:"type"`
+	SchemaId   primitive.ObjectID `json:"schema_id"`
+	OccurredAt time.Time          `json:"occurred_at"`
+	Data       any                `json:"data"`
+}
+
+func NewEvent(eventType string, schemaId primitive.ObjectID, data any) *Event {
+	return &Event{
+		ID:         primitive.NewObjectID(),
+		Type:       eventType,
+		SchemaId:   schemaId,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+// LeadsCreatedData is the data of a lead.created event, one per batch of
+// leads written by an import, or per lead consumed from a message broker,
+// which has no import.
+type LeadsCreatedData struct {
+	ImportId *primitive.ObjectID `json:"import_id,omitempty"`
+	Leads    []primitive.M       `json:"leads"`
+}
+
+// LeadCreatedData is the data of a lead.created event published to a
+// message broker, one per lead.
+type LeadCreatedData struct {
+	ImportId *primitive.ObjectID `json:"import_id,omitempty"`
+	Lead     primitive.M         `json:"lead"`
+}
+
+// ImportEventData is the data of the import.completed and import.failed
+// events.
+type ImportEventData struct {
+	ImportId     primitive.ObjectID  `json:"import_id"`
+	SourceId     *primitive.ObjectID `json:"source_id,omitempty"`
+	FileName     string              `json:"file_name"`
+	Entry        string              `json:"entry,omitempty"`
+	Uploader     string              `json:"uploader,omitempty"`
+	Status       string              `json:"status"`
+	RowsRead     int                 `json:"rows_read"`
+	RowsInserted int                 `json:"rows_inserted"`
+	Error        string              `json:"error,omitempty"`
+}
+
+func NewImportEvent(imp *Import) *Event {
+	eventType := EventImportCompleted
+	if imp.Status == ImportStatusFailed {
+		eventType = EventImportFailed
+	}
+
+	data := ImportEventData{
+		ImportId:     imp.ID,
+		FileName:     imp.FileName,
+		Entry:        imp.Entry,
+		Uploader:     imp.Uploader,
+		Status:       imp.Status,
+		RowsRead:     imp.RowsRead,
+		RowsInserted: imp.RowsInserted,
+		Error:        imp.Error,
+	}
+	if !imp.SourceId.IsZero() {
+		data.SourceId = &imp.SourceId
+	}
+
+	return NewEvent(eventType, imp.SchemaId, data)
+}
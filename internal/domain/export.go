@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatNDJSON  = "ndjson"
+	ExportFormatXLSX    = "xlsx"
+	ExportFormatParquet = "parquet"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+var ExportFormats = []string{ExportFormatCSV, ExportFormatNDJSON, ExportFormatXLSX, ExportFormatParquet}
+
+// Export is a lead export written to a file in the background, for exports
+// too large to stream within a single request.
+type Export struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	TenantId string             `bson:"tenant_id"`
+	SchemaId primitive.ObjectID `bson:"schema_id"`
+	Format   string             `bson:"format"`
+	Query    LeadQuery          `bson:"query"`
+	// PII is set when the file holds the decrypted sensitive fields, so only
+	// callers that may read them can download it.
+	PII        bool               `bson:"pii"`
+	Status     string             `bson:"status"`
+	Rows       int64              `bson:"rows"`
+	Size       int64              `bson:"size"`
+	Error      string             `bson:"error,omitempty"`
+	CreatedAt  primitive.DateTime `bson:"created_at"`
+	StartedAt  primitive.DateTime `bson:"started_at,omitempty"`
+	FinishedAt primitive.DateTime `bson:"finished_at,omitempty"`
+}
+
+func NewExport(schemaId primitive.ObjectID, format string, query LeadQuery) *Export {
+	return &Export{
+		SchemaId:  schemaId,
+		Format:    format,
+		Query:     query,
+		Status:    ExportStatusPending,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+// FileName is the name the export is downloaded as.
+func (e *Export) FileName() string {
+	return "leads-" + e.ID.Hex() + ExportExtension(e.Format)
+}
+
+func (e *Export) Complete(rows, size int64) {
+	e.Status = ExportStatusCompleted
+	e.Rows = rows
+	e.Size = size
+	e.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+func (e *Export) Fail(err error) {
+	e.Status = ExportStatusFailed
+	e.Error = err.Error()
+	e.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+func ValidateExportFormat(format string) error {
+	if !slices.Contains(ExportFormats, format) {
+		return ErrInvalidExport
+	}
+	return nil
+}
+
+func ExportExtension(format string) string {
+	return "." + format
+}
+
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv"
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	case ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
@@ -1,13 +1,58 @@
 package domain
 
 import (
+	"io"
 	"mime/multipart"
+	"os"
 	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type File struct {
-	SchemaId string
-	File     *multipart.FileHeader
+	SchemaId       string
+	Name           string
+	Size           int64
+	Uploader       string
+	IdempotencyKey string
+	SourceId       primitive.ObjectID
+	Open           func() (FileContent, error)
+}
+
+// FileContent is the uploaded content, seekable so it can be read once for
+// its checksum and again for its leads.
+type FileContent interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+func NewMultipartFile(schemaId string, header *multipart.FileHeader) *File {
+	return &File{
+		SchemaId: schemaId,
+		Name:     header.Filename,
+		Size:     header.Size,
+		Open: func() (FileContent, error) {
+			return header.Open()
+		},
+	}
+}
+
+func NewLocalFile(schemaId, name, path string) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		SchemaId: schemaId,
+		Name:     name,
+		Size:     info.Size(),
+		Open: func() (FileContent, error) {
+			return os.Open(path)
+		},
+	}, nil
 }
 
 func ValidateDuplicatedFields(headers []string) bool {
@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ImportStatusProcessing = "processing"
+	ImportStatusCompleted  = "completed"
+	ImportStatusFailed     = "failed"
+	ImportStatusRolledBack = "rolled_back"
+	// ImportStatusSkipped records a scheduled run whose remote file did not
+	// change since the previous run.
+	ImportStatusSkipped = "skipped"
+)
+
+type Import struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	TenantId       string             `bson:"tenant_id"`
+	SchemaId       primitive.ObjectID `bson:"schema_id"`
+	SourceId       primitive.ObjectID `bson:"source_id,omitempty"`
+	FileName       string             `bson:"file_name"`
+	Entry          string             `bson:"entry,omitempty"`
+	Size           int64              `bson:"size"`
+	Checksum       string             `bson:"checksum"`
+	IdempotencyKey string             `bson:"idempotency_key,omitempty"`
+	Uploader       string             `bson:"uploader"`
+	Status         string             `bson:"status"`
+	RowsRead       int                `bson:"rows_read"`
+	RowsInserted   int                `bson:"rows_inserted"`
+	// RowsSuppressed counts the valid rows left out because their email or
+	// phone is suppressed.
+	RowsSuppressed int                `bson:"rows_suppressed,omitempty"`
+	Error          string             `bson:"error,omitempty"`
+	StartedAt      primitive.DateTime `bson:"started_at"`
+	FinishedAt     primitive.DateTime `bson:"finished_at,omitempty"`
+	RolledBackAt   primitive.DateTime `bson:"rolled_back_at,omitempty"`
+	RowsDeleted    int64              `bson:"rows_deleted,omitempty"`
+	Progress       *ImportProgress    `bson:"progress,omitempty"`
+
+	// IdempotencyClaimed is set while the import may be replayed to the
+	// uploads repeating its idempotency key, which only one import of a
+	// schema, or of each entry of an archive, claims at once.
+	IdempotencyClaimed bool `bson:"idempotency_claimed,omitempty"`
+
+	// Replayed is set when a repeated upload is answered with this import
+	// instead of processing the file again.
+	Replayed bool `bson:"-"`
+}
+
+// ImportProgress is how far the file of an import has been read. It is saved
+// periodically while the import is processing and kept once it finishes.
+type ImportProgress struct {
+	RowsRead     int   `bson:"rows_read"`
+	RowsValid    int   `bson:"rows_valid"`
+	RowsRejected int   `bson:"rows_rejected"`
+	BytesRead    int64 `bson:"bytes_read"`
+	BytesTotal   int64 `bson:"bytes_total"`
+	// EstimatedSecondsRemaining extrapolates the time taken so far to the
+	// bytes left to read.
+	EstimatedSecondsRemaining int64              `bson:"estimated_seconds_remaining"`
+	UpdatedAt                 primitive.DateTime `bson:"updated_at"`
+}
+
+func NewImport(schemaId primitive.ObjectID, file *File, checksum string) *Import {
+	return &Import{
+		SchemaId:       schemaId,
+		SourceId:       file.SourceId,
+		FileName:       file.Name,
+		Size:           file.Size,
+		Checksum:       checksum,
+		IdempotencyKey: file.IdempotencyKey,
+		Uploader:       file.Uploader,
+		Status:         ImportStatusProcessing,
+		StartedAt:      primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func (i *Import) Complete(rowsRead, rowsInserted int) {
+	i.Status = ImportStatusCompleted
+	i.RowsRead = rowsRead
+	i.RowsInserted = rowsInserted
+	i.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+// Fail records the error the import failed with. A failed import keeps none of
+// its leads, even when it failed after they were written.
+func (i *Import) Fail(rowsRead int, err error) {
+	i.Status = ImportStatusFailed
+	i.RowsRead = rowsRead
+	i.RowsInserted = 0
+	i.RowsSuppressed = 0
+	i.Error = err.Error()
+	i.IdempotencyClaimed = false
+	i.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+func (i *Import) Skip() {
+	i.Status = ImportStatusSkipped
+	i.IdempotencyClaimed = false
+	i.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+func (i *Import) CanRollback() error {
+	switch i.Status {
+	case ImportStatusProcessing:
+		return ErrImportInProgress
+	case ImportStatusRolledBack:
+		return ErrImportAlreadyRolledBack
+	default:
+		return nil
+	}
+}
+
+func (i *Import) RollBack(rowsDeleted int64) {
+	i.Status = ImportStatusRolledBack
+	i.IdempotencyClaimed = false
+	i.RowsDeleted = rowsDeleted
+	i.RolledBackAt = primitive.NewDateTimeFromTime(time.Now())
+}
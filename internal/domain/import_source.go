@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"net/url"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// ImportSourceModeAppend adds the leads of every run to those already
+	// imported.
+	ImportSourceModeAppend = "append"
+	// ImportSourceModeReplace rolls back the previous runs of the source before
+	// importing, so the schema only holds the leads of the latest file.
+	ImportSourceModeReplace = "replace"
+)
+
+// ImportSource is a remote file fetched on a cron schedule and ingested into
+// its schema.
+type ImportSource struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	TenantId   string             `bson:"tenant_id"`
+	SchemaId   primitive.ObjectID `bson:"schema_id"`
+	URL        string             `bson:"url"`
+	AuthHeader string             `bson:"auth_header,omitempty"`
+	// AuthValue is the value of the auth header, which is only stored sealed
+	// in SealedAuthValue. Sources stored before auth values were sealed still
+	// hold it in plain.
+	AuthValue       string        `bson:"auth_value,omitempty"`
+	SealedAuthValue *SealedSecret `bson:"sealed_auth_value,omitempty"`
+	Schedule        string        `bson:"schedule"`
+	Mode            string        `bson:"mode"`
+	Enabled         bool          `bson:"enabled"`
+
+	// ETag, LastModified and Checksum describe the last file fetched, so an
+	// unchanged file is skipped.
+	ETag         string             `bson:"etag,omitempty"`
+	LastModified string             `bson:"last_modified,omitempty"`
+	Checksum     string             `bson:"checksum,omitempty"`
+	LastRunAt    primitive.DateTime `bson:"last_run_at,omitempty"`
+	LastImportId primitive.ObjectID `bson:"last_import_id,omitempty"`
+	NextRunAt    primitive.DateTime `bson:"next_run_at"`
+	CreatedAt    primitive.DateTime `bson:"created_at"`
+	UpdatedAt    primitive.DateTime `bson:"updated_at"`
+}
+
+func (s *ImportSource) Validate() error {
+	parsed, err := url.Parse(s.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return ErrInvalidImportSource
+	}
+
+	if s.AuthValue != "" && s.AuthHeader == "" {
+		return ErrInvalidImportSource
+	}
+
+	switch s.Mode {
+	case ImportSourceModeAppend, ImportSourceModeReplace:
+		return nil
+	default:
+		return ErrInvalidImportSource
+	}
+}
+
+// ResetValidators forgets the last file fetched, so the next run imports the
+// file even if it did not change.
+func (s *ImportSource) ResetValidators() {
+	s.ETag = ""
+	s.LastModified = ""
+	s.Checksum = ""
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LeadPIIField holds the encrypted values of the sensitive fields of a lead:
+// the data key that encrypted them, wrapped by the key manager, under "key"
+// and the ciphertext of each field under "fields". Blind indexed fields keep
+// their blind index in place of their value.
+const LeadPIIField = "pii"
+
+// LeadLegalHoldField is set on the leads under legal hold, which are never
+// deleted by the retention of their schema nor by the erasure of their data
+// subject.
+const LeadLegalHoldField = "legal_hold"
+
+// LeadAnonymizedAtField is when the data subject of an anonymized lead was
+// erased.
+const LeadAnonymizedAtField = "anonymized_at"
+
+// The consent of a lead to be contacted: the channel it was given for, when it
+// was given, in Unix seconds as every datetime field, and where it was
+// collected. Any file or message may hold them, whatever its schema.
+const (
+	LeadConsentChannelField   = "consent_channel"
+	LeadConsentTimestampField = "consent_timestamp"
+	LeadConsentSourceField    = "consent_source"
+)
+
+var ConsentChannels = []string{"email", "sms", "phone", "whatsapp", "mail"}
+
+// ConsentFieldTypes are the types of the consent fields, read as the fields of
+// a schema are.
+var ConsentFieldTypes = map[string]string{
+	LeadConsentChannelField:   "string",
+	LeadConsentTimestampField: "datetime",
+	LeadConsentSourceField:    "string",
+}
+
+func IsConsentField(name string) bool {
+	_, ok := ConsentFieldTypes[name]
+	return ok
+}
+
+// ValidateConsent accepts a lead without consent, or one whose consent names
+// one of the ConsentChannels.
+func ValidateConsent(lead primitive.M) bool {
+	channel, ok := lead[LeadConsentChannelField].(string)
+	if !ok {
+		_, hasTimestamp := lead[LeadConsentTimestampField]
+		_, hasSource := lead[LeadConsentSourceField]
+		return !hasTimestamp && !hasSource
+	}
+	return slices.Contains(ConsentChannels, channel)
+}
+
+// LeadChange is a lead written to a schema, as seen by the change stream of
+// the leads. ResumeToken resumes the stream right after the change.
+type LeadChange struct {
+	ResumeToken string
+	Operation   string
+	Lead        primitive.M
+}
+
+// LeadQuery is a lead query as received, before it is checked against the
+// schema. Filters are "<field>:<value>" pairs whose value is written the same
+// way as in an uploaded file.
+type LeadQuery struct {
+	ImportId    string `bson:"import_id,omitempty"`
+	CreatedFrom string `bson:"created_from,omitempty"`
+	CreatedTo   string `bson:"created_to,omitempty"`
+	// ConsentedFrom and ConsentedTo select the leads by the time of their
+	// consent, which leads without consent never match.
+	ConsentedFrom string   `bson:"consented_from,omitempty"`
+	ConsentedTo   string   `bson:"consented_to,omitempty"`
+	Filters       []string `bson:"filters,omitempty"`
+}
+
+// LeadFilter selects the leads of a schema. Zero fields do not filter, and
+// Fields holds the values the fields must equal.
+type LeadFilter struct {
+	SchemaId      primitive.ObjectID
+	ImportId      primitive.ObjectID
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	ConsentedFrom time.Time
+	ConsentedTo   time.Time
+	Fields        map[string]interface{}
+}
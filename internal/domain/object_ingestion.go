@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ObjectIngestionStatusProcessing = "processing"
+	ObjectIngestionStatusDone       = "done"
+	ObjectIngestionStatusFailed     = "failed"
+)
+
+// StoredObject is an object found in a watched bucket.
+type StoredObject struct {
+	Bucket       string
+	Key          string
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectIngestion records the ingestion of one version of a bucket object,
+// identified by its bucket, key and ETag, so it is never ingested twice. The
+// instance processing it holds its claim from ClaimedAt for a lease, after
+// which another instance may take it over.
+type ObjectIngestion struct {
+	ID         primitive.ObjectID   `bson:"_id"`
+	SchemaId   primitive.ObjectID   `bson:"schema_id"`
+	Bucket     string               `bson:"bucket"`
+	Key        string               `bson:"key"`
+	ETag       string               `bson:"etag"`
+	Size       int64                `bson:"size"`
+	Status     string               `bson:"status"`
+	ImportIds  []primitive.ObjectID `bson:"import_ids,omitempty"`
+	Error      string               `bson:"error,omitempty"`
+	MovedTo    string               `bson:"moved_to,omitempty"`
+	StartedAt  primitive.DateTime   `bson:"started_at"`
+	ClaimedAt  primitive.DateTime   `bson:"claimed_at"`
+	FinishedAt primitive.DateTime   `bson:"finished_at,omitempty"`
+}
+
+func NewObjectIngestion(schemaId primitive.ObjectID, object *StoredObject) *ObjectIngestion {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	return &ObjectIngestion{
+		SchemaId:  schemaId,
+		Bucket:    object.Bucket,
+		Key:       object.Key,
+		ETag:      object.ETag,
+		Size:      object.Size,
+		Status:    ObjectIngestionStatusProcessing,
+		StartedAt: now,
+		ClaimedAt: now,
+	}
+}
+
+// Finish records the imports the object produced. The object failed when the
+// pipeline returned an error or any of its imports failed.
+func (o *ObjectIngestion) Finish(imports []*Import, err error) {
+	o.Status = ObjectIngestionStatusDone
+	o.ImportIds = nil
+	o.Error = ""
+
+	for _, imp := range imports {
+		o.ImportIds = append(o.ImportIds, imp.ID)
+		if imp.Status == ImportStatusFailed {
+			o.Status = ObjectIngestionStatusFailed
+			o.Error = imp.Error
+		}
+	}
+
+	if err != nil {
+		o.Status = ObjectIngestionStatusFailed
+		o.Error = err.Error()
+	}
+
+	o.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+// Retry starts a new attempt of a failed object dropped into the bucket
+// again, or of an object whose claim was abandoned.
+func (o *ObjectIngestion) Retry() {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	o.Status = ObjectIngestionStatusProcessing
+	o.ImportIds = nil
+	o.Error = ""
+	o.MovedTo = ""
+	o.StartedAt = now
+	o.ClaimedAt = now
+	o.FinishedAt = 0
+}
+
+// IsAbandoned reports an object still processing whose claim is older than
+// lease, as the instance processing it probably stopped.
+func (o *ObjectIngestion) IsAbandoned(now time.Time, lease time.Duration) bool {
+	return o.Status == ObjectIngestionStatusProcessing && o.ClaimedAt.Time().Before(now.Add(-lease))
+}
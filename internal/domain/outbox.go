@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusPublished = "published"
+	OutboxStatusDead      = "dead"
+)
+
+// OutboxMessage holds the broker records of an event until they are
+// published, so events are kept while the broker is unavailable. A message
+// the broker keeps rejecting ends up dead, and is kept with its last error.
+type OutboxMessage struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	EventId       primitive.ObjectID `bson:"event_id"`
+	SchemaId      primitive.ObjectID `bson:"schema_id"`
+	Event         string             `bson:"event"`
+	Topic         string             `bson:"topic"`
+	Records       []OutboxRecord     `bson:"records"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	NextAttemptAt primitive.DateTime `bson:"next_attempt_at"`
+	CreatedAt     primitive.DateTime `bson:"created_at"`
+	PublishedAt   primitive.DateTime `bson:"published_at,omitempty"`
+}
+
+// OutboxRecord is one message sent to the broker.
+type OutboxRecord struct {
+	ID    string `bson:"id"`
+	Key   string `bson:"key"`
+	Value string `bson:"value"`
+}
+
+func NewOutboxMessage(event *Event, topic string, records []OutboxRecord) *OutboxMessage {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	return &OutboxMessage{
+		EventId:       event.ID,
+		SchemaId:      event.SchemaId,
+		Event:         event.Type,
+		Topic:         topic,
+		Records:       records,
+		Status:        OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+func (m *OutboxMessage) Publish() {
+	m.Attempts++
+	m.Status = OutboxStatusPublished
+	m.LastError = ""
+	m.PublishedAt = primitive.NewDateTimeFromTime(time.Now())
+}
+
+// Fail records a failed attempt and schedules the next one after retryIn, or
+// moves the message to the dead state once maxAttempts were made.
+func (m *OutboxMessage) Fail(err error, maxAttempts int, retryIn time.Duration) {
+	m.Attempts++
+	m.LastError = err.Error()
+	if m.Attempts >= maxAttempts {
+		m.Status = OutboxStatusDead
+		return
+	}
+	m.NextAttemptAt = primitive.NewDateTimeFromTime(time.Now().Add(retryIn))
+}
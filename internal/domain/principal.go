@@ -0,0 +1,46 @@
+package domain
+
+import "context"
+
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request, kept in its context so
+// the services can record who did what.
+type Principal struct {
+	// Subject identifies the caller: api-key:<id> for API keys and the sub
+	// claim for bearer tokens.
+	Subject string
+	Name    string
+	Method  string
+	Scopes  []string
+	// Tenant owns the data the caller reads and writes: the tenant of the API
+	// key or the tenant claim of the bearer token.
+	Tenant string
+}
+
+// Context scopes the context to the caller and its tenant.
+func (p *Principal) Context(ctx context.Context) context.Context {
+	return ContextWithTenant(ContextWithPrincipal(ctx, p), p.Tenant)
+}
+
+// HasScopes reports whether the caller was granted every one of the scopes.
+func (p *Principal) HasScopes(scopes []string) bool {
+	return grantsScopes(p.Scopes, scopes)
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the caller of the request, or false when the
+// request was not authenticated, as when auth is disabled or the work was not
+// started by a request.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits caps what a tenant can do. Requests are refilled at
+// RequestsPerSecond up to Burst, and ingestion is capped by MaxRowsPerDay
+// leads, files of MaxFileSize bytes and MaxConcurrentImports imports at a
+// time. Zero means no limit.
+type Limits struct {
+	RequestsPerSecond    float64
+	Burst                int
+	MaxRowsPerDay        int64
+	MaxFileSize          int64
+	MaxConcurrentImports int
+}
+
+// Usage counts the leads a tenant ingested on a day, in UTC.
+type Usage struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	TenantId  string             `bson:"tenant_id"`
+	Day       string             `bson:"day"`
+	Rows      int64              `bson:"rows"`
+	UpdatedAt primitive.DateTime `bson:"updated_at"`
+}
+
+// UsageDay returns the day the usage at t is counted in.
+func UsageDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// NextUsageDay returns when the day of t ends and its usage resets.
+func NextUsageDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// LimitError is a rate limit or a quota that was reached, with how long
+// until it is lifted.
+type LimitError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// TenantUsage is what a tenant used of its limits: the leads ingested on Day,
+// which resets at ResetsAt, the imports running, and the requests left in the
+// bucket of the caller, when requests are limited and the caller is known.
+type TenantUsage struct {
+	Tenant            string
+	Limits            Limits
+	Day               string
+	Rows              int64
+	ResetsAt          time.Time
+	RunningImports    int64
+	RequestsAvailable *float64
+}
@@ -2,22 +2,92 @@ package domain
 
 import (
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Schema struct {
 	ID        primitive.ObjectID `bson:"_id"`
+	TenantId  string             `bson:"tenant_id"`
 	Fields    []SchemaField      `bson:"fields"`
+	Retention *Retention         `bson:"retention,omitempty"`
 	CreatedAt primitive.DateTime `bson:"created_at"`
 	UpdatedAt primitive.DateTime `bson:"updated_at"`
 }
 
+// Retention is how long the leads of a schema are kept: Days after their
+// created_at or, when Field is set, after the value of that datetime field.
+type Retention struct {
+	Days  int    `bson:"days" json:"days"`
+	Field string `bson:"field,omitempty" json:"field,omitempty"`
+}
+
+// ExpiryField is the field the retention of a lead is counted from.
+func (r *Retention) ExpiryField() string {
+	if r.Field == "" {
+		return "created_at"
+	}
+	return r.Field
+}
+
+// Cutoff is the value of the expiry field before which leads are past their
+// retention at now, as stored: a date for created_at and Unix seconds for
+// datetime fields.
+func (r *Retention) Cutoff(now time.Time) interface{} {
+	cutoff := now.AddDate(0, 0, -r.Days)
+	if r.Field == "" {
+		return primitive.NewDateTimeFromTime(cutoff)
+	}
+	return cutoff.Unix()
+}
+
+// SchemaField is a field of the leads of a schema. The values of Sensitive
+// fields are encrypted before they are stored.
 type SchemaField struct {
-	Name     string `bson:"name"`
-	Type     string `bson:"type"`
-	Required bool   `bson:"required"`
-	Unique   bool   `bson:"unique"`
+	Name      string `bson:"name" json:"name"`
+	Type      string `bson:"type" json:"type"`
+	Required  bool   `bson:"required" json:"required"`
+	Unique    bool   `bson:"unique" json:"unique"`
+	Sensitive bool   `bson:"sensitive" json:"sensitive"`
+}
+
+// BlindIndexed reports whether the field is stored as a blind index next to
+// its encrypted value, so it can still be unique and filtered on: sensitive
+// fields that are unique, as email and phone always are.
+func (f *SchemaField) BlindIndexed() bool {
+	return f.Sensitive && (f.Unique || requiredFields[f.Name])
+}
+
+// HasSensitiveFields reports whether any field of the schema is encrypted.
+func (s *Schema) HasSensitiveFields() bool {
+	for _, field := range s.Fields {
+		if field.Sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRetention accepts a schema without retention, or one kept a positive
+// number of days after created_at or after one of its datetime fields that is
+// not encrypted, as encrypted values can not be compared.
+func (s *Schema) ValidateRetention() bool {
+	if s.Retention == nil {
+		return true
+	}
+	if s.Retention.Days <= 0 {
+		return false
+	}
+	if s.Retention.Field == "" {
+		return true
+	}
+	for _, field := range s.Fields {
+		if field.Name == s.Retention.Field {
+			return field.Type == "datetime" && !field.Sensitive
+		}
+	}
+	return false
 }
 
 func (s *Schema) ValidateIfFieldsTypesAreValid() bool {
@@ -45,6 +115,9 @@ func (s *Schema) Normalize() {
 		s.Fields[i].Name = strings.ToLower(s.Fields[i].Name)
 		s.Fields[i].Type = strings.ToLower(s.Fields[i].Type)
 	}
+	if s.Retention != nil {
+		s.Retention.Field = strings.ToLower(s.Retention.Field)
+	}
 }
 
 func (s *Schema) ValidateIfRequiredFieldsArePresent() bool {
@@ -62,15 +135,31 @@ func (s *Schema) ValidateIfRequiredFieldsArePresent() bool {
 	return true
 }
 
-func (s *Schema) ValidateCreatedAndUpdatedFields() bool {
+// ValidateReservedFields rejects the fields the service sets on the leads,
+// which a field of the schema would overwrite or be overwritten by, and the
+// consent fields every lead may hold.
+func (s *Schema) ValidateReservedFields() bool {
 	for _, field := range s.Fields {
-		if field.Name == "created_at" || field.Name == "updated_at" {
+		if reservedFields[field.Name] || IsConsentField(field.Name) {
 			return false
 		}
 	}
 	return true
 }
 
+var reservedFields = map[string]bool{
+	"_id":                 true,
+	"created_at":          true,
+	"updated_at":          true,
+	"tenant_id":           true,
+	"import_id":           true,
+	"schema_id":           true,
+	"message_id":          true,
+	LeadPIIField:          true,
+	LeadLegalHoldField:    true,
+	LeadAnonymizedAtField: true,
+}
+
 var requiredFields = map[string]bool{
 	"phone": true,
 	"email": true,
@@ -0,0 +1,188 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SuppressionKindEmail = "email"
+	SuppressionKindPhone = "phone"
+)
+
+var SuppressionKinds = []string{SuppressionKindEmail, SuppressionKindPhone}
+
+const (
+	SuppressionReasonErasure   = "erasure"
+	SuppressionReasonOptOut    = "opt_out"
+	SuppressionReasonBounce    = "bounce"
+	SuppressionReasonComplaint = "complaint"
+	SuppressionReasonOther     = "other"
+)
+
+// SuppressionReasons are the reasons callers may suppress an email or a phone
+// for. Erasures are only suppressed by the erasure of their data subject.
+var SuppressionReasons = []string{SuppressionReasonOptOut, SuppressionReasonBounce, SuppressionReasonComplaint, SuppressionReasonOther}
+
+// Suppression keeps an email or a phone from being imported. Only the hash of
+// the normalized value is stored.
+type Suppression struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	TenantId  string             `bson:"tenant_id"`
+	Kind      string             `bson:"kind"`
+	Hash      string             `bson:"hash"`
+	Reason    string             `bson:"reason"`
+	CreatedBy string             `bson:"created_by,omitempty"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
+
+// NewSuppression suppresses the normalized value of the kind.
+func NewSuppression(hash SuppressionHasher, kind, value string) *Suppression {
+	return &Suppression{
+		Kind:      kind,
+		Hash:      hash(kind, value),
+		Reason:    SuppressionReasonErasure,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+// ParseSuppression suppresses the email or phone value for the reason, which
+// is opt_out when empty. The value is normalized before it is hashed, so it
+// matches the leads that hold it written in any other way.
+func ParseSuppression(hash SuppressionHasher, kind, value, reason string) (*Suppression, error) {
+	if reason == "" {
+		reason = SuppressionReasonOptOut
+	}
+	if !slices.Contains(SuppressionReasons, reason) {
+		return nil, ErrInvalidSuppression
+	}
+
+	normalized, err := NormalizeSuppressed(kind, value)
+	if err != nil {
+		return nil, err
+	}
+
+	suppression := NewSuppression(hash, kind, normalized)
+	suppression.Reason = reason
+	return suppression, nil
+}
+
+// NormalizeSuppressed normalizes the email or phone value, which must not be
+// empty once normalized.
+func NormalizeSuppressed(kind, value string) (string, error) {
+	var normalized string
+	switch kind {
+	case SuppressionKindEmail:
+		normalized = NormalizeEmail(value)
+	case SuppressionKindPhone:
+		normalized = NormalizePhone(value)
+	default:
+		return "", ErrInvalidSuppression
+	}
+	if normalized == "" {
+		return "", ErrInvalidSuppression
+	}
+	return normalized, nil
+}
+
+// SuppressionFilter selects the suppressions of a tenant, newest first. Zero
+// fields do not filter, Hashes matches any of its hashes and After resumes the
+// list after the given ID.
+type SuppressionFilter struct {
+	Kind   string
+	Hashes []string
+	Reason string
+	After  primitive.ObjectID
+	Limit  int64
+}
+
+// SuppressionImport is the outcome of a list of suppressions uploaded at once.
+type SuppressionImport struct {
+	RowsRead      int
+	RowsRejected  int
+	Suppressed    int64
+	AlreadyListed int64
+}
+
+// SuppressionHasher hashes the normalized value of a kind for the suppression
+// list of a tenant.
+type SuppressionHasher func(kind, value string) string
+
+// KeyedSuppressionHasher hashes with the HMAC-SHA256 of the key, so the
+// emails and phones of the list can not be found back by hashing guesses
+// without it.
+func KeyedSuppressionHasher(key []byte) SuppressionHasher {
+	return func(kind, value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(kind + ":" + value))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+// UnkeyedSuppressionHash is the SHA-256 of the kind and the normalized value,
+// which the suppressions were hashed with before they were keyed, and still
+// are without encryption. Emails and phones never share a hash.
+func UnkeyedSuppressionHash(kind, value string) string {
+	sum := sha256.Sum256([]byte(kind + ":" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// SuppressionHashes returns the hash of the normalized value of the kind and,
+// when it differs, its unkeyed hash, so suppressions written before they were
+// keyed still match.
+func SuppressionHashes(hash SuppressionHasher, kind, value string) []string {
+	hashes := []string{hash(kind, value)}
+	if unkeyed := UnkeyedSuppressionHash(kind, value); unkeyed != hashes[0] {
+		hashes = append(hashes, unkeyed)
+	}
+	return hashes
+}
+
+// NormalizeEmail trims and lowercases the email.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone keeps the digits of the phone only.
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// SubjectHashes returns the hashes of the email and phone values of a lead,
+// any of which is suppressed when the lead may not be imported.
+func SubjectHashes(hash SuppressionHasher, email, phone interface{}) []string {
+	var hashes []string
+	if email := NormalizeEmail(stringOf(email)); email != "" {
+		hashes = append(hashes, SuppressionHashes(hash, SuppressionKindEmail, email)...)
+	}
+	if phone := NormalizePhone(stringOf(phone)); phone != "" {
+		hashes = append(hashes, SuppressionHashes(hash, SuppressionKindPhone, phone)...)
+	}
+	return hashes
+}
+
+func stringOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant owns the data written without a tenant, as when auth is
+// disabled, by API keys created without one, and before tenants existed.
+const DefaultTenant = "default"
+
+// tenantPattern keeps tenant IDs usable as database names.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+func ValidateTenant(tenant string) error {
+	if !tenantPattern.MatchString(tenant) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant scopes the work done with the context to the tenant. The
+// auth middleware scopes requests to the tenant of their caller, and the
+// background workers scope the work they do on behalf of a tenant.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant the context was scoped to. Contexts
+// without a tenant belong to the background workers that act on every tenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
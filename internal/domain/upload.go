@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	UploadStatusOpen      = "open"
+	UploadStatusCompleted = "completed"
+	UploadStatusCancelled = "cancelled"
+	UploadStatusExpired   = "expired"
+)
+
+type UploadSession struct {
+	ID             primitive.ObjectID   `bson:"_id"`
+	TenantId       string               `bson:"tenant_id"`
+	SchemaId       primitive.ObjectID   `bson:"schema_id"`
+	FileName       string               `bson:"file_name"`
+	Size           int64                `bson:"size"`
+	Offset         int64                `bson:"offset"`
+	Uploader       string               `bson:"uploader"`
+	IdempotencyKey string               `bson:"idempotency_key,omitempty"`
+	Status         string               `bson:"status"`
+	ImportIds      []primitive.ObjectID `bson:"import_ids,omitempty"`
+	CreatedAt      primitive.DateTime   `bson:"created_at"`
+	UpdatedAt      primitive.DateTime   `bson:"updated_at"`
+	ExpiresAt      primitive.DateTime   `bson:"expires_at"`
+}
+
+func (u *UploadSession) Validate() error {
+	if u.FileName == "" || u.Size <= 0 {
+		return ErrInvalidUploadSession
+	}
+	return nil
+}
+
+// CanWrite checks that a chunk of the given length can be appended at offset.
+func (u *UploadSession) CanWrite(offset, length int64) error {
+	if u.Status != UploadStatusOpen {
+		return ErrUploadClosed
+	}
+	if offset != u.Offset {
+		return ErrUploadOffsetMismatch
+	}
+	if offset+length > u.Size {
+		return ErrUploadSizeExceeded
+	}
+	return nil
+}
+
+func (u *UploadSession) CanFinalize() error {
+	if u.Status != UploadStatusOpen {
+		return ErrUploadClosed
+	}
+	if u.Offset != u.Size {
+		return ErrUploadIncomplete
+	}
+	return nil
+}
+
+func (u *UploadSession) IsExpired(now time.Time) bool {
+	return u.Status == UploadStatusOpen && now.After(u.ExpiresAt.Time())
+}
@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusDelivered = "delivered"
+	WebhookDeliveryStatusDead      = "dead"
+)
+
+// Webhook subscribes a URL to events of a schema. Payloads are signed with
+// Secret.
+type Webhook struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	TenantId string             `bson:"tenant_id"`
+	SchemaId primitive.ObjectID `bson:"schema_id"`
+	URL      string             `bson:"url"`
+	// Secret is only stored sealed in SealedSecret. Webhooks stored before
+	// secrets were sealed still hold it in plain.
+	Secret       string             `bson:"secret,omitempty"`
+	SealedSecret *SealedSecret      `bson:"sealed_secret,omitempty"`
+	Events       []string           `bson:"events"`
+	Enabled      bool               `bson:"enabled"`
+	CreatedAt    primitive.DateTime `bson:"created_at"`
+	UpdatedAt    primitive.DateTime `bson:"updated_at"`
+}
+
+func (w *Webhook) Validate() error {
+	parsed, err := url.Parse(w.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return ErrInvalidWebhook
+	}
+
+	if len(w.Events) == 0 {
+		return ErrInvalidWebhook
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(EventTypes, event) {
+			return ErrInvalidWebhook
+		}
+	}
+
+	return nil
+}
+
+// WebhookDelivery is an event queued for a webhook, retried with exponential
+// backoff until it is delivered or runs out of attempts. Attempts keeps every
+// try, while Failures counts those since the delivery was last queued.
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	TenantId      string             `bson:"tenant_id"`
+	WebhookId     primitive.ObjectID `bson:"webhook_id"`
+	SchemaId      primitive.ObjectID `bson:"schema_id"`
+	EventId       primitive.ObjectID `bson:"event_id"`
+	Event         string             `bson:"event"`
+	Payload       string             `bson:"payload"`
+	Status        string             `bson:"status"`
+	Attempts      []WebhookAttempt   `bson:"attempts"`
+	Failures      int                `bson:"failures"`
+	NextAttemptAt primitive.DateTime `bson:"next_attempt_at"`
+	CreatedAt     primitive.DateTime `bson:"created_at"`
+	DeliveredAt   primitive.DateTime `bson:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt is one try to deliver a payload.
+type WebhookAttempt struct {
+	At         primitive.DateTime `bson:"at"`
+	StatusCode int                `bson:"status_code,omitempty"`
+	Error      string             `bson:"error,omitempty"`
+	Duration   time.Duration      `bson:"duration"`
+}
+
+func NewWebhookDelivery(webhook *Webhook, event *Event, payload []byte) *WebhookDelivery {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	return &WebhookDelivery{
+		WebhookId:     webhook.ID,
+		SchemaId:      webhook.SchemaId,
+		EventId:       event.ID,
+		Event:         event.Type,
+		Payload:       string(payload),
+		Status:        WebhookDeliveryStatusPending,
+		Attempts:      []WebhookAttempt{},
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+func (d *WebhookDelivery) Succeed(attempt WebhookAttempt) {
+	d.Attempts = append(d.Attempts, attempt)
+	d.Status = WebhookDeliveryStatusDelivered
+	d.DeliveredAt = attempt.At
+}
+
+// Fail records a failed attempt and schedules the next one after retryIn, or
+// moves the delivery to the dead letter state once maxAttempts were made.
+func (d *WebhookDelivery) Fail(attempt WebhookAttempt, maxAttempts int, retryIn time.Duration) {
+	d.Attempts = append(d.Attempts, attempt)
+	d.Failures++
+	if d.Failures >= maxAttempts {
+		d.Status = WebhookDeliveryStatusDead
+		return
+	}
+	d.NextAttemptAt = primitive.NewDateTimeFromTime(attempt.At.Time().Add(retryIn))
+}
+
+// Abandon moves the delivery to the dead letter state without another attempt.
+func (d *WebhookDelivery) Abandon(reason string) {
+	d.Attempts = append(d.Attempts, WebhookAttempt{At: primitive.NewDateTimeFromTime(time.Now()), Error: reason})
+	d.Status = WebhookDeliveryStatusDead
+}
+
+// Requeue gives a dead delivery a new round of attempts.
+func (d *WebhookDelivery) Requeue() error {
+	if d.Status != WebhookDeliveryStatusDead {
+		return ErrWebhookDeliveryNotDead
+	}
+	d.Status = WebhookDeliveryStatusPending
+	d.Failures = 0
+	d.NextAttemptAt = primitive.NewDateTimeFromTime(time.Now())
+	return nil
+}
+
+// RedactLeads removes the leads with the given IDs from the payload of a
+// lead.created delivery. A pending delivery left without leads is abandoned.
+func (d *WebhookDelivery) RedactLeads(ids []primitive.ObjectID) error {
+	var event struct {
+		Event
+		Data LeadsCreatedData `json:"data"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(d.Payload)))
+	// numbers are kept as they were written
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return err
+	}
+
+	erased := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		erased[id.Hex()] = true
+	}
+	event.Data.Leads = slices.DeleteFunc(event.Data.Leads, func(lead primitive.M) bool {
+		id, _ := lead["_id"].(string)
+		return erased[id]
+	})
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	d.Payload = string(payload)
+
+	if len(event.Data.Leads) == 0 && d.Status == WebhookDeliveryStatusPending {
+		d.Abandon("leads erased")
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package encryption
+
+import "context"
+
+// KeyManager wraps the data keys that encrypt the sensitive fields of leads
+// with a master key it never hands out, such as a key file or the key of a
+// KMS. Wrapped keys are stored next to the data they encrypt.
+type KeyManager interface {
+	Wrap(ctx *context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx *context.Context, wrapped []byte) ([]byte, error)
+}
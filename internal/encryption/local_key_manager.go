@@ -0,0 +1,49 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+)
+
+// wrapAdditionalData binds the wrapped keys to their purpose, so no other
+// ciphertext of the master key passes for a data key.
+var wrapAdditionalData = []byte("data key")
+
+// LocalKeyManager wraps data keys with a master key read from a local file,
+// for deployments without a KMS.
+type LocalKeyManager struct {
+	key []byte
+}
+
+func NewLocalKeyManager(key []byte) (*LocalKeyManager, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return &LocalKeyManager{key: key}, nil
+}
+
+// LoadLocalKeyManager reads the base64 encoded 32 byte master key of the file,
+// e.g. written by `openssl rand -base64 32`.
+func LoadLocalKeyManager(path string) (*LocalKeyManager, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLocalKeyManager(key)
+}
+
+func (km *LocalKeyManager) Wrap(_ *context.Context, dataKey []byte) ([]byte, error) {
+	return Seal(km.key, dataKey, wrapAdditionalData)
+}
+
+func (km *LocalKeyManager) Unwrap(_ *context.Context, wrapped []byte) ([]byte, error) {
+	return Open(km.key, wrapped, wrapAdditionalData)
+}
@@ -0,0 +1,85 @@
+package infrastructure
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/vitortenor/lead-stream-service/internal/configuration"
+	"github.com/vitortenor/lead-stream-service/internal/messaging"
+)
+
+func CreateEventPublisher(envConfig *configuration.Config) (messaging.EventPublisher, error) {
+	events := envConfig.Events
+	switch events.Broker {
+	case "kafka":
+		log.Println("Connecting to Kafka...")
+		return messaging.NewKafkaPublisher(&kafka.Writer{
+			Addr:                   kafka.TCP(events.Kafka.Brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		}), nil
+
+	case "nats":
+		log.Println("Connecting to NATS...")
+		conn, err := nats.Connect(events.Nats.URL)
+		if err != nil {
+			return nil, err
+		}
+		js, err := conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return messaging.NewNatsPublisher(conn, js), nil
+
+	case "memory":
+		return messaging.NewMemoryPublisher(), nil
+
+	default:
+		return nil, errors.New("unknown events broker: " + events.Broker)
+	}
+}
+
+// CreateEventConsumer subscribes to the topic as part of the consumer group,
+// so several instances share its messages.
+func CreateEventConsumer(envConfig *configuration.Config, topic string) (messaging.EventConsumer, error) {
+	events := envConfig.Events
+	group := envConfig.Consumers.Group
+	switch events.Broker {
+	case "kafka":
+		return messaging.NewKafkaConsumer(kafka.NewReader(kafka.ReaderConfig{
+			Brokers: events.Kafka.Brokers,
+			GroupID: group,
+			Topic:   topic,
+		})), nil
+
+	case "nats":
+		conn, err := nats.Connect(events.Nats.URL)
+		if err != nil {
+			return nil, err
+		}
+		js, err := conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// durable names can not hold the wildcards and dots of subjects
+		durable := strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(group + "_" + topic)
+		sub, err := js.PullSubscribe(topic, durable, nats.ManualAck())
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return messaging.NewNatsConsumer(sub), nil
+
+	case "memory":
+		return messaging.NewMemoryConsumer(), nil
+
+	default:
+		return nil, errors.New("unknown events broker: " + events.Broker)
+	}
+}
@@ -0,0 +1,21 @@
+package infrastructure
+
+import (
+	"errors"
+
+	"github.com/vitortenor/lead-stream-service/internal/configuration"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+)
+
+// CreateKeyManager returns the key manager that wraps the data keys of the
+// sensitive fields. Other KMS are supported by implementing
+// encryption.KeyManager and adding them here.
+func CreateKeyManager(envConfig *configuration.Config) (encryption.KeyManager, error) {
+	switch envConfig.Encryption.KeyManager {
+	case "local":
+		return encryption.LoadLocalKeyManager(envConfig.Encryption.KeyFile)
+
+	default:
+		return nil, errors.New("unknown encryption key manager: " + envConfig.Encryption.KeyManager)
+	}
+}
@@ -2,9 +2,13 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
 	"github.com/vitortenor/lead-stream-service/internal/configuration"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -24,26 +28,353 @@ func CreateConnection(ctx context.Context, envConfig *configuration.Config) (*mo
 
 	db := client.Database(envConfig.Database.Name)
 
+	err = assignDefaultTenant(ctx, db, envConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	err = createIndex(ctx, db.Collection(envConfig.Database.Collection["leads"]))
 	if err != nil {
 		return nil, err
 	}
 
+	err = createStagingIndex(ctx, db.Collection(repositories.StagingCollection(envConfig.Database.Collection["leads"])))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createImportIndex(ctx, db.Collection(envConfig.Database.Collection["imports"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createImportSourceIndex(ctx, db.Collection(envConfig.Database.Collection["import_sources"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createObjectIngestionIndex(ctx, db.Collection(envConfig.Database.Collection["object_ingestions"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createWebhookIndex(ctx, db.Collection(envConfig.Database.Collection["webhooks"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createWebhookDeliveryIndex(ctx, db.Collection(envConfig.Database.Collection["webhook_deliveries"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createExportIndex(ctx, db.Collection(envConfig.Database.Collection["exports"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createAPIKeyIndex(ctx, db.Collection(envConfig.Database.Collection["api_keys"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createOutboxIndex(ctx, db.Collection(envConfig.Database.Collection["outbox"]), envConfig.Events.Outbox.Retention.Std())
+	if err != nil {
+		return nil, err
+	}
+
+	err = createUsageIndex(ctx, db.Collection(envConfig.Database.Collection["usage"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createEncryptionKeyIndex(ctx, db.Collection(envConfig.Database.Collection["encryption_keys"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createSuppressionIndex(ctx, db.Collection(envConfig.Database.Collection["suppressions"]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createAuditIndex(ctx, db.Collection(envConfig.Database.Collection["audit"]))
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// CreateTenantDatabases returns the databases of the tenants: the database of
+// the service, or with the database tenancy mode one database per tenant,
+// indexed the first time it is used.
+func CreateTenantDatabases(envConfig *configuration.Config, db *mongo.Database) *repositories.TenantDatabases {
+	if envConfig.Tenancy.Mode != "database" {
+		return repositories.NewTenantDatabases(db, "", nil)
+	}
+
+	return repositories.NewTenantDatabases(db, envConfig.Tenancy.DatabasePrefix, func(ctx context.Context, tenantDb *mongo.Database) error {
+		err := createIndex(ctx, tenantDb.Collection(envConfig.Database.Collection["leads"]))
+		if err != nil {
+			return err
+		}
+
+		err = createStagingIndex(ctx, tenantDb.Collection(repositories.StagingCollection(envConfig.Database.Collection["leads"])))
+		if err != nil {
+			return err
+		}
+
+		return createImportIndex(ctx, tenantDb.Collection(envConfig.Database.Collection["imports"]))
+	})
+}
+
+// assignDefaultTenant hands the records written before tenants existed to
+// the default tenant.
+func assignDefaultTenant(ctx context.Context, db *mongo.Database, envConfig *configuration.Config) error {
+	for _, name := range []string{"schemas", "leads", "imports", "uploads", "import_sources", "webhooks", "webhook_deliveries", "exports", "api_keys"} {
+		_, err := db.Collection(envConfig.Database.Collection[name]).UpdateMany(ctx,
+			bson.M{"tenant_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"tenant_id": domain.DefaultTenant}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createIndex keeps email and telephone unique within each tenant. It drops
+// the unique indexes that spanned every tenant, so two tenants can hold the
+// same lead.
 func createIndex(ctx context.Context, collection *mongo.Collection) error {
+	for _, name := range []string{"email_1", "telephone_1"} {
+		_, err := collection.Indexes().DropOne(ctx, name)
+		var serverErr mongo.ServerError
+		// IndexNotFound and NamespaceNotFound, the index or the collection
+		// does not exist
+		if err != nil && !(errors.As(err, &serverErr) && (serverErr.HasErrorCode(27) || serverErr.HasErrorCode(26))) {
+			return err
+		}
+	}
+
 	var indexModel []mongo.IndexModel
 
 	indexModel = append(indexModel, mongo.IndexModel{
-		Keys:    bson.D{{Key: "email", Value: 1}},
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	indexModel = append(indexModel, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "telephone", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	})
 
 	indexModel = append(indexModel, mongo.IndexModel{
-		Keys:    bson.D{{Key: "telephone", Value: 1}},
+		Keys: bson.D{{Key: "import_id", Value: 1}},
+	})
+
+	// a lead consumed from a broker is written once however many times its
+	// message is delivered
+	indexModel = append(indexModel, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "message_id", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"message_id": bson.M{"$exists": true}}),
+	})
+
+	indexModel = append(indexModel, mongo.IndexModel{
+		Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "_id", Value: 1}},
+	})
+
+	// the retention of schemas is counted from created_at unless they name
+	// another field
+	indexModel = append(indexModel, mongo.IndexModel{
+		Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createStagingIndex only indexes the import of the staged leads, as their
+// email and phone are checked once they are published.
+func createStagingIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "import_id", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createExportIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "finished_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createAPIKeyIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createUsageIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createEncryptionKeyIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "purpose", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createSuppressionIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createAuditIndex keeps a single chained entry per position of the chain of
+// a tenant, so concurrent writers can not fork it.
+func createAuditIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"seq": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "entity_type", Value: 1}, {Key: "entity_id", Value: 1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createImportIndex lets a single import of a schema, or of each entry of an
+// archive, claim an idempotency key at once, so concurrent uploads with the
+// same key can not both be processed.
+func createImportIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "started_at", Value: -1}}},
+		{Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "checksum", Value: 1}}},
+		{Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "idempotency_key", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "schema_id", Value: 1}, {Key: "idempotency_key", Value: 1}, {Key: "entry", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_claimed": true}),
+		},
+		{Keys: bson.D{{Key: "source_id", Value: 1}, {Key: "started_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createObjectIngestionIndex makes each version of a bucket object claimable
+// only once.
+func createObjectIngestionIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "bucket", Value: 1}, {Key: "key", Value: 1}, {Key: "etag", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createImportSourceIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "enabled", Value: 1}, {Key: "next_run_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createWebhookIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "schema_id", Value: 1}, {Key: "events", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createWebhookDeliveryIndex(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createOutboxIndex(ctx context.Context, collection *mongo.Collection, retention time.Duration) error {
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+	}
+	if retention > 0 {
+		indexModel = append(indexModel, mongo.IndexModel{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		})
+	}
 
 	_, err := collection.Indexes().CreateMany(ctx, indexModel)
 	if err != nil {
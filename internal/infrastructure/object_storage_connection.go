@@ -0,0 +1,32 @@
+package infrastructure
+
+import (
+	"context"
+	"log"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/vitortenor/lead-stream-service/internal/configuration"
+)
+
+func CreateObjectStorageClient(ctx context.Context, envConfig *configuration.Config) (*minio.Client, error) {
+	log.Println("Connecting to object storage...")
+	storage := envConfig.ObjectStorage
+	client, err := minio.New(storage.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(storage.AccessKeyId, storage.SecretAccessKey, ""),
+		Secure: storage.UseSSL,
+		Region: storage.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, watch := range storage.Watches {
+		_, err := client.BucketExists(ctx, watch.Bucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	_ = t.Run("success, the key is only returned on create", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/api-keys", "application/json",
+			strings.NewReader(`{"name":"crm","scopes":["leads:read","leads:upload"]}`))
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			var created handlers.APIKeyResponseBody
+			if assert.Equal(t, http.StatusCreated, res.StatusCode) && assert.NoError(t, json.NewDecoder(res.Body).Decode(&created)) {
+				_ = assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+
+				get, err := http.Get(srv.URL + "/api-keys/" + created.ID)
+				if assert.NoError(t, err) {
+					defer get.Body.Close()
+					var found handlers.APIKeyResponseBody
+					_ = assert.NoError(t, json.NewDecoder(get.Body).Decode(&found))
+					_ = assert.Empty(t, found.Key)
+					_ = assert.Equal(t, []string{"leads:read", "leads:upload"}, found.Scopes)
+				}
+			}
+		}
+	})
+
+	_ = t.Run("success, revoke", func(t *testing.T) {
+		// arrange
+		res, err := http.Post(srv.URL+"/api-keys", "application/json", strings.NewReader(`{"name":"crm","scopes":["leads:read"]}`))
+		if err != nil {
+			t.Fatal("Failed to create API key:", err)
+		}
+		defer res.Body.Close()
+		var created handlers.APIKeyResponseBody
+		_ = json.NewDecoder(res.Body).Decode(&created)
+
+		// act
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api-keys/"+created.ID, nil)
+		revoke, err := http.DefaultClient.Do(req)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer revoke.Body.Close()
+			var revoked handlers.APIKeyResponseBody
+			if assert.Equal(t, http.StatusOK, revoke.StatusCode) && assert.NoError(t, json.NewDecoder(revoke.Body).Decode(&revoked)) {
+				_ = assert.NotEmpty(t, revoked.RevokedAt)
+			}
+		}
+	})
+
+	_ = t.Run("unknown scope", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/api-keys", "application/json", strings.NewReader(`{"name":"crm","scopes":["leads:delete"]}`))
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+		}
+	})
+}
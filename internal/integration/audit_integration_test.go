@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
+)
+
+func TestAuditHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	_ = t.Run("success, the changes of a request are found by its ID", func(t *testing.T) {
+		// arrange
+		body := `{"fields": [
+			{"name": "email", "type": "string", "required": true, "unique": true},
+			{"name": "phone", "type": "integer", "required": true, "unique": true}
+		]}`
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/schema", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(handlers.RequestIdHeader, "audit-test-1")
+		createRes, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Failed to create schema:", err)
+		}
+		defer createRes.Body.Close()
+
+		// act
+		res, err := http.Get(srv.URL + "/audit?request_id=audit-test-1")
+
+		// assert
+		_ = assert.Equal(t, http.StatusCreated, createRes.StatusCode)
+		_ = assert.Equal(t, "audit-test-1", createRes.Header.Get(handlers.RequestIdHeader))
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			var list handlers.AuditListResponse
+			if assert.Equal(t, http.StatusOK, res.StatusCode) && assert.NoError(t, json.NewDecoder(res.Body).Decode(&list.Body)) {
+				if assert.Len(t, list.Body.Entries, 1) {
+					entry := list.Body.Entries[0]
+					_ = assert.Equal(t, "schema.created", entry.Action)
+					_ = assert.Equal(t, "schema", entry.EntityType)
+					_ = assert.NotEmpty(t, entry.Hash)
+					if assert.Len(t, entry.Changes, 1) {
+						_ = assert.Equal(t, "fields", entry.Changes[0].Field)
+					}
+				}
+			}
+		}
+	})
+
+	_ = t.Run("success, the chain is valid", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/audit/verify")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			var verification handlers.AuditVerifyResponse
+			if assert.Equal(t, http.StatusOK, res.StatusCode) && assert.NoError(t, json.NewDecoder(res.Body).Decode(&verification.Body)) {
+				_ = assert.True(t, verification.Body.Valid)
+				_ = assert.Positive(t, verification.Body.Entries)
+			}
+		}
+	})
+
+	_ = t.Run("invalid time range", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/audit?from=yesterday")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
+	"github.com/vitortenor/lead-stream-service/internal/tools"
+)
+
+func TestDataSubjectHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	fileUrl := srv.URL + "/schema/67808a19c567c857d77d7f12/file"
+
+	exportSubject := func(t *testing.T, body string) int {
+		res, err := http.Post(srv.URL+"/data-subjects/export", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal("Failed to export data subject:", err)
+		}
+		defer res.Body.Close()
+		var resBody struct {
+			Count int `json:"count"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&resBody)
+		return resBody.Count
+	}
+
+	_ = t.Run("success, erased subjects are not imported again", func(t *testing.T) {
+		// arrange
+		if _, err := uploadFile(rootPath, fileUrl, "test_data_subject.csv"); err != nil {
+			t.Fatal("Failed to upload file:", err)
+		}
+		found := exportSubject(t, `{"email":"SUBJECT@test.com"}`)
+
+		// act
+		res, err := http.Post(srv.URL+"/data-subjects/erase", "application/json", strings.NewReader(`{"email":"subject@test.com"}`))
+
+		// assert
+		_ = assert.Equal(t, 1, found)
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			var erasure handlers.ErasureResponseBody
+			if assert.Equal(t, http.StatusOK, res.StatusCode) && assert.NoError(t, json.NewDecoder(res.Body).Decode(&erasure)) {
+				_ = assert.Equal(t, "delete", erasure.Mode)
+				_ = assert.Equal(t, int64(1), erasure.LeadsErased)
+			}
+		}
+
+		_, err = uploadFile(rootPath, fileUrl, "test_data_subject_reimport.csv")
+		_ = assert.NoError(t, err)
+		_ = assert.Zero(t, exportSubject(t, `{"phone":"987654321"}`))
+		_ = assert.Equal(t, 1, exportSubject(t, `{"phone":"987654322"}`))
+	})
+
+	_ = t.Run("neither email nor phone", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/data-subjects/erase", "application/json", strings.NewReader(`{"mode":"anonymize"}`))
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/tools"
+)
+
+func TestExportHandler_Export(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+	exportUrl := srv.URL + "/schema/" + schemaId + "/leads/export"
+
+	_ = t.Run("success, csv follows the schema", func(t *testing.T) {
+		// arrange
+		importId, err := uploadFile(rootPath, srv.URL+"/schema/"+schemaId+"/file", "test_file_handler_success.csv")
+		if err != nil {
+			t.Fatal("Failed to upload file:", err)
+		}
+
+		// act
+		res, err := http.Get(exportUrl + "?format=csv&import_id=" + importId + "&filter=phone:123456789")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				body, _ := io.ReadAll(res.Body)
+				lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+				_ = assert.Equal(t, "text/csv", res.Header.Get("Content-Type"))
+				if assert.Len(t, lines, 2) {
+					_ = assert.Equal(t, "_id,email,name,phone,lastname,import_id,created_at,updated_at", lines[0])
+					_ = assert.Contains(t, lines[1], ",test@test.com,Test,123456789,,"+importId+",")
+				}
+			}
+		}
+	})
+
+	_ = t.Run("field not in the schema", func(t *testing.T) {
+		// act
+		res, err := http.Get(exportUrl + "?format=ndjson&filter=city:Paris")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+
+	_ = t.Run("background export is not ready right away", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/schema/"+schemaId+"/leads/exports", "application/json", strings.NewReader(`{"format":"parquet"}`))
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusAccepted, res.StatusCode) {
+				var resBody struct {
+					ID     string `json:"id"`
+					Status string `json:"status"`
+				}
+				_ = json.NewDecoder(res.Body).Decode(&resBody)
+				_ = assert.Equal(t, "pending", resBody.Status)
+
+				download, err := http.Get(srv.URL + "/exports/" + resBody.ID + "/download")
+				if assert.NoError(t, err) {
+					defer download.Body.Close()
+					_ = assert.Equal(t, http.StatusConflict, download.StatusCode)
+				}
+			}
+		}
+	})
+}
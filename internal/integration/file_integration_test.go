@@ -57,11 +57,13 @@ func TestFileHandler_Upload(t *testing.T) {
 		if assert.NoError(t, err) {
 			if assert.Equal(t, http.StatusOK, res.StatusCode) {
 				var resBody struct {
-					Message string `json:"message"`
+					Message  string `json:"message"`
+					ImportId string `json:"import_id"`
 				}
 				body, _ := io.ReadAll(res.Body)
 				_ = json.Unmarshal(body, &resBody)
 				_ = assert.Equal(t, "File uploaded successfully", resBody.Message)
+				_ = assert.NotEmpty(t, resBody.ImportId)
 			}
 		}
 	})
@@ -288,6 +290,163 @@ func TestFileHandler_Upload(t *testing.T) {
 			}
 		}
 	})
+
+	_ = t.Run("zip archive, each entry is its own import", func(t *testing.T) {
+		// arrange
+		file, err := openFile(rootPath, "test_file_handler_archive.zip")
+		if err != nil {
+			t.Fatal("Failed to open test file:", err)
+		}
+		defer file.Close()
+
+		urlWithParams := strings.Replace(fileUrl, "{schemaId}", schemaId, 1)
+
+		body, contentType, err := createMultipartForm(file)
+		if err != nil {
+			t.Fatal("Failed to create multipart form:", err)
+		}
+
+		// act
+		res, err := makeRequest(urlWithParams, contentType, &body)
+		if err != nil {
+			t.Fatal("Failed to perform request:", err)
+		}
+		defer res.Body.Close()
+
+		// assert
+		if assert.NoError(t, err) {
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					Results []struct {
+						Entry  string `json:"entry"`
+						Status string `json:"status"`
+						Error  string `json:"error"`
+					} `json:"results"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				if assert.Len(t, resBody.Results, 2) {
+					_ = assert.Equal(t, "first.csv", resBody.Results[0].Entry)
+					_ = assert.Equal(t, "completed", resBody.Results[0].Status)
+					_ = assert.Equal(t, "second.csv", resBody.Results[1].Entry)
+					_ = assert.Equal(t, "failed", resBody.Results[1].Status)
+					_ = assert.Equal(t, "required fields missing", resBody.Results[1].Error)
+				}
+			}
+		}
+	})
+
+	_ = t.Run("multiple files, each has its own result", func(t *testing.T) {
+		// arrange
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, content := range map[string]string{
+			"first.csv":  "email,phone,name\nmulti-first@test.com,333333333,First\n",
+			"second.csv": "email,phone,lastname\nmulti-second@test.com,444444444,Second\n",
+		} {
+			part, err := writer.CreateFormFile("file", name)
+			if err != nil {
+				t.Fatal("Failed to create multipart form:", err)
+			}
+			_, _ = part.Write([]byte(content))
+		}
+		_ = writer.Close()
+
+		urlWithParams := strings.Replace(fileUrl, "{schemaId}", schemaId, 1)
+
+		// act
+		res, err := makeRequest(urlWithParams, writer.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatal("Failed to perform request:", err)
+		}
+		defer res.Body.Close()
+
+		// assert
+		if assert.NoError(t, err) {
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					Results []struct {
+						FileName string `json:"file_name"`
+						Status   string `json:"status"`
+						Error    string `json:"error"`
+					} `json:"results"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				if assert.Len(t, resBody.Results, 2) {
+					statuses := make(map[string]string)
+					for _, result := range resBody.Results {
+						statuses[result.FileName] = result.Status
+					}
+					_ = assert.Equal(t, "completed", statuses["first.csv"])
+					_ = assert.Equal(t, "failed", statuses["second.csv"])
+				}
+			}
+		}
+	})
+
+	_ = t.Run("missing file part", func(t *testing.T) {
+		// arrange
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		_ = writer.WriteField("name", "leads")
+		_ = writer.Close()
+
+		urlWithParams := strings.Replace(fileUrl, "{schemaId}", schemaId, 1)
+
+		// act
+		res, err := makeRequest(urlWithParams, writer.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatal("Failed to perform request:", err)
+		}
+		defer res.Body.Close()
+
+		// assert
+		if assert.NoError(t, err) {
+			if assert.Equal(t, http.StatusBadRequest, res.StatusCode) {
+				var body huma.ErrorModel
+				_ = json.NewDecoder(res.Body).Decode(&body)
+				_ = assert.Equal(t, "file missing", body.Detail)
+			}
+		}
+	})
+
+	_ = t.Run("repeated upload returns the original import", func(t *testing.T) {
+		// arrange
+		file, err := openFile(rootPath, "test_file_handler_success.csv")
+		if err != nil {
+			t.Fatal("Failed to open test file:", err)
+		}
+		defer file.Close()
+
+		urlWithParams := strings.Replace(fileUrl, "{schemaId}", schemaId, 1)
+
+		body, contentType, err := createMultipartForm(file)
+		if err != nil {
+			t.Fatal("Failed to create multipart form:", err)
+		}
+
+		// act
+		res, err := makeRequest(urlWithParams, contentType, &body)
+		if err != nil {
+			t.Fatal("Failed to perform request:", err)
+		}
+		defer res.Body.Close()
+
+		// assert
+		if assert.NoError(t, err) {
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					ImportId string `json:"import_id"`
+					Replayed bool   `json:"replayed"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				_ = assert.NotEmpty(t, resBody.ImportId)
+				_ = assert.True(t, resBody.Replayed)
+			}
+		}
+	})
 }
 
 func openFile(rootPath, fileName string) (*os.File, error) {
@@ -0,0 +1,277 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/tools"
+)
+
+func TestImportHandler_Get(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+	fileUrl := strings.Replace(srv.URL+"/schema/{schemaId}/file", "{schemaId}", schemaId, 1)
+
+	_ = t.Run("success", func(t *testing.T) {
+		// arrange
+		importId, err := uploadFile(rootPath, fileUrl, "test_file_handler_success.csv")
+		if err != nil {
+			t.Fatal("Failed to upload file:", err)
+		}
+
+		// act
+		res, err := http.Get(srv.URL + "/imports/" + importId)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					ID           string `json:"id"`
+					SchemaId     string `json:"schema_id"`
+					FileName     string `json:"file_name"`
+					Checksum     string `json:"checksum"`
+					Status       string `json:"status"`
+					RowsRead     int    `json:"rows_read"`
+					RowsInserted int    `json:"rows_inserted"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				_ = assert.Equal(t, importId, resBody.ID)
+				_ = assert.Equal(t, schemaId, resBody.SchemaId)
+				_ = assert.Equal(t, "test_file_handler_success.csv", resBody.FileName)
+				_ = assert.Len(t, resBody.Checksum, 64)
+				_ = assert.Equal(t, "completed", resBody.Status)
+				_ = assert.Equal(t, 1, resBody.RowsRead)
+				_ = assert.Equal(t, 1, resBody.RowsInserted)
+			}
+		}
+	})
+
+	_ = t.Run("non existent import", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/imports/67699e3d7887d75bb8523702")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusNotFound, res.StatusCode) {
+				var body huma.ErrorModel
+				_ = json.NewDecoder(res.Body).Decode(&body)
+				_ = assert.Equal(t, "mongo: no documents in result", body.Detail)
+			}
+		}
+	})
+}
+
+func TestImportHandler_ListBySchema(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+	fileUrl := strings.Replace(srv.URL+"/schema/{schemaId}/file", "{schemaId}", schemaId, 1)
+
+	_ = t.Run("success, failed uploads are recorded too", func(t *testing.T) {
+		// arrange
+		_, _ = uploadFile(rootPath, fileUrl, "test_file_handler_fail_3.csv")
+
+		// act
+		res, err := http.Get(srv.URL + "/schema/" + schemaId + "/imports")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					Imports []struct {
+						Status string `json:"status"`
+						Error  string `json:"error"`
+					} `json:"imports"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				if assert.Len(t, resBody.Imports, 1) {
+					_ = assert.Equal(t, "failed", resBody.Imports[0].Status)
+					_ = assert.Equal(t, "duplicated value", resBody.Imports[0].Error)
+				}
+			}
+		}
+	})
+
+	_ = t.Run("non existent schema", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/schema/67699e3d7887d75bb8523702/imports")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		}
+	})
+}
+
+func TestImportHandler_Rollback(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+	fileUrl := strings.Replace(srv.URL+"/schema/{schemaId}/file", "{schemaId}", schemaId, 1)
+
+	importId, err := uploadFile(rootPath, fileUrl, "test_file_handler_success.csv")
+	if err != nil {
+		t.Fatal("Failed to upload file:", err)
+	}
+	rollbackUrl := srv.URL + "/imports/" + importId + "/rollback"
+
+	_ = t.Run("success", func(t *testing.T) {
+		// act
+		res, err := http.Post(rollbackUrl, "", nil)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					Status      string `json:"status"`
+					RowsDeleted int64  `json:"rows_deleted"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				_ = assert.Equal(t, "rolled_back", resBody.Status)
+				_ = assert.Equal(t, int64(1), resBody.RowsDeleted)
+			}
+		}
+	})
+
+	_ = t.Run("already rolled back", func(t *testing.T) {
+		// act
+		res, err := http.Post(rollbackUrl, "", nil)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusConflict, res.StatusCode) {
+				var body huma.ErrorModel
+				_ = json.NewDecoder(res.Body).Decode(&body)
+				_ = assert.Equal(t, "import already rolled back", body.Detail)
+			}
+		}
+	})
+
+	_ = t.Run("same file can be uploaded again after rollback", func(t *testing.T) {
+		// act
+		newImportId, err := uploadFile(rootPath, fileUrl, "test_file_handler_success.csv")
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.NotEmpty(t, newImportId)
+			_ = assert.NotEqual(t, importId, newImportId)
+		}
+	})
+}
+
+func uploadFile(rootPath, url, fileName string) (string, error) {
+	file, err := openFile(rootPath, fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	body, contentType, err := createMultipartForm(file)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := makeRequest(url, contentType, &body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var resBody struct {
+		ImportId string `json:"import_id"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&resBody)
+	if err != nil {
+		return "", err
+	}
+
+	return resBody.ImportId, nil
+}
+
+func TestImportHandler_StreamProgress(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+	fileUrl := strings.Replace(srv.URL+"/schema/{schemaId}/file", "{schemaId}", schemaId, 1)
+
+	_ = t.Run("finished import ends the stream", func(t *testing.T) {
+		// arrange
+		importId, err := uploadFile(rootPath, fileUrl, "test_file_handler_success.csv")
+		if err != nil {
+			t.Fatal("Failed to upload file:", err)
+		}
+
+		// act
+		res, err := http.Get(srv.URL + "/imports/" + importId + "/progress")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				body, _ := io.ReadAll(res.Body)
+				_ = assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+				_ = assert.Contains(t, string(body), "event: progress\n")
+				_ = assert.Contains(t, string(body), `"status":"completed"`)
+				_ = assert.Contains(t, string(body), `"rows_valid":1`)
+			}
+		}
+	})
+
+	_ = t.Run("non existent import", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/imports/67699e3d7887d75bb8523702/progress")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		}
+	})
+}
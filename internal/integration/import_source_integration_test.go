@@ -0,0 +1,172 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportSourceHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	remote := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("email,phone,name\nsource@test.com,555555555,Source\n"))
+	}))
+	defer remote.Close()
+
+	schemaId := "67808a19c567c857d77d7f12"
+	sourcesUrl := srv.URL + "/schema/" + schemaId + "/import-sources"
+
+	_ = t.Run("success, the source is created and run", func(t *testing.T) {
+		// arrange
+		source, err := postJSON(sourcesUrl, map[string]any{
+			"url":      remote.URL + "/leads.csv",
+			"schedule": "0 6 * * *",
+			"mode":     "append",
+			"enabled":  true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		defer source.Body.Close()
+		var created struct {
+			ID        string `json:"id"`
+			NextRunAt string `json:"next_run_at"`
+		}
+		_ = json.NewDecoder(source.Body).Decode(&created)
+
+		// act
+		first, err := postJSON(srv.URL+"/import-sources/"+created.ID+"/run", nil)
+		if err != nil {
+			t.Fatal("Failed to run import source:", err)
+		}
+		defer first.Body.Close()
+		second, err := postJSON(srv.URL+"/import-sources/"+created.ID+"/run", nil)
+		if err != nil {
+			t.Fatal("Failed to run import source:", err)
+		}
+		defer second.Body.Close()
+
+		// assert
+		_ = assert.Equal(t, http.StatusCreated, source.StatusCode)
+		_ = assert.NotEmpty(t, created.NextRunAt)
+		if assert.Equal(t, http.StatusOK, first.StatusCode) && assert.Equal(t, http.StatusOK, second.StatusCode) {
+			var firstBody, secondBody struct {
+				Results []struct {
+					Status       string `json:"status"`
+					RowsInserted int    `json:"rows_inserted"`
+				} `json:"results"`
+			}
+			_ = json.NewDecoder(first.Body).Decode(&firstBody)
+			_ = json.NewDecoder(second.Body).Decode(&secondBody)
+			if assert.Len(t, firstBody.Results, 1) && assert.Len(t, secondBody.Results, 1) {
+				_ = assert.Equal(t, "completed", firstBody.Results[0].Status)
+				_ = assert.Equal(t, 1, firstBody.Results[0].RowsInserted)
+				_ = assert.Equal(t, "skipped", secondBody.Results[0].Status)
+			}
+		}
+	})
+
+	_ = t.Run("invalid mode", func(t *testing.T) {
+		// act
+		res, err := postJSON(sourcesUrl, map[string]any{
+			"url":      remote.URL + "/leads.csv",
+			"schedule": "0 6 * * *",
+			"mode":     "merge",
+			"enabled":  true,
+		})
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+		}
+	})
+
+	_ = t.Run("invalid schedule", func(t *testing.T) {
+		// act
+		res, err := postJSON(sourcesUrl, map[string]any{
+			"url":      remote.URL + "/leads.csv",
+			"schedule": "every day",
+			"mode":     "append",
+			"enabled":  true,
+		})
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusBadRequest, res.StatusCode) {
+				var body huma.ErrorModel
+				_ = json.NewDecoder(res.Body).Decode(&body)
+				_ = assert.Contains(t, body.Detail, "invalid import source")
+			}
+		}
+	})
+
+	_ = t.Run("delete", func(t *testing.T) {
+		// arrange
+		source, err := postJSON(sourcesUrl, map[string]any{
+			"url":      remote.URL + "/leads.csv",
+			"schedule": "0 6 * * *",
+			"mode":     "replace",
+			"enabled":  false,
+		})
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		defer source.Body.Close()
+		var created struct {
+			ID string `json:"id"`
+		}
+		_ = json.NewDecoder(source.Body).Decode(&created)
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/import-sources/"+created.ID, nil)
+
+		// act
+		res, err := http.DefaultClient.Do(req)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusNoContent, res.StatusCode)
+			get, err := http.Get(srv.URL + "/import-sources/" + created.ID)
+			if assert.NoError(t, err) {
+				defer get.Body.Close()
+				_ = assert.Equal(t, http.StatusNotFound, get.StatusCode)
+			}
+		}
+	})
+}
+
+func postJSON(url string, body any) (*http.Response, error) {
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	return http.DefaultClient.Do(req)
+}
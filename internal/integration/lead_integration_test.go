@@ -0,0 +1,56 @@
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The streams themselves need MongoDB to run as a replica set, so only the
+// requests rejected before a stream is opened are covered here.
+func TestLeadHandler_Stream(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+
+	_ = t.Run("invalid resume token", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/schema/" + schemaId + "/leads/stream?resume_token=not-a-token")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+
+	_ = t.Run("websocket from another origin", func(t *testing.T) {
+		// arrange
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/schema/"+schemaId+"/leads/ws", nil)
+		req.Header.Set("Origin", "https://attacker.example")
+
+		// act
+		res, err := http.DefaultClient.Do(req)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		}
+	})
+
+	_ = t.Run("schema not found", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/schema/67808a19c567c857d77d7f13/leads/ws")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		}
+	})
+}
@@ -60,6 +60,111 @@ func TestSchemaHandler_Create(t *testing.T) {
 		}
 	})
 
+	_ = t.Run("success - sensitive fields", func(t *testing.T) {
+		// arrange
+		var reqBody = `
+		{
+			"fields": [
+				{
+					"name": "email",
+					"type": "string",
+					"required": true,
+					"unique": true,
+					"sensitive": true
+				},
+				{
+					"name": "phone",
+					"type": "integer",
+					"required": true,
+					"unique": true
+				}
+			]
+		}
+		`
+		// act
+		res, err := http.Post(schemaUrl, echo.MIMEApplicationJSON, bytes.NewBufferString(reqBody))
+
+		// assert
+		if assert.NoError(t, err) {
+			if assert.Equal(t, http.StatusCreated, res.StatusCode) {
+				var resBody struct {
+					Fields []struct {
+						Name      string `json:"name"`
+						Sensitive bool   `json:"sensitive"`
+					} `json:"fields"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				if assert.Len(t, resBody.Fields, 2) {
+					_ = assert.True(t, resBody.Fields[0].Sensitive)
+					_ = assert.False(t, resBody.Fields[1].Sensitive)
+				}
+			}
+		}
+	})
+
+	_ = t.Run("success - retention", func(t *testing.T) {
+		// arrange
+		var reqBody = `
+		{
+			"fields": [
+				{"name": "email", "type": "string", "required": true, "unique": true},
+				{"name": "phone", "type": "integer", "required": true, "unique": true},
+				{"name": "signed_up_at", "type": "datetime"}
+			],
+			"retention": {"days": 365, "field": "signed_up_at"}
+		}
+		`
+		// act
+		res, err := http.Post(schemaUrl, echo.MIMEApplicationJSON, bytes.NewBufferString(reqBody))
+
+		// assert
+		if assert.NoError(t, err) {
+			if assert.Equal(t, http.StatusCreated, res.StatusCode) {
+				var resBody struct {
+					ID        string `json:"id"`
+					Retention struct {
+						Days  int    `json:"days"`
+						Field string `json:"field"`
+					} `json:"retention"`
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = json.Unmarshal(body, &resBody)
+				_ = assert.Equal(t, 365, resBody.Retention.Days)
+				_ = assert.Equal(t, "signed_up_at", resBody.Retention.Field)
+
+				req, _ := http.NewRequest(http.MethodDelete, schemaUrl+"/"+resBody.ID+"/retention", nil)
+				deleteRes, err := http.DefaultClient.Do(req)
+				if assert.NoError(t, err) {
+					defer deleteRes.Body.Close()
+					deleted, _ := io.ReadAll(deleteRes.Body)
+					_ = assert.Equal(t, http.StatusOK, deleteRes.StatusCode)
+					_ = assert.NotContains(t, string(deleted), "retention")
+				}
+			}
+		}
+	})
+
+	_ = t.Run("invalid body - retention field not a datetime", func(t *testing.T) {
+		// arrange
+		var reqBody = `
+		{
+			"fields": [
+				{"name": "email", "type": "string", "required": true, "unique": true},
+				{"name": "phone", "type": "integer", "required": true, "unique": true}
+			],
+			"retention": {"days": 30, "field": "phone"}
+		}
+		`
+		// act
+		res, err := http.Post(schemaUrl, echo.MIMEApplicationJSON, bytes.NewBufferString(reqBody))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+
 	_ = t.Run("invalid body - invalid field type", func(t *testing.T) {
 		// arrange
 		var reqBody = `
@@ -2,8 +2,11 @@ package integration
 
 import (
 	"context"
+	"crypto/x509"
 	"log"
+	"net/http"
 	"net/http/httptest"
+	"os"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -15,6 +18,7 @@ import (
 	"github.com/vitortenor/lead-stream-service/internal/api"
 	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
 	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
 	"github.com/vitortenor/lead-stream-service/internal/repositories"
 	"github.com/vitortenor/lead-stream-service/internal/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,6 +26,17 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// remoteFileRoots trusts the certificate every httptest TLS server shares, so
+// import sources can fetch the files they serve.
+func remoteFileRoots() *x509.CertPool {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return roots
+}
+
 func InitServerTest() (*httptest.Server, error) {
 	ctx := context.Background()
 
@@ -53,6 +68,7 @@ func InitServerTest() (*httptest.Server, error) {
 	}
 
 	db := client.Database("lead-stream-service-test")
+	tenantDbs := repositories.NewTenantDatabases(db, "", nil)
 	log.Println("Connected to in-memory database")
 
 	err = seed(&ctx, db.Collection("schemas"), createSchema())
@@ -60,23 +76,157 @@ func InitServerTest() (*httptest.Server, error) {
 		return nil, err
 	}
 
+	masterKey, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	keyManager, err := encryption.NewLocalKeyManager(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leadCipher := services.NewLeadCipher(keyManager, repositories.NewEncryptionKeyRepository("encryption_keys", db))
+
+	auditService := services.NewAuditService(
+		repositories.NewAuditRepository("audit", db),
+		services.AuditOptions{HashChain: true},
+	)
+	auditHandler := handlers.NewAuditHandler(auditService)
+
 	schemaHandler := handlers.NewSchemaHandler(
 		services.NewSchemaService(
-			repositories.NewSchemaRepository("schemas", db),
+			repositories.NewSchemaRepository("schemas", tenantDbs),
+			leadCipher,
+			auditService,
+		),
+	)
+
+	webhookService := services.NewWebhookService(
+		repositories.NewSchemaRepository("schemas", tenantDbs),
+		repositories.NewWebhookRepository("webhooks", db),
+		repositories.NewWebhookDeliveryRepository("webhook_deliveries", db),
+		leadCipher,
+		services.WebhookOptions{Timeout: time.Second, MaxAttempts: 3, Backoff: time.Second, MaxBackoff: time.Minute, Workers: 1,
+			AllowPrivateNetworks: true, RootCAs: remoteFileRoots()},
+	)
+
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+
+	quotaService := services.NewQuotaService(
+		repositories.NewUsageRepository("usage", db),
+		repositories.NewImportRepository("imports", tenantDbs),
+		services.QuotaOptions{Defaults: domain.Limits{MaxFileSize: 10 * 1024 * 1024}, StaleImportAfter: time.Hour},
+	)
+
+	usageHandler := handlers.NewUsageHandler(quotaService)
+
+	fileService := services.NewFileService(
+		repositories.NewSchemaRepository("schemas", tenantDbs),
+		repositories.NewLeadRepository("leads", tenantDbs),
+		repositories.NewImportRepository("imports", tenantDbs),
+		repositories.NewSuppressionRepository("suppressions", db),
+		webhookService,
+		quotaService,
+		leadCipher,
+		auditService,
+		services.IngestionOptions{
+			BatchSize:            1000,
+			IdempotencyRetention: time.Hour,
+			StaleImportAfter:     time.Hour,
+			MaxUncompressedSize:  1024 * 1024,
+			MaxArchiveEntries:    5,
+			ProgressInterval:     time.Second,
+		},
+	)
+
+	fileHandler := handlers.NewFileHandler(fileService)
+
+	importService := services.NewImportService(
+		repositories.NewTenantRepository("schemas", tenantDbs),
+		repositories.NewSchemaRepository("schemas", tenantDbs),
+		repositories.NewLeadRepository("leads", tenantDbs),
+		repositories.NewImportRepository("imports", tenantDbs),
+		auditService,
+	)
+
+	importHandler := handlers.NewImportHandler(importService, time.Second)
+
+	uploadHandler := handlers.NewUploadHandler(
+		services.NewUploadService(
+			repositories.NewSchemaRepository("schemas", tenantDbs),
+			repositories.NewUploadRepository("uploads", db),
+			fileService,
+			services.UploadOptions{Dir: os.TempDir(), Timeout: time.Hour},
+		),
+		1024*1024,
+	)
+
+	importSourceHandler := handlers.NewImportSourceHandler(
+		services.NewImportSourceService(
+			repositories.NewSchemaRepository("schemas", tenantDbs),
+			repositories.NewImportSourceRepository("import_sources", db),
+			repositories.NewImportRepository("imports", tenantDbs),
+			fileService,
+			importService,
+			leadCipher,
+			services.ImportSourceOptions{Dir: os.TempDir(), Timeout: time.Minute, MaxSize: 1024 * 1024,
+				AllowPrivateNetworks: true, RootCAs: remoteFileRoots()},
+		),
+	)
+
+	leadHandler := handlers.NewLeadHandler(
+		services.NewLeadService(
+			repositories.NewSchemaRepository("schemas", tenantDbs),
+			repositories.NewLeadRepository("leads", tenantDbs),
+			leadCipher,
+			auditService,
+		),
+		nil,
+	)
+
+	exportService := services.NewExportService(
+		repositories.NewSchemaRepository("schemas", tenantDbs),
+		repositories.NewLeadRepository("leads", tenantDbs),
+		repositories.NewExportRepository("exports", db),
+		leadCipher,
+		services.ExportOptions{Dir: os.TempDir(), Lease: time.Hour, Retention: time.Hour},
+	)
+
+	exportHandler := handlers.NewExportHandler(exportService)
+
+	dataSubjectHandler := handlers.NewDataSubjectHandler(
+		services.NewDataSubjectService(
+			repositories.NewLeadRepository("leads", tenantDbs),
+			repositories.NewSuppressionRepository("suppressions", db),
+			repositories.NewErasureRepository("erasures", db),
+			repositories.NewOutboxRepository("outbox", db),
+			repositories.NewWebhookDeliveryRepository("webhook_deliveries", db),
+			leadCipher,
+			auditService,
+		),
+	)
+
+	suppressionHandler := handlers.NewSuppressionHandler(
+		services.NewSuppressionService(
+			repositories.NewSuppressionRepository("suppressions", db),
+			leadCipher,
 		),
 	)
 
-	fileHandler := handlers.NewFileHandler(
-		services.NewFileService(
-			repositories.NewSchemaRepository("schemas", db),
-			repositories.NewLeadRepository("leads", db),
+	apiKeyHandler := handlers.NewAPIKeyHandler(
+		services.NewAPIKeyService(
+			repositories.NewAPIKeyRepository("api_keys", db),
 		),
 	)
 
 	e := echo.New()
 	humaApi := humaecho.New(e, huma.DefaultConfig("api", "v1"))
 
-	api.InitRoutes(humaApi, schemaHandler, fileHandler)
+	api.InitRequestId(humaApi)
+	api.InitAuth(humaApi, nil)
+	api.InitRateLimit(humaApi, quotaService)
+	api.InitRoutes(humaApi, apiKeyHandler, usageHandler, schemaHandler, fileHandler, importHandler, uploadHandler, importSourceHandler, webhookHandler, leadHandler, exportHandler, dataSubjectHandler, suppressionHandler, auditHandler)
+	api.InitWebSocketRoutes(e, leadHandler, nil, quotaService)
 
 	ts := httptest.NewServer(e)
 
@@ -126,6 +276,7 @@ func createSchema() []domain.Schema {
 
 	schema := domain.Schema{
 		ID:        objectId,
+		TenantId:  domain.DefaultTenant,
 		Fields:    schemaFields,
 		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
 		UpdatedAt: primitive.NewDateTimeFromTime(time.Now()),
@@ -0,0 +1,153 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
+	"github.com/vitortenor/lead-stream-service/internal/tools"
+)
+
+func TestSuppressionHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+
+	upload := func(t *testing.T, url, fileName string) *http.Response {
+		file, err := openFile(rootPath, fileName)
+		if err != nil {
+			t.Fatal("Failed to open file:", err)
+		}
+		defer file.Close()
+
+		body, contentType, err := createMultipartForm(file)
+		if err != nil {
+			t.Fatal("Failed to create multipart form:", err)
+		}
+
+		res, err := makeRequest(url, contentType, &body)
+		if err != nil {
+			t.Fatal("Failed to upload file:", err)
+		}
+		return res
+	}
+
+	_ = t.Run("success, listed emails and phones are left out of imports", func(t *testing.T) {
+		// arrange
+		listRes := upload(t, srv.URL+"/suppressions/bulk", "test_suppression_list.csv")
+		defer listRes.Body.Close()
+
+		// act
+		leadsRes := upload(t, srv.URL+"/schema/"+schemaId+"/file", "test_suppression_leads.csv")
+		defer leadsRes.Body.Close()
+
+		// assert
+		var list handlers.SuppressionUploadResponse
+		if assert.Equal(t, http.StatusOK, listRes.StatusCode) && assert.NoError(t, json.NewDecoder(listRes.Body).Decode(&list.Body)) {
+			_ = assert.Equal(t, 3, list.Body.RowsRead)
+			_ = assert.Equal(t, 1, list.Body.RowsRejected)
+			_ = assert.Equal(t, int64(2), list.Body.Suppressed)
+		}
+
+		var leads handlers.FileResponse
+		if assert.Equal(t, http.StatusOK, leadsRes.StatusCode) && assert.NoError(t, json.NewDecoder(leadsRes.Body).Decode(&leads.Body)) {
+			_ = assert.Equal(t, 1, leads.Body.Results[0].RowsInserted)
+			_ = assert.Equal(t, 2, leads.Body.Results[0].RowsSuppressed)
+		}
+	})
+
+	_ = t.Run("success, leads are exported by their consent", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/schema/" + schemaId + "/leads/export?format=csv&filter=consent_channel:email" +
+			"&consented_from=2023-11-14T00:00:00Z&consented_to=2023-11-15T00:00:00Z")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				body, _ := io.ReadAll(res.Body)
+				lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+				if assert.Len(t, lines, 2) {
+					_ = assert.Contains(t, lines[1], ",consented@test.com,")
+				}
+			}
+		}
+	})
+
+	_ = t.Run("success, a suppression is created, found and deleted", func(t *testing.T) {
+		// arrange
+		body := `{"kind":"email","value":"Single@test.com","reason":"bounce"}`
+		createRes, err := http.Post(srv.URL+"/suppressions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal("Failed to create suppression:", err)
+		}
+		defer createRes.Body.Close()
+		var created handlers.SuppressionResponseBody
+		_ = json.NewDecoder(createRes.Body).Decode(&created)
+
+		againRes, err := http.Post(srv.URL+"/suppressions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal("Failed to create suppression:", err)
+		}
+		defer againRes.Body.Close()
+
+		// act
+		listRes, err := http.Get(srv.URL + "/suppressions?kind=email&value=" + url.QueryEscape("single@TEST.com"))
+		if err != nil {
+			t.Fatal("Failed to list suppressions:", err)
+		}
+		defer listRes.Body.Close()
+
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/suppressions/"+created.ID, nil)
+		deleteRes, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Failed to delete suppression:", err)
+		}
+		defer deleteRes.Body.Close()
+
+		getRes, err := http.Get(srv.URL + "/suppressions/" + created.ID)
+		if err != nil {
+			t.Fatal("Failed to get suppression:", err)
+		}
+		defer getRes.Body.Close()
+
+		// assert
+		_ = assert.Equal(t, http.StatusCreated, createRes.StatusCode)
+		_ = assert.Equal(t, "bounce", created.Reason)
+		_ = assert.Equal(t, http.StatusOK, againRes.StatusCode)
+
+		var list handlers.SuppressionListResponse
+		if assert.Equal(t, http.StatusOK, listRes.StatusCode) && assert.NoError(t, json.NewDecoder(listRes.Body).Decode(&list.Body)) {
+			if assert.Len(t, list.Body.Suppressions, 1) {
+				_ = assert.Equal(t, created.ID, list.Body.Suppressions[0].ID)
+			}
+		}
+
+		_ = assert.Equal(t, http.StatusNoContent, deleteRes.StatusCode)
+		_ = assert.Equal(t, http.StatusNotFound, getRes.StatusCode)
+	})
+
+	_ = t.Run("phone without digits", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/suppressions", "application/json", strings.NewReader(`{"kind":"phone","value":"none"}`))
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		}
+	})
+}
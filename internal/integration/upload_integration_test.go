@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/tools"
+)
+
+func TestUploadHandler_Resumable(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	file, err := openFile(rootPath, "test_file_handler_success.csv")
+	if err != nil {
+		t.Fatal("Failed to open test file:", err)
+	}
+	defer file.Close()
+	content, err := readAll(file)
+	if err != nil {
+		t.Fatal("Failed to read test file:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+
+	var upload struct {
+		ID       string `json:"id"`
+		Offset   int64  `json:"offset"`
+		Size     int64  `json:"size"`
+		Status   string `json:"status"`
+		ImportId string `json:"import_id"`
+	}
+
+	_ = t.Run("create upload session", func(t *testing.T) {
+		// arrange
+		reqBody := `{"file_name": "leads.csv", "size": ` + strconv.Itoa(len(content)) + `}`
+
+		// act
+		res, err := http.Post(srv.URL+"/schema/"+schemaId+"/uploads", echo.MIMEApplicationJSON, bytes.NewBufferString(reqBody))
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusCreated, res.StatusCode) {
+				_ = json.NewDecoder(res.Body).Decode(&upload)
+				_ = assert.NotEmpty(t, upload.ID)
+				_ = assert.Equal(t, int64(0), upload.Offset)
+				_ = assert.Equal(t, "open", upload.Status)
+			}
+		}
+	})
+
+	_ = t.Run("write the first chunk", func(t *testing.T) {
+		// act
+		res, err := putChunk(srv.URL+"/uploads/"+upload.ID, 0, content[:10])
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				_ = json.NewDecoder(res.Body).Decode(&upload)
+				_ = assert.Equal(t, int64(10), upload.Offset)
+			}
+		}
+	})
+
+	_ = t.Run("finalize before the last chunk", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/uploads/"+upload.ID+"/finalize", "", nil)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusConflict, res.StatusCode) {
+				var body huma.ErrorModel
+				_ = json.NewDecoder(res.Body).Decode(&body)
+				_ = assert.Equal(t, "upload incomplete", body.Detail)
+			}
+		}
+	})
+
+	_ = t.Run("write a chunk at the wrong offset", func(t *testing.T) {
+		// act
+		res, err := putChunk(srv.URL+"/uploads/"+upload.ID, 0, content[:10])
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusConflict, res.StatusCode)
+		}
+	})
+
+	_ = t.Run("query the current offset and resume", func(t *testing.T) {
+		// arrange
+		res, err := http.Get(srv.URL + "/uploads/" + upload.ID)
+		if err != nil {
+			t.Fatal("Failed to get upload:", err)
+		}
+		_ = json.NewDecoder(res.Body).Decode(&upload)
+		_ = res.Body.Close()
+
+		// act
+		res, err = putChunk(srv.URL+"/uploads/"+upload.ID, upload.Offset, content[upload.Offset:])
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				_ = json.NewDecoder(res.Body).Decode(&upload)
+				_ = assert.Equal(t, upload.Size, upload.Offset)
+			}
+		}
+	})
+
+	_ = t.Run("finalize", func(t *testing.T) {
+		// act
+		res, err := http.Post(srv.URL+"/uploads/"+upload.ID+"/finalize", "", nil)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var resBody struct {
+					Message  string `json:"message"`
+					ImportId string `json:"import_id"`
+				}
+				_ = json.NewDecoder(res.Body).Decode(&resBody)
+				_ = assert.Equal(t, "File uploaded successfully", resBody.Message)
+				_ = assert.NotEmpty(t, resBody.ImportId)
+			}
+		}
+	})
+}
+
+func putChunk(url string, offset int64, chunk []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	client := &http.Client{}
+	return client.Do(req)
+}
+
+func readAll(file *os.File) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(file)
+	return buf.Bytes(), err
+}
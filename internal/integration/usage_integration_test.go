@@ -0,0 +1,35 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/api/handlers"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+func TestUsageHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	_ = t.Run("success, the limits of the tenant", func(t *testing.T) {
+		// act
+		res, err := http.Get(srv.URL + "/usage")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			var usage handlers.UsageResponseBody
+			if assert.Equal(t, http.StatusOK, res.StatusCode) && assert.NoError(t, json.NewDecoder(res.Body).Decode(&usage)) {
+				_ = assert.Equal(t, domain.DefaultTenant, usage.TenantId)
+				_ = assert.Equal(t, int64(10*1024*1024), usage.Limits.MaxFileSize)
+				_ = assert.Zero(t, usage.Limits.RequestsPerSecond)
+				_ = assert.Nil(t, usage.RequestsAvailable)
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/tools"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	srv, err := InitServerTest()
+	if err != nil {
+		t.Fatal("Failed to initialize server:", err)
+	}
+
+	rootPath, err := tools.FindProjectRoot()
+	if err != nil {
+		t.Fatal("Failed to find project root:", err)
+	}
+
+	schemaId := "67808a19c567c857d77d7f12"
+	webhooksUrl := srv.URL + "/schema/" + schemaId + "/webhooks"
+	fileUrl := strings.Replace(srv.URL+"/schema/{schemaId}/file", "{schemaId}", schemaId, 1)
+
+	var webhookId string
+
+	_ = t.Run("success, the secret is only returned on create", func(t *testing.T) {
+		// act
+		created, err := postJSON(webhooksUrl, map[string]any{
+			"url":     "https://crm.example.com/hooks/leads",
+			"events":  []string{"import.completed"},
+			"enabled": true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		defer created.Body.Close()
+		var createdBody struct {
+			ID     string `json:"id"`
+			Secret string `json:"secret"`
+		}
+		_ = json.NewDecoder(created.Body).Decode(&createdBody)
+		webhookId = createdBody.ID
+
+		fetched, err := http.Get(srv.URL + "/webhooks/" + webhookId)
+		if err != nil {
+			t.Fatal("Failed to get webhook:", err)
+		}
+		defer fetched.Body.Close()
+		var fetchedBody map[string]any
+		_ = json.NewDecoder(fetched.Body).Decode(&fetchedBody)
+
+		// assert
+		_ = assert.Equal(t, http.StatusCreated, created.StatusCode)
+		_ = assert.NotEmpty(t, createdBody.Secret)
+		if assert.Equal(t, http.StatusOK, fetched.StatusCode) {
+			_ = assert.NotContains(t, fetchedBody, "secret")
+		}
+	})
+
+	_ = t.Run("success, imports queue a delivery", func(t *testing.T) {
+		// arrange
+		importId, err := uploadFile(rootPath, fileUrl, "test_file_handler_success.csv")
+		if err != nil {
+			t.Fatal("Failed to upload file:", err)
+		}
+
+		// act
+		res, err := http.Get(srv.URL + "/webhooks/" + webhookId + "/deliveries?status=pending")
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				var body struct {
+					Deliveries []struct {
+						ID    string `json:"id"`
+						Event string `json:"event"`
+					} `json:"deliveries"`
+				}
+				_ = json.NewDecoder(res.Body).Decode(&body)
+				if assert.Len(t, body.Deliveries, 1) {
+					_ = assert.NotEmpty(t, importId)
+					_ = assert.Equal(t, "import.completed", body.Deliveries[0].Event)
+
+					retry, err := postJSON(srv.URL+"/webhook-deliveries/"+body.Deliveries[0].ID+"/retry", nil)
+					if assert.NoError(t, err) {
+						defer retry.Body.Close()
+						_ = assert.Equal(t, http.StatusConflict, retry.StatusCode)
+					}
+				}
+			}
+		}
+	})
+
+	_ = t.Run("unknown event", func(t *testing.T) {
+		// act
+		res, err := postJSON(webhooksUrl, map[string]any{
+			"url":     "https://crm.example.com/hooks/leads",
+			"events":  []string{"lead.deleted"},
+			"enabled": true,
+		})
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+		}
+	})
+
+	_ = t.Run("success, deleted", func(t *testing.T) {
+		// arrange
+		req, err := http.NewRequest(http.MethodDelete, srv.URL+"/webhooks/"+webhookId, nil)
+		if err != nil {
+			t.Fatal("Failed to build request:", err)
+		}
+
+		// act
+		res, err := http.DefaultClient.Do(req)
+
+		// assert
+		if assert.NoError(t, err) {
+			defer res.Body.Close()
+			_ = assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package messaging
+
+import "context"
+
+// Delivery is a message received from a broker. The broker sends it again,
+// to this or another consumer, until it is acknowledged. Position is where the
+// broker stored the message in its topic, the same on every delivery of it.
+type Delivery struct {
+	Message
+	Position string
+	ack      func(ctx context.Context) error
+}
+
+func NewDelivery(message Message, position string, ack func(ctx context.Context) error) *Delivery {
+	return &Delivery{
+		Message:  message,
+		Position: position,
+		ack:      ack,
+	}
+}
+
+func (d *Delivery) Ack(ctx *context.Context) error {
+	return d.ack(*ctx)
+}
+
+// EventConsumer receives the messages of a topic in order.
+type EventConsumer interface {
+	// Fetch blocks until the next message arrives or ctx is done.
+	Fetch(ctx *context.Context) (*Delivery, error)
+	Close() error
+}
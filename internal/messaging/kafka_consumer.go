@@ -0,0 +1,49 @@
+package messaging
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// NewKafkaConsumer reads through a consumer group, so acknowledging a message
+// commits its offset.
+func NewKafkaConsumer(reader *kafka.Reader) EventConsumer {
+	return &kafkaConsumer{
+		reader: reader,
+	}
+}
+
+type kafkaConsumer struct {
+	reader *kafka.Reader
+}
+
+func (c *kafkaConsumer) Fetch(ctx *context.Context) (*Delivery, error) {
+	record, err := c.reader.FetchMessage(*ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message := Message{
+		Key:     string(record.Key),
+		Value:   record.Value,
+		Headers: make(map[string]string, len(record.Headers)),
+	}
+	for _, header := range record.Headers {
+		if header.Key == MessageIdHeader {
+			message.ID = string(header.Value)
+			continue
+		}
+		message.Headers[header.Key] = string(header.Value)
+	}
+
+	position := strconv.Itoa(record.Partition) + "/" + strconv.FormatInt(record.Offset, 10)
+	return NewDelivery(message, position, func(ctx context.Context) error {
+		return c.reader.CommitMessages(ctx, record)
+	}), nil
+}
+
+func (c *kafkaConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -0,0 +1,43 @@
+package messaging
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageIdHeader carries Message.ID on brokers without a native message ID.
+const MessageIdHeader = "message-id"
+
+func NewKafkaPublisher(writer *kafka.Writer) EventPublisher {
+	return &kafkaPublisher{
+		writer: writer,
+	}
+}
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func (p *kafkaPublisher) Publish(ctx *context.Context, topic string, messages []Message) error {
+	records := make([]kafka.Message, 0, len(messages))
+	for _, message := range messages {
+		headers := []kafka.Header{{Key: MessageIdHeader, Value: []byte(message.ID)}}
+		for key, value := range message.Headers {
+			headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+
+		records = append(records, kafka.Message{
+			Topic:   topic,
+			Key:     []byte(message.Key),
+			Value:   message.Value,
+			Headers: headers,
+		})
+	}
+
+	return p.writer.WriteMessages(*ctx, records...)
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,63 @@
+package messaging
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// MemoryConsumer hands out the messages sent to it, for tests and local runs
+// without a broker.
+type MemoryConsumer struct {
+	messages chan Message
+
+	mu      sync.Mutex
+	fetched int
+	acked   []Message
+}
+
+func NewMemoryConsumer(messages ...Message) *MemoryConsumer {
+	consumer := &MemoryConsumer{
+		messages: make(chan Message, max(len(messages), 64)),
+	}
+	for _, message := range messages {
+		consumer.messages <- message
+	}
+	return consumer
+}
+
+// Send queues a message for Fetch.
+func (c *MemoryConsumer) Send(message Message) {
+	c.messages <- message
+}
+
+func (c *MemoryConsumer) Fetch(ctx *context.Context) (*Delivery, error) {
+	select {
+	case <-(*ctx).Done():
+		return nil, (*ctx).Err()
+	case message := <-c.messages:
+		c.mu.Lock()
+		c.fetched++
+		position := strconv.Itoa(c.fetched)
+		c.mu.Unlock()
+
+		return NewDelivery(message, position, func(_ context.Context) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.acked = append(c.acked, message)
+			return nil
+		}), nil
+	}
+}
+
+// Acked returns the messages acknowledged so far, oldest first.
+func (c *MemoryConsumer) Acked() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.acked...)
+}
+
+func (c *MemoryConsumer) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher keeps the messages in memory, for tests and local runs
+// without a broker.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	err      error
+	messages map[string][]Message
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{
+		messages: make(map[string][]Message),
+	}
+}
+
+func (p *MemoryPublisher) Publish(_ *context.Context, topic string, messages []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.messages[topic] = append(p.messages[topic], messages...)
+	return nil
+}
+
+// SetErr makes Publish fail with err, or succeed again when it is nil.
+func (p *MemoryPublisher) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+// Messages returns the messages published to the topic, oldest first.
+func (p *MemoryPublisher) Messages(topic string) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Message(nil), p.messages[topic]...)
+}
+
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
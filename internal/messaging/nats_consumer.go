@@ -0,0 +1,65 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NewNatsConsumer reads through a durable JetStream pull subscription, so
+// acknowledging a message removes it from the pending messages of the
+// consumer.
+func NewNatsConsumer(sub *nats.Subscription) EventConsumer {
+	return &natsConsumer{
+		sub: sub,
+	}
+}
+
+type natsConsumer struct {
+	sub *nats.Subscription
+}
+
+func (c *natsConsumer) Fetch(ctx *context.Context) (*Delivery, error) {
+	for {
+		msgs, err := c.sub.Fetch(1, nats.MaxWait(5*time.Second))
+		if errors.Is(err, nats.ErrTimeout) && (*ctx).Err() == nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if (*ctx).Err() != nil {
+			return nil, (*ctx).Err()
+		}
+
+		msg := msgs[0]
+		message := Message{
+			ID:      msg.Header.Get(nats.MsgIdHdr),
+			Key:     msg.Header.Get(MessageKeyHeader),
+			Value:   msg.Data,
+			Headers: make(map[string]string, len(msg.Header)),
+		}
+		for key := range msg.Header {
+			if key != nats.MsgIdHdr && key != MessageKeyHeader {
+				message.Headers[key] = msg.Header.Get(key)
+			}
+		}
+
+		// the stream sequence stays the same when the message is redelivered
+		var position string
+		if meta, err := msg.Metadata(); err == nil {
+			position = strconv.FormatUint(meta.Sequence.Stream, 10)
+		}
+
+		return NewDelivery(message, position, func(ctx context.Context) error {
+			return msg.AckSync(nats.Context(ctx))
+		}), nil
+	}
+}
+
+func (c *natsConsumer) Close() error {
+	return c.sub.Unsubscribe()
+}
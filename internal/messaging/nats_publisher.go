@@ -0,0 +1,67 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nats-io/nats.go"
+)
+
+// MessageKeyHeader carries Message.Key on NATS, which has no message keys.
+const MessageKeyHeader = "message-key"
+
+// NewNatsPublisher publishes through JetStream, so every message is stored by
+// a stream before it is acknowledged. A stream must capture the subjects the
+// messages are published to.
+func NewNatsPublisher(conn *nats.Conn, js nats.JetStreamContext) EventPublisher {
+	return &natsPublisher{
+		conn: conn,
+		js:   js,
+	}
+}
+
+type natsPublisher struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+func (p *natsPublisher) Publish(ctx *context.Context, topic string, messages []Message) error {
+	futures := make([]nats.PubAckFuture, 0, len(messages))
+	for _, message := range messages {
+		msg := nats.NewMsg(topic)
+		msg.Data = message.Value
+		// JetStream drops messages whose ID it already stored recently
+		msg.Header.Set(nats.MsgIdHdr, message.ID)
+		msg.Header.Set(MessageKeyHeader, message.Key)
+		for key, value := range message.Headers {
+			msg.Header.Set(key, value)
+		}
+
+		future, err := p.js.PublishMsgAsync(msg)
+		if err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+
+	select {
+	case <-p.js.PublishAsyncComplete():
+	case <-(*ctx).Done():
+		return (*ctx).Err()
+	}
+
+	var errs []error
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,21 @@
+package messaging
+
+import "context"
+
+// Message is a record sent to a topic. ID identifies the record so brokers
+// and consumers can drop the duplicates of a retried publish, and Key keeps
+// the records of the same entity in order.
+type Message struct {
+	ID      string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// EventPublisher sends messages to a message broker. Publish returns once the
+// broker acknowledged every message, and may have sent some of them when it
+// fails.
+type EventPublisher interface {
+	Publish(ctx *context.Context, topic string, messages []Message) error
+	Close() error
+}
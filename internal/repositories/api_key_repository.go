@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type APIKeyRepository interface {
+	Create(ctx *context.Context, key *domain.APIKey) error
+	Update(ctx *context.Context, key *domain.APIKey) error
+	FindById(ctx *context.Context, id string) (*domain.APIKey, error)
+	FindByHash(ctx *context.Context, hash string) (*domain.APIKey, error)
+	FindAll(ctx *context.Context) ([]*domain.APIKey, error)
+}
+
+func NewAPIKeyRepository(collName string, db *mongo.Database) APIKeyRepository {
+	return &apiKeyRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type apiKeyRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *apiKeyRepository) Create(ctx *context.Context, key *domain.APIKey) error {
+	key.ID = primitive.NewObjectID()
+	key.TenantId = tenantOf(ctx, key.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) Update(ctx *context.Context, key *domain.APIKey) error {
+	_, err := r.coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": key.ID}), key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) FindById(ctx *context.Context, id string) (*domain.APIKey, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var key domain.APIKey
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindByHash(ctx *context.Context, hash string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	err := r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"hash": hash})).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindAll(ctx *context.Context) ([]*domain.APIKey, error) {
+	opts := options.Find().SetSort(primitive.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, primitive.M{}), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*domain.APIKey, 0)
+	err = cursor.All(*ctx, &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository appends to the audit trail and reads it back. Entries are
+// never updated nor deleted.
+type AuditRepository interface {
+	// Create appends the entry. A chained entry whose Seq the tenant holds
+	// already fails with a duplicate key error.
+	Create(ctx *context.Context, entry *domain.AuditEntry) error
+	// FindLastChained returns the chained entry of the tenant with the highest
+	// Seq, or nil when the tenant has none.
+	FindLastChained(ctx *context.Context) (*domain.AuditEntry, error)
+	// FindChained returns up to limit chained entries of the tenant after the
+	// given Seq, in order.
+	FindChained(ctx *context.Context, afterSeq int64, limit int64) ([]*domain.AuditEntry, error)
+	FindAll(ctx *context.Context, filter *domain.AuditFilter) ([]*domain.AuditEntry, error)
+}
+
+func NewAuditRepository(collName string, db *mongo.Database) AuditRepository {
+	return &auditRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type auditRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *auditRepository) Create(ctx *context.Context, entry *domain.AuditEntry) error {
+	entry.ID = primitive.NewObjectID()
+	entry.TenantId = tenantOf(ctx, entry.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *auditRepository) FindLastChained(ctx *context.Context) (*domain.AuditEntry, error) {
+	opts := options.FindOne().SetSort(primitive.D{{Key: "seq", Value: -1}})
+
+	var entry domain.AuditEntry
+	err := r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"seq": primitive.M{"$exists": true}}), opts).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (r *auditRepository) FindChained(ctx *context.Context, afterSeq int64, limit int64) ([]*domain.AuditEntry, error) {
+	opts := options.Find().SetSort(primitive.D{{Key: "seq", Value: 1}}).SetLimit(limit)
+	return r.find(ctx, primitive.M{"seq": primitive.M{"$gt": afterSeq}}, opts)
+}
+
+func (r *auditRepository) FindAll(ctx *context.Context, filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	query := primitive.M{}
+	for field, value := range map[string]string{
+		"actor":       filter.Actor,
+		"action":      filter.Action,
+		"entity_type": filter.EntityType,
+		"entity_id":   filter.EntityId,
+		"request_id":  filter.RequestId,
+	} {
+		if value != "" {
+			query[field] = value
+		}
+	}
+
+	createdAt := primitive.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = primitive.NewDateTimeFromTime(filter.From)
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = primitive.NewDateTimeFromTime(filter.To)
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	if !filter.After.IsZero() {
+		query["_id"] = primitive.M{"$lt": filter.After}
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "_id", Value: -1}}).SetLimit(filter.Limit)
+	return r.find(ctx, query, opts)
+}
+
+func (r *auditRepository) find(ctx *context.Context, filter primitive.M, opts *options.FindOptions) ([]*domain.AuditEntry, error) {
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*domain.AuditEntry, 0)
+	err = cursor.All(*ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EncryptionKeyRepository interface {
+	// FindOrCreate stores the key unless the tenant already holds a key of
+	// its purpose, and returns the key the tenant holds either way.
+	FindOrCreate(ctx *context.Context, key *domain.EncryptionKey) (*domain.EncryptionKey, error)
+}
+
+func NewEncryptionKeyRepository(collName string, db *mongo.Database) EncryptionKeyRepository {
+	return &encryptionKeyRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type encryptionKeyRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *encryptionKeyRepository) FindOrCreate(ctx *context.Context, key *domain.EncryptionKey) (*domain.EncryptionKey, error) {
+	filter := primitive.M{"tenant_id": tenantOf(ctx, key.TenantId), "purpose": key.Purpose}
+	update := primitive.M{"$setOnInsert": primitive.M{
+		"_id":        primitive.NewObjectID(),
+		"key":        key.Key,
+		"created_at": key.CreatedAt,
+	}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var stored domain.EncryptionKey
+	err := r.coll.FindOneAndUpdate(*ctx, filter, update, opts).Decode(&stored)
+	if mongo.IsDuplicateKeyError(err) {
+		// another instance inserted the key first
+		err = r.coll.FindOne(*ctx, filter).Decode(&stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ErasureRepository interface {
+	Create(ctx *context.Context, erasure *domain.Erasure) error
+}
+
+func NewErasureRepository(collName string, db *mongo.Database) ErasureRepository {
+	return &erasureRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type erasureRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *erasureRepository) Create(ctx *context.Context, erasure *domain.Erasure) error {
+	erasure.ID = primitive.NewObjectID()
+	erasure.TenantId = tenantOf(ctx, erasure.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, erasure)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
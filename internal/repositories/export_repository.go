@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ExportRepository interface {
+	Create(ctx *context.Context, export *domain.Export) error
+	Update(ctx *context.Context, export *domain.Export) error
+	FindById(ctx *context.Context, id string) (*domain.Export, error)
+	ClaimNext(ctx *context.Context, now time.Time, lease time.Duration) (*domain.Export, error)
+	FindFinishedBefore(ctx *context.Context, before time.Time) ([]*domain.Export, error)
+	Delete(ctx *context.Context, id primitive.ObjectID) error
+}
+
+func NewExportRepository(collName string, db *mongo.Database) ExportRepository {
+	return &exportRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type exportRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *exportRepository) Create(ctx *context.Context, export *domain.Export) error {
+	export.ID = primitive.NewObjectID()
+	export.TenantId = tenantOf(ctx, export.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, export)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) Update(ctx *context.Context, export *domain.Export) error {
+	_, err := r.coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": export.ID}), export)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) FindById(ctx *context.Context, id string) (*domain.Export, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var export domain.Export
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&export)
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// ClaimNext marks the oldest pending export as running, or an export left
+// running for longer than lease by a worker that stopped, so that a single
+// worker writes it. It returns mongo.ErrNoDocuments when there is none.
+func (r *exportRepository) ClaimNext(ctx *context.Context, now time.Time, lease time.Duration) (*domain.Export, error) {
+	filter := primitive.M{"$or": primitive.A{
+		primitive.M{"status": domain.ExportStatusPending},
+		primitive.M{
+			"status":     domain.ExportStatusRunning,
+			"started_at": primitive.M{"$lt": primitive.NewDateTimeFromTime(now.Add(-lease))},
+		},
+	}}
+	update := primitive.M{"$set": primitive.M{
+		"status":     domain.ExportStatusRunning,
+		"started_at": primitive.NewDateTimeFromTime(now),
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(primitive.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var export domain.Export
+	err := r.coll.FindOneAndUpdate(*ctx, tenantFilter(ctx, filter), update, opts).Decode(&export)
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func (r *exportRepository) FindFinishedBefore(ctx *context.Context, before time.Time) ([]*domain.Export, error) {
+	filter := primitive.M{"finished_at": primitive.M{"$lt": primitive.NewDateTimeFromTime(before)}}
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	exports := make([]*domain.Export, 0)
+	err = cursor.All(*ctx, &exports)
+	if err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (r *exportRepository) Delete(ctx *context.Context, id primitive.ObjectID) error {
+	_, err := r.coll.DeleteOne(*ctx, tenantFilter(ctx, primitive.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
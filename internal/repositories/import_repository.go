@@ -0,0 +1,296 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ImportRepository interface {
+	Create(ctx *context.Context, imp *domain.Import) error
+	Update(ctx *context.Context, imp *domain.Import) error
+	UpdateProgress(ctx *context.Context, id primitive.ObjectID, progress *domain.ImportProgress) error
+	FindById(ctx *context.Context, id string) (*domain.Import, error)
+	FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.Import, error)
+	FindBySourceId(ctx *context.Context, sourceId primitive.ObjectID) ([]*domain.Import, error)
+	// FindReplayableByIdempotencyKey and FindReplayableByChecksum return the
+	// imports started since the given time that completed, or are still
+	// processing and saved progress since aliveSince.
+	FindReplayableByIdempotencyKey(ctx *context.Context, schemaId primitive.ObjectID, key string, since, aliveSince time.Time) ([]*domain.Import, error)
+	FindReplayableByChecksum(ctx *context.Context, schemaId primitive.ObjectID, checksum string, since, aliveSince time.Time) ([]*domain.Import, error)
+	// ReleaseIdempotencyKey gives up the claims on the key of the imports
+	// started before the given time, returning whether there was any.
+	ReleaseIdempotencyKey(ctx *context.Context, schemaId primitive.ObjectID, key string, before time.Time) (bool, error)
+	CountProcessing(ctx *context.Context, since time.Time) (int64, error)
+	// CountProcessingBefore counts the imports CountProcessing counts that
+	// were recorded before the given import.
+	CountProcessingBefore(ctx *context.Context, id primitive.ObjectID, since time.Time) (int64, error)
+	Delete(ctx *context.Context, id primitive.ObjectID) error
+	// FindStale returns the imports still processing that neither started
+	// nor saved their progress since the given time.
+	FindStale(ctx *context.Context, since time.Time) ([]*domain.Import, error)
+}
+
+func NewImportRepository(collName string, dbs *TenantDatabases) ImportRepository {
+	return &importRepository{
+		collName: collName,
+		dbs:      dbs,
+	}
+}
+
+type importRepository struct {
+	collName string
+	dbs      *TenantDatabases
+}
+
+func (r *importRepository) Create(ctx *context.Context, imp *domain.Import) error {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return err
+	}
+
+	imp.ID = primitive.NewObjectID()
+	imp.TenantId = tenantOf(ctx, imp.TenantId)
+
+	_, err = coll.InsertOne(*ctx, imp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importRepository) Update(ctx *context.Context, imp *domain.Import) error {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": imp.ID}), imp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CountProcessing counts the imports still processing that started or saved
+// their progress since the given time, so the imports of an instance that
+// stopped are not counted forever.
+func (r *importRepository) CountProcessing(ctx *context.Context, since time.Time) (int64, error) {
+	return r.countProcessing(ctx, primitive.M{}, since)
+}
+
+func (r *importRepository) CountProcessingBefore(ctx *context.Context, id primitive.ObjectID, since time.Time) (int64, error) {
+	return r.countProcessing(ctx, primitive.M{"_id": primitive.M{"$lt": id}}, since)
+}
+
+// Delete removes the import, which gives up its claim on its idempotency key.
+func (r *importRepository) Delete(ctx *context.Context, id primitive.ObjectID) error {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.DeleteOne(*ctx, tenantFilter(ctx, primitive.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importRepository) countProcessing(ctx *context.Context, filter primitive.M, since time.Time) (int64, error) {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	recent := primitive.NewDateTimeFromTime(since)
+	filter["status"] = domain.ImportStatusProcessing
+	filter["$or"] = primitive.A{
+		primitive.M{"started_at": primitive.M{"$gte": recent}},
+		primitive.M{"progress.updated_at": primitive.M{"$gte": recent}},
+	}
+
+	return coll.CountDocuments(*ctx, tenantFilter(ctx, filter))
+}
+
+func (r *importRepository) FindStale(ctx *context.Context, since time.Time) ([]*domain.Import, error) {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	recent := primitive.NewDateTimeFromTime(since)
+	filter := tenantFilter(ctx, primitive.M{
+		"status":              domain.ImportStatusProcessing,
+		"started_at":          primitive.M{"$lt": recent},
+		"progress.updated_at": primitive.M{"$not": primitive.M{"$gte": recent}},
+	})
+
+	cursor, err := coll.Find(*ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := make([]*domain.Import, 0)
+	err = cursor.All(*ctx, &imports)
+	if err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+// UpdateProgress only sets the progress of an import that is still
+// processing, so it never overwrites the outcome of a finished import.
+func (r *importRepository) UpdateProgress(ctx *context.Context, id primitive.ObjectID, progress *domain.ImportProgress) error {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return err
+	}
+
+	filter := tenantFilter(ctx, primitive.M{"_id": id, "status": domain.ImportStatusProcessing})
+	_, err = coll.UpdateOne(*ctx, filter, primitive.M{"$set": primitive.M{"progress": progress}})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importRepository) FindById(ctx *context.Context, id string) (*domain.Import, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	var imp domain.Import
+	err = coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&imp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &imp, nil
+}
+
+func (r *importRepository) FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.Import, error) {
+	objID, err := primitive.ObjectIDFromHex(schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "started_at", Value: -1}})
+	cursor, err := coll.Find(*ctx, tenantFilter(ctx, primitive.M{"schema_id": objID}), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := make([]*domain.Import, 0)
+	err = cursor.All(*ctx, &imports)
+	if err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+func (r *importRepository) FindBySourceId(ctx *context.Context, sourceId primitive.ObjectID) ([]*domain.Import, error) {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "started_at", Value: -1}})
+	cursor, err := coll.Find(*ctx, tenantFilter(ctx, primitive.M{"source_id": sourceId}), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := make([]*domain.Import, 0)
+	err = cursor.All(*ctx, &imports)
+	if err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+func (r *importRepository) FindReplayableByIdempotencyKey(ctx *context.Context, schemaId primitive.ObjectID, key string, since, aliveSince time.Time) ([]*domain.Import, error) {
+	return r.findReplayable(ctx, primitive.M{"schema_id": schemaId, "idempotency_key": key}, since, aliveSince)
+}
+
+func (r *importRepository) FindReplayableByChecksum(ctx *context.Context, schemaId primitive.ObjectID, checksum string, since, aliveSince time.Time) ([]*domain.Import, error) {
+	return r.findReplayable(ctx, primitive.M{"schema_id": schemaId, "checksum": checksum}, since, aliveSince)
+}
+
+func (r *importRepository) ReleaseIdempotencyKey(ctx *context.Context, schemaId primitive.ObjectID, key string, before time.Time) (bool, error) {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return false, err
+	}
+
+	filter := tenantFilter(ctx, primitive.M{
+		"schema_id":           schemaId,
+		"idempotency_key":     key,
+		"idempotency_claimed": true,
+		"started_at":          primitive.M{"$lt": primitive.NewDateTimeFromTime(before)},
+	})
+	result, err := coll.UpdateMany(*ctx, filter, primitive.M{"$unset": primitive.M{"idempotency_claimed": ""}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// findReplayable returns the imports matching the filter that started after
+// since and completed, or are still processing and saved progress since
+// aliveSince, so their result still holds. Imports that failed, were rolled
+// back or stopped making progress are left out. An archive yields one import
+// per entry, all sharing the checksum of the upload.
+func (r *importRepository) findReplayable(ctx *context.Context, filter primitive.M, since, aliveSince time.Time) ([]*domain.Import, error) {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	alive := primitive.NewDateTimeFromTime(aliveSince)
+	filter = tenantFilter(ctx, filter)
+	filter["started_at"] = primitive.M{"$gte": primitive.NewDateTimeFromTime(since)}
+	filter["$or"] = primitive.A{
+		primitive.M{"status": domain.ImportStatusCompleted},
+		primitive.M{"status": domain.ImportStatusProcessing, "$or": primitive.A{
+			primitive.M{"started_at": primitive.M{"$gte": alive}},
+			primitive.M{"progress.updated_at": primitive.M{"$gte": alive}},
+		}},
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "started_at", Value: 1}})
+	cursor, err := coll.Find(*ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := make([]*domain.Import, 0)
+	err = cursor.All(*ctx, &imports)
+	if err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ImportSourceRepository interface {
+	Create(ctx *context.Context, source *domain.ImportSource) error
+	Update(ctx *context.Context, source *domain.ImportSource) error
+	Delete(ctx *context.Context, id string) error
+	FindById(ctx *context.Context, id string) (*domain.ImportSource, error)
+	FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.ImportSource, error)
+	FindDue(ctx *context.Context, now time.Time) ([]*domain.ImportSource, error)
+	ClaimRun(ctx *context.Context, source *domain.ImportSource, nextRunAt time.Time) error
+	RecordRun(ctx *context.Context, source *domain.ImportSource) error
+}
+
+func NewImportSourceRepository(collName string, db *mongo.Database) ImportSourceRepository {
+	return &importSourceRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type importSourceRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *importSourceRepository) Create(ctx *context.Context, source *domain.ImportSource) error {
+	source.ID = primitive.NewObjectID()
+	source.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	source.UpdatedAt = source.CreatedAt
+
+	source.TenantId = tenantOf(ctx, source.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, source)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importSourceRepository) Update(ctx *context.Context, source *domain.ImportSource) error {
+	source.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	result, err := r.coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": source.ID}), source)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *importSourceRepository) Delete(ctx *context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.coll.DeleteOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *importSourceRepository) FindById(ctx *context.Context, id string) (*domain.ImportSource, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var source domain.ImportSource
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &source, nil
+}
+
+func (r *importSourceRepository) FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.ImportSource, error) {
+	objID, err := primitive.ObjectIDFromHex(schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, primitive.M{"schema_id": objID}), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]*domain.ImportSource, 0)
+	err = cursor.All(*ctx, &sources)
+	if err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+func (r *importSourceRepository) FindDue(ctx *context.Context, now time.Time) ([]*domain.ImportSource, error) {
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, primitive.M{
+		"enabled":     true,
+		"next_run_at": primitive.M{"$lte": primitive.NewDateTimeFromTime(now)},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]*domain.ImportSource, 0)
+	err = cursor.All(*ctx, &sources)
+	if err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// ClaimRun moves the next run of a due source forward, failing with
+// domain.ErrImportInProgress when another instance already claimed this run.
+func (r *importSourceRepository) ClaimRun(ctx *context.Context, source *domain.ImportSource, nextRunAt time.Time) error {
+	next := primitive.NewDateTimeFromTime(nextRunAt)
+
+	result, err := r.coll.UpdateOne(*ctx,
+		primitive.M{"_id": source.ID, "next_run_at": source.NextRunAt},
+		primitive.M{"$set": primitive.M{"next_run_at": next}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return domain.ErrImportInProgress
+	}
+
+	source.NextRunAt = next
+	return nil
+}
+
+// RecordRun saves the outcome of a run without touching the settings of the
+// source, which may have been changed while it ran.
+func (r *importSourceRepository) RecordRun(ctx *context.Context, source *domain.ImportSource) error {
+	_, err := r.coll.UpdateOne(*ctx, tenantFilter(ctx, primitive.M{"_id": source.ID}), primitive.M{"$set": primitive.M{
+		"etag":           source.ETag,
+		"last_modified":  source.LastModified,
+		"checksum":       source.Checksum,
+		"last_run_at":    source.LastRunAt,
+		"last_import_id": source.LastImportId,
+	}})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
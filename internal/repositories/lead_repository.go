@@ -2,42 +2,658 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/vitortenor/lead-stream-service/internal/domain"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type LeadRepository interface {
 	CreateMany(ctx *context.Context, leads []*bson.D) error
+	CreateManyInTransaction(ctx *context.Context, leads []*bson.D) error
+	// CreateManyStaged writes the leads of an import to the staging
+	// collection, where no reader sees them until they are published.
+	CreateManyStaged(ctx *context.Context, leads []*bson.D) error
+	// PublishStaged moves up to limit staged leads of the import to the
+	// leads, returning how many it moved, zero once none is left.
+	PublishStaged(ctx *context.Context, importId primitive.ObjectID, limit int64) (int, error)
+	DeleteStaged(ctx *context.Context, importId primitive.ObjectID) (int64, error)
+	// UnpublishByImportId moves up to limit leads of the import that are not
+	// under legal hold back to the staging collection, returning how many it
+	// moved, zero once none is left.
+	UnpublishByImportId(ctx *context.Context, importId primitive.ObjectID, limit int64) (int, error)
+	// Create writes a lead, failing with domain.ErrLeadMessageConsumed when
+	// it has the message_id of a lead written already.
 	Create(ctx *context.Context, lead *bson.D) error
+	FindByMessageId(ctx *context.Context, messageId string) (primitive.M, error)
+	// DeleteByImportId deletes the leads of the import, except those under
+	// legal hold.
+	DeleteByImportId(ctx *context.Context, importId primitive.ObjectID) (int64, error)
+	FindByImportId(ctx *context.Context, importId primitive.ObjectID, after primitive.ObjectID, limit int64) ([]primitive.M, error)
+	WatchBySchemaId(ctx *context.Context, schemaId primitive.ObjectID, resumeToken string) (LeadChangeStream, error)
+	FindByFilter(ctx *context.Context, filter *domain.LeadFilter) (LeadCursor, error)
+	// CountByFilter counts the leads found by the filter, up to limit unless
+	// it is zero.
+	CountByFilter(ctx *context.Context, filter *domain.LeadFilter, limit int64) (int64, error)
+	FindBySubject(ctx *context.Context, filter *domain.SubjectFilter) ([]primitive.M, error)
+	// DeleteStagedBySubject deletes the staged leads whose email or phone
+	// holds one of the values of the filter, so their import never publishes
+	// them.
+	DeleteStagedBySubject(ctx *context.Context, filter *domain.SubjectFilter) (int64, error)
+	DeleteByIds(ctx *context.Context, ids []primitive.ObjectID) (int64, error)
+	Anonymize(ctx *context.Context, ids []primitive.ObjectID) (int64, error)
+	DeleteExpired(ctx *context.Context, schemaId primitive.ObjectID, field string, cutoff interface{}) (int64, error)
+	SetLegalHold(ctx *context.Context, schemaId, id primitive.ObjectID, hold bool) error
 }
 
-func NewLeadRepository(collName string, db *mongo.Database) LeadRepository {
+// LeadCursor reads the leads found by a query one at a time, so they never
+// have to fit in memory together.
+type LeadCursor interface {
+	// Next returns nil once every lead was read.
+	Next(ctx *context.Context) (primitive.M, error)
+	Close(ctx *context.Context) error
+}
+
+// LeadChangeStream follows the leads written to a schema.
+type LeadChangeStream interface {
+	// Next waits a few seconds for the next change and returns nil when none
+	// arrived, so callers can keep their connection alive in between.
+	Next(ctx *context.Context) (*domain.LeadChange, error)
+	Close(ctx *context.Context) error
+}
+
+// StagingCollection is the collection the leads of the collection are staged
+// in while their import is read.
+func StagingCollection(collName string) string {
+	return collName + "_staging"
+}
+
+func NewLeadRepository(collName string, dbs *TenantDatabases) LeadRepository {
 	return &leadRepository{
-		coll: db.Collection(collName),
+		collName: collName,
+		dbs:      dbs,
 	}
 }
 
 type leadRepository struct {
-	coll *mongo.Collection
+	collName string
+	dbs      *TenantDatabases
 }
 
 func (lr *leadRepository) Create(ctx *context.Context, lead *bson.D) error {
-	_, err := lr.coll.InsertOne(*ctx, lead)
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.InsertOne(*ctx, withTenant(ctx, lead))
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// the email or the phone may be the duplicate instead
+	messageId, ok := lead.Map()["message_id"]
+	if !ok {
+		return err
+	}
+	consumed, countErr := coll.CountDocuments(*ctx, tenantFilter(ctx, bson.M{"message_id": messageId}), options.Count().SetLimit(1))
+	if countErr != nil {
+		return countErr
+	}
+	if consumed > 0 {
+		return domain.ErrLeadMessageConsumed
+	}
 
 	return err
 }
 
+func (lr *leadRepository) FindByMessageId(ctx *context.Context, messageId string) (primitive.M, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	var lead primitive.M
+	err = coll.FindOne(*ctx, tenantFilter(ctx, bson.M{"message_id": messageId})).Decode(&lead)
+	if err != nil {
+		return nil, err
+	}
+
+	return lead, nil
+}
+
 func (lr *leadRepository) CreateMany(ctx *context.Context, leads []*bson.D) error {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return err
+	}
+
 	doc := make([]interface{}, len(leads))
 	for i, v := range leads {
-		doc[i] = v
+		doc[i] = withTenant(ctx, v)
 	}
 
-	_, err := lr.coll.InsertMany(*ctx, doc)
+	_, err = coll.InsertMany(*ctx, doc)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (lr *leadRepository) CreateManyInTransaction(ctx *context.Context, leads []*bson.D) error {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return err
+	}
+
+	session, err := coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(*ctx)
+
+	_, err = session.WithTransaction(*ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var txCtx context.Context = sessCtx
+		return nil, lr.CreateMany(&txCtx, leads)
+	})
+
+	return err
+}
+
+func (lr *leadRepository) CreateManyStaged(ctx *context.Context, leads []*bson.D) error {
+	coll, err := lr.dbs.Collection(ctx, StagingCollection(lr.collName))
+	if err != nil {
+		return err
+	}
+
+	doc := make([]interface{}, len(leads))
+	for i, v := range leads {
+		doc[i] = withTenant(ctx, v)
+	}
+
+	_, err = coll.InsertMany(*ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PublishStaged inserts the oldest staged leads of the import with the IDs
+// they were staged with, then removes them from the staging collection. A
+// failure between the two leaves both copies, which the cleanup of the import
+// removes by its ID.
+func (lr *leadRepository) PublishStaged(ctx *context.Context, importId primitive.ObjectID, limit int64) (int, error) {
+	staging, err := lr.dbs.Collection(ctx, StagingCollection(lr.collName))
+	if err != nil {
+		return 0, err
+	}
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := staging.Find(*ctx, tenantFilter(ctx, bson.M{"import_id": importId}), opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var leads []bson.D
+	if err := cursor.All(*ctx, &leads); err != nil {
+		return 0, err
+	}
+	if len(leads) == 0 {
+		return 0, nil
+	}
+
+	docs := make([]interface{}, len(leads))
+	ids := make(bson.A, len(leads))
+	for i, lead := range leads {
+		docs[i] = lead
+		ids[i] = lead.Map()["_id"]
+	}
+
+	if _, err := coll.InsertMany(*ctx, docs); err != nil {
+		return 0, err
+	}
+
+	if _, err := staging.DeleteMany(*ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+
+	return len(leads), nil
+}
+
+// UnpublishByImportId inserts the oldest leads of the import into the staging
+// collection with their IDs, then removes them from the leads. A failure
+// between the two leaves both copies.
+func (lr *leadRepository) UnpublishByImportId(ctx *context.Context, importId primitive.ObjectID, limit int64) (int, error) {
+	staging, err := lr.dbs.Collection(ctx, StagingCollection(lr.collName))
+	if err != nil {
+		return 0, err
+	}
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := coll.Find(*ctx, tenantFilter(ctx, bson.M{"import_id": importId, domain.LeadLegalHoldField: bson.M{"$ne": true}}), opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var leads []bson.D
+	if err := cursor.All(*ctx, &leads); err != nil {
+		return 0, err
+	}
+	if len(leads) == 0 {
+		return 0, nil
+	}
+
+	docs := make([]interface{}, len(leads))
+	ids := make(bson.A, len(leads))
+	for i, lead := range leads {
+		docs[i] = lead
+		ids[i] = lead.Map()["_id"]
+	}
+
+	if _, err := staging.InsertMany(*ctx, docs); err != nil {
+		return 0, err
+	}
+
+	if _, err := coll.DeleteMany(*ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+
+	return len(leads), nil
+}
+
+func (lr *leadRepository) DeleteStaged(ctx *context.Context, importId primitive.ObjectID) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, StagingCollection(lr.collName))
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := coll.DeleteMany(*ctx, tenantFilter(ctx, bson.M{"import_id": importId, domain.LeadLegalHoldField: bson.M{"$ne": true}}))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (lr *leadRepository) DeleteByImportId(ctx *context.Context, importId primitive.ObjectID) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := coll.DeleteMany(*ctx, tenantFilter(ctx, bson.M{"import_id": importId, domain.LeadLegalHoldField: bson.M{"$ne": true}}))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// FindByImportId pages through the leads of an import in insertion order,
+// returning up to limit leads whose ID comes after the given one.
+func (lr *leadRepository) FindByImportId(ctx *context.Context, importId primitive.ObjectID, after primitive.ObjectID, limit int64) ([]primitive.M, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := tenantFilter(ctx, bson.M{"import_id": importId})
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := coll.Find(*ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	leads := make([]primitive.M, 0)
+	err = cursor.All(*ctx, &leads)
+	if err != nil {
+		return nil, err
+	}
+
+	return leads, nil
+}
+
+// FindByFilter opens a cursor over the leads matching the filter, in
+// insertion order.
+func (lr *leadRepository) FindByFilter(ctx *context.Context, filter *domain.LeadFilter) (LeadCursor, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := coll.Find(*ctx, leadFilterQuery(ctx, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &leadCursor{cursor: cursor}, nil
+}
+
+func (lr *leadRepository) CountByFilter(ctx *context.Context, filter *domain.LeadFilter, limit int64) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := options.Count()
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return coll.CountDocuments(*ctx, leadFilterQuery(ctx, filter), opts)
+}
+
+// leadFilterQuery is the query of the leads of the tenant found by the filter.
+func leadFilterQuery(ctx *context.Context, filter *domain.LeadFilter) bson.M {
+	query := tenantFilter(ctx, bson.M{"schema_id": filter.SchemaId})
+	if !filter.ImportId.IsZero() {
+		query["import_id"] = filter.ImportId
+	}
+
+	createdAt := bson.M{}
+	if !filter.CreatedFrom.IsZero() {
+		createdAt["$gte"] = primitive.NewDateTimeFromTime(filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		createdAt["$lt"] = primitive.NewDateTimeFromTime(filter.CreatedTo)
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	// consent is stored in Unix seconds as every datetime field
+	consentedAt := bson.M{}
+	if !filter.ConsentedFrom.IsZero() {
+		consentedAt["$gte"] = filter.ConsentedFrom.Unix()
+	}
+	if !filter.ConsentedTo.IsZero() {
+		consentedAt["$lt"] = filter.ConsentedTo.Unix()
+	}
+	if len(consentedAt) > 0 {
+		query[domain.LeadConsentTimestampField] = consentedAt
+	}
+
+	for field, value := range filter.Fields {
+		query[field] = value
+	}
+
+	return query
+}
+
+// FindBySubject finds the leads of every schema whose email or phone holds
+// one of the values of the filter.
+func (lr *leadRepository) FindBySubject(ctx *context.Context, filter *domain.SubjectFilter) ([]primitive.M, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	query := subjectQuery(filter)
+	if query == nil {
+		return []primitive.M{}, nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := coll.Find(*ctx, tenantFilter(ctx, query), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	leads := make([]primitive.M, 0)
+	err = cursor.All(*ctx, &leads)
+	if err != nil {
+		return nil, err
+	}
+
+	return leads, nil
+}
+
+func (lr *leadRepository) DeleteStagedBySubject(ctx *context.Context, filter *domain.SubjectFilter) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, StagingCollection(lr.collName))
+	if err != nil {
+		return 0, err
+	}
+
+	query := subjectQuery(filter)
+	if query == nil {
+		return 0, nil
+	}
+
+	result, err := coll.DeleteMany(*ctx, tenantFilter(ctx, query))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// subjectQuery matches the leads whose email or phone holds one of the values
+// of the filter, and is nil when the filter has none.
+func subjectQuery(filter *domain.SubjectFilter) bson.M {
+	var or bson.A
+	if len(filter.Emails) > 0 {
+		or = append(or, bson.M{"email": bson.M{"$in": filter.Emails}})
+	}
+	if len(filter.Phones) > 0 {
+		or = append(or, bson.M{"phone": bson.M{"$in": filter.Phones}})
+	}
+	if len(or) == 0 {
+		return nil
+	}
+	return bson.M{"$or": or}
+}
+
+// DeleteByIds deletes the leads that are not under legal hold.
+func (lr *leadRepository) DeleteByIds(ctx *context.Context, ids []primitive.ObjectID) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := coll.DeleteMany(*ctx, tenantFilter(ctx, bson.M{"_id": bson.M{"$in": ids}, domain.LeadLegalHoldField: bson.M{"$ne": true}}))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// Anonymize strips the leads not under legal hold down to their IDs, schema,
+// import and timestamps. Email and phone are replaced with a value derived
+// from the ID of the lead, as they must stay unique.
+func (lr *leadRepository) Anonymize(ctx *context.Context, ids []primitive.ObjectID) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	erased := bson.M{"$concat": bson.A{"erased:", bson.M{"$toString": "$_id"}}}
+	pipeline := mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{
+		"_id":           "$_id",
+		"tenant_id":     "$tenant_id",
+		"schema_id":     "$schema_id",
+		"import_id":     "$import_id",
+		"email":         erased,
+		"phone":         erased,
+		"created_at":    "$created_at",
+		"updated_at":    now,
+		"anonymized_at": now,
+	}}}}
+
+	result, err := coll.UpdateMany(*ctx, tenantFilter(ctx, bson.M{"_id": bson.M{"$in": ids}, domain.LeadLegalHoldField: bson.M{"$ne": true}}), pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// DeleteExpired deletes the leads of the schema whose field holds a value
+// before the cutoff, leaving those under legal hold and those without a value.
+func (lr *leadRepository) DeleteExpired(ctx *context.Context, schemaId primitive.ObjectID, field string, cutoff interface{}) (int64, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := coll.DeleteMany(*ctx, tenantFilter(ctx, bson.M{
+		"schema_id":               schemaId,
+		field:                     bson.M{"$lt": cutoff},
+		domain.LeadLegalHoldField: bson.M{"$ne": true},
+	}))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (lr *leadRepository) SetLegalHold(ctx *context.Context, schemaId, id primitive.ObjectID, hold bool) error {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$unset": bson.M{domain.LeadLegalHoldField: ""}}
+	if hold {
+		update = bson.M{"$set": bson.M{domain.LeadLegalHoldField: true}}
+	}
+
+	result, err := coll.UpdateOne(*ctx, tenantFilter(ctx, bson.M{"_id": id, "schema_id": schemaId}), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// withTenant sets the tenant of the lead to the tenant of the context, so a
+// lead can never be written to another tenant.
+func withTenant(ctx *context.Context, lead *bson.D) *bson.D {
+	tenant := tenantOf(ctx, "")
+	for i, e := range *lead {
+		if e.Key == "tenant_id" {
+			(*lead)[i].Value = tenant
+			return lead
+		}
+	}
+	*lead = append(*lead, bson.E{Key: "tenant_id", Value: tenant})
+	return lead
+}
+
+type leadCursor struct {
+	cursor *mongo.Cursor
+}
+
+func (c *leadCursor) Next(ctx *context.Context) (primitive.M, error) {
+	if !c.cursor.Next(*ctx) {
+		return nil, c.cursor.Err()
+	}
+
+	var lead primitive.M
+	if err := c.cursor.Decode(&lead); err != nil {
+		return nil, err
+	}
+
+	return lead, nil
+}
+
+func (c *leadCursor) Close(ctx *context.Context) error {
+	return c.cursor.Close(*ctx)
+}
+
+// WatchBySchemaId opens a change stream of the leads inserted, updated or
+// replaced in the schema, starting after the given resume token, or now when
+// it is empty. Change streams require MongoDB to run as a replica set.
+func (lr *leadRepository) WatchBySchemaId(ctx *context.Context, schemaId primitive.ObjectID, resumeToken string) (LeadChangeStream, error) {
+	coll, err := lr.dbs.Collection(ctx, lr.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	match := bson.M{
+		"operationType":          bson.M{"$in": bson.A{"insert", "update", "replace"}},
+		"fullDocument.schema_id": schemaId,
+	}
+	if tenant, ok := domain.TenantFromContext(*ctx); ok {
+		match["fullDocument.tenant_id"] = tenant
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(10 * time.Second)
+	if resumeToken != "" {
+		opts.SetStartAfter(bson.M{"_data": resumeToken})
+	}
+
+	stream, err := coll.Watch(*ctx, pipeline, opts)
+	if err != nil {
+		return nil, changeStreamError(err)
+	}
+
+	return &leadChangeStream{stream: stream}, nil
+}
+
+type leadChangeStream struct {
+	stream *mongo.ChangeStream
+}
+
+func (s *leadChangeStream) Next(ctx *context.Context) (*domain.LeadChange, error) {
+	if !s.stream.TryNext(*ctx) {
+		return nil, changeStreamError(s.stream.Err())
+	}
+
+	var event struct {
+		ID            bson.M      `bson:"_id"`
+		OperationType string      `bson:"operationType"`
+		FullDocument  primitive.M `bson:"fullDocument"`
+	}
+	if err := s.stream.Decode(&event); err != nil {
+		return nil, err
+	}
+
+	token, _ := event.ID["_data"].(string)
+	return &domain.LeadChange{
+		ResumeToken: token,
+		Operation:   event.OperationType,
+		Lead:        event.FullDocument,
+	}, nil
+}
+
+func (s *leadChangeStream) Close(ctx *context.Context) error {
+	return s.stream.Close(*ctx)
+}
+
+// changeStreamError tells the resume tokens that fell off the oplog, reported
+// as ChangeStreamHistoryLost or ChangeStreamFatalError, from the other
+// failures of a change stream.
+func changeStreamError(err error) error {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && (serverErr.HasErrorCode(286) || serverErr.HasErrorCode(280)) {
+		return errors.Join(domain.ErrResumeTokenExpired, err)
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ObjectIngestionRepository interface {
+	Create(ctx *context.Context, ingestion *domain.ObjectIngestion) error
+	Update(ctx *context.Context, ingestion *domain.ObjectIngestion) error
+	Retry(ctx *context.Context, ingestion *domain.ObjectIngestion, now time.Time, lease time.Duration) error
+	FindByObject(ctx *context.Context, object *domain.StoredObject) (*domain.ObjectIngestion, error)
+}
+
+func NewObjectIngestionRepository(collName string, db *mongo.Database) ObjectIngestionRepository {
+	return &objectIngestionRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type objectIngestionRepository struct {
+	coll *mongo.Collection
+}
+
+// Create claims the object, failing with domain.ErrObjectClaimed when the same
+// version was already claimed, possibly by another instance.
+func (r *objectIngestionRepository) Create(ctx *context.Context, ingestion *domain.ObjectIngestion) error {
+	ingestion.ID = primitive.NewObjectID()
+
+	_, err := r.coll.InsertOne(*ctx, ingestion)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrObjectClaimed
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *objectIngestionRepository) Update(ctx *context.Context, ingestion *domain.ObjectIngestion) error {
+	_, err := r.coll.ReplaceOne(*ctx, primitive.M{"_id": ingestion.ID}, ingestion)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retry claims a failed object again, or an object whose claim is older than
+// lease, failing with domain.ErrObjectClaimed when another instance got there
+// first.
+func (r *objectIngestionRepository) Retry(ctx *context.Context, ingestion *domain.ObjectIngestion, now time.Time, lease time.Duration) error {
+	ingestion.Retry()
+
+	result, err := r.coll.ReplaceOne(*ctx,
+		primitive.M{"_id": ingestion.ID, "$or": primitive.A{
+			primitive.M{"status": domain.ObjectIngestionStatusFailed},
+			primitive.M{
+				"status":     domain.ObjectIngestionStatusProcessing,
+				"claimed_at": primitive.M{"$lt": primitive.NewDateTimeFromTime(now.Add(-lease))},
+			},
+		}},
+		ingestion,
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return domain.ErrObjectClaimed
+	}
+
+	return nil
+}
+
+func (r *objectIngestionRepository) FindByObject(ctx *context.Context, object *domain.StoredObject) (*domain.ObjectIngestion, error) {
+	var ingestion domain.ObjectIngestion
+	err := r.coll.FindOne(*ctx, primitive.M{
+		"bucket": object.Bucket,
+		"key":    object.Key,
+		"etag":   object.ETag,
+	}).Decode(&ingestion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ingestion, nil
+}
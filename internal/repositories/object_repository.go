@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+// ObjectRepository reads the objects of an S3-compatible bucket.
+type ObjectRepository interface {
+	List(ctx *context.Context, bucket, prefix string) ([]*domain.StoredObject, error)
+	Download(ctx *context.Context, object *domain.StoredObject, path string) error
+	Move(ctx *context.Context, object *domain.StoredObject, key string) error
+}
+
+func NewObjectRepository(client *minio.Client) ObjectRepository {
+	return &objectRepository{
+		client: client,
+	}
+}
+
+type objectRepository struct {
+	client *minio.Client
+}
+
+func (r *objectRepository) List(ctx *context.Context, bucket, prefix string) ([]*domain.StoredObject, error) {
+	objects := make([]*domain.StoredObject, 0)
+	for info := range r.client.ListObjects(*ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		objects = append(objects, &domain.StoredObject{
+			Bucket:       bucket,
+			Key:          info.Key,
+			ETag:         info.ETag,
+			Size:         info.Size,
+			LastModified: info.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+// Download writes the object to path, failing if it changed since it was
+// listed.
+func (r *objectRepository) Download(ctx *context.Context, object *domain.StoredObject, path string) error {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetMatchETag(object.ETag); err != nil {
+		return err
+	}
+
+	return r.client.FGetObject(*ctx, object.Bucket, object.Key, path, opts)
+}
+
+// Move copies the object to key within its bucket and removes the original.
+func (r *objectRepository) Move(ctx *context.Context, object *domain.StoredObject, key string) error {
+	_, err := r.client.ComposeObject(*ctx,
+		minio.CopyDestOptions{Bucket: object.Bucket, Object: key},
+		minio.CopySrcOptions{Bucket: object.Bucket, Object: object.Key, MatchETag: object.ETag},
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.client.RemoveObject(*ctx, object.Bucket, object.Key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OutboxRepository interface {
+	Create(ctx *context.Context, message *domain.OutboxMessage) error
+	Update(ctx *context.Context, message *domain.OutboxMessage) error
+	ClaimNext(ctx *context.Context, now time.Time, lease time.Duration) (*domain.OutboxMessage, error)
+	// RedactLeads removes the records of the leads from every message,
+	// published or not, returning how many messages held any.
+	RedactLeads(ctx *context.Context, ids []primitive.ObjectID) (int64, error)
+}
+
+func NewOutboxRepository(collName string, db *mongo.Database) OutboxRepository {
+	return &outboxRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type outboxRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *outboxRepository) Create(ctx *context.Context, message *domain.OutboxMessage) error {
+	message.ID = primitive.NewObjectID()
+
+	_, err := r.coll.InsertOne(*ctx, message)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *outboxRepository) Update(ctx *context.Context, message *domain.OutboxMessage) error {
+	_, err := r.coll.ReplaceOne(*ctx, primitive.M{"_id": message.ID}, message)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimNext takes the oldest pending message when it is due and pushes its
+// next attempt back by lease, so no other relay publishes it meanwhile.
+// Messages are only ever taken in order, so a message that keeps failing holds
+// back the ones after it until it is dead, which are skipped. It returns mongo.ErrNoDocuments when the oldest
+// message is not due or was claimed by another relay.
+func (r *outboxRepository) ClaimNext(ctx *context.Context, now time.Time, lease time.Duration) (*domain.OutboxMessage, error) {
+	opts := options.FindOne().SetSort(primitive.D{{Key: "_id", Value: 1}})
+
+	var message domain.OutboxMessage
+	err := r.coll.FindOne(*ctx, primitive.M{"status": domain.OutboxStatusPending}, opts).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	if message.NextAttemptAt.Time().After(now) {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	nextAttemptAt := primitive.NewDateTimeFromTime(now.Add(lease))
+	result, err := r.coll.UpdateOne(*ctx,
+		primitive.M{"_id": message.ID, "next_attempt_at": message.NextAttemptAt},
+		primitive.M{"$set": primitive.M{"next_attempt_at": nextAttemptAt}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	message.NextAttemptAt = nextAttemptAt
+	return &message, nil
+}
+
+func (r *outboxRepository) RedactLeads(ctx *context.Context, ids []primitive.ObjectID) (int64, error) {
+	keys := make(primitive.A, len(ids))
+	for i, id := range ids {
+		keys[i] = id.Hex()
+	}
+
+	result, err := r.coll.UpdateMany(*ctx,
+		primitive.M{"records.key": primitive.M{"$in": keys}},
+		primitive.M{"$pull": primitive.M{"records": primitive.M{"key": primitive.M{"$in": keys}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
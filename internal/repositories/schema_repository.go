@@ -12,24 +12,34 @@ import (
 type SchemaRepository interface {
 	Create(ctx *context.Context, schema *domain.Schema) error
 	FindById(ctx *context.Context, id string) (*domain.Schema, error)
+	FindWithRetention(ctx *context.Context) ([]*domain.Schema, error)
+	UpdateRetention(ctx *context.Context, id primitive.ObjectID, retention *domain.Retention) error
 }
 
-func NewSchemaRepository(collName string, db *mongo.Database) SchemaRepository {
+func NewSchemaRepository(collName string, dbs *TenantDatabases) SchemaRepository {
 	return &schemaRepository{
-		coll: db.Collection(collName),
+		collName: collName,
+		dbs:      dbs,
 	}
 }
 
 type schemaRepository struct {
-	coll *mongo.Collection
+	collName string
+	dbs      *TenantDatabases
 }
 
 func (r *schemaRepository) Create(ctx *context.Context, schema *domain.Schema) error {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return err
+	}
+
 	schema.ID = primitive.NewObjectID()
+	schema.TenantId = tenantOf(ctx, schema.TenantId)
 	schema.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
 	schema.UpdatedAt = schema.CreatedAt
 
-	_, err := r.coll.InsertOne(*ctx, schema)
+	_, err = coll.InsertOne(*ctx, schema)
 	if err != nil {
 		return err
 	}
@@ -43,11 +53,61 @@ func (r *schemaRepository) FindById(ctx *context.Context, id string) (*domain.Sc
 		return nil, err
 	}
 
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
 	var schema domain.Schema
-	err = r.coll.FindOne(*ctx, primitive.M{"_id": objID}).Decode(&schema)
+	err = coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&schema)
 	if err != nil {
 		return nil, err
 	}
 
 	return &schema, nil
 }
+
+func (r *schemaRepository) FindWithRetention(ctx *context.Context) ([]*domain.Schema, error) {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := coll.Find(*ctx, tenantFilter(ctx, primitive.M{"retention": primitive.M{"$exists": true}}))
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make([]*domain.Schema, 0)
+	err = cursor.All(*ctx, &schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas, nil
+}
+
+// UpdateRetention sets the retention of the schema, or removes it when nil.
+func (r *schemaRepository) UpdateRetention(ctx *context.Context, id primitive.ObjectID, retention *domain.Retention) error {
+	coll, err := r.dbs.Collection(ctx, r.collName)
+	if err != nil {
+		return err
+	}
+
+	update := primitive.M{"$set": primitive.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())}}
+	if retention != nil {
+		update["$set"].(primitive.M)["retention"] = retention
+	} else {
+		update["$unset"] = primitive.M{"retention": ""}
+	}
+
+	result, err := coll.UpdateOne(*ctx, tenantFilter(ctx, primitive.M{"_id": id}), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
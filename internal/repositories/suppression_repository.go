@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SuppressionRepository interface {
+	// Create adds the suppression unless the tenant holds its hash already,
+	// and returns the one stored and whether it was added.
+	Create(ctx *context.Context, suppression *domain.Suppression) (*domain.Suppression, bool, error)
+	// CreateMany adds the suppressions the tenant does not hold yet and
+	// returns how many were added.
+	CreateMany(ctx *context.Context, suppressions []*domain.Suppression) (int64, error)
+	FindById(ctx *context.Context, id string) (*domain.Suppression, error)
+	FindAll(ctx *context.Context, filter *domain.SuppressionFilter) ([]*domain.Suppression, error)
+	// FindSuppressed returns which of the hashes the tenant suppressed.
+	FindSuppressed(ctx *context.Context, hashes []string) (map[string]bool, error)
+	Delete(ctx *context.Context, id string) error
+}
+
+func NewSuppressionRepository(collName string, db *mongo.Database) SuppressionRepository {
+	return &suppressionRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type suppressionRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *suppressionRepository) Create(ctx *context.Context, suppression *domain.Suppression) (*domain.Suppression, bool, error) {
+	suppression.ID = primitive.NewObjectID()
+	suppression.TenantId = tenantOf(ctx, suppression.TenantId)
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	filter := primitive.M{"tenant_id": suppression.TenantId, "hash": suppression.Hash}
+
+	var stored domain.Suppression
+	err := r.coll.FindOneAndUpdate(*ctx, filter, primitive.M{"$setOnInsert": suppression}, opts).Decode(&stored)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &stored, stored.ID == suppression.ID, nil
+}
+
+func (r *suppressionRepository) CreateMany(ctx *context.Context, suppressions []*domain.Suppression) (int64, error) {
+	if len(suppressions) == 0 {
+		return 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(suppressions))
+	for _, suppression := range suppressions {
+		suppression.ID = primitive.NewObjectID()
+		suppression.TenantId = tenantOf(ctx, suppression.TenantId)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(primitive.M{"tenant_id": suppression.TenantId, "hash": suppression.Hash}).
+			SetUpdate(primitive.M{"$setOnInsert": suppression}).
+			SetUpsert(true))
+	}
+
+	result, err := r.coll.BulkWrite(*ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.UpsertedCount, nil
+}
+
+func (r *suppressionRepository) FindById(ctx *context.Context, id string) (*domain.Suppression, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var suppression domain.Suppression
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&suppression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &suppression, nil
+}
+
+func (r *suppressionRepository) FindAll(ctx *context.Context, filter *domain.SuppressionFilter) ([]*domain.Suppression, error) {
+	query := primitive.M{}
+	if filter.Kind != "" {
+		query["kind"] = filter.Kind
+	}
+	if len(filter.Hashes) > 0 {
+		query["hash"] = primitive.M{"$in": filter.Hashes}
+	}
+	if filter.Reason != "" {
+		query["reason"] = filter.Reason
+	}
+	if !filter.After.IsZero() {
+		query["_id"] = primitive.M{"$lt": filter.After}
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "_id", Value: -1}}).SetLimit(filter.Limit)
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, query), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	suppressions := make([]*domain.Suppression, 0)
+	err = cursor.All(*ctx, &suppressions)
+	if err != nil {
+		return nil, err
+	}
+
+	return suppressions, nil
+}
+
+func (r *suppressionRepository) FindSuppressed(ctx *context.Context, hashes []string) (map[string]bool, error) {
+	suppressed := make(map[string]bool)
+	if len(hashes) == 0 {
+		return suppressed, nil
+	}
+
+	opts := options.Find().SetProjection(primitive.M{"hash": 1})
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, primitive.M{"hash": primitive.M{"$in": hashes}}), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []domain.Suppression
+	err = cursor.All(*ctx, &found)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, suppression := range found {
+		suppressed[suppression.Hash] = true
+	}
+
+	return suppressed, nil
+}
+
+func (r *suppressionRepository) Delete(ctx *context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.coll.DeleteOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
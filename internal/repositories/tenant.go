@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tenantFilter scopes the filter to the tenant of the context. Contexts
+// without a tenant, those of the background workers, see every tenant.
+func tenantFilter(ctx *context.Context, filter primitive.M) primitive.M {
+	if tenant, ok := domain.TenantFromContext(*ctx); ok {
+		filter["tenant_id"] = tenant
+	}
+	return filter
+}
+
+// tenantOf returns the tenant a new record belongs to: the tenant of the
+// context, else the one the record was given by the background work that
+// created it, else the default tenant.
+func tenantOf(ctx *context.Context, tenant string) string {
+	if ctxTenant, ok := domain.TenantFromContext(*ctx); ok {
+		return ctxTenant
+	}
+	if tenant != "" {
+		return tenant
+	}
+	return domain.DefaultTenant
+}
+
+// TenantDatabases holds the schemas, leads and imports of the tenants. They
+// all share one database unless a prefix is set, in which case each tenant
+// gets its own database, named after the prefix and the tenant, which setup
+// prepares the first time it is used.
+type TenantDatabases struct {
+	db     *mongo.Database
+	prefix string
+	setup  func(ctx context.Context, db *mongo.Database) error
+
+	mu    sync.Mutex
+	ready map[string]bool
+}
+
+func NewTenantDatabases(db *mongo.Database, prefix string, setup func(ctx context.Context, db *mongo.Database) error) *TenantDatabases {
+	return &TenantDatabases{
+		db:     db,
+		prefix: prefix,
+		setup:  setup,
+		ready:  make(map[string]bool),
+	}
+}
+
+// Collection returns the collection of the tenant of the context. With a
+// database per tenant, a context without a tenant fails with
+// domain.ErrTenantRequired rather than guess a database.
+func (td *TenantDatabases) Collection(ctx *context.Context, name string) (*mongo.Collection, error) {
+	if td.prefix == "" {
+		return td.db.Collection(name), nil
+	}
+
+	tenant, ok := domain.TenantFromContext(*ctx)
+	if !ok {
+		return nil, domain.ErrTenantRequired
+	}
+
+	db := td.db.Client().Database(td.prefix + tenant)
+
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if !td.ready[tenant] && td.setup != nil {
+		if err := td.setup(*ctx, db); err != nil {
+			return nil, err
+		}
+	}
+	td.ready[tenant] = true
+
+	return db.Collection(name), nil
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TenantRepository interface {
+	// FindAll returns the tenants holding schemas, for the background work
+	// that runs in every tenant.
+	FindAll(ctx *context.Context) ([]string, error)
+}
+
+func NewTenantRepository(schemaCollName string, dbs *TenantDatabases) TenantRepository {
+	return &tenantRepository{
+		schemaCollName: schemaCollName,
+		dbs:            dbs,
+	}
+}
+
+type tenantRepository struct {
+	schemaCollName string
+	dbs            *TenantDatabases
+}
+
+// FindAll reads the tenants off the schemas when they share a database, and
+// off the names of their databases otherwise.
+func (r *tenantRepository) FindAll(ctx *context.Context) ([]string, error) {
+	if r.dbs.prefix == "" {
+		values, err := r.dbs.db.Collection(r.schemaCollName).Distinct(*ctx, "tenant_id", primitive.M{})
+		if err != nil {
+			return nil, err
+		}
+
+		tenants := make([]string, 0, len(values))
+		for _, value := range values {
+			if tenant, ok := value.(string); ok {
+				tenants = append(tenants, tenant)
+			}
+		}
+		return tenants, nil
+	}
+
+	names, err := r.dbs.db.Client().ListDatabaseNames(*ctx, primitive.M{
+		"name": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(r.dbs.prefix)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := make([]string, 0, len(names))
+	for _, name := range names {
+		tenant := strings.TrimPrefix(name, r.dbs.prefix)
+		if domain.ValidateTenant(tenant) == nil {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants, nil
+}
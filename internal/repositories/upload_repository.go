@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UploadRepository interface {
+	Create(ctx *context.Context, upload *domain.UploadSession) error
+	Update(ctx *context.Context, upload *domain.UploadSession) error
+	FindById(ctx *context.Context, id string) (*domain.UploadSession, error)
+	AdvanceOffset(ctx *context.Context, upload *domain.UploadSession, offset int64, expiresAt time.Time) error
+	FindExpired(ctx *context.Context, now time.Time) ([]*domain.UploadSession, error)
+}
+
+func NewUploadRepository(collName string, db *mongo.Database) UploadRepository {
+	return &uploadRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type uploadRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *uploadRepository) Create(ctx *context.Context, upload *domain.UploadSession) error {
+	upload.ID = primitive.NewObjectID()
+	upload.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	upload.UpdatedAt = upload.CreatedAt
+
+	upload.TenantId = tenantOf(ctx, upload.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, upload)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *uploadRepository) Update(ctx *context.Context, upload *domain.UploadSession) error {
+	upload.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	_, err := r.coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": upload.ID}), upload)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *uploadRepository) FindById(ctx *context.Context, id string) (*domain.UploadSession, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var upload domain.UploadSession
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&upload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+// AdvanceOffset moves the offset of an open session forward and pushes back
+// its expiry, failing with domain.ErrUploadOffsetMismatch when another chunk
+// got there first.
+func (r *uploadRepository) AdvanceOffset(ctx *context.Context, upload *domain.UploadSession, offset int64, expiresAt time.Time) error {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	expires := primitive.NewDateTimeFromTime(expiresAt)
+
+	result, err := r.coll.UpdateOne(*ctx,
+		primitive.M{"_id": upload.ID, "offset": upload.Offset, "status": domain.UploadStatusOpen},
+		primitive.M{"$set": primitive.M{"offset": offset, "updated_at": now, "expires_at": expires}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return domain.ErrUploadOffsetMismatch
+	}
+
+	upload.Offset = offset
+	upload.UpdatedAt = now
+	upload.ExpiresAt = expires
+	return nil
+}
+
+func (r *uploadRepository) FindExpired(ctx *context.Context, now time.Time) ([]*domain.UploadSession, error) {
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, primitive.M{
+		"status":     domain.UploadStatusOpen,
+		"expires_at": primitive.M{"$lt": primitive.NewDateTimeFromTime(now)},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]*domain.UploadSession, 0)
+	err = cursor.All(*ctx, &uploads)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UsageRepository interface {
+	AddRows(ctx *context.Context, day string, rows int64) error
+	ReserveRows(ctx *context.Context, day string, rows, limit int64) (bool, error)
+	FindByDay(ctx *context.Context, day string) (*domain.Usage, error)
+}
+
+func NewUsageRepository(collName string, db *mongo.Database) UsageRepository {
+	return &usageRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type usageRepository struct {
+	coll *mongo.Collection
+}
+
+// AddRows counts the rows towards the usage of the tenant of the context on
+// the day, creating the usage of the day when it is the first.
+func (r *usageRepository) AddRows(ctx *context.Context, day string, rows int64) error {
+	filter := primitive.M{"tenant_id": tenantOf(ctx, ""), "day": day}
+	update := primitive.M{
+		"$inc":         primitive.M{"rows": rows},
+		"$set":         primitive.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())},
+		"$setOnInsert": primitive.M{"_id": primitive.NewObjectID()},
+	}
+
+	_, err := r.coll.UpdateOne(*ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReserveRows counts the rows towards the usage of the tenant of the context
+// on the day only when it stays within limit, returning whether it did. The
+// check and the count are a single update, so concurrent writers can not both
+// take the last rows of the day.
+func (r *usageRepository) ReserveRows(ctx *context.Context, day string, rows, limit int64) (bool, error) {
+	if rows > limit {
+		return false, nil
+	}
+
+	// the usage of the day is created first, as an upsert with the condition
+	// would insert another one whenever the condition fails
+	filter := primitive.M{"tenant_id": tenantOf(ctx, ""), "day": day}
+	create := primitive.M{"$setOnInsert": primitive.M{
+		"_id":        primitive.NewObjectID(),
+		"rows":       int64(0),
+		"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+	}}
+	_, err := r.coll.UpdateOne(*ctx, filter, create, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	filter["rows"] = primitive.M{"$lte": limit - rows}
+	update := primitive.M{
+		"$inc": primitive.M{"rows": rows},
+		"$set": primitive.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())},
+	}
+	result, err := r.coll.UpdateOne(*ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// FindByDay returns the usage of the tenant of the context on the day, empty
+// when nothing was counted yet.
+func (r *usageRepository) FindByDay(ctx *context.Context, day string) (*domain.Usage, error) {
+	tenant := tenantOf(ctx, "")
+
+	var usage domain.Usage
+	err := r.coll.FindOne(*ctx, primitive.M{"tenant_id": tenant, "day": day}).Decode(&usage)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &domain.Usage{TenantId: tenant, Day: day}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookDeliveryRepository interface {
+	CreateMany(ctx *context.Context, deliveries []*domain.WebhookDelivery) error
+	Update(ctx *context.Context, delivery *domain.WebhookDelivery) error
+	FindById(ctx *context.Context, id string) (*domain.WebhookDelivery, error)
+	FindByWebhookId(ctx *context.Context, webhookId primitive.ObjectID, status string, limit int64) ([]*domain.WebhookDelivery, error)
+	ClaimDue(ctx *context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error)
+	// FindByLeadIds returns the lead.created deliveries whose payload holds
+	// any of the leads, whatever their status.
+	FindByLeadIds(ctx *context.Context, ids []primitive.ObjectID) ([]*domain.WebhookDelivery, error)
+}
+
+func NewWebhookDeliveryRepository(collName string, db *mongo.Database) WebhookDeliveryRepository {
+	return &webhookDeliveryRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type webhookDeliveryRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *webhookDeliveryRepository) CreateMany(ctx *context.Context, deliveries []*domain.WebhookDelivery) error {
+	docs := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		delivery.ID = primitive.NewObjectID()
+		delivery.TenantId = tenantOf(ctx, delivery.TenantId)
+		docs[i] = delivery
+	}
+
+	_, err := r.coll.InsertMany(*ctx, docs)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *webhookDeliveryRepository) Update(ctx *context.Context, delivery *domain.WebhookDelivery) error {
+	_, err := r.coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": delivery.ID}), delivery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *webhookDeliveryRepository) FindById(ctx *context.Context, id string) (*domain.WebhookDelivery, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery domain.WebhookDelivery
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// FindByWebhookId returns the newest deliveries of the webhook, only those
+// with the given status unless it is empty.
+func (r *webhookDeliveryRepository) FindByWebhookId(ctx *context.Context, webhookId primitive.ObjectID, status string, limit int64) ([]*domain.WebhookDelivery, error) {
+	filter := primitive.M{"webhook_id": webhookId}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(primitive.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	err = cursor.All(*ctx, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDue takes the oldest pending delivery that is due and pushes its next
+// attempt back by lease, so no other dispatcher picks it up while it is being
+// sent. It returns mongo.ErrNoDocuments when nothing is due.
+func (r *webhookDeliveryRepository) ClaimDue(ctx *context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(primitive.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery domain.WebhookDelivery
+	err := r.coll.FindOneAndUpdate(*ctx,
+		primitive.M{
+			"status":          domain.WebhookDeliveryStatusPending,
+			"next_attempt_at": primitive.M{"$lte": primitive.NewDateTimeFromTime(now)},
+		},
+		primitive.M{"$set": primitive.M{"next_attempt_at": primitive.NewDateTimeFromTime(now.Add(lease))}},
+		opts,
+	).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (r *webhookDeliveryRepository) FindByLeadIds(ctx *context.Context, ids []primitive.ObjectID) ([]*domain.WebhookDelivery, error) {
+	if len(ids) == 0 {
+		return []*domain.WebhookDelivery{}, nil
+	}
+
+	// the payload is the JSON of the event, where lead IDs are hex strings
+	hexes := make([]string, len(ids))
+	for i, id := range ids {
+		hexes[i] = id.Hex()
+	}
+	filter := primitive.M{
+		"event":   domain.EventLeadCreated,
+		"payload": primitive.M{"$regex": strings.Join(hexes, "|")},
+	}
+
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	err = cursor.All(*ctx, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookRepository interface {
+	Create(ctx *context.Context, webhook *domain.Webhook) error
+	Update(ctx *context.Context, webhook *domain.Webhook) error
+	Delete(ctx *context.Context, id string) error
+	FindById(ctx *context.Context, id string) (*domain.Webhook, error)
+	FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.Webhook, error)
+	FindSubscribed(ctx *context.Context, schemaId primitive.ObjectID, event string) ([]*domain.Webhook, error)
+}
+
+func NewWebhookRepository(collName string, db *mongo.Database) WebhookRepository {
+	return &webhookRepository{
+		coll: db.Collection(collName),
+	}
+}
+
+type webhookRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *webhookRepository) Create(ctx *context.Context, webhook *domain.Webhook) error {
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	webhook.UpdatedAt = webhook.CreatedAt
+
+	webhook.TenantId = tenantOf(ctx, webhook.TenantId)
+
+	_, err := r.coll.InsertOne(*ctx, webhook)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) Update(ctx *context.Context, webhook *domain.Webhook) error {
+	webhook.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	result, err := r.coll.ReplaceOne(*ctx, tenantFilter(ctx, primitive.M{"_id": webhook.ID}), webhook)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) Delete(ctx *context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.coll.DeleteOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) FindById(ctx *context.Context, id string) (*domain.Webhook, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook domain.Webhook
+	err = r.coll.FindOne(*ctx, tenantFilter(ctx, primitive.M{"_id": objID})).Decode(&webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (r *webhookRepository) FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.Webhook, error) {
+	objID, err := primitive.ObjectIDFromHex(schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.find(ctx, primitive.M{"schema_id": objID})
+}
+
+func (r *webhookRepository) FindSubscribed(ctx *context.Context, schemaId primitive.ObjectID, event string) ([]*domain.Webhook, error) {
+	return r.find(ctx, primitive.M{"schema_id": schemaId, "events": event, "enabled": true})
+}
+
+func (r *webhookRepository) find(ctx *context.Context, filter primitive.M) ([]*domain.Webhook, error) {
+	opts := options.Find().SetSort(primitive.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.coll.Find(*ctx, tenantFilter(ctx, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*domain.Webhook, 0)
+	err = cursor.All(*ctx, &webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in clear to identify it.
+const apiKeyPrefixLength = 12
+
+type APIKeyService struct {
+	APIKeyRepository repositories.APIKeyRepository
+}
+
+func NewAPIKeyService(akr repositories.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{
+		APIKeyRepository: akr,
+	}
+}
+
+// Create generates the key and stores its hash. The key itself is only
+// returned here. Keys belong to the tenant of the caller, and only callers of
+// the default tenant can create keys for another tenant.
+func (as *APIKeyService) Create(ctx *context.Context, key *domain.APIKey) (*domain.APIKey, error) {
+	now := time.Now()
+	if err := key.Validate(now); err != nil {
+		return nil, err
+	}
+
+	if key.TenantId != "" {
+		if err := domain.ValidateTenant(key.TenantId); err != nil {
+			return nil, err
+		}
+		if tenant, ok := domain.TenantFromContext(*ctx); ok && tenant != key.TenantId {
+			if tenant != domain.DefaultTenant {
+				return nil, domain.ErrForbidden
+			}
+			tenantCtx := domain.ContextWithTenant(*ctx, key.TenantId)
+			ctx = &tenantCtx
+		}
+	}
+
+	secret, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key.Key = secret
+	key.Prefix = secret[:apiKeyPrefixLength]
+	key.Hash = hashAPIKey(secret)
+	key.RevokedAt = 0
+	key.CreatedAt = primitive.NewDateTimeFromTime(now)
+
+	err = as.APIKeyRepository.Create(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EnsureAdminKey stores the given key as an admin key unless it already is,
+// so that a first key can be configured to create the others.
+func (as *APIKeyService) EnsureAdminKey(ctx *context.Context, name, secret string) error {
+	_, err := as.APIKeyRepository.FindByHash(ctx, hashAPIKey(secret))
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	return as.APIKeyRepository.Create(ctx, &domain.APIKey{
+		Name:      name,
+		Prefix:    secret[:min(len(secret), apiKeyPrefixLength)],
+		Hash:      hashAPIKey(secret),
+		Scopes:    []string{domain.ScopeAdmin},
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	})
+}
+
+func (as *APIKeyService) FindAll(ctx *context.Context) ([]*domain.APIKey, error) {
+	return as.APIKeyRepository.FindAll(ctx)
+}
+
+func (as *APIKeyService) FindById(ctx *context.Context, id string) (*domain.APIKey, error) {
+	return as.APIKeyRepository.FindById(ctx, id)
+}
+
+// Revoke disables the key for good. Revoking a revoked key keeps the time it
+// was first revoked.
+func (as *APIKeyService) Revoke(ctx *context.Context, id string) (*domain.APIKey, error) {
+	key, err := as.APIKeyRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.RevokedAt == 0 {
+		key.Revoke()
+		err = as.APIKeyRepository.Update(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Authenticate finds the active key and checks that it grants the scopes.
+// Unknown, expired and revoked keys are all reported as ErrUnauthorized.
+func (as *APIKeyService) Authenticate(ctx *context.Context, secret string, scopes []string) (*domain.APIKey, error) {
+	if secret == "" {
+		return nil, domain.ErrUnauthorized
+	}
+
+	key, err := as.APIKeyRepository.FindByHash(ctx, hashAPIKey(secret))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, domain.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.IsActive(time.Now()) {
+		return nil, domain.ErrUnauthorized
+	}
+	if !key.HasScopes(scopes) {
+		return nil, domain.ErrForbidden
+	}
+
+	return key, nil
+}
+
+func newAPIKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "lsk_" + hex.EncodeToString(secret), nil
+}
+
+// hashAPIKey uses a plain SHA-256, enough for random keys of 256 bits, so a
+// key is found by its hash.
+func hashAPIKey(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
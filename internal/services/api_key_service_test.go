@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAPIKeyService_Create(t *testing.T) {
+	ctx := context.Background()
+
+	_ = t.Run("success", func(t *testing.T) {
+		// arrange
+		repository := NewAPIKeyRepositoryMock()
+		service := NewAPIKeyService(repository)
+
+		// act
+		key, err := service.Create(&ctx, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead}})
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.True(t, strings.HasPrefix(key.Key, "lsk_"))
+			_ = assert.Equal(t, key.Key[:apiKeyPrefixLength], key.Prefix)
+			_ = assert.Len(t, repository.keys, 1)
+			_ = assert.Equal(t, hashAPIKey(key.Key), repository.keys[0].Hash)
+		}
+	})
+
+	_ = t.Run("invalid settings", func(t *testing.T) {
+		// arrange
+		service := NewAPIKeyService(NewAPIKeyRepositoryMock())
+
+		// act
+		_, noScopeErr := service.Create(&ctx, &domain.APIKey{Name: "crm"})
+		_, unknownScopeErr := service.Create(&ctx, &domain.APIKey{Name: "crm", Scopes: []string{"leads:delete"}})
+		_, expiredErr := service.Create(&ctx, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead},
+			ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))})
+
+		// assert
+		_ = assert.ErrorIs(t, noScopeErr, domain.ErrInvalidAPIKeySettings)
+		_ = assert.ErrorIs(t, unknownScopeErr, domain.ErrInvalidAPIKeySettings)
+		_ = assert.ErrorIs(t, expiredErr, domain.ErrInvalidAPIKeySettings)
+	})
+
+	_ = t.Run("tenant of the key", func(t *testing.T) {
+		// arrange
+		service := NewAPIKeyService(NewAPIKeyRepositoryMock())
+		operatorCtx := domain.ContextWithTenant(ctx, domain.DefaultTenant)
+		tenantCtx := domain.ContextWithTenant(ctx, "acme")
+
+		// act
+		key, operatorErr := service.Create(&operatorCtx, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead}, TenantId: "acme"})
+		_, tenantErr := service.Create(&tenantCtx, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead}, TenantId: "globex"})
+		_, invalidErr := service.Create(&operatorCtx, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead}, TenantId: "acme corp"})
+
+		// assert
+		if assert.NoError(t, operatorErr) {
+			_ = assert.Equal(t, "acme", key.Principal().Tenant)
+		}
+		_ = assert.ErrorIs(t, tenantErr, domain.ErrForbidden)
+		_ = assert.ErrorIs(t, invalidErr, domain.ErrInvalidTenant)
+	})
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	ctx := context.Background()
+
+	newKey := func(t *testing.T, service *APIKeyService, key *domain.APIKey) *domain.APIKey {
+		created, err := service.Create(&ctx, key)
+		if err != nil {
+			t.Fatal("Failed to create API key:", err)
+		}
+		return created
+	}
+
+	_ = t.Run("grants the scopes of the key", func(t *testing.T) {
+		// arrange
+		service := NewAPIKeyService(NewAPIKeyRepositoryMock())
+		key := newKey(t, service, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead}})
+		admin := newKey(t, service, &domain.APIKey{Name: "ops", Scopes: []string{domain.ScopeAdmin}})
+
+		// act
+		found, readErr := service.Authenticate(&ctx, key.Key, []string{domain.ScopeLeadsRead})
+		_, uploadErr := service.Authenticate(&ctx, key.Key, []string{domain.ScopeLeadsUpload})
+		_, adminErr := service.Authenticate(&ctx, admin.Key, []string{domain.ScopeSchemaWrite})
+
+		// assert
+		if assert.NoError(t, readErr) {
+			_ = assert.Equal(t, key.ID, found.ID)
+		}
+		_ = assert.ErrorIs(t, uploadErr, domain.ErrForbidden)
+		_ = assert.NoError(t, adminErr)
+	})
+
+	_ = t.Run("rejects unknown, revoked and expired keys", func(t *testing.T) {
+		// arrange
+		repository := NewAPIKeyRepositoryMock()
+		service := NewAPIKeyService(repository)
+		revoked := newKey(t, service, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead}})
+		expired := newKey(t, service, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsRead},
+			ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))})
+		repository.keys[1].ExpiresAt = primitive.NewDateTimeFromTime(time.Now().Add(-time.Minute))
+
+		_, err := service.Revoke(&ctx, revoked.ID.Hex())
+		if err != nil {
+			t.Fatal("Failed to revoke API key:", err)
+		}
+
+		// act
+		_, missingErr := service.Authenticate(&ctx, "", nil)
+		_, unknownErr := service.Authenticate(&ctx, "lsk_unknown", nil)
+		_, revokedErr := service.Authenticate(&ctx, revoked.Key, nil)
+		_, expiredErr := service.Authenticate(&ctx, expired.Key, nil)
+
+		// assert
+		_ = assert.ErrorIs(t, missingErr, domain.ErrUnauthorized)
+		_ = assert.ErrorIs(t, unknownErr, domain.ErrUnauthorized)
+		_ = assert.ErrorIs(t, revokedErr, domain.ErrUnauthorized)
+		_ = assert.ErrorIs(t, expiredErr, domain.ErrUnauthorized)
+	})
+}
+
+func TestAPIKeyService_EnsureAdminKey(t *testing.T) {
+	ctx := context.Background()
+
+	_ = t.Run("stores the key once", func(t *testing.T) {
+		// arrange
+		repository := NewAPIKeyRepositoryMock()
+		service := NewAPIKeyService(repository)
+		secret := strings.Repeat("b", 32)
+
+		// act
+		firstErr := service.EnsureAdminKey(&ctx, "bootstrap", secret)
+		secondErr := service.EnsureAdminKey(&ctx, "bootstrap", secret)
+		_, authErr := service.Authenticate(&ctx, secret, []string{domain.ScopeAdmin})
+
+		// assert
+		_ = assert.NoError(t, firstErr)
+		_ = assert.NoError(t, secondErr)
+		_ = assert.Len(t, repository.keys, 1)
+		_ = assert.NoError(t, authErr)
+	})
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// auditChainAttempts is how many times an entry is chained again after
+	// another writer took its position in the chain.
+	auditChainAttempts = 5
+	// auditVerifyBatchSize is how many chained entries are read at once while
+	// the chain is verified.
+	auditVerifyBatchSize = 1000
+)
+
+type AuditOptions struct {
+	// HashChain chains every entry to the previous one of its tenant.
+	HashChain bool
+}
+
+// AuditService keeps the audit trail of the changes to schemas and leads.
+// The services that make the changes record them through a nil-safe
+// *AuditService, so changes are not audited when it is nil.
+type AuditService struct {
+	AuditRepository repositories.AuditRepository
+	Options         AuditOptions
+}
+
+func NewAuditService(ar repositories.AuditRepository, opts AuditOptions) *AuditService {
+	return &AuditService{
+		AuditRepository: ar,
+		Options:         opts,
+	}
+}
+
+// AuditQuery is a query of the audit trail as received, with From and To as
+// RFC 3339 times.
+type AuditQuery struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityId   string
+	RequestId  string
+	From       string
+	To         string
+	After      string
+	Limit      int64
+}
+
+// Record appends the action on the entity, by the caller of the context and
+// with the fields that differ between before and after. The change was made
+// already, so a failure to record it is logged rather than returned.
+func (as *AuditService) Record(ctx *context.Context, action, entityType, entityId string, before, after map[string]interface{}) {
+	if as == nil {
+		return
+	}
+
+	entry := domain.NewAuditEntry(callerOf(ctx), action, entityType, entityId, before, after)
+	entry.TenantId = tenantOfContext(ctx)
+	entry.RequestId = domain.RequestIdFromContext(*ctx)
+
+	if err := as.append(ctx, entry); err != nil {
+		log.Println("Failed to record audit entry "+action+" of "+entityType+" "+entityId+": ", err)
+	}
+}
+
+// append chains the entry after the last one of the tenant when the chain is
+// enabled, and chains it again when another writer took that position first.
+func (as *AuditService) append(ctx *context.Context, entry *domain.AuditEntry) error {
+	if !as.Options.HashChain {
+		return as.AuditRepository.Create(ctx, entry)
+	}
+
+	var err error
+	for attempt := 0; attempt < auditChainAttempts; attempt++ {
+		var previous *domain.AuditEntry
+		previous, err = as.AuditRepository.FindLastChained(ctx)
+		if err != nil {
+			return err
+		}
+
+		entry.Chain(previous)
+		err = as.AuditRepository.Create(ctx, entry)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (as *AuditService) List(ctx *context.Context, query AuditQuery) ([]*domain.AuditEntry, error) {
+	filter, err := auditFilterFromQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return as.AuditRepository.FindAll(ctx, filter)
+}
+
+// Verify walks the chain of the tenant and checks that every entry follows
+// the one before it and still holds its hash. Entries recorded before the
+// chain was enabled are not part of it.
+func (as *AuditService) Verify(ctx *context.Context) (*domain.AuditVerification, error) {
+	verification := &domain.AuditVerification{Valid: true}
+
+	var previous *domain.AuditEntry
+	for {
+		var afterSeq int64
+		if previous != nil {
+			afterSeq = previous.Seq
+		}
+
+		entries, err := as.AuditRepository.FindChained(ctx, afterSeq, auditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return verification, nil
+		}
+
+		for _, entry := range entries {
+			verification.Entries++
+			if !followsInChain(previous, entry) {
+				verification.Valid = false
+				verification.BrokenAt = entry.Seq
+				return verification, nil
+			}
+			previous = entry
+		}
+	}
+}
+
+// followsInChain reports whether the entry comes right after previous, nil
+// for the first entry, and was not changed since it was hashed.
+func followsInChain(previous, entry *domain.AuditEntry) bool {
+	seq, prevHash := int64(1), ""
+	if previous != nil {
+		seq, prevHash = previous.Seq+1, previous.Hash
+	}
+	return entry.Seq == seq && entry.PrevHash == prevHash && entry.Hash == entry.ComputeHash()
+}
+
+func auditFilterFromQuery(query AuditQuery) (*domain.AuditFilter, error) {
+	filter := &domain.AuditFilter{
+		Actor:      query.Actor,
+		Action:     query.Action,
+		EntityType: query.EntityType,
+		EntityId:   query.EntityId,
+		RequestId:  query.RequestId,
+		Limit:      query.Limit,
+	}
+
+	for _, bound := range []struct {
+		value string
+		into  *time.Time
+	}{{query.From, &filter.From}, {query.To, &filter.To}} {
+		if bound.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return nil, domain.ErrInvalidAuditQuery
+		}
+		*bound.into = parsed
+	}
+
+	if query.After != "" {
+		after, err := primitive.ObjectIDFromHex(query.After)
+		if err != nil {
+			return nil, domain.ErrInvalidAuditQuery
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
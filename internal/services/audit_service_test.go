@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuditService(t *testing.T) {
+	ctx := domain.ContextWithRequestId(domain.ContextWithPrincipal(domain.ContextWithTenant(context.Background(), "acme"),
+		&domain.Principal{Subject: "user-1", Method: domain.AuthMethodJWT}), "req-1")
+	newSchema := func() *domain.Schema {
+		return &domain.Schema{ID: primitive.NewObjectID(), Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		}}
+	}
+
+	_ = t.Run("success, a change is recorded with its caller, request and values", func(t *testing.T) {
+		// arrange
+		schema := newSchema()
+		schema.Retention = &domain.Retention{Days: 30}
+		repository := NewAuditRepositoryMock()
+		service := NewSchemaService(NewSchemaRepositoryMockWithSchema(schema), nil, NewAuditService(repository, AuditOptions{}))
+
+		// act
+		_, err := service.UpdateRetention(&ctx, schema.ID.Hex(), &domain.Retention{Days: 90})
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, repository.entries, 1) {
+			entry := repository.entries[0]
+			_ = assert.Equal(t, "acme", entry.TenantId)
+			_ = assert.Equal(t, "user-1", entry.Actor)
+			_ = assert.Equal(t, "req-1", entry.RequestId)
+			_ = assert.Equal(t, domain.AuditActionSchemaRetentionSet, entry.Action)
+			_ = assert.Equal(t, schema.ID.Hex(), entry.EntityId)
+			_ = assert.Equal(t, []domain.AuditChange{{Field: "retention", Before: `{"days":30}`, After: `{"days":90}`}}, entry.Changes)
+			_ = assert.Empty(t, entry.Hash)
+		}
+	})
+
+	_ = t.Run("changes of the background workers are recorded by the system", func(t *testing.T) {
+		// arrange
+		tenantCtx := domain.ContextWithTenant(context.Background(), "acme")
+		repository := NewAuditRepositoryMock()
+		service := NewAuditService(repository, AuditOptions{})
+
+		// act
+		service.Record(&tenantCtx, domain.AuditActionLeadsPurged, domain.AuditEntitySchema, "schema-1", nil, map[string]interface{}{"leads_purged": 3})
+
+		// assert
+		if assert.Len(t, repository.entries, 1) {
+			_ = assert.Equal(t, domain.AuditActorSystem, repository.entries[0].Actor)
+			_ = assert.Empty(t, repository.entries[0].RequestId)
+		}
+	})
+
+	_ = t.Run("success, a chain that was not changed is valid", func(t *testing.T) {
+		// arrange
+		repository := NewAuditRepositoryMock()
+		service := NewAuditService(repository, AuditOptions{HashChain: true})
+		for i := 0; i < 3; i++ {
+			service.Record(&ctx, domain.AuditActionLegalHoldPlaced, domain.AuditEntityLead, "lead-1", nil, map[string]interface{}{"legal_hold": true})
+		}
+
+		// act
+		verification, err := service.Verify(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, &domain.AuditVerification{Entries: 3, Valid: true}, verification)
+			_ = assert.Equal(t, repository.entries[0].Hash, repository.entries[1].PrevHash)
+		}
+	})
+
+	_ = t.Run("a changed or removed entry breaks the chain", func(t *testing.T) {
+		// arrange
+		changed := NewAuditRepositoryMock()
+		removed := NewAuditRepositoryMock()
+		for _, repository := range []*auditRepositoryMock{changed, removed} {
+			service := NewAuditService(repository, AuditOptions{HashChain: true})
+			for _, hold := range []bool{true, false, true} {
+				service.Record(&ctx, domain.AuditActionLegalHoldPlaced, domain.AuditEntityLead, "lead-1", nil, map[string]interface{}{"legal_hold": hold})
+			}
+		}
+		changed.entries[1].Actor = "someone-else"
+		removed.entries = append(removed.entries[:1], removed.entries[2:]...)
+
+		// act
+		changedVerification, changedErr := NewAuditService(changed, AuditOptions{}).Verify(&ctx)
+		removedVerification, removedErr := NewAuditService(removed, AuditOptions{}).Verify(&ctx)
+
+		// assert
+		if assert.NoError(t, changedErr) {
+			_ = assert.False(t, changedVerification.Valid)
+			_ = assert.Equal(t, int64(2), changedVerification.BrokenAt)
+		}
+		if assert.NoError(t, removedErr) {
+			_ = assert.False(t, removedVerification.Valid)
+			_ = assert.Equal(t, int64(3), removedVerification.BrokenAt)
+		}
+	})
+
+	_ = t.Run("an entry is chained again after another writer took its position", func(t *testing.T) {
+		// arrange
+		repository := NewAuditRepositoryMock()
+		service := NewAuditService(repository, AuditOptions{HashChain: true})
+		service.Record(&ctx, domain.AuditActionSchemaCreated, domain.AuditEntitySchema, "schema-1", nil, nil)
+		service.Record(&ctx, domain.AuditActionSchemaCreated, domain.AuditEntitySchema, "schema-2", nil, nil)
+		repository.staleReads = 1
+
+		// act
+		service.Record(&ctx, domain.AuditActionSchemaCreated, domain.AuditEntitySchema, "schema-3", nil, nil)
+		verification, err := service.Verify(&ctx)
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, repository.entries, 3) {
+			_ = assert.Equal(t, int64(3), repository.entries[2].Seq)
+			_ = assert.True(t, verification.Valid)
+		}
+	})
+
+	_ = t.Run("invalid time range", func(t *testing.T) {
+		// arrange
+		service := NewAuditService(NewAuditRepositoryMock(), AuditOptions{})
+
+		// act
+		_, err := service.List(&ctx, AuditQuery{From: "yesterday", Limit: 10})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidAuditQuery)
+	})
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+// Credentials are what a request authenticates with, an API key or a bearer
+// token.
+type Credentials struct {
+	APIKey      string
+	BearerToken string
+}
+
+// AuthService authenticates requests with API keys and, when TokenService is
+// set, with bearer tokens.
+type AuthService struct {
+	APIKeyService *APIKeyService
+	TokenService  *TokenService
+}
+
+func NewAuthService(aks *APIKeyService, ts *TokenService) *AuthService {
+	return &AuthService{
+		APIKeyService: aks,
+		TokenService:  ts,
+	}
+}
+
+// Authenticate returns the caller of the credentials, a bearer token taking
+// precedence over an API key, if it was granted every one of the scopes.
+func (as *AuthService) Authenticate(ctx *context.Context, credentials Credentials, scopes []string) (*domain.Principal, error) {
+	if credentials.BearerToken != "" {
+		if as.TokenService == nil {
+			return nil, domain.ErrUnauthorized
+		}
+		return as.TokenService.Authenticate(ctx, credentials.BearerToken, scopes)
+	}
+
+	key, err := as.APIKeyService.Authenticate(ctx, credentials.APIKey, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Principal(), nil
+}
+
+// callerOf returns the subject of the authenticated caller of the request, or
+// an empty string when there is none.
+func callerOf(ctx *context.Context) string {
+	if principal, ok := domain.PrincipalFromContext(*ctx); ok {
+		return principal.Subject
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+func TestAuthService_Authenticate(t *testing.T) {
+	ctx := context.Background()
+
+	_ = t.Run("api key", func(t *testing.T) {
+		// arrange
+		apiKeyService := NewAPIKeyService(NewAPIKeyRepositoryMock())
+		key, err := apiKeyService.Create(&ctx, &domain.APIKey{Name: "crm", Scopes: []string{domain.ScopeLeadsUpload}})
+		if err != nil {
+			t.Fatal("Failed to create API key:", err)
+		}
+		service := NewAuthService(apiKeyService, nil)
+
+		// act
+		principal, err := service.Authenticate(&ctx, Credentials{APIKey: key.Key}, []string{domain.ScopeLeadsUpload})
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, "api-key:"+key.ID.Hex(), principal.Subject)
+			_ = assert.Equal(t, "crm", principal.Name)
+			_ = assert.Equal(t, domain.AuthMethodAPIKey, principal.Method)
+		}
+	})
+
+	_ = t.Run("bearer token without token settings", func(t *testing.T) {
+		// arrange
+		service := NewAuthService(NewAPIKeyService(NewAPIKeyRepositoryMock()), nil)
+
+		// act
+		_, err := service.Authenticate(&ctx, Credentials{BearerToken: "token"}, nil)
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	})
+}
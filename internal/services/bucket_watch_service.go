@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	bucketDonePrefix   = "done/"
+	bucketFailedPrefix = "failed/"
+)
+
+// BucketWatch maps a bucket prefix to the schema its objects are ingested
+// into, in the tenant TenantId, the default tenant when empty. Processed
+// objects are moved below done/ or failed/ within the prefix.
+type BucketWatch struct {
+	TenantId string
+	SchemaId string
+	Bucket   string
+	Prefix   string
+}
+
+// BucketWatchOptions configures the bucket watcher. Objects are downloaded to
+// Dir before being ingested, and an object left processing for longer than
+// Lease is taken over by another instance.
+type BucketWatchOptions struct {
+	Dir     string
+	Lease   time.Duration
+	Watches []BucketWatch
+}
+
+type BucketWatchService struct {
+	ObjectRepository          repositories.ObjectRepository
+	ObjectIngestionRepository repositories.ObjectIngestionRepository
+	FileService               *FileService
+	Options                   BucketWatchOptions
+}
+
+func NewBucketWatchService(or repositories.ObjectRepository, oir repositories.ObjectIngestionRepository, fs *FileService, opts BucketWatchOptions) *BucketWatchService {
+	return &BucketWatchService{
+		ObjectRepository:          or,
+		ObjectIngestionRepository: oir,
+		FileService:               fs,
+		Options:                   opts,
+	}
+}
+
+// Poll ingests the new objects of every watched prefix and returns how many
+// were ingested. An object that fails does not stop the others.
+func (bs *BucketWatchService) Poll(ctx *context.Context) (int, error) {
+	ingested := 0
+	var errs []error
+
+	for _, watch := range bs.Options.Watches {
+		objects, err := bs.ObjectRepository.List(ctx, watch.Bucket, watch.Prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, object := range objects {
+			if isProcessedObject(watch, object) {
+				continue
+			}
+
+			ok, err := bs.ingest(withTenant(ctx, watch.TenantId), watch, object)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("s3://%s/%s: %w", object.Bucket, object.Key, err))
+			}
+			if ok {
+				ingested++
+			}
+		}
+	}
+
+	return ingested, errors.Join(errs...)
+}
+
+func (bs *BucketWatchService) Run(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			ingested, err := bs.Poll(ctx)
+			if err != nil {
+				log.Println("Failed to ingest bucket objects: ", err)
+			}
+			if ingested > 0 {
+				log.Printf("Ingested %d bucket objects", ingested)
+			}
+		}
+	}
+}
+
+// ingest claims the object and runs it through the ingestion pipeline. An
+// object whose earlier attempt finished but was not moved is only moved, and
+// a failed object dropped again, or an object whose claim was abandoned, is
+// retried.
+func (bs *BucketWatchService) ingest(ctx *context.Context, watch BucketWatch, object *domain.StoredObject) (bool, error) {
+	ingestion, err := bs.ObjectIngestionRepository.FindByObject(ctx, object)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		schemaId, err := primitive.ObjectIDFromHex(watch.SchemaId)
+		if err != nil {
+			return false, err
+		}
+		ingestion = domain.NewObjectIngestion(schemaId, object)
+		err = bs.ObjectIngestionRepository.Create(ctx, ingestion)
+		if err != nil {
+			return false, ignoreClaimed(err)
+		}
+	case err != nil:
+		return false, err
+	case ingestion.Status == domain.ObjectIngestionStatusProcessing && !ingestion.IsAbandoned(time.Now(), bs.Options.Lease):
+		return false, nil
+	case ingestion.Status != domain.ObjectIngestionStatusProcessing && ingestion.MovedTo == "":
+		return false, bs.move(ctx, watch, object, ingestion)
+	case ingestion.Status != domain.ObjectIngestionStatusDone:
+		err = bs.ObjectIngestionRepository.Retry(ctx, ingestion, time.Now(), bs.Options.Lease)
+		if err != nil {
+			return false, ignoreClaimed(err)
+		}
+	default:
+		// the same version was already ingested and dropped again
+		return false, bs.move(ctx, watch, object, ingestion)
+	}
+
+	imports, err := bs.process(ctx, watch, object, ingestion)
+	ingestion.Finish(imports, err)
+	if err := bs.ObjectIngestionRepository.Update(ctx, ingestion); err != nil {
+		return true, err
+	}
+
+	return true, bs.move(ctx, watch, object, ingestion)
+}
+
+func (bs *BucketWatchService) process(ctx *context.Context, watch BucketWatch, object *domain.StoredObject, ingestion *domain.ObjectIngestion) ([]*domain.Import, error) {
+	if err := os.MkdirAll(bs.Options.Dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	localPath := filepath.Join(bs.Options.Dir, ingestion.ID.Hex()+".object")
+	defer func() {
+		if err := os.Remove(localPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Println("Failed to remove downloaded object: ", err)
+		}
+	}()
+
+	err := bs.ObjectRepository.Download(ctx, object, localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := domain.NewLocalFile(watch.SchemaId, path.Base(object.Key), localPath)
+	if err != nil {
+		return nil, err
+	}
+	file.Uploader = fmt.Sprintf("s3://%s/%s", object.Bucket, object.Key)
+
+	return bs.FileService.ProcessAndSave(ctx, file)
+}
+
+func (bs *BucketWatchService) move(ctx *context.Context, watch BucketWatch, object *domain.StoredObject, ingestion *domain.ObjectIngestion) error {
+	destination := bucketDonePrefix
+	if ingestion.Status == domain.ObjectIngestionStatusFailed {
+		destination = bucketFailedPrefix
+	}
+	destination = watch.Prefix + destination + strings.TrimPrefix(object.Key, watch.Prefix)
+
+	err := bs.ObjectRepository.Move(ctx, object, destination)
+	if err != nil {
+		return err
+	}
+
+	ingestion.MovedTo = destination
+	return bs.ObjectIngestionRepository.Update(ctx, ingestion)
+}
+
+// isProcessedObject reports objects already moved below done/ or failed/, and
+// the empty objects some clients create to represent folders.
+func isProcessedObject(watch BucketWatch, object *domain.StoredObject) bool {
+	relative := strings.TrimPrefix(object.Key, watch.Prefix)
+	return strings.HasPrefix(relative, bucketDonePrefix) ||
+		strings.HasPrefix(relative, bucketFailedPrefix) ||
+		strings.HasSuffix(object.Key, "/")
+}
+
+func ignoreClaimed(err error) error {
+	if errors.Is(err, domain.ErrObjectClaimed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBucketWatchService_Poll(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+
+	newService := func(t *testing.T, objects map[string]string) (*BucketWatchService, *leadRepositoryMock, *objectIngestionRepositoryMock) {
+		leadRepository := NewLeadRepositoryMock()
+		ingestionRepository := NewObjectIngestionRepositoryMock()
+		fileService := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, IngestionOptions{BatchSize: 10})
+		return NewBucketWatchService(NewObjectRepositoryMock(objects), ingestionRepository, fileService, BucketWatchOptions{
+			Dir:     t.TempDir(),
+			Lease:   time.Hour,
+			Watches: []BucketWatch{{SchemaId: schema.ID.Hex(), Bucket: "leads", Prefix: "vendor/"}},
+		}), leadRepository, ingestionRepository
+	}
+
+	_ = t.Run("success, objects are moved to done or failed", func(t *testing.T) {
+		// arrange
+		objects := map[string]string{
+			"vendor/leads.csv":   "email,phone\na@test.com,1\n",
+			"vendor/invalid.csv": "email,name\nb@test.com,B\n",
+			"other/leads.csv":    "email,phone\nc@test.com,3\n",
+		}
+		service, leadRepository, ingestionRepository := newService(t, objects)
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 2, ingested)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.Contains(t, objects, "vendor/done/leads.csv")
+			_ = assert.Contains(t, objects, "vendor/failed/invalid.csv")
+			_ = assert.Contains(t, objects, "other/leads.csv")
+			_ = assert.Len(t, ingestionRepository.ingestions, 2)
+		}
+	})
+
+	_ = t.Run("objects are never ingested twice", func(t *testing.T) {
+		// arrange
+		content := "email,phone\na@test.com,1\n"
+		objects := map[string]string{"vendor/leads.csv": content}
+		service, leadRepository, _ := newService(t, objects)
+		if _, err := service.Poll(&ctx); err != nil {
+			t.Fatal("Failed to poll:", err)
+		}
+		objects["vendor/leads.csv"] = content
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 0, ingested)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.NotContains(t, objects, "vendor/leads.csv")
+		}
+	})
+
+	_ = t.Run("objects abandoned while processing are claimed again", func(t *testing.T) {
+		// arrange
+		objects := map[string]string{"vendor/leads.csv": "email,phone\na@test.com,1\n"}
+		service, leadRepository, ingestionRepository := newService(t, objects)
+		abandoned := domain.NewObjectIngestion(schema.ID, &domain.StoredObject{Bucket: "leads", Key: "vendor/leads.csv", ETag: objects["vendor/leads.csv"]})
+		abandoned.ClaimedAt = primitive.NewDateTimeFromTime(time.Now().Add(-2 * time.Hour))
+		if err := ingestionRepository.Create(&ctx, abandoned); err != nil {
+			t.Fatal("Failed to claim object:", err)
+		}
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, ingested)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.Equal(t, domain.ObjectIngestionStatusDone, ingestionRepository.ingestions[abandoned.ID].Status)
+		}
+	})
+
+	_ = t.Run("objects claimed within the lease are left alone", func(t *testing.T) {
+		// arrange
+		objects := map[string]string{"vendor/leads.csv": "email,phone\na@test.com,1\n"}
+		service, leadRepository, ingestionRepository := newService(t, objects)
+		claimed := domain.NewObjectIngestion(schema.ID, &domain.StoredObject{Bucket: "leads", Key: "vendor/leads.csv", ETag: objects["vendor/leads.csv"]})
+		if err := ingestionRepository.Create(&ctx, claimed); err != nil {
+			t.Fatal("Failed to claim object:", err)
+		}
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 0, ingested)
+			_ = assert.Empty(t, leadRepository.leads)
+			_ = assert.Contains(t, objects, "vendor/leads.csv")
+		}
+	})
+
+	_ = t.Run("failed objects dropped again are retried", func(t *testing.T) {
+		// arrange
+		content := "email,phone\na@test.com,1\n"
+		objects := map[string]string{"vendor/leads.csv": content}
+		service, leadRepository, ingestionRepository := newService(t, objects)
+		leadRepository.failOnCall = 1
+		if _, err := service.Poll(&ctx); err != nil {
+			t.Fatal("Failed to poll:", err)
+		}
+		objects["vendor/leads.csv"] = objects["vendor/failed/leads.csv"]
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, ingested)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.Contains(t, objects, "vendor/done/leads.csv")
+			for _, ingestion := range ingestionRepository.ingestions {
+				_ = assert.Equal(t, domain.ObjectIngestionStatusDone, ingestion.Status)
+				_ = assert.Equal(t, "vendor/done/leads.csv", ingestion.MovedTo)
+			}
+		}
+	})
+}
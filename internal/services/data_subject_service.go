@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DataSubjectService answers the requests of the people leads are about: to
+// get a copy of their leads, across every schema of the tenant, or to have
+// them erased and kept from being imported again.
+type DataSubjectService struct {
+	LeadRepository            repositories.LeadRepository
+	SuppressionRepository     repositories.SuppressionRepository
+	ErasureRepository         repositories.ErasureRepository
+	OutboxRepository          repositories.OutboxRepository
+	WebhookDeliveryRepository repositories.WebhookDeliveryRepository
+	// Cipher finds the leads whose email or phone is encrypted, which are
+	// not found when nil.
+	Cipher *LeadCipher
+	Audit  *AuditService
+}
+
+func NewDataSubjectService(lr repositories.LeadRepository, spr repositories.SuppressionRepository, er repositories.ErasureRepository, or repositories.OutboxRepository, wdr repositories.WebhookDeliveryRepository, cipher *LeadCipher, audit *AuditService) *DataSubjectService {
+	return &DataSubjectService{
+		LeadRepository:            lr,
+		SuppressionRepository:     spr,
+		ErasureRepository:         er,
+		OutboxRepository:          or,
+		WebhookDeliveryRepository: wdr,
+		Cipher:                    cipher,
+		Audit:                     audit,
+	}
+}
+
+// Export returns the leads of the subject, with their sensitive fields
+// decrypted for callers that may read them.
+func (ds *DataSubjectService) Export(ctx *context.Context, subject *domain.DataSubject) ([]primitive.M, error) {
+	if err := subject.Validate(); err != nil {
+		return nil, err
+	}
+
+	filter, err := ds.filter(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	leads, err := ds.LeadRepository.FindBySubject(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypt := canReadPII(ctx)
+	for _, lead := range leads {
+		if err := ds.Cipher.Open(ctx, lead, decrypt); err != nil {
+			return nil, err
+		}
+	}
+
+	return leads, nil
+}
+
+// Erase deletes or anonymizes the leads of the subject and records the
+// erasure with the hashes of the subject only. The subject is suppressed
+// first, so later batches of imports leave it out, and the leads of it that
+// running imports staged already are deleted. A batch that was checked
+// against the suppressions just before they were written may still be staged
+// and published afterwards, and a new erasure removes it. The leads are also
+// removed from the events kept in the outbox and the webhook deliveries.
+func (ds *DataSubjectService) Erase(ctx *context.Context, subject *domain.DataSubject, mode string) (*domain.Erasure, error) {
+	if err := subject.Validate(); err != nil {
+		return nil, err
+	}
+	if err := domain.ValidateErasureMode(mode); err != nil {
+		return nil, err
+	}
+
+	hash, err := ds.Cipher.SuppressionHasher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	suppressions := subject.Suppressions(hash)
+	if _, err := ds.SuppressionRepository.CreateMany(ctx, suppressions); err != nil {
+		return nil, err
+	}
+
+	filter, err := ds.filter(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ds.LeadRepository.DeleteStagedBySubject(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	leads, err := ds.LeadRepository.FindBySubject(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	erasure := domain.NewErasure(mode, suppressions)
+	erasure.RequestedBy = callerOf(ctx)
+
+	if len(leads) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(leads))
+		for _, lead := range leads {
+			ids = append(ids, lead["_id"].(primitive.ObjectID))
+		}
+
+		if mode == domain.ErasureModeAnonymize {
+			erasure.Leads, err = ds.LeadRepository.Anonymize(ctx, ids)
+		} else {
+			erasure.Leads, err = ds.LeadRepository.DeleteByIds(ctx, ids)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ds.redactEvents(ctx, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ds.ErasureRepository.Create(ctx, erasure); err != nil {
+		return nil, err
+	}
+
+	// only the hashes are recorded, as the values are what was erased
+	ds.Audit.Record(ctx, domain.AuditActionDataSubjectErased, domain.AuditEntityErasure, erasure.ID.Hex(), nil,
+		map[string]interface{}{"mode": erasure.Mode, "hashes": erasure.Hashes, "leads_erased": erasure.Leads})
+
+	return erasure, nil
+}
+
+// redactEvents removes the leads from the broker records kept in the outbox
+// and from the payloads of the webhook deliveries, sent or not.
+func (ds *DataSubjectService) redactEvents(ctx *context.Context, ids []primitive.ObjectID) error {
+	if _, err := ds.OutboxRepository.RedactLeads(ctx, ids); err != nil {
+		return err
+	}
+
+	deliveries, err := ds.WebhookDeliveryRepository.FindByLeadIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		if err := delivery.RedactLeads(ids); err != nil {
+			return err
+		}
+		if err := ds.WebhookDeliveryRepository.Update(ctx, delivery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// filter matches the subject by the values its email and phone may have been
+// written with and, when they are encrypted, by their blind indexes.
+func (ds *DataSubjectService) filter(ctx *context.Context, subject *domain.DataSubject) (*domain.SubjectFilter, error) {
+	filter := subject.Filter()
+
+	if ds.Cipher != nil {
+		var err error
+		if filter.Emails, err = ds.withBlindIndexes(ctx, "email", filter.Emails); err != nil {
+			return nil, err
+		}
+		if filter.Phones, err = ds.withBlindIndexes(ctx, "phone", filter.Phones); err != nil {
+			return nil, err
+		}
+	}
+
+	return filter, nil
+}
+
+func (ds *DataSubjectService) withBlindIndexes(ctx *context.Context, name string, values []interface{}) ([]interface{}, error) {
+	for _, value := range values {
+		index, err := ds.Cipher.blindIndex(ctx, name, value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, index)
+	}
+	return values, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDataSubjectService(t *testing.T) {
+	ctx := domain.ContextWithTenant(context.Background(), "acme")
+	newSchema := func(sensitive bool) *domain.Schema {
+		return &domain.Schema{
+			ID: primitive.NewObjectID(),
+			Fields: []domain.SchemaField{
+				{Name: "email", Type: "string", Required: true, Unique: true, Sensitive: sensitive},
+				{Name: "phone", Type: "integer", Required: true, Unique: true},
+				{Name: "name", Type: "string"},
+			},
+		}
+	}
+	content := "email,phone,name\nJane@Test.com,5511999,Jane\nb@test.com,2,Bob\n"
+
+	newCipher := func(t *testing.T) *LeadCipher {
+		masterKey, _ := encryption.NewDataKey()
+		keyManager, err := encryption.NewLocalKeyManager(masterKey)
+		if err != nil {
+			t.Fatal("Failed to create key manager:", err)
+		}
+		return NewLeadCipher(keyManager, NewEncryptionKeyRepositoryMock())
+	}
+
+	ingest := func(t *testing.T, schema *domain.Schema, leadRepository *leadRepositoryMock, suppressionRepository *suppressionRepositoryMock, cipher *LeadCipher) *domain.Import {
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), suppressionRepository, NewEventNotifierMock(), nil, cipher, nil,
+			IngestionOptions{BatchSize: 10})
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+		if err != nil {
+			t.Fatal("Failed to ingest leads:", err)
+		}
+		return imp
+	}
+
+	_ = t.Run("exports the leads of every schema by email or phone", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		ingest(t, newSchema(false), leadRepository, NewSuppressionRepositoryMock(), nil)
+		ingest(t, newSchema(false), leadRepository, NewSuppressionRepositoryMock(), nil)
+		service := NewDataSubjectService(leadRepository, NewSuppressionRepositoryMock(), NewErasureRepositoryMock(), NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), nil, nil)
+
+		// act
+		byEmail, emailErr := service.Export(&ctx, &domain.DataSubject{Email: " Jane@Test.com "})
+		byPhone, phoneErr := service.Export(&ctx, &domain.DataSubject{Phone: "+55 11 999"})
+
+		// assert
+		_ = assert.NoError(t, emailErr)
+		_ = assert.NoError(t, phoneErr)
+		_ = assert.Len(t, byEmail, 2)
+		_ = assert.Len(t, byPhone, 2)
+		_ = assert.Equal(t, "Jane", byEmail[0]["name"])
+	})
+
+	_ = t.Run("finds the leads whose email is encrypted", func(t *testing.T) {
+		// arrange
+		cipher := newCipher(t)
+		leadRepository := NewLeadRepositoryMock()
+		ingest(t, newSchema(true), leadRepository, NewSuppressionRepositoryMock(), cipher)
+		service := NewDataSubjectService(leadRepository, NewSuppressionRepositoryMock(), NewErasureRepositoryMock(), NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), cipher, nil)
+
+		// act
+		leads, err := service.Export(&ctx, &domain.DataSubject{Email: "Jane@Test.com"})
+
+		// assert
+		_ = assert.NoError(t, err)
+		if assert.Len(t, leads, 1) {
+			_ = assert.Equal(t, "Jane@Test.com", leads[0]["email"])
+			_ = assert.NotContains(t, leads[0], domain.LeadPIIField)
+		}
+	})
+
+	_ = t.Run("deletes the leads and keeps only hashes of the subject", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		suppressionRepository := NewSuppressionRepositoryMock()
+		erasureRepository := NewErasureRepositoryMock()
+		ingest(t, newSchema(false), leadRepository, suppressionRepository, nil)
+		service := NewDataSubjectService(leadRepository, suppressionRepository, erasureRepository, NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), nil, nil)
+
+		// act
+		erasure, err := service.Erase(&ctx, &domain.DataSubject{Email: "jane@test.com", Phone: "5511999"}, domain.ErasureModeDelete)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Equal(t, int64(1), erasure.Leads)
+		_ = assert.Len(t, leadRepository.leads, 1)
+		_ = assert.Equal(t, []string{
+			domain.UnkeyedSuppressionHash(domain.SuppressionKindEmail, "jane@test.com"),
+			domain.UnkeyedSuppressionHash(domain.SuppressionKindPhone, "5511999"),
+		}, erasureRepository.erasures[0].Hashes)
+		_ = assert.Len(t, suppressionRepository.suppressions, 2)
+	})
+
+	_ = t.Run("keeps the leads under legal hold", func(t *testing.T) {
+		// arrange
+		schema := newSchema(false)
+		leadRepository := NewLeadRepositoryMock()
+		ingest(t, schema, leadRepository, NewSuppressionRepositoryMock(), nil)
+		held := leadRepository.leads[0].Map()["_id"].(primitive.ObjectID)
+		_ = leadRepository.SetLegalHold(&ctx, schema.ID, held, true)
+		service := NewDataSubjectService(leadRepository, NewSuppressionRepositoryMock(), NewErasureRepositoryMock(), NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), nil, nil)
+
+		// act
+		erasure, err := service.Erase(&ctx, &domain.DataSubject{Email: "jane@test.com"}, domain.ErasureModeDelete)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Zero(t, erasure.Leads)
+		_ = assert.Len(t, leadRepository.leads, 2)
+	})
+
+	_ = t.Run("anonymizes the leads", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		ingest(t, newSchema(false), leadRepository, NewSuppressionRepositoryMock(), nil)
+		service := NewDataSubjectService(leadRepository, NewSuppressionRepositoryMock(), NewErasureRepositoryMock(), NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), nil, nil)
+
+		// act
+		erasure, err := service.Erase(&ctx, &domain.DataSubject{Phone: "5511999"}, domain.ErasureModeAnonymize)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Equal(t, int64(1), erasure.Leads)
+		lead := leadRepository.leads[0].Map()
+		_ = assert.Equal(t, "erased:"+lead["_id"].(primitive.ObjectID).Hex(), lead["email"])
+		_ = assert.NotContains(t, lead, "name")
+	})
+
+	_ = t.Run("removes the subject from staged leads and kept events", func(t *testing.T) {
+		// arrange
+		schema := newSchema(false)
+		leadRepository := NewLeadRepositoryMock()
+		ingest(t, schema, leadRepository, NewSuppressionRepositoryMock(), nil)
+		_ = leadRepository.CreateManyStaged(&ctx, []*bson.D{{{Key: "email", Value: "jane@test.com"}, {Key: "phone", Value: 3}}})
+		var leads []primitive.M
+		for _, lead := range leadRepository.leads {
+			leads = append(leads, lead.Map())
+		}
+		event := domain.NewEvent(domain.EventLeadCreated, schema.ID, domain.LeadsCreatedData{Leads: leads})
+		outboxRepository := NewOutboxRepositoryMock()
+		_ = NewOutboxService(outboxRepository, nil, OutboxOptions{}).Notify(&ctx, event)
+		payload, _ := json.Marshal(event)
+		deliveryRepository := NewWebhookDeliveryRepositoryMock()
+		_ = deliveryRepository.CreateMany(&ctx, []*domain.WebhookDelivery{domain.NewWebhookDelivery(&domain.Webhook{}, event, payload)})
+		service := NewDataSubjectService(leadRepository, NewSuppressionRepositoryMock(), NewErasureRepositoryMock(), outboxRepository, deliveryRepository, nil, nil)
+
+		// act
+		_, err := service.Erase(&ctx, &domain.DataSubject{Email: "jane@test.com", Phone: "5511999"}, domain.ErasureModeDelete)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Empty(t, leadRepository.staged)
+		if assert.Len(t, outboxRepository.messages[0].Records, 1) {
+			_ = assert.Equal(t, leads[1]["_id"].(primitive.ObjectID).Hex(), outboxRepository.messages[0].Records[0].Key)
+		}
+		_ = assert.NotContains(t, deliveryRepository.deliveries[0].Payload, "Jane@Test.com")
+		_ = assert.Contains(t, deliveryRepository.deliveries[0].Payload, "b@test.com")
+		_ = assert.Equal(t, domain.WebhookDeliveryStatusPending, deliveryRepository.deliveries[0].Status)
+	})
+
+	_ = t.Run("suppresses the subject from later imports", func(t *testing.T) {
+		// arrange
+		schema := newSchema(false)
+		suppressionRepository := NewSuppressionRepositoryMock()
+		service := NewDataSubjectService(NewLeadRepositoryMock(), suppressionRepository, NewErasureRepositoryMock(), NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), nil, nil)
+		_, _ = service.Erase(&ctx, &domain.DataSubject{Email: "JANE@test.com"}, domain.ErasureModeDelete)
+		leadRepository := NewLeadRepositoryMock()
+
+		// act
+		imp := ingest(t, schema, leadRepository, suppressionRepository, nil)
+
+		// assert
+		_ = assert.Equal(t, 2, imp.RowsRead)
+		_ = assert.Equal(t, 1, imp.RowsInserted)
+		_ = assert.Equal(t, 1, imp.RowsSuppressed)
+		_ = assert.Equal(t, "b@test.com", leadRepository.leads[0].Map()["email"])
+	})
+
+	_ = t.Run("fails without an email or phone", func(t *testing.T) {
+		// arrange
+		service := NewDataSubjectService(NewLeadRepositoryMock(), NewSuppressionRepositoryMock(), NewErasureRepositoryMock(), NewOutboxRepositoryMock(), NewWebhookDeliveryRepositoryMock(), nil, nil)
+
+		// act
+		_, exportErr := service.Export(&ctx, &domain.DataSubject{Email: " "})
+		_, modeErr := service.Erase(&ctx, &domain.DataSubject{Email: "a@test.com"}, "shred")
+
+		// assert
+		_ = assert.ErrorIs(t, exportErr, domain.ErrInvalidDataSubject)
+		_ = assert.ErrorIs(t, modeErr, domain.ErrInvalidDataSubject)
+	})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+// zstdMaxWindow bounds the memory a single zstd stream may ask the decoder
+// to allocate.
+const zstdMaxWindow = 64 << 20
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte{0x50, 0x4b, 0x03, 0x04}
+)
+
+// isZipArchive peeks at the first bytes of the file and rewinds it.
+func isZipArchive(file io.ReadSeeker) (bool, error) {
+	magic := make([]byte, len(zipMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(magic[:n], zipMagic), nil
+}
+
+// decompress detects gzip and zstd streams by their magic bytes and returns
+// a reader of the decompressed content. Anything else is returned as is.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(buffered), nil
+	}
+}
+
+// uncompressedBudget caps how many decompressed bytes may be read in total,
+// shared by every entry of an archive, to guard against decompression bombs.
+type uncompressedBudget struct {
+	remaining int64
+}
+
+func newUncompressedBudget(limit int64) *uncompressedBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &uncompressedBudget{remaining: limit}
+}
+
+func (b *uncompressedBudget) limit(r io.ReadCloser) io.ReadCloser {
+	if b == nil {
+		return r
+	}
+	return &budgetReader{ReadCloser: r, budget: b}
+}
+
+type budgetReader struct {
+	io.ReadCloser
+	budget *uncompressedBudget
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > br.budget.remaining+1 {
+		p = p[:br.budget.remaining+1]
+	}
+
+	n, err := br.ReadCloser.Read(p)
+	br.budget.remaining -= int64(n)
+	if br.budget.remaining < 0 {
+		return 0, domain.ErrUncompressedSizeExceeded
+	}
+
+	return n, err
+}
+
+// isArchiveMetadata reports entries that hold no leads, such as directories
+// and the resource forks macOS adds to archives.
+func isArchiveMetadata(entry *zip.File) bool {
+	return entry.FileInfo().IsDir() ||
+		strings.HasPrefix(entry.Name, "__MACOSX/") ||
+		strings.HasPrefix(path.Base(entry.Name), ".")
+}
+
+// archiveEntryReader closes the decompressed content of an archive entry
+// together with the entry itself.
+type archiveEntryReader struct {
+	io.ReadCloser
+	entry io.Closer
+}
+
+func (r *archiveEntryReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.entry.Close())
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFileService_ProcessAndSave_Compressed(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+	content := "email,phone\na@test.com,1\nb@test.com,2\n"
+
+	newService := func(options IngestionOptions) (*FileService, *leadRepositoryMock) {
+		leadRepository := NewLeadRepositoryMock()
+		options.BatchSize = 10
+		return NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options), leadRepository
+	}
+
+	_ = t.Run("gzip", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(IngestionOptions{})
+
+		// act
+		imports, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.csv.gz", gzipped(t, content)))
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 1) {
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imports[0].Status)
+			_ = assert.Len(t, leadRepository.leads, 2)
+		}
+	})
+
+	_ = t.Run("zstd", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(IngestionOptions{})
+
+		// act
+		imports, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.csv.zst", zstdCompressed(t, content)))
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 1) {
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imports[0].Status)
+			_ = assert.Len(t, leadRepository.leads, 2)
+		}
+	})
+
+	_ = t.Run("zip, each entry is its own import", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(IngestionOptions{})
+		archive := zipped(t, map[string]string{
+			"first.csv":        content,
+			"second.csv.gz":    gzipped(t, "email,phone\nc@test.com,3\n"),
+			"broken.csv":       "email,phone\nd@test.com,x\n",
+			"__MACOSX/._first": "metadata",
+		})
+
+		// act
+		imports, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.zip", archive))
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 3) {
+			statuses := make(map[string]string)
+			for _, imp := range imports {
+				_ = assert.Equal(t, "leads.zip", imp.FileName)
+				statuses[imp.Entry] = imp.Status
+			}
+			_ = assert.Equal(t, map[string]string{
+				"first.csv":     domain.ImportStatusCompleted,
+				"second.csv.gz": domain.ImportStatusCompleted,
+				"broken.csv":    domain.ImportStatusFailed,
+			}, statuses)
+			_ = assert.Len(t, leadRepository.leads, 3)
+		}
+	})
+
+	_ = t.Run("zip replay returns every entry and processes the failed ones again", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(IngestionOptions{IdempotencyRetention: time.Hour})
+		archive := zipped(t, map[string]string{
+			"first.csv":  content,
+			"broken.csv": "email,phone\nd@test.com,x\n",
+		})
+		if _, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.zip", archive)); err != nil {
+			t.Fatal("Failed to process file:", err)
+		}
+
+		// act
+		imports, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.zip", archive))
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 2) {
+			replayed := make(map[string]bool)
+			for _, imp := range imports {
+				replayed[imp.Entry] = imp.Replayed
+			}
+			_ = assert.Equal(t, map[string]bool{"first.csv": true, "broken.csv": false}, replayed)
+			_ = assert.Len(t, leadRepository.leads, 2)
+		}
+	})
+
+	_ = t.Run("zip with too many entries", func(t *testing.T) {
+		// arrange
+		service, _ := newService(IngestionOptions{MaxArchiveEntries: 1})
+		archive := zipped(t, map[string]string{"first.csv": content, "second.csv": content})
+
+		// act
+		_, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.zip", archive))
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrTooManyArchiveEntries, err)
+		}
+	})
+
+	_ = t.Run("decompression bomb", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(IngestionOptions{MaxUncompressedSize: int64(len(content)) - 1})
+
+		// act
+		imports, err := service.ProcessAndSave(&ctx, newFile(t, schema.ID.Hex(), "leads.csv.gz", gzipped(t, content)))
+
+		// assert
+		if assert.ErrorIs(t, err, domain.ErrUncompressedSizeExceeded) && assert.Len(t, imports, 1) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imports[0].Status)
+			_ = assert.Empty(t, leadRepository.leads)
+		}
+	})
+}
+
+func gzipped(t *testing.T, content string) string {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatal("Failed to gzip content:", err)
+	}
+	_ = writer.Close()
+	return buf.String()
+}
+
+func zstdCompressed(t *testing.T, content string) string {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal("Failed to create zstd encoder:", err)
+	}
+	defer encoder.Close()
+	return string(encoder.EncodeAll([]byte(content), nil))
+}
+
+func zipped(t *testing.T, entries map[string]string) string {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range entries {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal("Failed to create zip entry:", err)
+		}
+		_, _ = entry.Write([]byte(content))
+	}
+	_ = writer.Close()
+	return buf.String()
+}
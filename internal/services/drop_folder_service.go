@@ -0,0 +1,253 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+const (
+	dropFolderArchiveDir = "archive"
+	dropFolderErrorDir   = "error"
+	dropFolderMarkerExt  = ".done"
+	dropFolderErrorExt   = ".error"
+)
+
+// DropFolder maps a local directory, such as the inbox of an SFTP account, to
+// the schema its files are ingested into, in the tenant TenantId, the default
+// tenant when empty.
+type DropFolder struct {
+	TenantId string
+	SchemaId string
+	Path     string
+
+	// Marker makes the watcher wait for a "<file>.done" marker instead of the
+	// size of the file settling.
+	Marker bool
+}
+
+// DropFolderOptions configures the drop folder watcher. Without a marker, a
+// file is ready once its size and modification time stayed the same for
+// StableFor, and across at least two polls.
+type DropFolderOptions struct {
+	StableFor time.Duration
+	Folders   []DropFolder
+}
+
+type DropFolderService struct {
+	FileService *FileService
+	Options     DropFolderOptions
+
+	mu   sync.Mutex
+	seen map[string]fileObservation
+}
+
+// fileObservation is the last size and modification time seen for a file and
+// since when they have not changed.
+type fileObservation struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+func NewDropFolderService(fs *FileService, opts DropFolderOptions) *DropFolderService {
+	return &DropFolderService{
+		FileService: fs,
+		Options:     opts,
+		seen:        make(map[string]fileObservation),
+	}
+}
+
+// Poll ingests the ready files of every drop folder and returns how many were
+// ingested. A file that fails does not stop the others.
+func (ds *DropFolderService) Poll(ctx *context.Context) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ingested := 0
+	present := make(map[string]bool)
+	var errs []error
+
+	for _, folder := range ds.Options.Folders {
+		entries, err := os.ReadDir(folder.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			if !isDroppedFile(entry) {
+				continue
+			}
+
+			path := filepath.Join(folder.Path, entry.Name())
+			present[path] = true
+
+			ready, err := ds.isReady(folder, path, time.Now())
+			if err != nil || !ready {
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			if err := ds.ingest(withTenant(ctx, folder.TenantId), folder, path); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				continue
+			}
+			ingested++
+		}
+	}
+
+	for path := range ds.seen {
+		if !present[path] {
+			delete(ds.seen, path)
+		}
+	}
+
+	return ingested, errors.Join(errs...)
+}
+
+func (ds *DropFolderService) Run(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			ingested, err := ds.Poll(ctx)
+			if err != nil {
+				log.Println("Failed to ingest dropped files: ", err)
+			}
+			if ingested > 0 {
+				log.Printf("Ingested %d dropped files", ingested)
+			}
+		}
+	}
+}
+
+func (ds *DropFolderService) isReady(folder DropFolder, path string, now time.Time) (bool, error) {
+	if folder.Marker {
+		_, err := os.Stat(path + dropFolderMarkerExt)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	observation, ok := ds.seen[path]
+	if !ok || observation.size != info.Size() || !observation.modTime.Equal(info.ModTime()) {
+		ds.seen[path] = fileObservation{size: info.Size(), modTime: info.ModTime(), since: now}
+		return false, nil
+	}
+
+	return now.Sub(observation.since) >= ds.Options.StableFor, nil
+}
+
+// ingest runs the file through the ingestion pipeline and moves it to the
+// archive directory of its folder, or to the error directory together with a
+// report of what failed. A file ingested again after a crash before the move
+// is answered with its original import.
+func (ds *DropFolderService) ingest(ctx *context.Context, folder DropFolder, path string) error {
+	file, err := domain.NewLocalFile(folder.SchemaId, filepath.Base(path), path)
+	if err != nil {
+		return err
+	}
+	file.Uploader = "file://" + path
+
+	imports, err := ds.FileService.ProcessAndSave(ctx, file)
+	if len(imports) == 0 && err != nil && !isFileError(err) {
+		// nothing was recorded, so the file is left in place to be retried
+		return err
+	}
+
+	report := failureReport(imports, err)
+	dir := dropFolderArchiveDir
+	if report != "" {
+		dir = dropFolderErrorDir
+	}
+
+	target, err := moveDroppedFile(path, filepath.Join(folder.Path, dir))
+	if err != nil {
+		return err
+	}
+	delete(ds.seen, path)
+
+	if report != "" {
+		if err := os.WriteFile(target+dropFolderErrorExt, []byte(report), 0o640); err != nil {
+			return err
+		}
+	}
+
+	if folder.Marker {
+		if err := os.Remove(path + dropFolderMarkerExt); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveDroppedFile moves the file into dir, prefixed with the time it was
+// moved so files dropped again under the same name never overwrite each other.
+func moveDroppedFile(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, time.Now().Format("20060102T150405.000")+"-"+filepath.Base(path))
+	return target, os.Rename(path, target)
+}
+
+// failureReport lists why the file failed, one line per failed archive entry,
+// and is empty when every import completed.
+func failureReport(imports []*domain.Import, err error) string {
+	if err != nil {
+		return err.Error() + "\n"
+	}
+
+	var report strings.Builder
+	for _, imp := range imports {
+		if imp.Status != domain.ImportStatusFailed {
+			continue
+		}
+		if imp.Entry != "" {
+			report.WriteString(imp.Entry + ": ")
+		}
+		report.WriteString(imp.Error + "\n")
+	}
+
+	return report.String()
+}
+
+// isFileError reports errors caused by the content of the file rather than by
+// the service, which retrying would not fix.
+func isFileError(err error) bool {
+	return errors.Is(err, domain.ErrEmptyArchive) ||
+		errors.Is(err, domain.ErrTooManyArchiveEntries) ||
+		errors.Is(err, zip.ErrFormat)
+}
+
+// isDroppedFile skips directories, hidden files, such as those some SFTP
+// clients write to before renaming, and the markers themselves.
+func isDroppedFile(entry os.DirEntry) bool {
+	return entry.Type().IsRegular() &&
+		!strings.HasPrefix(entry.Name(), ".") &&
+		!strings.HasSuffix(entry.Name(), dropFolderMarkerExt)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDropFolderService_Poll(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+
+	newService := func(t *testing.T, marker bool) (*DropFolderService, *leadRepositoryMock, string) {
+		dir := t.TempDir()
+		leadRepository := NewLeadRepositoryMock()
+		fileService := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, IngestionOptions{BatchSize: 10})
+		return NewDropFolderService(fileService, DropFolderOptions{
+			Folders: []DropFolder{{SchemaId: schema.ID.Hex(), Path: dir, Marker: marker}},
+		}), leadRepository, dir
+	}
+
+	drop := func(t *testing.T, path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal("Failed to drop file:", err)
+		}
+	}
+
+	_ = t.Run("success, files are ingested once their size settles", func(t *testing.T) {
+		// arrange
+		service, leadRepository, dir := newService(t, false)
+		drop(t, filepath.Join(dir, "leads.csv"), "email,phone\na@test.com,1\n")
+
+		// act
+		first, err := service.Poll(&ctx)
+		if err != nil {
+			t.Fatal("Failed to poll:", err)
+		}
+		second, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 0, first)
+			_ = assert.Equal(t, 1, second)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.NoFileExists(t, filepath.Join(dir, "leads.csv"))
+			archived, _ := filepath.Glob(filepath.Join(dir, "archive", "*-leads.csv"))
+			_ = assert.Len(t, archived, 1)
+		}
+	})
+
+	_ = t.Run("growing files are not ingested", func(t *testing.T) {
+		// arrange
+		service, leadRepository, dir := newService(t, false)
+		path := filepath.Join(dir, "leads.csv")
+		drop(t, path, "email,phone\n")
+		if _, err := service.Poll(&ctx); err != nil {
+			t.Fatal("Failed to poll:", err)
+		}
+		drop(t, path, "email,phone\na@test.com,1\n")
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 0, ingested)
+			_ = assert.Empty(t, leadRepository.leads)
+			_ = assert.FileExists(t, path)
+		}
+	})
+
+	_ = t.Run("marker, files wait for their done marker", func(t *testing.T) {
+		// arrange
+		service, leadRepository, dir := newService(t, true)
+		path := filepath.Join(dir, "leads.csv")
+		drop(t, path, "email,phone\na@test.com,1\n")
+		waiting, err := service.Poll(&ctx)
+		if err != nil {
+			t.Fatal("Failed to poll:", err)
+		}
+		drop(t, path+".done", "")
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 0, waiting)
+			_ = assert.Equal(t, 1, ingested)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.NoFileExists(t, path+".done")
+		}
+	})
+
+	_ = t.Run("failed files are moved to the error directory with a report", func(t *testing.T) {
+		// arrange
+		service, leadRepository, dir := newService(t, true)
+		path := filepath.Join(dir, "leads.csv")
+		drop(t, path, "email,name\na@test.com,A\n")
+		drop(t, path+".done", "")
+
+		// act
+		ingested, err := service.Poll(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, ingested)
+			_ = assert.Empty(t, leadRepository.leads)
+			reports, _ := filepath.Glob(filepath.Join(dir, "error", "*-leads.csv.error"))
+			if assert.Len(t, reports, 1) {
+				report, _ := os.ReadFile(reports[0])
+				_ = assert.Equal(t, "required fields missing\n", string(report))
+			}
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventNotifier is told about the lead and import events of a schema.
+type EventNotifier interface {
+	// Wants reports whether anyone listens to the event type, so events that
+	// are costly to build can be skipped.
+	Wants(ctx *context.Context, schemaId primitive.ObjectID, eventType string) (bool, error)
+	Notify(ctx *context.Context, event *domain.Event) error
+}
+
+// Notifiers sends every event to each of its notifiers.
+type Notifiers []EventNotifier
+
+func (n Notifiers) Wants(ctx *context.Context, schemaId primitive.ObjectID, eventType string) (bool, error) {
+	for _, notifier := range n {
+		wanted, err := notifier.Wants(ctx, schemaId, eventType)
+		if err != nil || wanted {
+			return wanted, err
+		}
+	}
+	return false, nil
+}
+
+func (n Notifiers) Notify(ctx *context.Context, event *domain.Event) error {
+	var errs []error
+	for _, notifier := range n {
+		if err := notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExportOptions configures background exports. Their files are written to
+// Dir, an export left running for longer than Lease is taken over by another
+// worker, and finished exports are removed after Retention.
+type ExportOptions struct {
+	Dir       string
+	Lease     time.Duration
+	Retention time.Duration
+}
+
+// LeadExport is a validated export, ready to be written. Its sensitive fields
+// are only decrypted when decrypt is set, and left out otherwise.
+type LeadExport struct {
+	Format  string
+	schema  *domain.Schema
+	filter  *domain.LeadFilter
+	columns []exportColumn
+	decrypt bool
+}
+
+type ExportService struct {
+	SchemaRepository repositories.SchemaRepository
+	LeadRepository   repositories.LeadRepository
+	ExportRepository repositories.ExportRepository
+	Cipher           *LeadCipher
+	Options          ExportOptions
+}
+
+func NewExportService(sr repositories.SchemaRepository, lr repositories.LeadRepository, er repositories.ExportRepository, cipher *LeadCipher, opts ExportOptions) *ExportService {
+	return &ExportService{
+		SchemaRepository: sr,
+		LeadRepository:   lr,
+		ExportRepository: er,
+		Cipher:           cipher,
+		Options:          opts,
+	}
+}
+
+// Prepare checks the format and the query against the schema, and that the
+// leads found fit in a file of the format, so a streamed export fails before
+// anything is written. The sensitive fields are decrypted for callers that
+// may read them.
+func (es *ExportService) Prepare(ctx *context.Context, schemaId, format string, query domain.LeadQuery) (*LeadExport, error) {
+	if err := domain.ValidateExportFormat(format); err != nil {
+		return nil, err
+	}
+
+	schema, err := es.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := leadFilterFromQuery(schema, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := es.Cipher.IndexFilter(ctx, schema, filter); err != nil {
+		return nil, err
+	}
+
+	if maxRows := exportMaxRows(format); maxRows > 0 {
+		count, err := es.LeadRepository.CountByFilter(ctx, filter, maxRows+1)
+		if err != nil {
+			return nil, err
+		}
+		if count > maxRows {
+			return nil, domain.ErrExportTooLarge
+		}
+	}
+
+	return &LeadExport{Format: format, schema: schema, filter: filter, columns: exportColumns(schema), decrypt: canReadPII(ctx)}, nil
+}
+
+// Write streams the leads of the export to w one at a time and returns how
+// many were written. The file is only completed when every lead was written.
+func (es *ExportService) Write(ctx *context.Context, export *LeadExport, w io.Writer) (int64, error) {
+	cursor, err := es.LeadRepository.FindByFilter(ctx, export.filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	writer, err := newLeadWriter(export.Format, w, export.columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	for {
+		lead, err := cursor.Next(ctx)
+		if err != nil {
+			writer.Discard()
+			return rows, err
+		}
+		if lead == nil {
+			break
+		}
+
+		if err := es.Cipher.Open(ctx, lead, export.decrypt); err != nil {
+			writer.Discard()
+			return rows, err
+		}
+
+		if err := writer.Write(exportValues(export.columns, lead)); err != nil {
+			writer.Discard()
+			return rows, err
+		}
+		rows++
+	}
+
+	return rows, writer.Close()
+}
+
+// Create queues a background export, checked like a streamed one.
+func (es *ExportService) Create(ctx *context.Context, schemaId, format string, query domain.LeadQuery) (*domain.Export, error) {
+	export, err := es.Prepare(ctx, schemaId, format, query)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := domain.NewExport(export.schema.ID, format, query)
+	exp.PII = export.decrypt
+	err = es.ExportRepository.Create(ctx, exp)
+	if err != nil {
+		return nil, err
+	}
+
+	return exp, nil
+}
+
+func (es *ExportService) FindById(ctx *context.Context, id string) (*domain.Export, error) {
+	return es.ExportRepository.FindById(ctx, id)
+}
+
+// Open returns the file of a completed export. Files holding decrypted
+// sensitive fields are only returned to callers that may read them.
+func (es *ExportService) Open(ctx *context.Context, id string) (*domain.Export, *os.File, error) {
+	exp, err := es.ExportRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exp.PII && !canReadPII(ctx) {
+		return nil, nil, domain.ErrForbidden
+	}
+	if exp.Status != domain.ExportStatusCompleted {
+		return nil, nil, domain.ErrExportNotReady
+	}
+
+	file, err := os.Open(es.filePath(exp))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return exp, file, nil
+}
+
+// RunNext writes the next queued export, if any, and returns whether one was
+// found.
+func (es *ExportService) RunNext(ctx *context.Context) (bool, error) {
+	exp, err := es.ExportRepository.ClaimNext(ctx, time.Now(), es.Options.Lease)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	rows, size, err := es.writeFile(withTenant(ctx, exp.TenantId), exp)
+	if err != nil {
+		exp.Fail(err)
+	} else {
+		exp.Complete(rows, size)
+	}
+
+	return true, es.ExportRepository.Update(ctx, exp)
+}
+
+func (es *ExportService) RunWorker(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			// drains the queue before waiting for the next tick
+			for {
+				found, err := es.RunNext(ctx)
+				if err != nil {
+					log.Println("Failed to run export: ", err)
+				}
+				if !found || err != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// CleanupExpired removes the exports finished for longer than the retention
+// and their files, returning how many were removed.
+func (es *ExportService) CleanupExpired(ctx *context.Context) (int, error) {
+	exports, err := es.ExportRepository.FindFinishedBefore(ctx, time.Now().Add(-es.Options.Retention))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, exp := range exports {
+		if err := os.Remove(es.filePath(exp)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		if err := es.ExportRepository.Delete(ctx, exp.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (es *ExportService) RunCleanup(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			removed, err := es.CleanupExpired(ctx)
+			if err != nil {
+				log.Println("Failed to clean up expired exports: ", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d expired exports", removed)
+			}
+		}
+	}
+}
+
+// writeFile writes the export to a temporary file and only moves it in place
+// once complete, so a download never sees a partial file.
+func (es *ExportService) writeFile(ctx *context.Context, exp *domain.Export) (int64, int64, error) {
+	export, err := es.Prepare(ctx, exp.SchemaId.Hex(), exp.Format, exp.Query)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the worker has no caller, the export was allowed when it was created
+	export.decrypt = exp.PII
+
+	if err := os.MkdirAll(es.Options.Dir, 0o750); err != nil {
+		return 0, 0, err
+	}
+
+	file, err := os.CreateTemp(es.Options.Dir, exp.ID.Hex()+".*.part")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(file.Name())
+
+	rows, err := es.Write(ctx, export, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info, err := os.Stat(file.Name())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rows, info.Size(), os.Rename(file.Name(), es.filePath(exp))
+}
+
+func (es *ExportService) filePath(exp *domain.Export) string {
+	return filepath.Join(es.Options.Dir, exp.ID.Hex()+domain.ExportExtension(exp.Format))
+}
+
+// leadFilterFromQuery checks the query against the schema. Field filters must
+// name a field of the schema, or a consent field, and hold a value of its
+// type.
+func leadFilterFromQuery(schema *domain.Schema, query domain.LeadQuery) (*domain.LeadFilter, error) {
+	filter := &domain.LeadFilter{SchemaId: schema.ID, Fields: make(map[string]interface{})}
+
+	if query.ImportId != "" {
+		importId, err := primitive.ObjectIDFromHex(query.ImportId)
+		if err != nil {
+			return nil, domain.ErrInvalidLeadFilter
+		}
+		filter.ImportId = importId
+	}
+
+	for _, bound := range []struct {
+		value string
+		into  *time.Time
+	}{
+		{query.CreatedFrom, &filter.CreatedFrom},
+		{query.CreatedTo, &filter.CreatedTo},
+		{query.ConsentedFrom, &filter.ConsentedFrom},
+		{query.ConsentedTo, &filter.ConsentedTo},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return nil, domain.ErrInvalidLeadFilter
+		}
+		*bound.into = parsed
+	}
+
+	fieldTypes := make(map[string]string, len(schema.Fields)+len(domain.ConsentFieldTypes))
+	for _, field := range schema.Fields {
+		fieldTypes[field.Name] = field.Type
+	}
+	for name, fieldType := range domain.ConsentFieldTypes {
+		fieldTypes[name] = fieldType
+	}
+
+	for _, f := range query.Filters {
+		name, value, ok := strings.Cut(f, ":")
+		fieldType, known := fieldTypes[name]
+		if !ok || !known {
+			return nil, domain.ErrInvalidLeadFilter
+		}
+
+		parsed, err := domain.ValueFromType(value, fieldType)
+		if err != nil {
+			return nil, domain.ErrInvalidLeadFilter
+		}
+		filter.Fields[name] = parsed
+	}
+
+	return filter, nil
+}
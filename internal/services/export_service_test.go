@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExportService_Write(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "score", Type: "float"},
+			{Name: "signed_up", Type: "datetime"},
+		},
+	}
+	importId := primitive.NewObjectID()
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	newService := func(t *testing.T) (*ExportService, []primitive.ObjectID) {
+		leadRepository := NewLeadRepositoryMock()
+		_ = leadRepository.CreateMany(&ctx, []*bson.D{
+			{
+				{Key: "schema_id", Value: schema.ID},
+				{Key: "import_id", Value: importId},
+				{Key: "email", Value: "a@test.com"},
+				{Key: "phone", Value: 1},
+				{Key: "score", Value: 9.5},
+				{Key: "signed_up", Value: int64(1700000000)},
+				{Key: "consent_channel", Value: "email"},
+				{Key: "created_at", Value: primitive.NewDateTimeFromTime(createdAt)},
+				{Key: "updated_at", Value: primitive.NewDateTimeFromTime(createdAt)},
+			},
+			{
+				{Key: "schema_id", Value: schema.ID},
+				{Key: "email", Value: "b@test.com"},
+				{Key: "phone", Value: 2},
+				{Key: "created_at", Value: primitive.NewDateTimeFromTime(createdAt)},
+				{Key: "updated_at", Value: primitive.NewDateTimeFromTime(createdAt)},
+			},
+			{
+				{Key: "schema_id", Value: primitive.NewObjectID()},
+				{Key: "email", Value: "c@test.com"},
+				{Key: "phone", Value: 3},
+			},
+		})
+
+		ids := make([]primitive.ObjectID, 0, 2)
+		for _, lead := range leadRepository.leads[:2] {
+			ids = append(ids, lead.Map()["_id"].(primitive.ObjectID))
+		}
+
+		return NewExportService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewExportRepositoryMock(), nil,
+			ExportOptions{Dir: t.TempDir(), Lease: time.Hour, Retention: time.Hour}), ids
+	}
+
+	export := func(t *testing.T, service *ExportService, format string, query domain.LeadQuery) []byte {
+		prepared, err := service.Prepare(&ctx, schema.ID.Hex(), format, query)
+		if err != nil {
+			t.Fatal("Failed to prepare export:", err)
+		}
+		var buf bytes.Buffer
+		if _, err := service.Write(&ctx, prepared, &buf); err != nil {
+			t.Fatal("Failed to write export:", err)
+		}
+		return buf.Bytes()
+	}
+
+	_ = t.Run("csv follows the field order of the schema", func(t *testing.T) {
+		// arrange
+		service, ids := newService(t)
+
+		// act
+		data := export(t, service, domain.ExportFormatCSV, domain.LeadQuery{})
+
+		// assert
+		_ = assert.Equal(t, "_id,phone,email,score,signed_up,import_id,created_at,updated_at\n"+
+			ids[0].Hex()+",1,a@test.com,9.5,2023-11-14T22:13:20Z,"+importId.Hex()+",2025-01-02T03:04:05Z,2025-01-02T03:04:05Z\n"+
+			ids[1].Hex()+",2,b@test.com,,,,2025-01-02T03:04:05Z,2025-01-02T03:04:05Z\n", string(data))
+	})
+
+	_ = t.Run("ndjson leaves out missing values and applies the filters", func(t *testing.T) {
+		// arrange
+		service, ids := newService(t)
+
+		// act
+		data := export(t, service, domain.ExportFormatNDJSON, domain.LeadQuery{Filters: []string{"phone:2"}})
+
+		// assert
+		_ = assert.Equal(t, `{"_id":"`+ids[1].Hex()+`","phone":2,"email":"b@test.com",`+
+			`"created_at":"2025-01-02T03:04:05Z","updated_at":"2025-01-02T03:04:05Z"}`+"\n", string(data))
+	})
+
+	_ = t.Run("filters on the consent fields", func(t *testing.T) {
+		// arrange
+		service, ids := newService(t)
+
+		// act
+		data := export(t, service, domain.ExportFormatNDJSON, domain.LeadQuery{Filters: []string{"consent_channel:email"}})
+
+		// assert
+		_ = assert.Contains(t, string(data), ids[0].Hex())
+		_ = assert.NotContains(t, string(data), ids[1].Hex())
+	})
+
+	_ = t.Run("invalid consent range", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+
+		// act
+		_, err := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{ConsentedFrom: "yesterday"})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidLeadFilter)
+	})
+
+	_ = t.Run("xlsx holds a row per lead", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+
+		// act
+		data := export(t, service, domain.ExportFormatXLSX, domain.LeadQuery{ImportId: importId.Hex()})
+
+		// assert
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if assert.NoError(t, err) {
+			defer file.Close()
+			rows, err := file.GetRows("Sheet1")
+			if assert.NoError(t, err) && assert.Len(t, rows, 2) {
+				_ = assert.Equal(t, []string{"_id", "phone", "email", "score", "signed_up", "import_id", "created_at", "updated_at"}, rows[0])
+				_ = assert.Equal(t, []string{"1", "a@test.com", "9.5", "2023-11-14T22:13:20Z"}, rows[1][1:5])
+			}
+		}
+	})
+
+	_ = t.Run("parquet keeps the column order and types", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+
+		// act
+		data := export(t, service, domain.ExportFormatParquet, domain.LeadQuery{})
+
+		// assert
+		file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+		if assert.NoError(t, err) {
+			var names []string
+			for _, field := range file.Schema().Fields() {
+				names = append(names, field.Name())
+			}
+			_ = assert.Equal(t, []string{"_id", "phone", "email", "score", "signed_up", "import_id", "created_at", "updated_at"}, names)
+			_ = assert.Equal(t, int64(2), file.NumRows())
+
+			rows := make([]parquet.Row, 2)
+			n, err := parquet.NewReader(file).ReadRows(rows)
+			if (err == nil || err == io.EOF) && assert.Equal(t, 2, n) {
+				_ = assert.Equal(t, int64(1), rows[0][1].Int64())
+				_ = assert.Equal(t, "a@test.com", rows[0][2].String())
+				_ = assert.Equal(t, 9.5, rows[0][3].Double())
+				_ = assert.Equal(t, int64(1700000000000), rows[0][4].Int64())
+				_ = assert.True(t, rows[1][3].IsNull())
+			}
+		}
+	})
+
+	_ = t.Run("xlsx exports over the rows of a worksheet fail before anything is written", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+		service.LeadRepository.(*leadRepositoryMock).counted = xlsxMaxRows
+
+		// act
+		_, xlsxErr := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatXLSX, domain.LeadQuery{})
+		_, csvErr := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{})
+
+		// assert
+		_ = assert.ErrorIs(t, xlsxErr, domain.ErrExportTooLarge)
+		_ = assert.NoError(t, csvErr)
+	})
+
+	_ = t.Run("failed exports are not completed", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+		service.LeadRepository.(*leadRepositoryMock).cursorErr = assert.AnError
+		prepared, _ := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatParquet, domain.LeadQuery{})
+		var buf bytes.Buffer
+
+		// act
+		rows, err := service.Write(&ctx, prepared, &buf)
+
+		// assert
+		_ = assert.ErrorIs(t, err, assert.AnError)
+		_ = assert.Equal(t, int64(2), rows)
+		_, openErr := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		_ = assert.Error(t, openErr)
+	})
+
+	_ = t.Run("invalid query", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+
+		// act
+		_, unknownFieldErr := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{Filters: []string{"name:a"}})
+		_, wrongTypeErr := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{Filters: []string{"phone:one"}})
+		_, dateErr := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{CreatedFrom: "yesterday"})
+		_, formatErr := service.Prepare(&ctx, schema.ID.Hex(), "pdf", domain.LeadQuery{})
+
+		// assert
+		_ = assert.ErrorIs(t, unknownFieldErr, domain.ErrInvalidLeadFilter)
+		_ = assert.ErrorIs(t, wrongTypeErr, domain.ErrInvalidLeadFilter)
+		_ = assert.ErrorIs(t, dateErr, domain.ErrInvalidLeadFilter)
+		_ = assert.ErrorIs(t, formatErr, domain.ErrInvalidExport)
+	})
+
+	_ = t.Run("background export is written to a file until it expires", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t)
+		exp, err := service.Create(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{})
+		if err != nil {
+			t.Fatal("Failed to create export:", err)
+		}
+		_, _, notReadyErr := service.Open(&ctx, exp.ID.Hex())
+
+		// act
+		found, err := service.RunNext(&ctx)
+		if err != nil {
+			t.Fatal("Failed to run export:", err)
+		}
+		completed, file, openErr := service.Open(&ctx, exp.ID.Hex())
+
+		// assert
+		_ = assert.True(t, found)
+		_ = assert.ErrorIs(t, notReadyErr, domain.ErrExportNotReady)
+		if assert.NoError(t, openErr) {
+			content, _ := io.ReadAll(file)
+			_ = file.Close()
+			_ = assert.Equal(t, domain.ExportStatusCompleted, completed.Status)
+			_ = assert.Equal(t, int64(2), completed.Rows)
+			_ = assert.Equal(t, int64(len(content)), completed.Size)
+		}
+
+		service.Options.Retention = -time.Minute
+		removed, err := service.CleanupExpired(&ctx)
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, removed)
+			_, err := service.FindById(&ctx, exp.ID.Hex())
+			_ = assert.Error(t, err)
+		}
+	})
+}
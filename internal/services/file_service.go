@@ -1,60 +1,584 @@
 package services
 
 import (
+	"archive/zip"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/vitortenor/lead-stream-service/internal/domain"
 	"github.com/vitortenor/lead-stream-service/internal/repositories"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// IngestionOptions controls how leads are written. Files up to
+// TransactionMaxSize bytes are written in a single multi-document transaction
+// when Transactional is set; everything else is staged in batches of
+// BatchSize and only published to the leads once the whole file was read.
+type IngestionOptions struct {
+	BatchSize          int
+	Transactional      bool
+	TransactionMaxSize int64
+
+	// IdempotencyRetention is how long a repeated upload, matched by its
+	// Idempotency-Key or by the checksum of its content, is answered with the
+	// original import. Zero disables the check.
+	IdempotencyRetention time.Duration
+	// StaleImportAfter is how long an import still processing may go without
+	// saving its progress before it is no longer replayed, as the instance
+	// running it probably stopped. Zero replays it regardless.
+	StaleImportAfter time.Duration
+
+	// MaxUncompressedSize caps the decompressed bytes read from one upload,
+	// across every entry of an archive, and MaxArchiveEntries caps the number
+	// of entries of an archive. Zero means no limit.
+	MaxUncompressedSize int64
+	MaxArchiveEntries   int
+
+	// ProgressInterval is how often the progress of a file being read is
+	// saved to its import.
+	ProgressInterval time.Duration
+}
+
+// FileOutcome is what one file of a multi-file upload produced. Err is set
+// when the file failed, either alongside its failed import or, when no import
+// could be recorded, on its own.
+type FileOutcome struct {
+	File    *domain.File
+	Imports []*domain.Import
+	Err     error
+}
+
 type FileService struct {
-	SchemaRepository repositories.SchemaRepository
-	LeadRepository   repositories.LeadRepository
+	SchemaRepository      repositories.SchemaRepository
+	LeadRepository        repositories.LeadRepository
+	ImportRepository      repositories.ImportRepository
+	SuppressionRepository repositories.SuppressionRepository
+	Notifier              EventNotifier
+	// Quotas caps what each tenant ingests, without limits when nil.
+	Quotas *QuotaService
+	// Cipher encrypts the sensitive fields of the leads, which can not be
+	// written when nil.
+	Cipher  *LeadCipher
+	Audit   *AuditService
+	Options IngestionOptions
 }
 
-func NewFileService(sr repositories.SchemaRepository, lr repositories.LeadRepository) *FileService {
+func NewFileService(sr repositories.SchemaRepository, lr repositories.LeadRepository, ir repositories.ImportRepository, spr repositories.SuppressionRepository, notifier EventNotifier, quotas *QuotaService, cipher *LeadCipher, audit *AuditService, opts IngestionOptions) *FileService {
 	return &FileService{
-		SchemaRepository: sr,
-		LeadRepository:   lr,
+		SchemaRepository:      sr,
+		LeadRepository:        lr,
+		ImportRepository:      ir,
+		SuppressionRepository: spr,
+		Notifier:              notifier,
+		Quotas:                quotas,
+		Cipher:                cipher,
+		Audit:                 audit,
+		Options:               opts,
 	}
 }
 
-func (fs *FileService) ProcessAndSave(ctx *context.Context, file *domain.File) error {
+// ProcessAndSave ingests an uploaded file and returns the imports it produced.
+// Plain, gzip and zstd files produce a single import whose failure is also
+// returned as the error. A zip archive produces one import per entry, and the
+// failure of an entry is only recorded in its import.
+func (fs *FileService) ProcessAndSave(ctx *context.Context, file *domain.File) ([]*domain.Import, error) {
+	return fs.processAndSave(ctx, file, nil)
+}
+
+// Replacement holds the leads a file replaces. Withdraw unpublishes them, so
+// the leads of the file can take their unique values, and Restore publishes
+// them again when the leads of the file could not be published. Commit removes
+// them once the leads of the file were.
+type Replacement interface {
+	Withdraw(ctx *context.Context) error
+	Restore(ctx *context.Context) error
+	Commit(ctx *context.Context) error
+}
+
+// ProcessAndReplace ingests the file like ProcessAndSave, but withdraws the
+// leads of replace once the file was read in full and before its leads are
+// published, so the leads it replaces are only removed once the new ones are
+// known to be valid, and restored when the import fails after all. They are
+// replaced by the first entry of an archive that completes, and not at all
+// when the upload is replayed or fails.
+func (fs *FileService) ProcessAndReplace(ctx *context.Context, file *domain.File, replace Replacement) ([]*domain.Import, error) {
+	return fs.processAndSave(ctx, file, &replacement{Replacement: replace})
+}
+
+// replacement is a Replacement that is committed at most once.
+type replacement struct {
+	Replacement
+	committed bool
+}
+
+// processAndSave ingests the file, replacing the leads of replace, when set,
+// with those of the first import that completes.
+func (fs *FileService) processAndSave(ctx *context.Context, file *domain.File, replace *replacement) ([]*domain.Import, error) {
+	// files that do not name their uploader are recorded as the caller's
+	if file.Uploader == "" {
+		file.Uploader = callerOf(ctx)
+	}
+
 	schema, err := fs.SchemaRepository.FindById(ctx, file.SchemaId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	openedFile, err := file.File.Open()
+	openedFile, err := file.Open()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer openedFile.Close()
 
-	reader := csv.NewReader(openedFile)
+	checksum, err := checksumOf(openedFile)
+	if err != nil {
+		return nil, err
+	}
+
+	originals, err := fs.findOriginalImports(ctx, schema.ID, file.IdempotencyKey, checksum)
+	if err != nil {
+		return nil, err
+	}
+	for _, original := range originals {
+		original.Replayed = true
+	}
+	// the entries of an archive are replayed one by one, along with those
+	// processed again, unless the upload replaces earlier leads, which would
+	// then include those of the replayed entries
+	if len(originals) > 0 && (originals[0].Entry == "" || replace != nil) {
+		return originals, nil
+	}
+
+	if fs.Quotas != nil {
+		if err := fs.Quotas.CheckFileSize(ctx, file.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	isArchive, err := isZipArchive(openedFile)
+	if err != nil {
+		return nil, err
+	}
+	if isArchive {
+		imports, err := fs.processArchive(ctx, schema, file, checksum, openedFile, originals, replace)
+		if len(imports) == 0 {
+			return fs.replayClaimed(ctx, schema.ID, file.IdempotencyKey, checksum, err)
+		}
+		return imports, err
+	}
+
+	budget := newUncompressedBudget(fs.Options.MaxUncompressedSize)
+	imp, err := fs.process(ctx, schema, domain.NewImport(schema.ID, file, checksum), file.Size, replace, func(progress *importProgress) (io.ReadCloser, error) {
+		content, err := decompress(progress.countBytes(openedFile))
+		if err != nil {
+			return nil, err
+		}
+		return budget.limit(content), nil
+	})
+	if imp == nil {
+		return fs.replayClaimed(ctx, schema.ID, file.IdempotencyKey, checksum, err)
+	}
+
+	return []*domain.Import{imp}, err
+}
+
+// replayClaimed answers an upload whose idempotency key was claimed by a
+// concurrent one with the imports of the latter, or with
+// domain.ErrImportInProgress when they are not replayable. Any other error is
+// returned as is.
+func (fs *FileService) replayClaimed(ctx *context.Context, schemaId primitive.ObjectID, key, checksum string, err error) ([]*domain.Import, error) {
+	if key == "" || !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	originals, err := fs.findOriginalImports(ctx, schemaId, key, checksum)
+	if err != nil {
+		return nil, err
+	}
+	if len(originals) == 0 {
+		return nil, domain.ErrImportInProgress
+	}
+	for _, original := range originals {
+		original.Replayed = true
+	}
+
+	return originals, nil
+}
+
+// ProcessAndSaveAll ingests every file of a multi-file upload into the same
+// schema. The failure of a file does not stop the others, so the only error
+// returned is the schema lookup. A shared idempotency key is scoped to each
+// file by its position in the upload.
+func (fs *FileService) ProcessAndSaveAll(ctx *context.Context, files []*domain.File) ([]*FileOutcome, error) {
+	if len(files) == 0 {
+		return nil, domain.ErrFileMissing
+	}
+
+	if _, err := fs.SchemaRepository.FindById(ctx, files[0].SchemaId); err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]*FileOutcome, 0, len(files))
+	for i, file := range files {
+		if file.IdempotencyKey != "" && len(files) > 1 {
+			file.IdempotencyKey = fmt.Sprintf("%s:%d", file.IdempotencyKey, i)
+		}
+
+		imports, err := fs.ProcessAndSave(ctx, file)
+		outcomes = append(outcomes, &FileOutcome{File: file, Imports: imports, Err: err})
+	}
+
+	return outcomes, nil
+}
+
+// processArchive processes each entry of the archive, except those that
+// already have a replayable import among originals, which is returned instead.
+// The entries that failed in an earlier upload are thus processed again.
+func (fs *FileService) processArchive(ctx *context.Context, schema *domain.Schema, file *domain.File, checksum string, archive domain.FileContent, originals []*domain.Import, replace *replacement) ([]*domain.Import, error) {
+	reader, err := zip.NewReader(archive, file.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*zip.File
+	for _, entry := range reader.File {
+		if !isArchiveMetadata(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, domain.ErrEmptyArchive
+	}
+	if fs.Options.MaxArchiveEntries > 0 && len(entries) > fs.Options.MaxArchiveEntries {
+		return nil, domain.ErrTooManyArchiveEntries
+	}
+
+	budget := newUncompressedBudget(fs.Options.MaxUncompressedSize)
+	imports := make([]*domain.Import, 0, len(entries))
+	for _, entry := range entries {
+		if i := slices.IndexFunc(originals, func(original *domain.Import) bool { return original.Entry == entry.Name }); i >= 0 {
+			imports = append(imports, originals[i])
+			continue
+		}
+
+		imp := domain.NewImport(schema.ID, file, checksum)
+		imp.Entry = entry.Name
+
+		imp, err := fs.process(ctx, schema, imp, int64(entry.UncompressedSize64), replace, func(progress *importProgress) (io.ReadCloser, error) {
+			compressed, err := entry.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := decompress(progress.countBytes(compressed))
+			if err != nil {
+				_ = compressed.Close()
+				return nil, err
+			}
+			return budget.limit(&archiveEntryReader{ReadCloser: content, entry: compressed}), nil
+		})
+		if imp == nil {
+			return imports, err
+		}
+		imports = append(imports, imp)
+	}
+
+	return imports, nil
+}
+
+// process records the import and writes the leads read from the content
+// opened by open, which counts the size bytes it reads through progress. When
+// replace is set, the leads are staged even if the file is small enough for a
+// transaction, and the leads it replaces are withdrawn before they are
+// published, unless an earlier import replaced them already. The leads are
+// reserved from the quota of the tenant once the whole file was read, and
+// given back when the import fails. The returned import is nil only when it
+// could not be recorded at all, or was not kept because the quotas of the
+// tenant do not allow another import.
+func (fs *FileService) process(ctx *context.Context, schema *domain.Schema, imp *domain.Import, size int64, replace *replacement, open func(progress *importProgress) (io.ReadCloser, error)) (*domain.Import, error) {
+	if err := fs.create(ctx, imp); err != nil {
+		return nil, err
+	}
+
+	var maxRows int64
+	if fs.Quotas != nil {
+		var err error
+		if maxRows, err = fs.Quotas.StartImport(ctx, imp); err != nil {
+			// an import that never ran is not kept, nor is its idempotency key
+			if deleteErr := fs.ImportRepository.Delete(ctx, imp.ID); deleteErr != nil {
+				err = errors.Join(err, deleteErr)
+			}
+			return nil, err
+		}
+	}
+
+	transactional := replace == nil && fs.Options.Transactional && size <= fs.Options.TransactionMaxSize
+	progress := newImportProgress(fs.ImportRepository, imp, size, fs.Options.ProgressInterval)
+	rowsRead, rowsInserted, rowsSuppressed := 0, 0, 0
+
+	content, err := open(progress)
+	if err == nil {
+		rowsRead, rowsInserted, rowsSuppressed, err = fs.saveLeads(ctx, content, schema, imp.ID, transactional, maxRows, progress)
+		if closeErr := content.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	saved := err == nil
+	var reservation *RowReservation
+	if err == nil && fs.Quotas != nil {
+		reservation, err = fs.Quotas.ReserveRows(ctx, rowsInserted)
+	}
+	withdrawn := false
+	if err == nil && replace != nil && !replace.committed {
+		withdrawn = true
+		err = replace.Withdraw(ctx)
+	}
+	if err == nil && !transactional {
+		err = fs.publish(ctx, imp.ID, progress)
+	}
+	if err == nil {
+		imp.Complete(rowsRead, rowsInserted)
+		imp.RowsSuppressed = rowsSuppressed
+		err = fs.notifyCompleted(ctx, imp)
+	}
+
+	if err != nil {
+		// staged leads, and those published or committed before the error,
+		// are removed
+		if !transactional || saved {
+			if cleanupErr := fs.discard(ctx, imp.ID); cleanupErr != nil {
+				err = errors.Join(err, cleanupErr)
+			}
+		}
+		// the replaced leads take their unique values back once the leads of
+		// the import are removed
+		if withdrawn {
+			if restoreErr := replace.Restore(ctx); restoreErr != nil {
+				err = errors.Join(err, restoreErr)
+			}
+		}
+		if fs.Quotas != nil {
+			if releaseErr := fs.Quotas.ReleaseRows(ctx, reservation); releaseErr != nil {
+				log.Println("Failed to release usage: ", releaseErr)
+			}
+		}
+		imp.Fail(rowsRead, err)
+	} else {
+		if withdrawn {
+			replace.committed = true
+			if commitErr := replace.Commit(ctx); commitErr != nil {
+				log.Println("Failed to remove replaced leads: ", commitErr)
+			}
+		}
+	}
+	imp.Progress = progress.finish()
+
+	if updateErr := fs.ImportRepository.Update(ctx, imp); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	if imp.Status != domain.ImportStatusCompleted {
+		fs.notify(ctx, imp)
+	}
+	fs.Audit.Record(ctx, domain.AuditActionLeadsImported, domain.AuditEntityImport, imp.ID.Hex(), nil, map[string]interface{}{
+		"schema_id":       imp.SchemaId.Hex(),
+		"file_name":       imp.FileName,
+		"status":          imp.Status,
+		"rows_read":       imp.RowsRead,
+		"rows_inserted":   imp.RowsInserted,
+		"rows_suppressed": imp.RowsSuppressed,
+	})
+
+	return imp, err
+}
+
+// create records the import, claiming its idempotency key while the import
+// may be replayed. A claim held by an import older than the retention window
+// is given up for the new one, while a recent claim fails with a duplicate key
+// error.
+func (fs *FileService) create(ctx *context.Context, imp *domain.Import) error {
+	imp.IdempotencyClaimed = imp.IdempotencyKey != "" && fs.Options.IdempotencyRetention > 0
+
+	err := fs.ImportRepository.Create(ctx, imp)
+	if !imp.IdempotencyClaimed || !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	before := time.Now().Add(-fs.Options.IdempotencyRetention)
+	released, releaseErr := fs.ImportRepository.ReleaseIdempotencyKey(ctx, imp.SchemaId, imp.IdempotencyKey, before)
+	if releaseErr != nil || !released {
+		return errors.Join(err, releaseErr)
+	}
+
+	return fs.ImportRepository.Create(ctx, imp)
+}
+
+// publish moves the staged leads of the import to the leads once the whole
+// file was read, saving the progress along the way so the import is not taken
+// for stale.
+func (fs *FileService) publish(ctx *context.Context, importId primitive.ObjectID, progress *importProgress) error {
+	for {
+		published, err := fs.LeadRepository.PublishStaged(ctx, importId, int64(max(fs.Options.BatchSize, 1)))
+		if err != nil || published == 0 {
+			return err
+		}
+		progress.save(ctx)
+	}
+}
+
+// discard removes the leads an import that did not complete left behind,
+// staged or published.
+func (fs *FileService) discard(ctx *context.Context, importId primitive.ObjectID) error {
+	_, stagedErr := fs.LeadRepository.DeleteStaged(ctx, importId)
+	_, leadsErr := fs.LeadRepository.DeleteByImportId(ctx, importId)
+	return errors.Join(stagedErr, leadsErr)
+}
+
+// notify tells subscribers how an import that did not complete ended.
+// Failures are only logged, as the import itself is already recorded.
+func (fs *FileService) notify(ctx *context.Context, imp *domain.Import) {
+	if err := fs.Notifier.Notify(ctx, domain.NewImportEvent(imp)); err != nil {
+		log.Println("Failed to notify import event: ", err)
+	}
+}
+
+// notifyCompleted tells subscribers about the leads of a completed import, in
+// batches, and then about the import. It runs before the import is recorded
+// as completed, so a completed import never misses its events: when they can
+// not be recorded, the import fails instead.
+func (fs *FileService) notifyCompleted(ctx *context.Context, imp *domain.Import) error {
+	if err := fs.notifyLeads(ctx, imp); err != nil {
+		return err
+	}
+	return fs.Notifier.Notify(ctx, domain.NewImportEvent(imp))
+}
+
+func (fs *FileService) notifyLeads(ctx *context.Context, imp *domain.Import) error {
+	wanted, err := fs.Notifier.Wants(ctx, imp.SchemaId, domain.EventLeadCreated)
+	if err != nil || !wanted {
+		return err
+	}
+
+	var after primitive.ObjectID
+	for {
+		leads, err := fs.LeadRepository.FindByImportId(ctx, imp.ID, after, int64(max(fs.Options.BatchSize, 1)))
+		if err != nil || len(leads) == 0 {
+			return err
+		}
+
+		// subscribers are never sent the sensitive fields
+		for _, lead := range leads {
+			redactLead(lead)
+		}
+
+		event := domain.NewEvent(domain.EventLeadCreated, imp.SchemaId, domain.LeadsCreatedData{ImportId: &imp.ID, Leads: leads})
+		if err := fs.Notifier.Notify(ctx, event); err != nil {
+			return err
+		}
+
+		after = leads[len(leads)-1]["_id"].(primitive.ObjectID)
+	}
+}
+
+// findOriginalImports looks for an earlier upload of the same request, first
+// by idempotency key and then by content, within the retention window.
+func (fs *FileService) findOriginalImports(ctx *context.Context, schemaId primitive.ObjectID, key, checksum string) ([]*domain.Import, error) {
+	if fs.Options.IdempotencyRetention <= 0 {
+		return nil, nil
+	}
+	since := time.Now().Add(-fs.Options.IdempotencyRetention)
+	aliveSince := since
+	if fs.Options.StaleImportAfter > 0 {
+		aliveSince = time.Now().Add(-fs.Options.StaleImportAfter)
+	}
+
+	if key != "" {
+		imports, err := fs.ImportRepository.FindReplayableByIdempotencyKey(ctx, schemaId, key, since, aliveSince)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range imports {
+			if imp.Checksum != checksum {
+				return nil, domain.ErrIdempotencyKeyReused
+			}
+		}
+		if len(imports) > 0 {
+			return imports, nil
+		}
+	}
+
+	return fs.ImportRepository.FindReplayableByChecksum(ctx, schemaId, checksum, since, aliveSince)
+}
+
+// saveLeads reads the CSV and writes its leads, returning how many rows were
+// read, how many leads were written and how many were left out as suppressed. Every row is counted in progress. A
+// file with more than maxRows leads fails, unless maxRows is zero. The leads
+// of a non-transactional save are only staged, and the caller is responsible
+// for publishing them or, when it fails, removing them.
+func (fs *FileService) saveLeads(ctx *context.Context, r io.Reader, schema *domain.Schema, importId primitive.ObjectID, transactional bool, maxRows int64, progress *importProgress) (int, int, int, error) {
+	reader := csv.NewReader(r)
 	reader.Comment = '#'
 	headers, err := reader.Read()
 	if err != nil {
-		return err
+		return 0, 0, 0, err
 	}
 
-	if !domain.ValidateRequiredFields(headers) {
-		return domain.ErrRequiredFieldsMissing
+	if err := validateHeaders(headers, schema); err != nil {
+		return 0, 0, 0, err
 	}
 
-	if !domain.ValidateDuplicatedFields(headers) {
-		return domain.ErrDuplicatedFields
+	hash, err := fs.Cipher.SuppressionHasher(ctx)
+	if err != nil {
+		return 0, 0, 0, err
 	}
 
-	if !domain.ValidateRequiredFieldsFromSchema(headers, schema.Fields) {
-		return domain.ErrRequiredFieldsMissing
+	batchSize := fs.Options.BatchSize
+	if transactional {
+		batchSize = 0
 	}
 
 	var leads []*bson.D
+	var subjects [][]string
+	rowsRead, rowsInserted, rowsSuppressed := 0, 0, 0
+	flush := func() error {
+		if len(leads) == 0 {
+			return nil
+		}
+
+		kept, err := fs.unsuppressed(ctx, leads, subjects)
+		if err != nil {
+			return err
+		}
+		rowsSuppressed += len(leads) - len(kept)
+		leads, subjects = kept, subjects[:0]
+		if len(leads) == 0 {
+			return nil
+		}
+
+		if transactional {
+			err = fs.LeadRepository.CreateManyInTransaction(ctx, leads)
+		} else {
+			err = fs.LeadRepository.CreateManyStaged(ctx, leads)
+		}
+		if err != nil {
+			return err
+		}
+
+		rowsInserted += len(leads)
+		leads = leads[:0]
+		return nil
+	}
+
 	uniqueFieldsMap := make(map[string]map[string]bool)
 
 	for _, field := range schema.Fields {
@@ -69,46 +593,140 @@ func (fs *FileService) ProcessAndSave(ctx *context.Context, file *domain.File) e
 			if err.Error() == "EOF" {
 				break
 			}
-			return err
+			return rowsRead, rowsInserted, rowsSuppressed, err
 		}
+		rowsRead++
 
 		for i, value := range record {
 			header := headers[i]
 			if uniqueFields, ok := uniqueFieldsMap[header]; ok {
 				if uniqueFields[value] {
-					return domain.ErrDuplicatedValue
+					progress.row(ctx, false)
+					return rowsRead, rowsInserted, rowsSuppressed, domain.ErrDuplicatedValue
 				}
 				uniqueFields[value] = true
 			}
 		}
 
-		doc, err := leadFromRecord(record, headers, *schema)
+		doc, err := leadFromRecord(record, headers, *schema, importId)
 		if err != nil {
-			return err
+			progress.row(ctx, false)
+			return rowsRead, rowsInserted, rowsSuppressed, err
+		}
+		// the subject is read before the email and phone may be encrypted
+		subject := doc.Map()
+		subjects = append(subjects, domain.SubjectHashes(hash, subject["email"], subject["phone"]))
+		if err := fs.Cipher.Seal(ctx, schema, doc); err != nil {
+			return rowsRead, rowsInserted, rowsSuppressed, err
 		}
+		progress.row(ctx, true)
 		leads = append(leads, doc)
+
+		if maxRows > 0 && int64(rowsInserted+len(leads)) > maxRows {
+			return rowsRead, rowsInserted, rowsSuppressed, dailyRowsExceeded(time.Now())
+		}
+
+		if batchSize > 0 && len(leads) >= batchSize {
+			if err := flush(); err != nil {
+				return rowsRead, rowsInserted, rowsSuppressed, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return rowsRead, rowsInserted, rowsSuppressed, err
+	}
+
+	return rowsRead, rowsInserted, rowsSuppressed, nil
+}
+
+// unsuppressed returns the leads whose subject, the hashes of their email and
+// phone, is not suppressed.
+func (fs *FileService) unsuppressed(ctx *context.Context, leads []*bson.D, subjects [][]string) ([]*bson.D, error) {
+	var hashes []string
+	for _, subject := range subjects {
+		hashes = append(hashes, subject...)
 	}
 
-	err = fs.LeadRepository.CreateMany(ctx, leads)
+	suppressed, err := fs.SuppressionRepository.FindSuppressed(ctx, hashes)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(suppressed) == 0 {
+		return leads, nil
+	}
+
+	kept := leads[:0]
+	for i, lead := range leads {
+		if !slices.ContainsFunc(subjects[i], func(hash string) bool { return suppressed[hash] }) {
+			kept = append(kept, lead)
+		}
+	}
+	return kept, nil
+}
+
+func checksumOf(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// validateHeaders checks the fields of the leads against the schema before
+// any lead is read.
+func validateHeaders(headers []string, schema *domain.Schema) error {
+	if !domain.ValidateRequiredFields(headers) {
+		return domain.ErrRequiredFieldsMissing
+	}
+
+	if !domain.ValidateDuplicatedFields(headers) {
+		return domain.ErrDuplicatedFields
+	}
+
+	if !domain.ValidateRequiredFieldsFromSchema(headers, schema.Fields) {
+		return domain.ErrRequiredFieldsMissing
 	}
 
 	return nil
 }
 
-func leadFromRecord(record []string, headers []string, schema domain.Schema) (*bson.D, error) {
+// leadFromRecord builds the lead of a row, tagged with the import that read
+// it unless importId is zero. The consent fields are read along with those of
+// the schema, and left out when empty.
+func leadFromRecord(record []string, headers []string, schema domain.Schema, importId primitive.ObjectID) (*bson.D, error) {
 	doc := bson.D{}
 	seen := make(map[string]string)
 	for _, field := range schema.Fields {
 		seen[field.Name] = field.Type
 	}
+	for name, fieldType := range domain.ConsentFieldTypes {
+		seen[name] = fieldType
+	}
 
 	doc = append(doc, bson.E{Key: "schema_id", Value: schema.ID})
+	if !importId.IsZero() {
+		doc = append(doc, bson.E{Key: "import_id", Value: importId})
+	}
 
 	dateTime := primitive.NewDateTimeFromTime(time.Now())
 
 	for i, value := range record {
+		if domain.IsConsentField(headers[i]) {
+			// consent is optional, so a row of a file may leave it empty
+			if value == "" {
+				continue
+			}
+			if headers[i] == domain.LeadConsentChannelField {
+				value = strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+
 		parsedValue, err := domain.ValueFromType(value, seen[headers[i]])
 		if err != nil {
 			return nil, domain.ErrInvalidFieldValues
@@ -116,6 +734,10 @@ func leadFromRecord(record []string, headers []string, schema domain.Schema) (*b
 		doc = append(doc, bson.E{Key: headers[i], Value: parsedValue})
 	}
 
+	if !domain.ValidateConsent(doc.Map()) {
+		return nil, domain.ErrInvalidFieldValues
+	}
+
 	doc = append(doc, bson.E{Key: "created_at", Value: dateTime})
 	doc = append(doc, bson.E{Key: "updated_at", Value: dateTime})
 
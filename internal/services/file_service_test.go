@@ -0,0 +1,467 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFileService_ProcessAndSave(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+	content := "email,phone\na@test.com,1\nb@test.com,2\nc@test.com,3\n"
+
+	_ = t.Run("success, leads are written in batches", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 2})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imp.Status)
+			_ = assert.Equal(t, 3, imp.RowsRead)
+			_ = assert.Equal(t, 3, imp.RowsInserted)
+			_ = assert.Equal(t, 2, leadRepository.calls)
+			_ = assert.Len(t, leadRepository.leads, 3)
+		}
+	})
+
+	_ = t.Run("failed batch removes the leads already written", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		leadRepository.failOnCall = 2
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 2})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.True(t, mongo.IsDuplicateKeyError(err))
+			_ = assert.Equal(t, domain.ImportStatusFailed, imp.Status)
+			_ = assert.Equal(t, 3, imp.RowsRead)
+			_ = assert.Empty(t, leadRepository.leads)
+		}
+	})
+
+	_ = t.Run("invalid row after a written batch leaves no leads behind", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 1})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", "email,phone\na@test.com,1\nb@test.com,x\n"))
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrInvalidFieldValues, err)
+			_ = assert.Equal(t, domain.ImportStatusFailed, imp.Status)
+			_ = assert.Equal(t, 2, imp.RowsRead)
+			_ = assert.Empty(t, leadRepository.leads)
+			_ = assert.Empty(t, leadRepository.staged)
+			_ = assert.Zero(t, leadRepository.published)
+		}
+	})
+
+	_ = t.Run("import whose events can not be recorded fails", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		notifier := NewEventNotifierMock()
+		notifier.failOn, notifier.failWith = domain.EventImportCompleted, errors.New("outbox unavailable")
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), notifier, nil, nil, nil,
+			IngestionOptions{BatchSize: 2})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imp.Status)
+			_ = assert.Equal(t, 0, imp.RowsInserted)
+			_ = assert.Empty(t, leadRepository.leads)
+			_ = assert.Equal(t, domain.EventImportFailed, notifier.events[len(notifier.events)-1].Type)
+		}
+	})
+
+	_ = t.Run("small files are written in a single transaction", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 1, Transactional: true, TransactionMaxSize: 1024})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 3, imp.RowsInserted)
+			_ = assert.Equal(t, 1, leadRepository.transactions)
+		}
+	})
+
+	_ = t.Run("files above the transaction limit are written in batches", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 1, Transactional: true, TransactionMaxSize: 8})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 3, imp.RowsInserted)
+			_ = assert.Equal(t, 0, leadRepository.transactions)
+			_ = assert.Equal(t, 3, leadRepository.calls)
+		}
+	})
+
+	_ = t.Run("success, consent is read along with the fields of the schema", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 10})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv",
+			"email,phone,consent_channel,consent_timestamp,consent_source\na@test.com,1, SMS ,1700000000,landing page\nb@test.com,2,,,\n"))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 2, imp.RowsInserted)
+			consented, notConsented := leadRepository.leads[0].Map(), leadRepository.leads[1].Map()
+			_ = assert.Equal(t, "sms", consented[domain.LeadConsentChannelField])
+			_ = assert.Equal(t, int64(1700000000), consented[domain.LeadConsentTimestampField])
+			_ = assert.Equal(t, "landing page", consented[domain.LeadConsentSourceField])
+			_ = assert.NotContains(t, notConsented, domain.LeadConsentChannelField)
+			_ = assert.NotContains(t, notConsented, domain.LeadConsentTimestampField)
+		}
+	})
+
+	_ = t.Run("consent without a known channel is rejected", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 10})
+
+		// act
+		_, noChannelErr := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", "email,phone,consent_source\na@test.com,1,landing page\n"))
+		_, unknownChannelErr := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "other.csv", "email,phone,consent_channel\na@test.com,1,fax\n"))
+
+		// assert
+		_ = assert.ErrorIs(t, noChannelErr, domain.ErrInvalidFieldValues)
+		_ = assert.ErrorIs(t, unknownChannelErr, domain.ErrInvalidFieldValues)
+	})
+}
+
+func TestFileService_ProcessAndSave_Progress(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+
+	_ = t.Run("success, progress is saved while reading and kept in the import", func(t *testing.T) {
+		// arrange
+		content := "email,phone\na@test.com,1\nb@test.com,2\nc@test.com,3\n"
+		importRepository := NewImportRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), importRepository, NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 2})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		// saved for each of the three rows, then each of the two batches published
+		if assert.NoError(t, err) && assert.Len(t, importRepository.progress, 5) {
+			_ = assert.Equal(t, 1, importRepository.progress[0].RowsRead)
+			_ = assert.Equal(t, 3, importRepository.progress[2].RowsValid)
+			_ = assert.Equal(t, &domain.ImportProgress{
+				RowsRead:   3,
+				RowsValid:  3,
+				BytesRead:  int64(len(content)),
+				BytesTotal: int64(len(content)),
+				UpdatedAt:  imp.Progress.UpdatedAt,
+			}, imp.Progress)
+		}
+	})
+
+	_ = t.Run("rejected row is counted in the failed import", func(t *testing.T) {
+		// arrange
+		content := "email,phone\na@test.com,1\nb@test.com,two\nc@test.com,3\n"
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 2, ProgressInterval: time.Hour})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.ErrorIs(t, err, domain.ErrInvalidFieldValues) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imp.Status)
+			_ = assert.Equal(t, 2, imp.Progress.RowsRead)
+			_ = assert.Equal(t, 1, imp.Progress.RowsValid)
+			_ = assert.Equal(t, 1, imp.Progress.RowsRejected)
+		}
+	})
+}
+
+func TestFileService_ProcessAndSave_Replay(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+	content := "email,phone\na@test.com,1\n"
+	options := IngestionOptions{BatchSize: 10, IdempotencyRetention: time.Hour}
+
+	_ = t.Run("same content returns the original import", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		original, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+		if err != nil {
+			t.Fatal("Failed to process file:", err)
+		}
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "copy.csv", content))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.True(t, imp.Replayed)
+			_ = assert.Equal(t, original.ID, imp.ID)
+			_ = assert.Len(t, leadRepository.leads, 1)
+		}
+	})
+
+	_ = t.Run("same idempotency key returns the original import", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		file := newFile(t, schema.ID.Hex(), "leads.csv", content)
+		file.IdempotencyKey = "key-1"
+		original, err := processOne(&ctx, service, file)
+		if err != nil {
+			t.Fatal("Failed to process file:", err)
+		}
+
+		// act
+		imp, err := processOne(&ctx, service, file)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.True(t, imp.Replayed)
+			_ = assert.Equal(t, original.ID, imp.ID)
+		}
+	})
+
+	_ = t.Run("same idempotency key with different content", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		file := newFile(t, schema.ID.Hex(), "leads.csv", content)
+		file.IdempotencyKey = "key-1"
+		if _, err := processOne(&ctx, service, file); err != nil {
+			t.Fatal("Failed to process file:", err)
+		}
+		other := newFile(t, schema.ID.Hex(), "leads.csv", "email,phone\nb@test.com,2\n")
+		other.IdempotencyKey = "key-1"
+
+		// act
+		_, err := processOne(&ctx, service, other)
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrIdempotencyKeyReused, err)
+		}
+	})
+
+	_ = t.Run("stale import holding the idempotency key is not replayed", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 10, IdempotencyRetention: time.Hour, StaleImportAfter: 10 * time.Minute})
+		file := newFile(t, schema.ID.Hex(), "leads.csv", content)
+		file.IdempotencyKey = "key-1"
+		original, err := processOne(&ctx, service, file)
+		if err != nil {
+			t.Fatal("Failed to process file:", err)
+		}
+		original.Status = domain.ImportStatusProcessing
+		original.StartedAt = primitive.NewDateTimeFromTime(time.Now().Add(-30 * time.Minute))
+		original.Progress = nil
+
+		// act
+		imp, err := processOne(&ctx, service, file)
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrImportInProgress, err)
+			_ = assert.Nil(t, imp)
+		}
+	})
+
+	_ = t.Run("idempotency key claimed before the retention window is released", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		file := newFile(t, schema.ID.Hex(), "leads.csv", content)
+		file.IdempotencyKey = "key-1"
+		original, err := processOne(&ctx, service, file)
+		if err != nil {
+			t.Fatal("Failed to process file:", err)
+		}
+		original.StartedAt = primitive.NewDateTimeFromTime(time.Now().Add(-2 * time.Hour))
+
+		// act
+		imp, err := processOne(&ctx, service, file)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.False(t, imp.Replayed)
+			_ = assert.True(t, imp.IdempotencyClaimed)
+			_ = assert.False(t, original.IdempotencyClaimed)
+		}
+	})
+
+	_ = t.Run("failed imports are processed again", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		leadRepository.failOnCall = 1
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		failed, _ := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.False(t, imp.Replayed)
+			_ = assert.NotEqual(t, failed.ID, imp.ID)
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imp.Status)
+		}
+	})
+}
+
+func TestFileService_ProcessAndSaveAll(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+	options := IngestionOptions{BatchSize: 10, IdempotencyRetention: time.Hour}
+
+	_ = t.Run("a failed file does not stop the others", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		files := []*domain.File{
+			newFile(t, schema.ID.Hex(), "first.csv", "email,phone\na@test.com,1\n"),
+			newFile(t, schema.ID.Hex(), "second.csv", "email,name\nb@test.com,B\n"),
+			newFile(t, schema.ID.Hex(), "third.csv", "email,phone\nc@test.com,3\n"),
+		}
+
+		// act
+		outcomes, err := service.ProcessAndSaveAll(&ctx, files)
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, outcomes, 3) {
+			_ = assert.NoError(t, outcomes[0].Err)
+			_ = assert.Equal(t, domain.ErrRequiredFieldsMissing, outcomes[1].Err)
+			_ = assert.Equal(t, domain.ImportStatusFailed, outcomes[1].Imports[0].Status)
+			_ = assert.NoError(t, outcomes[2].Err)
+			_ = assert.Len(t, leadRepository.leads, 2)
+		}
+	})
+
+	_ = t.Run("idempotency key is scoped to each file", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+		newFiles := func() []*domain.File {
+			files := []*domain.File{
+				newFile(t, schema.ID.Hex(), "first.csv", "email,phone\na@test.com,1\n"),
+				newFile(t, schema.ID.Hex(), "second.csv", "email,phone\nb@test.com,2\n"),
+			}
+			for _, file := range files {
+				file.IdempotencyKey = "key-1"
+			}
+			return files
+		}
+		if _, err := service.ProcessAndSaveAll(&ctx, newFiles()); err != nil {
+			t.Fatal("Failed to process files:", err)
+		}
+
+		// act
+		outcomes, err := service.ProcessAndSaveAll(&ctx, newFiles())
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, outcomes, 2) {
+			for _, outcome := range outcomes {
+				_ = assert.NoError(t, outcome.Err)
+				_ = assert.True(t, outcome.Imports[0].Replayed)
+			}
+		}
+	})
+
+	_ = t.Run("without files", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, options)
+
+		// act
+		_, err := service.ProcessAndSaveAll(&ctx, nil)
+
+		// assert
+		_ = assert.Equal(t, domain.ErrFileMissing, err)
+	})
+}
+
+func newFile(t *testing.T, schemaId, name, content string) *domain.File {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal("Failed to create form file:", err)
+	}
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(int64(len(content)) + 1024)
+	if err != nil {
+		t.Fatal("Failed to read form:", err)
+	}
+	t.Cleanup(func() { _ = form.RemoveAll() })
+
+	return domain.NewMultipartFile(schemaId, form.File["file"][0])
+}
+
+func processOne(ctx *context.Context, service *FileService, file *domain.File) (*domain.Import, error) {
+	imports, err := service.ProcessAndSave(ctx, file)
+	if len(imports) == 0 {
+		return nil, err
+	}
+	return imports[0], err
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// importProgress counts the rows and bytes read by an import and saves them
+// to the import every interval, so clients can follow a large file while it
+// is read.
+type importProgress struct {
+	progress   domain.ImportProgress
+	importId   primitive.ObjectID
+	repository repositories.ImportRepository
+	interval   time.Duration
+	startedAt  time.Time
+	savedAt    time.Time
+}
+
+func newImportProgress(ir repositories.ImportRepository, imp *domain.Import, bytesTotal int64, interval time.Duration) *importProgress {
+	now := time.Now()
+	return &importProgress{
+		progress:   domain.ImportProgress{BytesTotal: bytesTotal},
+		importId:   imp.ID,
+		repository: ir,
+		interval:   interval,
+		startedAt:  now,
+		savedAt:    now,
+	}
+}
+
+// countBytes returns a reader that counts the bytes read from r. It wraps the
+// content before it is decompressed, so the count matches BytesTotal.
+func (p *importProgress) countBytes(r io.Reader) io.Reader {
+	return &countingReader{Reader: r, count: &p.progress.BytesRead}
+}
+
+// row records a row read from the file and saves the progress when the
+// interval has passed since it was last saved.
+func (p *importProgress) row(ctx *context.Context, valid bool) {
+	p.progress.RowsRead++
+	if valid {
+		p.progress.RowsValid++
+	} else {
+		p.progress.RowsRejected++
+	}
+
+	p.save(ctx)
+}
+
+// save saves the progress when the interval has passed since it was last
+// saved, which also tells the import is still alive.
+func (p *importProgress) save(ctx *context.Context) {
+	if time.Since(p.savedAt) < p.interval {
+		return
+	}
+	p.savedAt = time.Now()
+
+	// a progress that could not be saved is not worth failing the import for
+	if err := p.repository.UpdateProgress(ctx, p.importId, p.snapshot()); err != nil {
+		log.Println("Failed to save import progress: ", err)
+	}
+}
+
+// snapshot returns the progress so far, estimating the time left from the
+// rate the bytes have been read at.
+func (p *importProgress) snapshot() *domain.ImportProgress {
+	progress := p.progress
+	progress.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	if progress.BytesRead > 0 && progress.BytesTotal > progress.BytesRead {
+		elapsed := time.Since(p.startedAt)
+		remaining := time.Duration(float64(elapsed) * float64(progress.BytesTotal-progress.BytesRead) / float64(progress.BytesRead))
+		progress.EstimatedSecondsRemaining = int64(remaining.Round(time.Second).Seconds())
+	}
+
+	return &progress
+}
+
+// finish returns the final progress of the import, with nothing left to read.
+func (p *importProgress) finish() *domain.ImportProgress {
+	progress := p.snapshot()
+	progress.EstimatedSecondsRemaining = 0
+	return progress
+}
+
+type countingReader struct {
+	io.Reader
+	count *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	*cr.count += int64(n)
+	return n, err
+}
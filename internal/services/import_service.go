@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// withdrawBatchSize is how many leads are moved between the leads and the
+// staging collection at once when an import is replaced.
+const withdrawBatchSize = 1000
+
+type ImportService struct {
+	TenantRepository repositories.TenantRepository
+	SchemaRepository repositories.SchemaRepository
+	LeadRepository   repositories.LeadRepository
+	ImportRepository repositories.ImportRepository
+	Audit            *AuditService
+}
+
+func NewImportService(tr repositories.TenantRepository, sr repositories.SchemaRepository, lr repositories.LeadRepository, ir repositories.ImportRepository, audit *AuditService) *ImportService {
+	return &ImportService{
+		TenantRepository: tr,
+		SchemaRepository: sr,
+		LeadRepository:   lr,
+		ImportRepository: ir,
+		Audit:            audit,
+	}
+}
+
+func (is *ImportService) FindById(ctx *context.Context, id string) (*domain.Import, error) {
+	return is.ImportRepository.FindById(ctx, id)
+}
+
+// FollowProgress sends the import, then reloads it every interval and sends
+// it again whenever its progress or status changed, until it is no longer
+// processing or ctx is done.
+func (is *ImportService) FollowProgress(ctx *context.Context, imp *domain.Import, interval time.Duration, send func(imp *domain.Import) error) error {
+	if err := send(imp); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for imp.Status == domain.ImportStatusProcessing {
+		select {
+		case <-(*ctx).Done():
+			return (*ctx).Err()
+		case <-ticker.C:
+		}
+
+		current, err := is.ImportRepository.FindById(ctx, imp.ID.Hex())
+		if err != nil {
+			return err
+		}
+		if current.Status == imp.Status && progressUpdatedAt(current) == progressUpdatedAt(imp) {
+			continue
+		}
+
+		imp = current
+		if err := send(imp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func progressUpdatedAt(imp *domain.Import) primitive.DateTime {
+	if imp.Progress == nil {
+		return 0
+	}
+	return imp.Progress.UpdatedAt
+}
+
+func (is *ImportService) FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.Import, error) {
+	_, err := is.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	return is.ImportRepository.FindBySchemaId(ctx, schemaId)
+}
+
+func (is *ImportService) Rollback(ctx *context.Context, id string) (*domain.Import, error) {
+	imp, err := is.ImportRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := imp.CanRollback(); err != nil {
+		return nil, err
+	}
+
+	deleted, err := is.LeadRepository.DeleteByImportId(ctx, imp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := is.rolledBack(ctx, imp, deleted); err != nil {
+		return nil, err
+	}
+
+	return imp, nil
+}
+
+// Withdraw unpublishes the leads of a completed import, except those under
+// legal hold, so an import replacing it can publish leads with the same unique
+// values. The import is then either rolled back with CompleteRollback, or its
+// leads published again with Restore.
+func (is *ImportService) Withdraw(ctx *context.Context, imp *domain.Import) error {
+	if err := imp.CanRollback(); err != nil {
+		return err
+	}
+
+	for {
+		withdrawn, err := is.LeadRepository.UnpublishByImportId(ctx, imp.ID, withdrawBatchSize)
+		if err != nil || withdrawn == 0 {
+			return err
+		}
+	}
+}
+
+// Restore publishes again the leads of an import that were withdrawn.
+func (is *ImportService) Restore(ctx *context.Context, imp *domain.Import) error {
+	for {
+		published, err := is.LeadRepository.PublishStaged(ctx, imp.ID, withdrawBatchSize)
+		if err != nil || published == 0 {
+			return err
+		}
+	}
+}
+
+// CompleteRollback deletes the withdrawn leads of an import and records it as
+// rolled back.
+func (is *ImportService) CompleteRollback(ctx *context.Context, imp *domain.Import) error {
+	deleted, err := is.LeadRepository.DeleteStaged(ctx, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	return is.rolledBack(ctx, imp, deleted)
+}
+
+func (is *ImportService) rolledBack(ctx *context.Context, imp *domain.Import, deleted int64) error {
+	before := imp.Status
+	imp.RollBack(deleted)
+	if err := is.ImportRepository.Update(ctx, imp); err != nil {
+		return err
+	}
+
+	is.Audit.Record(ctx, domain.AuditActionImportRolledBack, domain.AuditEntityImport, imp.ID.Hex(),
+		map[string]interface{}{"status": before},
+		map[string]interface{}{"status": imp.Status, "rows_deleted": imp.RowsDeleted})
+	return nil
+}
+
+// RecoverStale fails the imports of every tenant still processing that saved
+// no progress since the given time, as their instance stopped before they
+// finished, and removes the leads they left behind, staged or published. It
+// returns how many imports it recovered. A tenant that fails does not stop the
+// others, and its error is returned along with the count.
+func (is *ImportService) RecoverStale(ctx *context.Context, since time.Time) (int, error) {
+	tenants, err := is.TenantRepository.FindAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var recovered int
+	var errs []error
+	for _, tenant := range tenants {
+		tenantCtx := withTenant(ctx, tenant)
+
+		imports, err := is.ImportRepository.FindStale(tenantCtx, since)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, imp := range imports {
+			if err := is.recover(tenantCtx, imp); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			recovered++
+		}
+	}
+
+	return recovered, errors.Join(errs...)
+}
+
+func (is *ImportService) recover(ctx *context.Context, imp *domain.Import) error {
+	if _, err := is.LeadRepository.DeleteStaged(ctx, imp.ID); err != nil {
+		return err
+	}
+	deleted, err := is.LeadRepository.DeleteByImportId(ctx, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	imp.Fail(imp.RowsRead, domain.ErrImportInterrupted)
+	if err := is.ImportRepository.Update(ctx, imp); err != nil {
+		return err
+	}
+
+	is.Audit.Record(ctx, domain.AuditActionImportInterrupted, domain.AuditEntityImport, imp.ID.Hex(),
+		map[string]interface{}{"status": domain.ImportStatusProcessing},
+		map[string]interface{}{"status": imp.Status, "rows_deleted": deleted})
+	return nil
+}
+
+// RunRecovery recovers the imports that saved no progress for staleAfter,
+// checking every staleAfter.
+func (is *ImportService) RunRecovery(ctx *context.Context, staleAfter time.Duration) {
+	ticker := time.NewTicker(staleAfter)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			recovered, err := is.RecoverStale(ctx, time.Now().Add(-staleAfter))
+			if err != nil {
+				log.Println("Failed to recover stale imports: ", err)
+			}
+			if recovered > 0 {
+				log.Printf("Recovered %d stale imports", recovered)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestImportService_Rollback(t *testing.T) {
+	ctx := context.Background()
+
+	_ = t.Run("success", func(t *testing.T) {
+		// arrange
+		imp := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusCompleted}
+		otherImportId := primitive.NewObjectID()
+
+		leadRepository := NewLeadRepositoryMock()
+		_ = leadRepository.CreateMany(&ctx, []*bson.D{
+			{{Key: "import_id", Value: imp.ID}, {Key: "email", Value: "a@test.com"}},
+			{{Key: "import_id", Value: imp.ID}, {Key: "email", Value: "b@test.com"}},
+			{{Key: "import_id", Value: otherImportId}, {Key: "email", Value: "c@test.com"}},
+		})
+
+		service := NewImportService(NewTenantRepositoryMock(), NewSchemaRepositoryMock(), leadRepository, NewImportRepositoryMock(imp), nil)
+
+		// act
+		result, err := service.Rollback(&ctx, imp.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusRolledBack, result.Status)
+			_ = assert.Equal(t, int64(2), result.RowsDeleted)
+			_ = assert.NotZero(t, result.RolledBackAt)
+			if assert.Len(t, leadRepository.leads, 1) {
+				_ = assert.Equal(t, otherImportId, leadRepository.leads[0].Map()["import_id"])
+			}
+		}
+	})
+
+	_ = t.Run("success, leads under legal hold are kept", func(t *testing.T) {
+		// arrange
+		imp := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusCompleted}
+
+		leadRepository := NewLeadRepositoryMock()
+		_ = leadRepository.CreateMany(&ctx, []*bson.D{
+			{{Key: "import_id", Value: imp.ID}, {Key: "email", Value: "a@test.com"}},
+			{{Key: "import_id", Value: imp.ID}, {Key: "email", Value: "b@test.com"}, {Key: domain.LeadLegalHoldField, Value: true}},
+		})
+
+		service := NewImportService(NewTenantRepositoryMock(), NewSchemaRepositoryMock(), leadRepository, NewImportRepositoryMock(imp), nil)
+
+		// act
+		result, err := service.Rollback(&ctx, imp.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusRolledBack, result.Status)
+			_ = assert.Equal(t, int64(1), result.RowsDeleted)
+			if assert.Len(t, leadRepository.leads, 1) {
+				_ = assert.Equal(t, "b@test.com", leadRepository.leads[0].Map()["email"])
+			}
+		}
+	})
+
+	_ = t.Run("already rolled back", func(t *testing.T) {
+		// arrange
+		imp := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusRolledBack}
+		service := NewImportService(NewTenantRepositoryMock(), NewSchemaRepositoryMock(), NewLeadRepositoryMock(), NewImportRepositoryMock(imp), nil)
+
+		// act
+		_, err := service.Rollback(&ctx, imp.ID.Hex())
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrImportAlreadyRolledBack, err)
+		}
+	})
+
+	_ = t.Run("import in progress", func(t *testing.T) {
+		// arrange
+		imp := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing}
+		service := NewImportService(NewTenantRepositoryMock(), NewSchemaRepositoryMock(), NewLeadRepositoryMock(), NewImportRepositoryMock(imp), nil)
+
+		// act
+		_, err := service.Rollback(&ctx, imp.ID.Hex())
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrImportInProgress, err)
+		}
+	})
+}
+
+func TestImportService_FollowProgress(t *testing.T) {
+	ctx := context.Background()
+
+	_ = t.Run("success, changes are sent until the import finishes", func(t *testing.T) {
+		// arrange
+		imp := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing}
+		importRepository := NewImportRepositoryMock(imp)
+		service := NewImportService(NewTenantRepositoryMock(), NewSchemaRepositoryMock(), NewLeadRepositoryMock(), importRepository, nil)
+
+		var sent []*domain.Import
+		send := func(imp *domain.Import) error {
+			sent = append(sent, imp)
+			if len(sent) == 1 {
+				finished := *imp
+				finished.Complete(3, 3)
+				finished.Progress = &domain.ImportProgress{RowsRead: 3, RowsValid: 3, UpdatedAt: finished.FinishedAt}
+				importRepository.imports[imp.ID] = &finished
+			}
+			return nil
+		}
+
+		// act
+		err := service.FollowProgress(&ctx, imp, time.Millisecond, send)
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, sent, 2) {
+			_ = assert.Equal(t, domain.ImportStatusProcessing, sent[0].Status)
+			_ = assert.Equal(t, domain.ImportStatusCompleted, sent[1].Status)
+			_ = assert.Equal(t, 3, sent[1].Progress.RowsRead)
+		}
+	})
+
+	_ = t.Run("finished import is sent once", func(t *testing.T) {
+		// arrange
+		imp := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusFailed}
+		service := NewImportService(NewTenantRepositoryMock(), NewSchemaRepositoryMock(), NewLeadRepositoryMock(), NewImportRepositoryMock(imp), nil)
+
+		calls := 0
+		send := func(*domain.Import) error {
+			calls++
+			return nil
+		}
+
+		// act
+		err := service.FollowProgress(&ctx, imp, time.Millisecond, send)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, calls)
+		}
+	})
+}
+
+func TestImportService_RecoverStale(t *testing.T) {
+	ctx := context.Background()
+
+	_ = t.Run("success, stale imports fail and their leads are removed", func(t *testing.T) {
+		// arrange
+		now := time.Now()
+		stale := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing,
+			StartedAt: primitive.NewDateTimeFromTime(now.Add(-2 * time.Hour))}
+		running := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing,
+			StartedAt: primitive.NewDateTimeFromTime(now.Add(-2 * time.Hour)),
+			Progress:  &domain.ImportProgress{UpdatedAt: primitive.NewDateTimeFromTime(now)}}
+
+		leadRepository := NewLeadRepositoryMock()
+		_ = leadRepository.CreateMany(&ctx, []*bson.D{{{Key: "import_id", Value: stale.ID}, {Key: "email", Value: "a@test.com"}}})
+		_ = leadRepository.CreateManyStaged(&ctx, []*bson.D{
+			{{Key: "import_id", Value: stale.ID}, {Key: "email", Value: "b@test.com"}},
+			{{Key: "import_id", Value: running.ID}, {Key: "email", Value: "c@test.com"}},
+		})
+		importRepository := NewImportRepositoryMock(stale, running)
+		service := NewImportService(NewTenantRepositoryMock(domain.DefaultTenant), NewSchemaRepositoryMock(), leadRepository, importRepository, nil)
+
+		// act
+		recovered, err := service.RecoverStale(&ctx, now.Add(-time.Hour))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, recovered)
+			_ = assert.Equal(t, domain.ImportStatusFailed, stale.Status)
+			_ = assert.Equal(t, domain.ErrImportInterrupted.Error(), stale.Error)
+			_ = assert.Equal(t, domain.ImportStatusProcessing, running.Status)
+			_ = assert.Empty(t, leadRepository.leads)
+			if assert.Len(t, leadRepository.staged, 1) {
+				_ = assert.Equal(t, running.ID, leadRepository.staged[0].Map()["import_id"])
+			}
+		}
+	})
+}
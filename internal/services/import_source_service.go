@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// importSourceAuthSecret is the name the auth values of import sources are
+// sealed under.
+const importSourceAuthSecret = "import_source.auth_value"
+
+// ImportSourceOptions configures scheduled imports. Remote files are
+// downloaded to Dir, each fetch is abandoned after Timeout and files larger
+// than MaxSize bytes are rejected. Zero MaxSize means no limit. Remote servers
+// on loopback, link-local or private addresses are only reached when
+// AllowPrivateNetworks is set, and their certificates are verified against
+// RootCAs, the roots of the system when nil.
+type ImportSourceOptions struct {
+	Dir                  string
+	Timeout              time.Duration
+	MaxSize              int64
+	AllowPrivateNetworks bool
+	RootCAs              *x509.CertPool
+}
+
+type ImportSourceService struct {
+	SchemaRepository       repositories.SchemaRepository
+	ImportSourceRepository repositories.ImportSourceRepository
+	ImportRepository       repositories.ImportRepository
+	FileService            *FileService
+	ImportService          *ImportService
+	// Cipher seals the auth values of the sources, which can not be set when
+	// nil.
+	Cipher  *LeadCipher
+	Options ImportSourceOptions
+
+	client *http.Client
+}
+
+func NewImportSourceService(sr repositories.SchemaRepository, isr repositories.ImportSourceRepository, ir repositories.ImportRepository, fs *FileService, is *ImportService, cipher *LeadCipher, opts ImportSourceOptions) *ImportSourceService {
+	return &ImportSourceService{
+		SchemaRepository:       sr,
+		ImportSourceRepository: isr,
+		ImportRepository:       ir,
+		FileService:            fs,
+		ImportService:          is,
+		Cipher:                 cipher,
+		Options:                opts,
+		client:                 newPublicClient(opts.Timeout, opts.AllowPrivateNetworks, opts.RootCAs, domain.ErrInvalidImportSource),
+	}
+}
+
+// remoteFile is a file fetched from an import source and the validators the
+// server returned for it.
+type remoteFile struct {
+	path         string
+	etag         string
+	lastModified string
+}
+
+func (ss *ImportSourceService) Create(ctx *context.Context, schemaId string, source *domain.ImportSource) (*domain.ImportSource, error) {
+	schedule, err := parseSchedule(source)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := ss.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ss.sealAuthValue(ctx, source); err != nil {
+		return nil, err
+	}
+
+	source.SchemaId = schema.ID
+	source.ResetValidators()
+	source.NextRunAt = primitive.NewDateTimeFromTime(schedule.Next(time.Now()))
+
+	err = ss.ImportSourceRepository.Create(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+func (ss *ImportSourceService) FindById(ctx *context.Context, id string) (*domain.ImportSource, error) {
+	return ss.ImportSourceRepository.FindById(ctx, id)
+}
+
+func (ss *ImportSourceService) FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.ImportSource, error) {
+	_, err := ss.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss.ImportSourceRepository.FindBySchemaId(ctx, schemaId)
+}
+
+// Update replaces the settings of the source. The auth value is kept when it
+// is omitted and the auth header did not change, so it need not be sent again.
+func (ss *ImportSourceService) Update(ctx *context.Context, id string, changes *domain.ImportSource) (*domain.ImportSource, error) {
+	source, err := ss.ImportSourceRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := changes.AuthValue == "" && changes.AuthHeader == source.AuthHeader
+	if kept {
+		changes.AuthValue, changes.SealedAuthValue = source.AuthValue, source.SealedAuthValue
+	}
+
+	schedule, err := parseSchedule(changes)
+	if err != nil {
+		return nil, err
+	}
+	if !kept {
+		if err := ss.sealAuthValue(ctx, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	if changes.URL != source.URL || !kept {
+		source.ResetValidators()
+	}
+
+	source.URL = changes.URL
+	source.AuthHeader = changes.AuthHeader
+	source.AuthValue = changes.AuthValue
+	source.SealedAuthValue = changes.SealedAuthValue
+	source.Schedule = changes.Schedule
+	source.Mode = changes.Mode
+	source.Enabled = changes.Enabled
+	source.NextRunAt = primitive.NewDateTimeFromTime(schedule.Next(time.Now()))
+
+	err = ss.ImportSourceRepository.Update(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// Delete removes the source. The imports of its past runs stay in the import
+// history.
+func (ss *ImportSourceService) Delete(ctx *context.Context, id string) error {
+	return ss.ImportSourceRepository.Delete(ctx, id)
+}
+
+// Run fetches and imports the source right away, regardless of its schedule.
+func (ss *ImportSourceService) Run(ctx *context.Context, id string) ([]*domain.Import, error) {
+	source, err := ss.ImportSourceRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss.run(ctx, source)
+}
+
+// RunDue runs every enabled source whose next run is due and returns how many
+// ran. Each run is claimed first, so several instances never run it twice.
+func (ss *ImportSourceService) RunDue(ctx *context.Context) (int, error) {
+	now := time.Now()
+	sources, err := ss.ImportSourceRepository.FindDue(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	var errs []error
+	for _, source := range sources {
+		schedule, err := parseSchedule(source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("import source %s: %w", source.ID.Hex(), err))
+			continue
+		}
+
+		err = ss.ImportSourceRepository.ClaimRun(ctx, source, schedule.Next(now))
+		if errors.Is(err, domain.ErrImportInProgress) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err := ss.run(withTenant(ctx, source.TenantId), source); err != nil {
+			errs = append(errs, fmt.Errorf("import source %s: %w", source.ID.Hex(), err))
+		}
+		ran++
+	}
+
+	return ran, errors.Join(errs...)
+}
+
+func (ss *ImportSourceService) RunScheduler(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			ran, err := ss.RunDue(ctx)
+			if err != nil {
+				log.Println("Failed to run import sources: ", err)
+			}
+			if ran > 0 {
+				log.Printf("Ran %d import sources", ran)
+			}
+		}
+	}
+}
+
+// run fetches the remote file and ingests it. Every run is recorded in the
+// import history: a failed fetch as a failed import and an unchanged file as
+// a skipped one. The returned error is only set when the run could not be
+// recorded.
+func (ss *ImportSourceService) run(ctx *context.Context, source *domain.ImportSource) ([]*domain.Import, error) {
+	source.LastRunAt = primitive.NewDateTimeFromTime(time.Now())
+
+	imports, err := ss.fetchAndIngest(ctx, source)
+	if err != nil {
+		imp, recordErr := ss.record(ctx, source, err)
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		imports = []*domain.Import{imp}
+	}
+
+	source.LastImportId = imports[len(imports)-1].ID
+	return imports, ss.ImportSourceRepository.RecordRun(ctx, source)
+}
+
+func (ss *ImportSourceService) fetchAndIngest(ctx *context.Context, source *domain.ImportSource) ([]*domain.Import, error) {
+	remote, err := ss.fetch(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil {
+		return ss.skip(ctx, source)
+	}
+	defer func() {
+		if err := os.Remove(remote.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Println("Failed to remove fetched file: ", err)
+		}
+	}()
+
+	file, err := domain.NewLocalFile(source.SchemaId.Hex(), remoteFileName(source.URL), remote.path)
+	if err != nil {
+		return nil, err
+	}
+	file.Uploader = source.URL
+	file.SourceId = source.ID
+
+	checksum, err := checksumOfFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if checksum == source.Checksum {
+		source.ETag, source.LastModified = remote.etag, remote.lastModified
+		return ss.skip(ctx, source)
+	}
+
+	var imports []*domain.Import
+	if source.Mode == domain.ImportSourceModeReplace {
+		imports, err = ss.FileService.ProcessAndReplace(ctx, file, &previousRuns{service: ss, source: source})
+	} else {
+		imports, err = ss.FileService.ProcessAndSave(ctx, file)
+	}
+	if len(imports) == 0 {
+		return nil, err
+	}
+	if imports[0].Replayed {
+		// the same content was already imported by another upload
+		return ss.skip(ctx, source)
+	}
+
+	if err == nil {
+		source.ETag, source.LastModified, source.Checksum = remote.etag, remote.lastModified, checksum
+	}
+	return imports, nil
+}
+
+// fetch downloads the remote file, returning nil when the server answered
+// that it did not change since the last run.
+func (ss *ImportSourceService) fetch(ctx *context.Context, source *domain.ImportSource) (*remoteFile, error) {
+	req, err := http.NewRequestWithContext(*ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if source.AuthHeader != "" {
+		authValue, err := ss.openAuthValue(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(source.AuthHeader, authValue)
+	}
+	if source.ETag != "" {
+		req.Header.Set("If-None-Match", source.ETag)
+	}
+	if source.LastModified != "" {
+		req.Header.Set("If-Modified-Since", source.LastModified)
+	}
+
+	res, err := ss.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrRemoteFileUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: %s", domain.ErrRemoteFileUnavailable, res.Status)
+	}
+
+	if err := os.MkdirAll(ss.Options.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	out, err := os.CreateTemp(ss.Options.Dir, source.ID.Hex()+"-*.download")
+	if err != nil {
+		return nil, err
+	}
+
+	body := io.Reader(res.Body)
+	if ss.Options.MaxSize > 0 {
+		body = io.LimitReader(res.Body, ss.Options.MaxSize+1)
+	}
+
+	written, err := io.Copy(out, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && ss.Options.MaxSize > 0 && written > ss.Options.MaxSize {
+		err = domain.ErrUploadSizeExceeded
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return nil, err
+	}
+
+	return &remoteFile{
+		path:         out.Name(),
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// previousRuns are the completed runs of a source that a run in replace mode
+// replaces. Their leads are withdrawn once the new file was read in full and
+// staged, before its leads are published, as unique fields, such as the
+// email, would otherwise collide with the leads of the previous file.
+type previousRuns struct {
+	service   *ImportSourceService
+	source    *domain.ImportSource
+	withdrawn []*domain.Import
+}
+
+func (p *previousRuns) Withdraw(ctx *context.Context) error {
+	imports, err := p.service.ImportRepository.FindBySourceId(ctx, p.source.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, imp := range imports {
+		if imp.Status != domain.ImportStatusCompleted {
+			continue
+		}
+		// a run withdrawn in part is restored along with the others
+		p.withdrawn = append(p.withdrawn, imp)
+		if err := p.service.ImportService.Withdraw(ctx, imp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *previousRuns) Restore(ctx *context.Context) error {
+	var errs []error
+	for _, imp := range p.withdrawn {
+		errs = append(errs, p.service.ImportService.Restore(ctx, imp))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *previousRuns) Commit(ctx *context.Context) error {
+	var errs []error
+	for _, imp := range p.withdrawn {
+		errs = append(errs, p.service.ImportService.CompleteRollback(ctx, imp))
+	}
+	return errors.Join(errs...)
+}
+
+// sealAuthValue moves the auth value of the source to its sealed value, so it
+// is never stored in plain.
+func (ss *ImportSourceService) sealAuthValue(ctx *context.Context, source *domain.ImportSource) error {
+	source.SealedAuthValue = nil
+	if source.AuthValue == "" {
+		return nil
+	}
+
+	sealed, err := ss.Cipher.SealSecret(ctx, importSourceAuthSecret, source.AuthValue)
+	if err != nil {
+		return err
+	}
+
+	source.AuthValue = ""
+	source.SealedAuthValue = sealed
+	return nil
+}
+
+// openAuthValue returns the auth value of the source, in plain for the sources
+// stored before auth values were sealed.
+func (ss *ImportSourceService) openAuthValue(ctx *context.Context, source *domain.ImportSource) (string, error) {
+	if source.SealedAuthValue == nil {
+		return source.AuthValue, nil
+	}
+	return ss.Cipher.OpenSecret(ctx, importSourceAuthSecret, source.SealedAuthValue)
+}
+
+func (ss *ImportSourceService) skip(ctx *context.Context, source *domain.ImportSource) ([]*domain.Import, error) {
+	imp, err := ss.record(ctx, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []*domain.Import{imp}, nil
+}
+
+// record adds a run that did not ingest anything to the import history, as
+// failed with the given error or as skipped without one.
+func (ss *ImportSourceService) record(ctx *context.Context, source *domain.ImportSource, runErr error) (*domain.Import, error) {
+	file := &domain.File{Name: remoteFileName(source.URL), Uploader: source.URL, SourceId: source.ID}
+	imp := domain.NewImport(source.SchemaId, file, source.Checksum)
+	if runErr != nil {
+		imp.Fail(0, runErr)
+	} else {
+		imp.Skip()
+	}
+
+	err := ss.ImportRepository.Create(ctx, imp)
+	if err != nil {
+		return nil, err
+	}
+	if runErr != nil {
+		ss.FileService.notify(ctx, imp)
+	}
+
+	return imp, nil
+}
+
+func parseSchedule(source *domain.ImportSource) (cron.Schedule, error) {
+	if err := source.Validate(); err != nil {
+		return nil, err
+	}
+
+	schedule, err := cron.ParseStandard(source.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidImportSource, err)
+	}
+
+	return schedule, nil
+}
+
+func checksumOfFile(file *domain.File) (string, error) {
+	content, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	return checksumOf(content)
+}
+
+func remoteFileName(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	name := path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		return parsed.Host
+	}
+	return name
+}
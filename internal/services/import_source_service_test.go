@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestImportSourceService(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+
+	// serve answers with content and its ETag, or 304 when it did not change
+	serve := func(t *testing.T, content *string, etag *string) string {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("If-None-Match") == *etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", *etag)
+			_, _ = w.Write([]byte(*content))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL + "/leads.csv"
+	}
+
+	// every httptest TLS server shares the same certificate
+	certificates := httptest.NewTLSServer(http.NotFoundHandler())
+	roots := x509.NewCertPool()
+	roots.AddCert(certificates.Certificate())
+	certificates.Close()
+
+	newServiceWith := func(t *testing.T, opts ImportSourceOptions) (*ImportSourceService, *leadRepositoryMock, *importSourceRepositoryMock) {
+		masterKey, _ := encryption.NewDataKey()
+		keyManager, err := encryption.NewLocalKeyManager(masterKey)
+		if err != nil {
+			t.Fatal("Failed to create key manager:", err)
+		}
+		schemaRepository := NewSchemaRepositoryMockWithSchema(schema)
+		leadRepository := NewLeadRepositoryMock()
+		importRepository := NewImportRepositoryMock()
+		sourceRepository := NewImportSourceRepositoryMock()
+		fileService := NewFileService(schemaRepository, leadRepository, importRepository, NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, IngestionOptions{BatchSize: 10})
+		importService := NewImportService(NewTenantRepositoryMock(), schemaRepository, leadRepository, importRepository, nil)
+		opts.Dir, opts.Timeout, opts.RootCAs = t.TempDir(), time.Minute, roots
+		return NewImportSourceService(schemaRepository, sourceRepository, importRepository, fileService, importService,
+			NewLeadCipher(keyManager, NewEncryptionKeyRepositoryMock()), opts), leadRepository, sourceRepository
+	}
+
+	newService := func(t *testing.T) (*ImportSourceService, *leadRepositoryMock, *importSourceRepositoryMock) {
+		return newServiceWith(t, ImportSourceOptions{AllowPrivateNetworks: true})
+	}
+
+	newSource := func(url, mode string) *domain.ImportSource {
+		return &domain.ImportSource{
+			URL:        url,
+			AuthHeader: "Authorization",
+			AuthValue:  "Bearer secret",
+			Schedule:   "0 6 * * *",
+			Mode:       mode,
+			Enabled:    true,
+		}
+	}
+
+	_ = t.Run("success, due sources run and unchanged files are skipped", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, sourceRepository := newService(t)
+		source, err := service.Create(&ctx, schema.ID.Hex(), newSource(serve(t, &content, &etag), domain.ImportSourceModeAppend))
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		sourceRepository.sources[source.ID].NextRunAt = primitive.NewDateTimeFromTime(time.Now().Add(-time.Minute))
+
+		// act
+		ran, err := service.RunDue(&ctx)
+		if err != nil {
+			t.Fatal("Failed to run import sources:", err)
+		}
+		skipped, err := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, skipped, 1) {
+			stored := sourceRepository.sources[source.ID]
+			_ = assert.Equal(t, 1, ran)
+			_ = assert.Len(t, leadRepository.leads, 1)
+			_ = assert.Equal(t, domain.ImportStatusSkipped, skipped[0].Status)
+			_ = assert.Equal(t, source.ID, skipped[0].SourceId)
+			_ = assert.Equal(t, `"v1"`, stored.ETag)
+			_ = assert.Equal(t, skipped[0].ID, stored.LastImportId)
+			_ = assert.True(t, stored.NextRunAt.Time().After(time.Now()))
+		}
+	})
+
+	_ = t.Run("replace mode rolls back the previous run", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, _ := newService(t)
+		source, err := service.Create(&ctx, schema.ID.Hex(), newSource(serve(t, &content, &etag), domain.ImportSourceModeReplace))
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		first, err := service.Run(&ctx, source.ID.Hex())
+		if err != nil {
+			t.Fatal("Failed to run import source:", err)
+		}
+		content, etag = "email,phone\na@test.com,1\nb@test.com,2\n", `"v2"`
+
+		// act
+		second, err := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusRolledBack, first[0].Status)
+			_ = assert.Equal(t, domain.ImportStatusCompleted, second[0].Status)
+			_ = assert.Len(t, leadRepository.leads, 2)
+		}
+	})
+
+	_ = t.Run("replace mode keeps the previous run when the new file is invalid", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, _ := newService(t)
+		source, err := service.Create(&ctx, schema.ID.Hex(), newSource(serve(t, &content, &etag), domain.ImportSourceModeReplace))
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		first, err := service.Run(&ctx, source.ID.Hex())
+		if err != nil {
+			t.Fatal("Failed to run import source:", err)
+		}
+		content, etag = "email,phone\nb@test.com,2\nc@test.com,x\n", `"v2"`
+
+		// act
+		second, err := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusCompleted, first[0].Status)
+			_ = assert.Equal(t, domain.ImportStatusFailed, second[0].Status)
+			_ = assert.Len(t, leadRepository.leads, 1)
+		}
+	})
+
+	_ = t.Run("replace mode restores the previous run when the new leads fail after being published", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, _ := newService(t)
+		source, err := service.Create(&ctx, schema.ID.Hex(), newSource(serve(t, &content, &etag), domain.ImportSourceModeReplace))
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		first, err := service.Run(&ctx, source.ID.Hex())
+		if err != nil {
+			t.Fatal("Failed to run import source:", err)
+		}
+		content, etag = "email,phone\na@test.com,1\nb@test.com,2\n", `"v2"`
+		service.FileService.Notifier = &eventNotifierMock{failOn: domain.EventLeadCreated, failWith: assert.AnError}
+
+		// act
+		second, err := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, leadRepository.leads, 1) {
+			_ = assert.Equal(t, domain.ImportStatusCompleted, first[0].Status)
+			_ = assert.Equal(t, domain.ImportStatusFailed, second[0].Status)
+			_ = assert.Equal(t, first[0].ID, leadRepository.leads[0].Map()["import_id"])
+			_ = assert.Empty(t, leadRepository.staged)
+		}
+	})
+
+	_ = t.Run("failed fetch is recorded as a failed import", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, _ := newService(t)
+		source := newSource(serve(t, &content, &etag), domain.ImportSourceModeAppend)
+		source.AuthValue = "Bearer wrong"
+		source, err := service.Create(&ctx, schema.ID.Hex(), source)
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+
+		// act
+		imports, err := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 1) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imports[0].Status)
+			_ = assert.Equal(t, "remote file unavailable: 401 Unauthorized", imports[0].Error)
+			_ = assert.Empty(t, leadRepository.leads)
+		}
+	})
+
+	_ = t.Run("auth values are only stored sealed", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, sourceRepository := newService(t)
+
+		// act
+		source, err := service.Create(&ctx, schema.ID.Hex(), newSource(serve(t, &content, &etag), domain.ImportSourceModeAppend))
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+		imports, runErr := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, runErr) && assert.Len(t, imports, 1) {
+			stored := sourceRepository.sources[source.ID]
+			_ = assert.Empty(t, stored.AuthValue)
+			_ = assert.NotNil(t, stored.SealedAuthValue)
+			_ = assert.NotContains(t, string(stored.SealedAuthValue.Ciphertext), "secret")
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imports[0].Status)
+			_ = assert.Len(t, leadRepository.leads, 1)
+		}
+	})
+
+	_ = t.Run("private addresses are refused", func(t *testing.T) {
+		// arrange
+		content, etag := "email,phone\na@test.com,1\n", `"v1"`
+		service, leadRepository, _ := newServiceWith(t, ImportSourceOptions{})
+		source, err := service.Create(&ctx, schema.ID.Hex(), newSource(serve(t, &content, &etag), domain.ImportSourceModeAppend))
+		if err != nil {
+			t.Fatal("Failed to create import source:", err)
+		}
+
+		// act
+		imports, err := service.Run(&ctx, source.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 1) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imports[0].Status)
+			_ = assert.Contains(t, imports[0].Error, domain.ErrRemoteAddressDenied.Error())
+			_ = assert.Empty(t, leadRepository.leads)
+		}
+	})
+
+	_ = t.Run("plain http", func(t *testing.T) {
+		// arrange
+		service, _, _ := newService(t)
+
+		// act
+		_, err := service.Create(&ctx, schema.ID.Hex(), newSource("http://example.com/leads.csv", domain.ImportSourceModeAppend))
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidImportSource)
+	})
+
+	_ = t.Run("invalid schedule", func(t *testing.T) {
+		// arrange
+		service, _, _ := newService(t)
+		source := newSource("https://example.com/leads.csv", domain.ImportSourceModeAppend)
+		source.Schedule = "every day"
+
+		// act
+		_, err := service.Create(&ctx, schema.ID.Hex(), source)
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidImportSource)
+	})
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// dataKeyMaxUses bounds the leads encrypted with one data key before
+	// another one is generated.
+	dataKeyMaxUses = 10000
+
+	// maxUnwrappedKeys bounds the unwrapped data keys kept to decrypt leads
+	// without asking the key manager for every one of them.
+	maxUnwrappedKeys = 1024
+)
+
+// LeadCipher encrypts the sensitive fields of leads before they are stored,
+// with envelope encryption: the fields are encrypted with a data key, which
+// is stored with the lead wrapped by the key manager. Blind indexed fields
+// also keep an HMAC of their value, under a key of the tenant, so they stay
+// unique and can be filtered on.
+type LeadCipher struct {
+	KeyManager              encryption.KeyManager
+	EncryptionKeyRepository repositories.EncryptionKeyRepository
+
+	mu        sync.Mutex
+	dataKeys  map[string]*dataKey
+	unwrapped map[string][]byte
+	indexKeys map[string][]byte
+}
+
+// dataKey is the data key new leads of a tenant are encrypted with.
+type dataKey struct {
+	plaintext []byte
+	wrapped   []byte
+	uses      int
+}
+
+func NewLeadCipher(km encryption.KeyManager, ekr repositories.EncryptionKeyRepository) *LeadCipher {
+	return &LeadCipher{
+		KeyManager:              km,
+		EncryptionKeyRepository: ekr,
+		dataKeys:                make(map[string]*dataKey),
+		unwrapped:               make(map[string][]byte),
+		indexKeys:               make(map[string][]byte),
+	}
+}
+
+// Seal encrypts the sensitive fields of the lead in place, moving them to
+// domain.LeadPIIField and leaving the blind index of the blind indexed ones.
+// A nil cipher fails with domain.ErrEncryptionDisabled when the schema has
+// sensitive fields.
+func (lc *LeadCipher) Seal(ctx *context.Context, schema *domain.Schema, lead *bson.D) error {
+	if !schema.HasSensitiveFields() {
+		return nil
+	}
+	if lc == nil {
+		return domain.ErrEncryptionDisabled
+	}
+
+	sensitive := make(map[string]domain.SchemaField)
+	for _, field := range schema.Fields {
+		if field.Sensitive {
+			sensitive[field.Name] = field
+		}
+	}
+
+	key, err := lc.dataKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	var fields bson.D
+	kept := (*lead)[:0]
+	for _, e := range *lead {
+		field, ok := sensitive[e.Key]
+		if !ok {
+			kept = append(kept, e)
+			continue
+		}
+
+		ciphertext, err := sealValue(key.plaintext, e.Key, e.Value)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, bson.E{Key: e.Key, Value: ciphertext})
+
+		if field.BlindIndexed() {
+			index, err := lc.blindIndex(ctx, e.Key, e.Value)
+			if err != nil {
+				return err
+			}
+			kept = append(kept, bson.E{Key: e.Key, Value: index})
+		}
+	}
+
+	if len(fields) > 0 {
+		kept = append(kept, bson.E{Key: domain.LeadPIIField, Value: bson.D{
+			{Key: "key", Value: key.wrapped},
+			{Key: "fields", Value: fields},
+		}})
+	}
+	*lead = kept
+
+	return nil
+}
+
+// Open decrypts the sensitive fields of the stored lead in place when decrypt
+// is set, and otherwise redacts them. Leads without sensitive fields are left
+// as they are.
+func (lc *LeadCipher) Open(ctx *context.Context, lead primitive.M, decrypt bool) error {
+	if !decrypt {
+		redactLead(lead)
+		return nil
+	}
+
+	pii, ok := documentOf(lead[domain.LeadPIIField])
+	if !ok {
+		return nil
+	}
+	if lc == nil {
+		return domain.ErrEncryptionDisabled
+	}
+	delete(lead, domain.LeadPIIField)
+
+	key, err := lc.unwrap(ctx, bytesOf(pii["key"]))
+	if err != nil {
+		return err
+	}
+
+	fields, _ := documentOf(pii["fields"])
+	for name, ciphertext := range fields {
+		value, err := openValue(key, name, bytesOf(ciphertext))
+		if err != nil {
+			return err
+		}
+		lead[name] = value
+	}
+
+	return nil
+}
+
+// redactLead leaves the sensitive fields out of the stored lead, blind indexes
+// included, for readers that may not read them.
+func redactLead(lead primitive.M) {
+	pii, ok := documentOf(lead[domain.LeadPIIField])
+	if !ok {
+		return
+	}
+	delete(lead, domain.LeadPIIField)
+
+	fields, _ := documentOf(pii["fields"])
+	for name := range fields {
+		delete(lead, name)
+	}
+}
+
+// IndexFilter replaces the values the filter matches sensitive fields with by
+// their blind index. Sensitive fields that are not blind indexed can not be
+// filtered on.
+func (lc *LeadCipher) IndexFilter(ctx *context.Context, schema *domain.Schema, filter *domain.LeadFilter) error {
+	for _, field := range schema.Fields {
+		value, ok := filter.Fields[field.Name]
+		if !ok || !field.Sensitive {
+			continue
+		}
+		if !field.BlindIndexed() {
+			return domain.ErrInvalidLeadFilter
+		}
+		if lc == nil {
+			return domain.ErrEncryptionDisabled
+		}
+
+		index, err := lc.blindIndex(ctx, field.Name, value)
+		if err != nil {
+			return err
+		}
+		filter.Fields[field.Name] = index
+	}
+
+	return nil
+}
+
+// SealSecret encrypts a secret the service reads back, bound to its name, with
+// the data key of the tenant of the context.
+func (lc *LeadCipher) SealSecret(ctx *context.Context, name, secret string) (*domain.SealedSecret, error) {
+	if lc == nil {
+		return nil, domain.ErrEncryptionDisabled
+	}
+
+	key, err := lc.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := encryption.Seal(key.plaintext, []byte(secret), []byte(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.SealedSecret{Key: key.wrapped, Ciphertext: ciphertext}, nil
+}
+
+// OpenSecret decrypts a secret sealed by SealSecret under the same name.
+func (lc *LeadCipher) OpenSecret(ctx *context.Context, name string, sealed *domain.SealedSecret) (string, error) {
+	if lc == nil {
+		return "", domain.ErrEncryptionDisabled
+	}
+
+	key, err := lc.unwrap(ctx, sealed.Key)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := encryption.Open(key, sealed.Ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("%w: secret %s", domain.ErrInvalidCiphertext, name)
+	}
+
+	return string(secret), nil
+}
+
+// dataKey returns the data key of the tenant of the context, generating a new
+// one once the current one encrypted dataKeyMaxUses leads.
+func (lc *LeadCipher) dataKey(ctx *context.Context) (*dataKey, error) {
+	tenant := tenantOfContext(ctx)
+
+	lc.mu.Lock()
+	key := lc.dataKeys[tenant]
+	if key != nil && key.uses < dataKeyMaxUses {
+		key.uses++
+		lc.mu.Unlock()
+		return key, nil
+	}
+	lc.mu.Unlock()
+
+	plaintext, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := lc.KeyManager.Wrap(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	key = &dataKey{plaintext: plaintext, wrapped: wrapped, uses: 1}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.dataKeys[tenant] = key
+	lc.cacheUnwrapped(wrapped, plaintext)
+
+	return key, nil
+}
+
+// unwrap returns the data key a lead was encrypted with.
+func (lc *LeadCipher) unwrap(ctx *context.Context, wrapped []byte) ([]byte, error) {
+	lc.mu.Lock()
+	key, ok := lc.unwrapped[string(wrapped)]
+	lc.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := lc.KeyManager.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidCiphertext, err)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.cacheUnwrapped(wrapped, key)
+
+	return key, nil
+}
+
+// cacheUnwrapped must be called with mu held.
+func (lc *LeadCipher) cacheUnwrapped(wrapped, key []byte) {
+	if len(lc.unwrapped) >= maxUnwrappedKeys {
+		clear(lc.unwrapped)
+	}
+	lc.unwrapped[string(wrapped)] = key
+}
+
+// blindIndex returns the blind index of the value of the field, under the
+// blind index key of the tenant of the context, as a hex string.
+func (lc *LeadCipher) blindIndex(ctx *context.Context, name string, value interface{}) (string, error) {
+	key, err := lc.indexKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return "", err
+	}
+
+	// the field name keeps equal values of different fields apart
+	input := append([]byte(name), 0, byte(t))
+	return hex.EncodeToString(encryption.BlindIndex(key, append(input, data...))), nil
+}
+
+// SuppressionHasher returns the hasher of the suppression list of the tenant
+// of the context, keyed like the blind indexes by a key derived from the blind
+// index key of the tenant. A nil cipher hashes without a key.
+func (lc *LeadCipher) SuppressionHasher(ctx *context.Context) (domain.SuppressionHasher, error) {
+	if lc == nil {
+		return domain.UnkeyedSuppressionHash, nil
+	}
+
+	key, err := lc.indexKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// derived, so a suppression hash never equals a blind index
+	return domain.KeyedSuppressionHasher(encryption.BlindIndex(key, []byte("suppressions"))), nil
+}
+
+// indexKey returns the blind index key of the tenant of the context, which is
+// generated and stored the first time the tenant needs it.
+func (lc *LeadCipher) indexKey(ctx *context.Context) ([]byte, error) {
+	tenant := tenantOfContext(ctx)
+
+	lc.mu.Lock()
+	key, ok := lc.indexKeys[tenant]
+	lc.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	plaintext, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := lc.KeyManager.Wrap(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	record := domain.NewEncryptionKey(domain.EncryptionKeyPurposeBlindIndex, wrapped)
+	record.TenantId = tenant
+	stored, err := lc.EncryptionKeyRepository.FindOrCreate(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err = lc.KeyManager.Unwrap(ctx, stored.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidCiphertext, err)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.indexKeys[tenant] = key
+
+	return key, nil
+}
+
+// sealValue encrypts the BSON value, prefixed with its type, bound to the name
+// of its field.
+func sealValue(key []byte, name string, value interface{}) ([]byte, error) {
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.Seal(key, append([]byte{byte(t)}, data...), []byte(name))
+}
+
+func openValue(key []byte, name string, ciphertext []byte) (interface{}, error) {
+	plaintext, err := encryption.Open(key, ciphertext, []byte(name))
+	if err != nil || len(plaintext) == 0 {
+		return nil, fmt.Errorf("%w: field %s", domain.ErrInvalidCiphertext, name)
+	}
+
+	var value interface{}
+	raw := bson.RawValue{Type: bsontype.Type(plaintext[0]), Value: plaintext[1:]}
+	if err := raw.Unmarshal(&value); err != nil {
+		return nil, fmt.Errorf("%w: field %s", domain.ErrInvalidCiphertext, name)
+	}
+
+	return value, nil
+}
+
+// canReadPII reports whether the caller may read the sensitive fields of
+// leads: callers granted pii:read, or anyone when auth is disabled.
+func canReadPII(ctx *context.Context) bool {
+	principal, ok := domain.PrincipalFromContext(*ctx)
+	return !ok || principal.HasScopes([]string{domain.ScopePIIRead})
+}
+
+// documentOf returns the embedded document of a stored lead, decoded as a map
+// or as a document depending on how the lead was read.
+func documentOf(value interface{}) (primitive.M, bool) {
+	switch v := value.(type) {
+	case primitive.M:
+		return v, true
+	case primitive.D:
+		return v.Map(), true
+	default:
+		return nil, false
+	}
+}
+
+func bytesOf(value interface{}) []byte {
+	switch v := value.(type) {
+	case primitive.Binary:
+		return v.Data
+	case []byte:
+		return v
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLeadCipher(t *testing.T) {
+	ctx := domain.ContextWithTenant(context.Background(), "acme")
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true, Sensitive: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+			{Name: "birthday", Type: "date", Sensitive: true},
+		},
+	}
+	content := "email,phone,birthday\na@test.com,1,631152000\nb@test.com,2,946684800\n"
+
+	newCipher := func(t *testing.T) *LeadCipher {
+		masterKey, _ := encryption.NewDataKey()
+		keyManager, err := encryption.NewLocalKeyManager(masterKey)
+		if err != nil {
+			t.Fatal("Failed to create key manager:", err)
+		}
+		return NewLeadCipher(keyManager, NewEncryptionKeyRepositoryMock())
+	}
+
+	ingest := func(t *testing.T, cipher *LeadCipher) *leadRepositoryMock {
+		leadRepository := NewLeadRepositoryMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, cipher, nil,
+			IngestionOptions{BatchSize: 10})
+		if _, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content)); err != nil {
+			t.Fatal("Failed to ingest leads:", err)
+		}
+		return leadRepository
+	}
+
+	export := func(t *testing.T, ctx context.Context, cipher *LeadCipher, leadRepository *leadRepositoryMock, query domain.LeadQuery) [][]string {
+		service := NewExportService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewExportRepositoryMock(), cipher,
+			ExportOptions{Dir: t.TempDir(), Lease: time.Hour, Retention: time.Hour})
+		prepared, err := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, query)
+		if err != nil {
+			t.Fatal("Failed to prepare export:", err)
+		}
+		var buf bytes.Buffer
+		if _, err := service.Write(&ctx, prepared, &buf); err != nil {
+			t.Fatal("Failed to write export:", err)
+		}
+		records, _ := csv.NewReader(&buf).ReadAll()
+		return records
+	}
+
+	_ = t.Run("stores the sensitive fields encrypted", func(t *testing.T) {
+		// arrange
+		cipher := newCipher(t)
+
+		// act
+		leadRepository := ingest(t, cipher)
+
+		// assert
+		lead := leadRepository.leads[0].Map()
+		_ = assert.NotEqual(t, "a@test.com", lead["email"])
+		_ = assert.Len(t, lead["email"], 64)
+		_ = assert.NotContains(t, lead, "birthday")
+		_ = assert.Equal(t, 1, lead["phone"])
+		_ = assert.Contains(t, lead, domain.LeadPIIField)
+	})
+
+	_ = t.Run("decrypts for callers that may read them", func(t *testing.T) {
+		// arrange
+		cipher := newCipher(t)
+		leadRepository := ingest(t, cipher)
+		reader := (&domain.Principal{Tenant: "acme", Scopes: []string{domain.ScopeLeadsRead, domain.ScopePIIRead}}).Context(ctx)
+
+		// act
+		records := export(t, reader, cipher, leadRepository, domain.LeadQuery{})
+
+		// assert
+		if assert.Len(t, records, 3) {
+			_ = assert.Equal(t, []string{"a@test.com", "1", "631152000"}, records[1][1:4])
+			_ = assert.Equal(t, []string{"b@test.com", "2", "946684800"}, records[2][1:4])
+		}
+	})
+
+	_ = t.Run("leaves them out for the other callers", func(t *testing.T) {
+		// arrange
+		cipher := newCipher(t)
+		leadRepository := ingest(t, cipher)
+		reader := (&domain.Principal{Tenant: "acme", Scopes: []string{domain.ScopeLeadsRead}}).Context(ctx)
+
+		// act
+		records := export(t, reader, cipher, leadRepository, domain.LeadQuery{})
+
+		// assert
+		if assert.Len(t, records, 3) {
+			_ = assert.Equal(t, []string{"", "1", ""}, records[1][1:4])
+		}
+	})
+
+	_ = t.Run("filters on the blind index", func(t *testing.T) {
+		// arrange
+		cipher := newCipher(t)
+		leadRepository := ingest(t, cipher)
+
+		// act
+		records := export(t, ctx, cipher, leadRepository, domain.LeadQuery{Filters: []string{"email:b@test.com"}})
+
+		// assert
+		if assert.Len(t, records, 2) {
+			_ = assert.Equal(t, "b@test.com", records[1][1])
+		}
+	})
+
+	_ = t.Run("fails, sensitive fields that are not blind indexed can not be filtered on", func(t *testing.T) {
+		// arrange
+		service := NewExportService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewExportRepositoryMock(), newCipher(t),
+			ExportOptions{Dir: t.TempDir()})
+
+		// act
+		_, err := service.Prepare(&ctx, schema.ID.Hex(), domain.ExportFormatCSV, domain.LeadQuery{Filters: []string{"birthday:631152000"}})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidLeadFilter)
+	})
+
+	_ = t.Run("fails, another master key can not decrypt the leads", func(t *testing.T) {
+		// arrange
+		leadRepository := ingest(t, newCipher(t))
+		lead := leadRepository.leads[0].Map()
+
+		// act
+		err := newCipher(t).Open(&ctx, lead, true)
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidCiphertext)
+	})
+
+	_ = t.Run("fails, sensitive fields require encryption", func(t *testing.T) {
+		// arrange
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 10})
+
+		// act
+		_, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+		_, schemaErr := NewSchemaService(NewSchemaRepositoryMock(), nil, nil).ValidateAndSave(&ctx, &domain.Schema{Fields: schema.Fields})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrEncryptionDisabled)
+		_ = assert.ErrorIs(t, schemaErr, domain.ErrEncryptionDisabled)
+	})
+}
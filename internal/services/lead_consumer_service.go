@@ -0,0 +1,306 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/messaging"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DeadLetterErrorHeader = "error"
+	DeadLetterTopicHeader = "source-topic"
+)
+
+// LeadSubscription consumes the leads of a topic into a schema of the tenant
+// TenantId, the default tenant when empty. Messages that are not valid leads
+// are sent to DeadLetterTopic.
+type LeadSubscription struct {
+	TenantId        string
+	SchemaId        string
+	Topic           string
+	DeadLetterTopic string
+	Consumer        messaging.EventConsumer
+}
+
+// LeadConsumerOptions configures how a message that could not be handled,
+// e.g. because the database is unavailable, is retried: after Backoff,
+// doubling up to MaxBackoff.
+type LeadConsumerOptions struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// LeadConsumerService writes the leads published one at a time by producers
+// to a message broker. Each message is a JSON object of field names to
+// values, validated with the same rules as the rows of an uploaded file.
+type LeadConsumerService struct {
+	SchemaRepository      repositories.SchemaRepository
+	LeadRepository        repositories.LeadRepository
+	SuppressionRepository repositories.SuppressionRepository
+	Publisher             messaging.EventPublisher
+	Notifier              EventNotifier
+	// Quotas caps the leads each tenant ingests, without limits when nil.
+	Quotas  *QuotaService
+	Cipher  *LeadCipher
+	Options LeadConsumerOptions
+}
+
+func NewLeadConsumerService(sr repositories.SchemaRepository, lr repositories.LeadRepository, spr repositories.SuppressionRepository, publisher messaging.EventPublisher, notifier EventNotifier, quotas *QuotaService, cipher *LeadCipher, opts LeadConsumerOptions) *LeadConsumerService {
+	return &LeadConsumerService{
+		SchemaRepository:      sr,
+		LeadRepository:        lr,
+		SuppressionRepository: spr,
+		Publisher:             publisher,
+		Notifier:              notifier,
+		Quotas:                quotas,
+		Cipher:                cipher,
+		Options:               opts,
+	}
+}
+
+// Handle writes the lead of the message and stores its lead.created event, or
+// sends the message to the dead letter topic when it is not a valid lead, and
+// then acknowledges it. Leads of a suppressed subject are acknowledged without
+// being written. Messages whose lead was written on an earlier delivery only
+// have the event of that lead stored again, as the earlier delivery may have
+// failed before storing it. The message is not acknowledged when an error is
+// returned, as when the tenant used up its leads of the day or the event
+// could not be stored.
+func (cs *LeadConsumerService) Handle(ctx *context.Context, sub *LeadSubscription, delivery *messaging.Delivery) error {
+	ctx = withTenant(ctx, sub.TenantId)
+	schema, err := cs.SchemaRepository.FindById(ctx, sub.SchemaId)
+	if err != nil {
+		return err
+	}
+
+	messageId := messageIdOf(sub, delivery)
+	lead, err := leadFromMessage(delivery.Value, schema, messageId)
+	var reservation *RowReservation
+	if err == nil {
+		hash, err := cs.Cipher.SuppressionHasher(ctx)
+		if err != nil {
+			return err
+		}
+		subject := lead.Map()
+		suppressed, err := cs.SuppressionRepository.FindSuppressed(ctx, domain.SubjectHashes(hash, subject["email"], subject["phone"]))
+		if err != nil {
+			return err
+		}
+		if len(suppressed) > 0 {
+			return delivery.Ack(ctx)
+		}
+		if cs.Quotas != nil {
+			reservation, err = cs.Quotas.ReserveRows(ctx, 1)
+			if errors.Is(err, domain.ErrQuotaExceeded) {
+				// a lead written on an earlier delivery was counted then
+				written, findErr := cs.writtenBefore(ctx, messageId)
+				if findErr != nil || !written {
+					return errors.Join(err, findErr)
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	if err == nil {
+		err = cs.Cipher.Seal(ctx, schema, lead)
+	}
+	if err == nil {
+		err = cs.LeadRepository.Create(ctx, lead)
+	}
+	if err != nil && cs.Quotas != nil {
+		// the lead was not written, or was counted on an earlier delivery
+		if releaseErr := cs.Quotas.ReleaseRows(ctx, reservation); releaseErr != nil {
+			log.Println("Failed to release usage: ", releaseErr)
+		}
+	}
+
+	switch {
+	case errors.Is(err, domain.ErrLeadMessageConsumed):
+		// written on an earlier delivery that was not acknowledged
+		written, err := cs.LeadRepository.FindByMessageId(ctx, messageId)
+		if err != nil {
+			return err
+		}
+		if err := cs.notify(ctx, schema, written); err != nil {
+			return err
+		}
+	case isInvalidLead(err):
+		if err := cs.deadLetter(ctx, sub, delivery, err); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		if err := cs.notify(ctx, schema, lead.Map()); err != nil {
+			return err
+		}
+	}
+
+	return delivery.Ack(ctx)
+}
+
+// writtenBefore returns whether the lead of the message was written on an
+// earlier delivery.
+func (cs *LeadConsumerService) writtenBefore(ctx *context.Context, messageId string) (bool, error) {
+	_, err := cs.LeadRepository.FindByMessageId(ctx, messageId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// notify stores the lead.created event of a lead written from a message.
+func (cs *LeadConsumerService) notify(ctx *context.Context, schema *domain.Schema, lead primitive.M) error {
+	// subscribers are never sent the sensitive fields
+	redactLead(lead)
+	event := domain.NewEvent(domain.EventLeadCreated, schema.ID, domain.LeadsCreatedData{Leads: []primitive.M{lead}})
+	return cs.Notifier.Notify(ctx, event)
+}
+
+// Consume handles the messages of the subscription in order until ctx is
+// done. A message is retried until it is handled, so a failure holds back the
+// messages after it.
+func (cs *LeadConsumerService) Consume(ctx *context.Context, sub *LeadSubscription) {
+	for {
+		delivery, err := sub.Consumer.Fetch(ctx)
+		if (*ctx).Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Println("Failed to fetch lead message from "+sub.Topic+": ", err)
+			if !sleep(ctx, cs.Options.Backoff) {
+				return
+			}
+			continue
+		}
+
+		backoff := cs.Options.Backoff
+		for {
+			err := cs.Handle(ctx, sub, delivery)
+			if err == nil {
+				break
+			}
+			log.Println("Failed to handle lead message from "+sub.Topic+": ", err)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = min(2*backoff, cs.Options.MaxBackoff)
+		}
+	}
+}
+
+func (cs *LeadConsumerService) deadLetter(ctx *context.Context, sub *LeadSubscription, delivery *messaging.Delivery, cause error) error {
+	headers := make(map[string]string, len(delivery.Headers)+2)
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[DeadLetterErrorHeader] = cause.Error()
+	headers[DeadLetterTopicHeader] = sub.Topic
+
+	return cs.Publisher.Publish(ctx, sub.DeadLetterTopic, []messaging.Message{{
+		ID:      delivery.ID,
+		Key:     delivery.Key,
+		Value:   delivery.Value,
+		Headers: headers,
+	}})
+}
+
+// messageIdOf identifies the message within the topic of the subscription, so
+// its lead is written once when it is delivered again. It falls back to the ID
+// the producer gave the message when the broker tells no position.
+func messageIdOf(sub *LeadSubscription, delivery *messaging.Delivery) string {
+	switch {
+	case delivery.Position != "":
+		return sub.Topic + "/" + delivery.Position
+	case delivery.ID != "":
+		return sub.Topic + "#" + delivery.ID
+	default:
+		return ""
+	}
+}
+
+// leadFromMessage reads the message as the single row of a file, whose
+// headers are the fields of the JSON object. The lead keeps the messageId,
+// when there is one, as its message_id.
+func leadFromMessage(value []byte, schema *domain.Schema, messageId string) (*bson.D, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidLeadMessage, err)
+	}
+
+	headers := make([]string, 0, len(fields))
+	record := make([]string, 0, len(fields))
+	for name, value := range fields {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			record = append(record, v)
+		case json.Number:
+			record = append(record, v.String())
+		case bool:
+			record = append(record, strconv.FormatBool(v))
+		default:
+			return nil, fmt.Errorf("%w: field %s is not a string, number or boolean", domain.ErrInvalidLeadMessage, name)
+		}
+		headers = append(headers, name)
+	}
+
+	if err := validateHeaders(headers, schema); err != nil {
+		return nil, err
+	}
+
+	lead, err := leadFromRecord(record, headers, *schema, primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	*lead = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, *lead...)
+	if messageId != "" {
+		*lead = append(*lead, bson.E{Key: "message_id", Value: messageId})
+	}
+	return lead, nil
+}
+
+// isInvalidLead tells the errors of the message itself, which fail again on
+// every retry, from those of the service.
+func isInvalidLead(err error) bool {
+	return errors.Is(err, domain.ErrInvalidLeadMessage) ||
+		errors.Is(err, domain.ErrRequiredFieldsMissing) ||
+		errors.Is(err, domain.ErrDuplicatedFields) ||
+		errors.Is(err, domain.ErrInvalidFieldValues) ||
+		errors.Is(err, domain.ErrEncryptionDisabled) ||
+		mongo.IsDuplicateKeyError(err)
+}
+
+// sleep waits for d and reports false when ctx is done first.
+func sleep(ctx *context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-(*ctx).Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/messaging"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestLeadConsumerService(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+			{Name: "active", Type: "boolean", Required: false, Unique: false},
+		},
+	}
+
+	newService := func() (*LeadConsumerService, *leadRepositoryMock, *messaging.MemoryPublisher, *eventNotifierMock) {
+		leadRepository := NewLeadRepositoryMock()
+		publisher := messaging.NewMemoryPublisher()
+		notifier := NewEventNotifierMock()
+		return NewLeadConsumerService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewSuppressionRepositoryMock(), publisher, notifier, nil, nil,
+			LeadConsumerOptions{Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}), leadRepository, publisher, notifier
+	}
+
+	newSubscription := func(messages ...string) (*LeadSubscription, *messaging.MemoryConsumer) {
+		consumer := messaging.NewMemoryConsumer()
+		for i, message := range messages {
+			consumer.Send(messaging.Message{ID: primitive.NewObjectID().Hex(), Key: string(rune('a' + i)), Value: []byte(message)})
+		}
+		return &LeadSubscription{
+			SchemaId:        schema.ID.Hex(),
+			Topic:           "leads.inbound",
+			DeadLetterTopic: "leads.inbound.dlq",
+			Consumer:        consumer,
+		}, consumer
+	}
+
+	handleNext := func(service *LeadConsumerService, sub *LeadSubscription) error {
+		delivery, err := sub.Consumer.Fetch(&ctx)
+		if err != nil {
+			return err
+		}
+		return service.Handle(&ctx, sub, delivery)
+	}
+
+	_ = t.Run("success, valid messages are written", func(t *testing.T) {
+		// arrange
+		service, leadRepository, publisher, notifier := newService()
+		sub, consumer := newSubscription(`{"email": "a@test.com", "phone": 5511999999999, "active": true}`)
+
+		// act
+		err := handleNext(service, sub)
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, leadRepository.leads, 1) {
+			lead := leadRepository.leads[0].Map()
+			_ = assert.Equal(t, "a@test.com", lead["email"])
+			_ = assert.Equal(t, 5511999999999, lead["phone"])
+			_ = assert.Equal(t, true, lead["active"])
+			_ = assert.Equal(t, schema.ID, lead["schema_id"])
+			_ = assert.NotContains(t, lead, "import_id")
+			_ = assert.Len(t, consumer.Acked(), 1)
+			_ = assert.Empty(t, publisher.Messages(sub.DeadLetterTopic))
+			if assert.Len(t, notifier.events, 1) {
+				_ = assert.Equal(t, domain.EventLeadCreated, notifier.events[0].Type)
+			}
+		}
+	})
+
+	_ = t.Run("success, leads of a suppressed subject are acknowledged without being written", func(t *testing.T) {
+		// arrange
+		service, leadRepository, publisher, notifier := newService()
+		sub, consumer := newSubscription(`{"email": "A@test.com", "phone": 5511999999999}`)
+		tenantCtx := domain.ContextWithTenant(ctx, domain.DefaultTenant)
+		_, _ = service.SuppressionRepository.CreateMany(&tenantCtx, (&domain.DataSubject{Email: "a@test.com"}).Suppressions(domain.UnkeyedSuppressionHash))
+
+		// act
+		err := handleNext(service, sub)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Empty(t, leadRepository.leads)
+		_ = assert.Len(t, consumer.Acked(), 1)
+		_ = assert.Empty(t, publisher.Messages(sub.DeadLetterTopic))
+		_ = assert.Empty(t, notifier.events)
+	})
+
+	_ = t.Run("success, leads are written to the tenant of the subscription", func(t *testing.T) {
+		// arrange
+		service, leadRepository, _, _ := newService()
+		sub, _ := newSubscription(`{"email": "a@test.com", "phone": 5511999999999}`, `{"email": "b@test.com", "phone": 5511999999998}`)
+		defaultSub, _ := newSubscription(`{"email": "c@test.com", "phone": 5511999999997}`)
+		sub.TenantId = "acme"
+
+		// act
+		firstErr := handleNext(service, sub)
+		secondErr := handleNext(service, sub)
+		defaultErr := handleNext(service, defaultSub)
+
+		// assert
+		_ = assert.NoError(t, firstErr)
+		_ = assert.NoError(t, secondErr)
+		_ = assert.NoError(t, defaultErr)
+		_ = assert.Equal(t, []string{"acme", "acme", domain.DefaultTenant}, leadRepository.tenants)
+	})
+
+	_ = t.Run("success, messages delivered again store the event of their lead without writing it twice", func(t *testing.T) {
+		// arrange
+		service, leadRepository, publisher, notifier := newService()
+		sub, consumer := newSubscription(`{"email": "a@test.com", "phone": 5511999999999}`)
+		delivery, _ := sub.Consumer.Fetch(&ctx)
+
+		// act
+		firstErr := service.Handle(&ctx, sub, delivery)
+		secondErr := service.Handle(&ctx, sub, delivery)
+
+		// assert
+		_ = assert.NoError(t, firstErr)
+		_ = assert.NoError(t, secondErr)
+		if assert.Len(t, leadRepository.leads, 1) {
+			_ = assert.Equal(t, "leads.inbound/1", leadRepository.leads[0].Map()["message_id"])
+		}
+		_ = assert.Len(t, consumer.Acked(), 2)
+		_ = assert.Empty(t, publisher.Messages(sub.DeadLetterTopic))
+		if assert.Len(t, notifier.events, 2) {
+			first := notifier.events[0].Data.(domain.LeadsCreatedData).Leads[0]
+			second := notifier.events[1].Data.(domain.LeadsCreatedData).Leads[0]
+			_ = assert.Equal(t, first["_id"], second["_id"])
+		}
+	})
+
+	_ = t.Run("failure, messages are not acknowledged when their event can not be stored", func(t *testing.T) {
+		// arrange
+		service, leadRepository, _, notifier := newService()
+		notifier.failOn, notifier.failWith = domain.EventLeadCreated, assert.AnError
+		sub, consumer := newSubscription(`{"email": "a@test.com", "phone": 5511999999999}`)
+		delivery, _ := sub.Consumer.Fetch(&ctx)
+
+		// act
+		firstErr := service.Handle(&ctx, sub, delivery)
+		notifier.failOn = ""
+		secondErr := service.Handle(&ctx, sub, delivery)
+
+		// assert
+		_ = assert.ErrorIs(t, firstErr, assert.AnError)
+		_ = assert.NoError(t, secondErr)
+		_ = assert.Len(t, leadRepository.leads, 1)
+		_ = assert.Len(t, consumer.Acked(), 1)
+		_ = assert.Len(t, notifier.events, 1)
+	})
+
+	_ = t.Run("failure, messages are not acknowledged once the tenant used up its leads of the day", func(t *testing.T) {
+		// arrange
+		service, leadRepository, publisher, _ := newService()
+		service.Quotas = NewQuotaService(NewUsageRepositoryMock(), NewImportRepositoryMock(), QuotaOptions{Defaults: domain.Limits{MaxRowsPerDay: 1}})
+		sub, consumer := newSubscription(`{"email": "a@test.com", "phone": 5511999999999}`, `{"email": "b@test.com", "phone": 5511999999998}`)
+
+		// act
+		firstErr := handleNext(service, sub)
+		secondErr := handleNext(service, sub)
+
+		// assert
+		_ = assert.NoError(t, firstErr)
+		_ = assert.ErrorIs(t, secondErr, domain.ErrQuotaExceeded)
+		_ = assert.Len(t, leadRepository.leads, 1)
+		_ = assert.Len(t, consumer.Acked(), 1)
+		_ = assert.Empty(t, publisher.Messages(sub.DeadLetterTopic))
+	})
+
+	_ = t.Run("success, a lead delivered again is counted once", func(t *testing.T) {
+		// arrange
+		service, _, _, notifier := newService()
+		usageRepository := NewUsageRepositoryMock()
+		service.Quotas = NewQuotaService(usageRepository, NewImportRepositoryMock(), QuotaOptions{Defaults: domain.Limits{MaxRowsPerDay: 1}})
+		notifier.failOn, notifier.failWith = domain.EventLeadCreated, assert.AnError
+		sub, consumer := newSubscription(`{"email": "a@test.com", "phone": 5511999999999}`)
+		delivery, _ := sub.Consumer.Fetch(&ctx)
+
+		// act
+		_ = service.Handle(&ctx, sub, delivery)
+		notifier.failOn = ""
+		err := service.Handle(&ctx, sub, delivery)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Len(t, consumer.Acked(), 1)
+		_ = assert.Equal(t, int64(1), usageRepository.rows[domain.DefaultTenant+"/"+domain.UsageDay(time.Now())])
+	})
+
+	_ = t.Run("success, invalid messages are sent to the dead letter topic", func(t *testing.T) {
+		// arrange
+		service, leadRepository, publisher, _ := newService()
+		sub, consumer := newSubscription(
+			`{"email": "a@test.com", "phone": "not a number"}`,
+			`{"email": "b@test.com"}`,
+			`{"email": "c@test.com", "phone": 1, "nickname": "c"}`,
+			`{"email": ["d@test.com"], "phone": 1}`,
+			`not json`,
+		)
+
+		// act
+		var errs []error
+		for range 5 {
+			errs = append(errs, handleNext(service, sub))
+		}
+
+		// assert
+		deadLetters := publisher.Messages(sub.DeadLetterTopic)
+		_ = assert.Equal(t, make([]error, 5), errs)
+		_ = assert.Empty(t, leadRepository.leads)
+		_ = assert.Len(t, consumer.Acked(), 5)
+		if assert.Len(t, deadLetters, 5) {
+			_ = assert.Equal(t, "a", deadLetters[0].Key)
+			_ = assert.Equal(t, domain.ErrInvalidFieldValues.Error(), deadLetters[0].Headers[DeadLetterErrorHeader])
+			_ = assert.Equal(t, domain.ErrRequiredFieldsMissing.Error(), deadLetters[1].Headers[DeadLetterErrorHeader])
+			_ = assert.Equal(t, domain.ErrInvalidFieldValues.Error(), deadLetters[2].Headers[DeadLetterErrorHeader])
+			_ = assert.Contains(t, deadLetters[3].Headers[DeadLetterErrorHeader], domain.ErrInvalidLeadMessage.Error())
+			_ = assert.Contains(t, deadLetters[4].Headers[DeadLetterErrorHeader], domain.ErrInvalidLeadMessage.Error())
+			_ = assert.Equal(t, "leads.inbound", deadLetters[4].Headers[DeadLetterTopicHeader])
+		}
+	})
+
+	_ = t.Run("failure, messages are not acknowledged when they can not be written", func(t *testing.T) {
+		// arrange
+		service, _, publisher, _ := newService()
+		sub, consumer := newSubscription(`{"email": "a@test.com", "phone": 1}`)
+		sub.SchemaId = primitive.NewObjectID().Hex()
+
+		// act
+		err := handleNext(service, sub)
+
+		// assert
+		_ = assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+		_ = assert.Empty(t, consumer.Acked())
+		_ = assert.Empty(t, publisher.Messages(sub.DeadLetterTopic))
+	})
+
+	_ = t.Run("success, failed messages are retried until the dead letter topic is back", func(t *testing.T) {
+		// arrange
+		service, _, publisher, _ := newService()
+		publisher.SetErr(assert.AnError)
+		sub, consumer := newSubscription(`not json`, `{"email": "a@test.com", "phone": 1}`)
+		consumeCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// act
+		go service.Consume(&consumeCtx, sub)
+		time.Sleep(20 * time.Millisecond)
+		acked := len(consumer.Acked())
+		publisher.SetErr(nil)
+
+		// assert
+		_ = assert.Zero(t, acked)
+		_ = assert.Eventually(t, func() bool { return len(consumer.Acked()) == 2 }, time.Second, 5*time.Millisecond)
+	})
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// xlsxMaxRows is the number of rows a worksheet holds, the header
+	// included.
+	xlsxMaxRows = 1048576
+
+	// parquetRowGroupSize bounds the rows buffered before they are written.
+	parquetRowGroupSize = 10000
+)
+
+// exportColumn is a column of an export, typed like a schema field.
+type exportColumn struct {
+	Name string
+	Type string
+}
+
+// exportColumns returns the ID of the lead, the fields of the schema in their
+// order and the import and timestamps of the lead.
+func exportColumns(schema *domain.Schema) []exportColumn {
+	columns := []exportColumn{{Name: "_id", Type: "string"}}
+	for _, field := range schema.Fields {
+		columns = append(columns, exportColumn{Name: field.Name, Type: field.Type})
+	}
+	return append(columns,
+		exportColumn{Name: "import_id", Type: "string"},
+		exportColumn{Name: "created_at", Type: "datetime"},
+		exportColumn{Name: "updated_at", Type: "datetime"},
+	)
+}
+
+// exportValues converts the lead to the values of the columns: string, int64,
+// float64, bool, time.Time for datetimes, or nil when the lead has no value.
+// Datetime fields hold Unix seconds, like the files they were uploaded from.
+func exportValues(columns []exportColumn, lead primitive.M) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = exportValue(lead[column.Name], column.Type)
+	}
+	return values
+}
+
+func exportValue(value interface{}, fieldType string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC()
+	case int32:
+		return exportValue(int64(v), fieldType)
+	case int:
+		return exportValue(int64(v), fieldType)
+	case int64:
+		if fieldType == "datetime" {
+			return time.Unix(v, 0).UTC()
+		}
+		return v
+	case float64, bool, string:
+		return v
+	default:
+		return nil
+	}
+}
+
+// formatExportValue writes a value as text, with every datetime in RFC 3339
+// and UTC.
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return ""
+	}
+}
+
+// leadWriter writes the leads of an export one at a time in a format. Close
+// completes the file, while Discard only releases the writer, so an export
+// that failed is left without the end of its file rather than cut short
+// behind a valid one.
+type leadWriter interface {
+	Write(values []interface{}) error
+	Close() error
+	Discard()
+}
+
+// exportMaxRows is how many leads a file of the format holds, zero meaning
+// no limit.
+func exportMaxRows(format string) int64 {
+	if format == domain.ExportFormatXLSX {
+		return xlsxMaxRows - 1
+	}
+	return 0
+}
+
+func newLeadWriter(format string, w io.Writer, columns []exportColumn) (leadWriter, error) {
+	switch format {
+	case domain.ExportFormatCSV:
+		return newCSVLeadWriter(w, columns)
+	case domain.ExportFormatNDJSON:
+		return newNDJSONLeadWriter(w, columns), nil
+	case domain.ExportFormatXLSX:
+		return newXLSXLeadWriter(w, columns)
+	case domain.ExportFormatParquet:
+		return newParquetLeadWriter(w, columns), nil
+	default:
+		return nil, domain.ErrInvalidExport
+	}
+}
+
+type csvLeadWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVLeadWriter(w io.Writer, columns []exportColumn) (*csvLeadWriter, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &csvLeadWriter{writer: writer, record: make([]string, len(columns))}, nil
+}
+
+func (cw *csvLeadWriter) Write(values []interface{}) error {
+	for i, value := range values {
+		cw.record[i] = formatExportValue(value)
+	}
+	return cw.writer.Write(cw.record)
+}
+
+func (cw *csvLeadWriter) Close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+func (cw *csvLeadWriter) Discard() {}
+
+// ndjsonLeadWriter writes a JSON object per line, with its keys in the order
+// of the columns and no key for the columns without a value.
+type ndjsonLeadWriter struct {
+	writer *bufio.Writer
+	keys   [][]byte
+}
+
+func newNDJSONLeadWriter(w io.Writer, columns []exportColumn) *ndjsonLeadWriter {
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		keys[i], _ = json.Marshal(column.Name)
+	}
+
+	return &ndjsonLeadWriter{writer: bufio.NewWriter(w), keys: keys}
+}
+
+func (nw *ndjsonLeadWriter) Write(values []interface{}) error {
+	_ = nw.writer.WriteByte('{')
+	first := true
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if t, ok := value.(time.Time); ok {
+			value = formatExportValue(t)
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if !first {
+			_ = nw.writer.WriteByte(',')
+		}
+		first = false
+		_, _ = nw.writer.Write(nw.keys[i])
+		_ = nw.writer.WriteByte(':')
+		_, _ = nw.writer.Write(data)
+	}
+	_, err := nw.writer.WriteString("}\n")
+	return err
+}
+
+func (nw *ndjsonLeadWriter) Close() error {
+	return nw.writer.Flush()
+}
+
+func (nw *ndjsonLeadWriter) Discard() {}
+
+// xlsxLeadWriter writes a single worksheet. Its rows are kept in a temporary
+// file rather than in memory, and the workbook is only written out on Close,
+// as it is a zip archive.
+type xlsxLeadWriter struct {
+	output io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXLeadWriter(w io.Writer, columns []exportColumn) (*xlsxLeadWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &xlsxLeadWriter{output: w, file: file, stream: stream, row: 1}, nil
+}
+
+func (xw *xlsxLeadWriter) Write(values []interface{}) error {
+	if xw.row == xlsxMaxRows {
+		return domain.ErrExportTooLarge
+	}
+	xw.row++
+
+	row := make([]interface{}, len(values))
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			value = formatExportValue(t)
+		}
+		row[i] = value
+	}
+
+	cell, err := excelize.CoordinatesToCellName(1, xw.row)
+	if err != nil {
+		return err
+	}
+	return xw.stream.SetRow(cell, row)
+}
+
+func (xw *xlsxLeadWriter) Close() error {
+	defer xw.file.Close()
+
+	if err := xw.stream.Flush(); err != nil {
+		return err
+	}
+	return xw.file.Write(xw.output)
+}
+
+// Discard removes the temporary file of the rows without writing the
+// workbook.
+func (xw *xlsxLeadWriter) Discard() {
+	_ = xw.file.Close()
+}
+
+// parquetLeadWriter writes every column as optional, with datetimes as
+// timestamps in milliseconds. Rows are written out in row groups of
+// parquetRowGroupSize.
+type parquetLeadWriter struct {
+	writer *parquet.Writer
+	row    parquet.Row
+}
+
+func newParquetLeadWriter(w io.Writer, columns []exportColumn) *parquetLeadWriter {
+	schema := parquet.NewSchema("lead", newParquetColumns(columns))
+	writer := parquet.NewWriter(w, schema, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))
+
+	return &parquetLeadWriter{writer: writer, row: make(parquet.Row, len(columns))}
+}
+
+func (pw *parquetLeadWriter) Write(values []interface{}) error {
+	for i, value := range values {
+		var v parquet.Value
+		switch value := value.(type) {
+		case string:
+			v = parquet.ByteArrayValue([]byte(value))
+		case int64:
+			v = parquet.Int64Value(value)
+		case float64:
+			v = parquet.DoubleValue(value)
+		case bool:
+			v = parquet.BooleanValue(value)
+		case time.Time:
+			v = parquet.Int64Value(value.UnixMilli())
+		}
+
+		definitionLevel := 1
+		if value == nil {
+			definitionLevel = 0
+		}
+		pw.row[i] = v.Level(0, definitionLevel, i)
+	}
+
+	_, err := pw.writer.WriteRows([]parquet.Row{pw.row})
+	return err
+}
+
+func (pw *parquetLeadWriter) Close() error {
+	return pw.writer.Close()
+}
+
+// Discard leaves the file without its footer, which readers need.
+func (pw *parquetLeadWriter) Discard() {}
+
+// parquetColumns is the root of the schema of a parquet export. Unlike
+// parquet.Group, which sorts its fields by name, it keeps the columns in the
+// order of the export.
+type parquetColumns []parquet.Field
+
+func newParquetColumns(columns []exportColumn) parquetColumns {
+	fields := make(parquetColumns, len(columns))
+	for i, column := range columns {
+		var node parquet.Node
+		switch column.Type {
+		case "integer", "date", "time":
+			node = parquet.Int(64)
+		case "float":
+			node = parquet.Leaf(parquet.DoubleType)
+		case "boolean":
+			node = parquet.Leaf(parquet.BooleanType)
+		case "datetime":
+			node = parquet.Timestamp(parquet.Millisecond)
+		default:
+			node = parquet.String()
+		}
+		fields[i] = &parquetColumn{Node: parquet.Optional(node), name: column.Name}
+	}
+	return fields
+}
+
+func (pc parquetColumns) ID() int                     { return 0 }
+func (pc parquetColumns) String() string              { return "lead" }
+func (pc parquetColumns) Type() parquet.Type          { return parquet.Group{}.Type() }
+func (pc parquetColumns) Optional() bool              { return false }
+func (pc parquetColumns) Repeated() bool              { return false }
+func (pc parquetColumns) Required() bool              { return true }
+func (pc parquetColumns) Leaf() bool                  { return false }
+func (pc parquetColumns) Fields() []parquet.Field     { return pc }
+func (pc parquetColumns) Encoding() encoding.Encoding { return nil }
+func (pc parquetColumns) Compression() compress.Codec { return nil }
+func (pc parquetColumns) GoType() reflect.Type        { return reflect.TypeOf(map[string]interface{}{}) }
+
+type parquetColumn struct {
+	parquet.Node
+	name string
+}
+
+func (pc *parquetColumn) Name() string { return pc.name }
+
+func (pc *parquetColumn) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(pc.name))
+}
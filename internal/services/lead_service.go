@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LeadService struct {
+	SchemaRepository repositories.SchemaRepository
+	LeadRepository   repositories.LeadRepository
+	Cipher           *LeadCipher
+	Audit            *AuditService
+}
+
+func NewLeadService(sr repositories.SchemaRepository, lr repositories.LeadRepository, cipher *LeadCipher, audit *AuditService) *LeadService {
+	return &LeadService{
+		SchemaRepository: sr,
+		LeadRepository:   lr,
+		Cipher:           cipher,
+		Audit:            audit,
+	}
+}
+
+// Watch follows the leads written to the schema, starting right after the
+// change of the resume token, or now when it is empty. Sensitive fields are
+// only decrypted for callers that may read them.
+func (ls *LeadService) Watch(ctx *context.Context, schemaId, resumeToken string) (repositories.LeadChangeStream, error) {
+	schema, err := ls.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	// resume tokens are hex strings, anything else is rejected by the
+	// database with a less helpful error
+	if _, err := hex.DecodeString(resumeToken); err != nil {
+		return nil, domain.ErrInvalidResumeToken
+	}
+
+	stream, err := ls.LeadRepository.WatchBySchemaId(ctx, schema.ID, resumeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openedLeadChangeStream{LeadChangeStream: stream, cipher: ls.Cipher, decrypt: canReadPII(ctx)}, nil
+}
+
+// SetLegalHold places the lead under legal hold, which keeps it from being
+// deleted by the retention of its schema or the erasure of its data subject,
+// or releases it.
+func (ls *LeadService) SetLegalHold(ctx *context.Context, schemaId, leadId string, hold bool) error {
+	schema, err := ls.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return err
+	}
+
+	id, err := primitive.ObjectIDFromHex(leadId)
+	if err != nil {
+		return err
+	}
+
+	if err := ls.LeadRepository.SetLegalHold(ctx, schema.ID, id, hold); err != nil {
+		return err
+	}
+
+	action := domain.AuditActionLegalHoldPlaced
+	if !hold {
+		action = domain.AuditActionLegalHoldReleased
+	}
+	ls.Audit.Record(ctx, action, domain.AuditEntityLead, leadId, nil,
+		map[string]interface{}{"schema_id": schema.ID.Hex(), "legal_hold": hold})
+
+	return nil
+}
+
+// openedLeadChangeStream opens the sensitive fields of the leads of a stream.
+type openedLeadChangeStream struct {
+	repositories.LeadChangeStream
+	cipher  *LeadCipher
+	decrypt bool
+}
+
+func (s *openedLeadChangeStream) Next(ctx *context.Context) (*domain.LeadChange, error) {
+	change, err := s.LeadChangeStream.Next(ctx)
+	if err != nil || change == nil || change.Lead == nil {
+		return change, err
+	}
+
+	if err := s.cipher.Open(ctx, change.Lead, s.decrypt); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
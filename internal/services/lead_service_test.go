@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestLeadService_Watch(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{ID: primitive.NewObjectID()}
+
+	_ = t.Run("success, the stream resumes after the token", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		service := NewLeadService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, nil, nil)
+
+		// act
+		stream, err := service.Watch(&ctx, schema.ID.Hex(), "8266A1B2C3000000012B")
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.NotNil(t, stream)
+			_ = assert.Equal(t, schema.ID, leadRepository.watchedSchemaId)
+			_ = assert.Equal(t, "8266A1B2C3000000012B", leadRepository.watchedResumeToken)
+		}
+	})
+
+	_ = t.Run("error, invalid resume token", func(t *testing.T) {
+		// arrange
+		service := NewLeadService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), nil, nil)
+
+		// act
+		_, err := service.Watch(&ctx, schema.ID.Hex(), "not-a-token")
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidResumeToken)
+	})
+
+	_ = t.Run("error, schema not found", func(t *testing.T) {
+		// arrange
+		service := NewLeadService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), nil, nil)
+
+		// act
+		_, err := service.Watch(&ctx, primitive.NewObjectID().Hex(), "")
+
+		// assert
+		_ = assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	})
+}
+
+func TestLeadService_SetLegalHold(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{ID: primitive.NewObjectID()}
+
+	_ = t.Run("success, placed and released", func(t *testing.T) {
+		// arrange
+		leadRepository := NewLeadRepositoryMock()
+		_ = leadRepository.Create(&ctx, &bson.D{{Key: "schema_id", Value: schema.ID}})
+		leadId := leadRepository.leads[0].Map()["_id"].(primitive.ObjectID).Hex()
+		service := NewLeadService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, nil, nil)
+
+		// act
+		placeErr := service.SetLegalHold(&ctx, schema.ID.Hex(), leadId, true)
+		held := leadRepository.leads[0].Map()[domain.LeadLegalHoldField]
+		releaseErr := service.SetLegalHold(&ctx, schema.ID.Hex(), leadId, false)
+
+		// assert
+		_ = assert.NoError(t, placeErr)
+		_ = assert.NoError(t, releaseErr)
+		_ = assert.Equal(t, true, held)
+		_ = assert.NotContains(t, leadRepository.leads[0].Map(), domain.LeadLegalHoldField)
+	})
+
+	_ = t.Run("error, lead not found", func(t *testing.T) {
+		// arrange
+		service := NewLeadService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), nil, nil)
+
+		// act
+		err := service.SetLegalHold(&ctx, schema.ID.Hex(), primitive.NewObjectID().Hex(), true)
+
+		// assert
+		_ = assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	})
+}
@@ -1,18 +1,31 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/vitortenor/lead-stream-service/internal/domain"
 	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func NewSchemaRepositoryMock() repositories.SchemaRepository {
 	return &schemaRepositoryMock{}
 }
 
+func NewSchemaRepositoryMockWithSchema(schema *domain.Schema) repositories.SchemaRepository {
+	return &schemaRepositoryMock{schema: schema}
+}
+
 type schemaRepositoryMock struct {
+	schema *domain.Schema
 }
 
 func (s schemaRepositoryMock) Create(_ *context.Context, schema *domain.Schema) error {
@@ -21,6 +34,12 @@ func (s schemaRepositoryMock) Create(_ *context.Context, schema *domain.Schema)
 }
 
 func (s schemaRepositoryMock) FindById(_ *context.Context, id string) (*domain.Schema, error) {
+	if s.schema != nil {
+		if s.schema.ID.Hex() == id {
+			return s.schema, nil
+		}
+		return nil, mongo.ErrNoDocuments
+	}
 	if id == "67696ff2e3f76ec9d8e8dc3b" {
 		return &domain.Schema{
 			ID: primitive.NewObjectID(),
@@ -28,3 +47,1285 @@ func (s schemaRepositoryMock) FindById(_ *context.Context, id string) (*domain.S
 	}
 	return nil, nil
 }
+
+func (s schemaRepositoryMock) FindWithRetention(_ *context.Context) ([]*domain.Schema, error) {
+	if s.schema != nil && s.schema.Retention != nil {
+		return []*domain.Schema{s.schema}, nil
+	}
+	return []*domain.Schema{}, nil
+}
+
+func (s schemaRepositoryMock) UpdateRetention(_ *context.Context, id primitive.ObjectID, retention *domain.Retention) error {
+	if s.schema == nil || s.schema.ID != id {
+		return mongo.ErrNoDocuments
+	}
+	s.schema.Retention = retention
+	return nil
+}
+
+func NewLeadRepositoryMock() *leadRepositoryMock {
+	return &leadRepositoryMock{}
+}
+
+type leadRepositoryMock struct {
+	leads              []*bson.D
+	staged             []*bson.D
+	published          int
+	calls              int
+	failOnCall         int
+	transactions       int
+	watchedSchemaId    primitive.ObjectID
+	watchedResumeToken string
+	// tenants are the tenants the leads were created in
+	tenants []string
+	// counted, when set, is how many leads every filter counts
+	counted int64
+	// cursorErr fails the cursors once their leads were read
+	cursorErr error
+}
+
+func (l *leadRepositoryMock) CreateMany(ctx *context.Context, leads []*bson.D) error {
+	l.calls++
+	if l.calls == l.failOnCall {
+		// mimics an ordered insert that stops at the first document of the batch
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+	}
+	tenant, _ := domain.TenantFromContext(*ctx)
+	for _, lead := range leads {
+		withId(lead)
+		l.tenants = append(l.tenants, tenant)
+	}
+	l.leads = append(l.leads, leads...)
+	return nil
+}
+
+func (l *leadRepositoryMock) CreateManyInTransaction(ctx *context.Context, leads []*bson.D) error {
+	l.transactions++
+	return l.CreateMany(ctx, leads)
+}
+
+// CreateManyStaged counts as a call like CreateMany, so failOnCall fails the
+// batches of non-transactional imports.
+func (l *leadRepositoryMock) CreateManyStaged(ctx *context.Context, leads []*bson.D) error {
+	l.calls++
+	if l.calls == l.failOnCall {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+	}
+	for _, lead := range leads {
+		withId(lead)
+	}
+	l.staged = append(l.staged, leads...)
+	return nil
+}
+
+func (l *leadRepositoryMock) PublishStaged(ctx *context.Context, importId primitive.ObjectID, limit int64) (int, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	var kept []*bson.D
+	published := 0
+	for _, lead := range l.staged {
+		if lead.Map()["import_id"] != importId || int64(published) == limit {
+			kept = append(kept, lead)
+			continue
+		}
+		published++
+		l.published++
+		l.leads = append(l.leads, lead)
+		l.tenants = append(l.tenants, tenant)
+	}
+	l.staged = kept
+	return published, nil
+}
+
+func (l *leadRepositoryMock) UnpublishByImportId(_ *context.Context, importId primitive.ObjectID, limit int64) (int, error) {
+	var kept []*bson.D
+	var keptTenants []string
+	unpublished := 0
+	for i, lead := range l.leads {
+		doc := lead.Map()
+		if doc["import_id"] != importId || doc[domain.LeadLegalHoldField] == true || int64(unpublished) == limit {
+			kept = append(kept, lead)
+			keptTenants = append(keptTenants, l.tenants[i])
+			continue
+		}
+		unpublished++
+		l.staged = append(l.staged, lead)
+	}
+	l.leads, l.tenants = kept, keptTenants
+	return unpublished, nil
+}
+
+func (l *leadRepositoryMock) DeleteStaged(_ *context.Context, importId primitive.ObjectID) (int64, error) {
+	var kept []*bson.D
+	var deleted int64
+	for _, lead := range l.staged {
+		if lead.Map()["import_id"] == importId {
+			deleted++
+			continue
+		}
+		kept = append(kept, lead)
+	}
+	l.staged = kept
+	return deleted, nil
+}
+
+func (l *leadRepositoryMock) FindByMessageId(ctx *context.Context, messageId string) (primitive.M, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	for i, lead := range l.leads {
+		if lead.Map()["message_id"] == messageId && l.tenants[i] == tenant {
+			return lead.Map(), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (l *leadRepositoryMock) Create(ctx *context.Context, lead *bson.D) error {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	if messageId, ok := lead.Map()["message_id"]; ok {
+		for i, written := range l.leads {
+			if written.Map()["message_id"] == messageId && l.tenants[i] == tenant {
+				return domain.ErrLeadMessageConsumed
+			}
+		}
+	}
+	l.tenants = append(l.tenants, tenant)
+	l.leads = append(l.leads, withId(lead))
+	return nil
+}
+
+func (l *leadRepositoryMock) DeleteByImportId(_ *context.Context, importId primitive.ObjectID) (int64, error) {
+	var kept []*bson.D
+	var deleted int64
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		if doc["import_id"] == importId && doc[domain.LeadLegalHoldField] != true {
+			deleted++
+			continue
+		}
+		kept = append(kept, lead)
+	}
+	l.leads = kept
+	return deleted, nil
+}
+
+func (l *leadRepositoryMock) FindByImportId(_ *context.Context, importId primitive.ObjectID, after primitive.ObjectID, limit int64) ([]primitive.M, error) {
+	leads := make([]primitive.M, 0)
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		if doc["import_id"] != importId || doc["_id"].(primitive.ObjectID).Hex() <= after.Hex() {
+			continue
+		}
+		if int64(len(leads)) == limit {
+			break
+		}
+		leads = append(leads, doc)
+	}
+	return leads, nil
+}
+
+func (l *leadRepositoryMock) WatchBySchemaId(_ *context.Context, schemaId primitive.ObjectID, resumeToken string) (repositories.LeadChangeStream, error) {
+	l.watchedSchemaId, l.watchedResumeToken = schemaId, resumeToken
+	return &leadChangeStreamMock{}, nil
+}
+
+func (l *leadRepositoryMock) FindByFilter(_ *context.Context, filter *domain.LeadFilter) (repositories.LeadCursor, error) {
+	var leads []primitive.M
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		if doc["schema_id"] != filter.SchemaId || (!filter.ImportId.IsZero() && doc["import_id"] != filter.ImportId) {
+			continue
+		}
+		matches := true
+		for field, value := range filter.Fields {
+			matches = matches && doc[field] == value
+		}
+		if matches {
+			leads = append(leads, doc)
+		}
+	}
+	return &leadCursorMock{leads: leads, err: l.cursorErr}, nil
+}
+
+func (l *leadRepositoryMock) CountByFilter(ctx *context.Context, filter *domain.LeadFilter, limit int64) (int64, error) {
+	if l.counted > 0 {
+		return l.counted, nil
+	}
+	cursor, _ := l.FindByFilter(ctx, filter)
+	return int64(len(cursor.(*leadCursorMock).leads)), nil
+}
+
+func (l *leadRepositoryMock) FindBySubject(_ *context.Context, filter *domain.SubjectFilter) ([]primitive.M, error) {
+	leads := make([]primitive.M, 0)
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		if slices.Contains(filter.Emails, doc["email"]) || slices.Contains(filter.Phones, doc["phone"]) {
+			leads = append(leads, doc)
+		}
+	}
+	return leads, nil
+}
+
+func (l *leadRepositoryMock) DeleteStagedBySubject(_ *context.Context, filter *domain.SubjectFilter) (int64, error) {
+	var kept []*bson.D
+	var deleted int64
+	for _, lead := range l.staged {
+		doc := lead.Map()
+		if slices.Contains(filter.Emails, doc["email"]) || slices.Contains(filter.Phones, doc["phone"]) {
+			deleted++
+			continue
+		}
+		kept = append(kept, lead)
+	}
+	l.staged = kept
+	return deleted, nil
+}
+
+func (l *leadRepositoryMock) DeleteByIds(_ *context.Context, ids []primitive.ObjectID) (int64, error) {
+	var kept []*bson.D
+	var deleted int64
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		if slices.Contains(ids, doc["_id"].(primitive.ObjectID)) && doc[domain.LeadLegalHoldField] != true {
+			deleted++
+			continue
+		}
+		kept = append(kept, lead)
+	}
+	l.leads = kept
+	return deleted, nil
+}
+
+func (l *leadRepositoryMock) Anonymize(_ *context.Context, ids []primitive.ObjectID) (int64, error) {
+	var anonymized int64
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		id := doc["_id"].(primitive.ObjectID)
+		if !slices.Contains(ids, id) || doc[domain.LeadLegalHoldField] == true {
+			continue
+		}
+		anonymized++
+		*lead = bson.D{
+			{Key: "_id", Value: id},
+			{Key: "schema_id", Value: doc["schema_id"]},
+			{Key: "import_id", Value: doc["import_id"]},
+			{Key: "email", Value: "erased:" + id.Hex()},
+			{Key: "phone", Value: "erased:" + id.Hex()},
+		}
+	}
+	return anonymized, nil
+}
+
+// DeleteExpired compares the values of the field as the database would for
+// dates and Unix seconds.
+func (l *leadRepositoryMock) DeleteExpired(_ *context.Context, schemaId primitive.ObjectID, field string, cutoff interface{}) (int64, error) {
+	var kept []*bson.D
+	var deleted int64
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		var expired bool
+		switch value := doc[field].(type) {
+		case primitive.DateTime:
+			expired = value < cutoff.(primitive.DateTime)
+		case int64:
+			expired = value < cutoff.(int64)
+		}
+		if doc["schema_id"] == schemaId && expired && doc[domain.LeadLegalHoldField] != true {
+			deleted++
+			continue
+		}
+		kept = append(kept, lead)
+	}
+	l.leads = kept
+	return deleted, nil
+}
+
+func (l *leadRepositoryMock) SetLegalHold(_ *context.Context, schemaId, id primitive.ObjectID, hold bool) error {
+	for _, lead := range l.leads {
+		doc := lead.Map()
+		if doc["_id"] != id || doc["schema_id"] != schemaId {
+			continue
+		}
+		kept := (*lead)[:0]
+		for _, e := range *lead {
+			if e.Key != domain.LeadLegalHoldField {
+				kept = append(kept, e)
+			}
+		}
+		if hold {
+			kept = append(kept, bson.E{Key: domain.LeadLegalHoldField, Value: true})
+		}
+		*lead = kept
+		return nil
+	}
+	return mongo.ErrNoDocuments
+}
+
+type leadCursorMock struct {
+	leads []primitive.M
+	err   error
+}
+
+func (l *leadCursorMock) Next(_ *context.Context) (primitive.M, error) {
+	if len(l.leads) == 0 {
+		return nil, l.err
+	}
+	lead := l.leads[0]
+	l.leads = l.leads[1:]
+	return lead, nil
+}
+
+func (l *leadCursorMock) Close(_ *context.Context) error {
+	return nil
+}
+
+type leadChangeStreamMock struct {
+	changes []*domain.LeadChange
+}
+
+func (l *leadChangeStreamMock) Next(_ *context.Context) (*domain.LeadChange, error) {
+	if len(l.changes) == 0 {
+		return nil, nil
+	}
+	change := l.changes[0]
+	l.changes = l.changes[1:]
+	return change, nil
+}
+
+func (l *leadChangeStreamMock) Close(_ *context.Context) error {
+	return nil
+}
+
+// withId sets the _id of the lead, as the database does on insert.
+func withId(lead *bson.D) *bson.D {
+	if _, ok := lead.Map()["_id"]; !ok {
+		*lead = append(*lead, bson.E{Key: "_id", Value: primitive.NewObjectID()})
+	}
+	return lead
+}
+
+func NewImportRepositoryMock(imports ...*domain.Import) *importRepositoryMock {
+	mock := &importRepositoryMock{imports: make(map[primitive.ObjectID]*domain.Import)}
+	for _, imp := range imports {
+		mock.imports[imp.ID] = imp
+	}
+	return mock
+}
+
+type importRepositoryMock struct {
+	imports  map[primitive.ObjectID]*domain.Import
+	progress []domain.ImportProgress
+}
+
+func (i *importRepositoryMock) Create(_ *context.Context, imp *domain.Import) error {
+	for _, other := range i.imports {
+		if imp.IdempotencyClaimed && other.IdempotencyClaimed && other.SchemaId == imp.SchemaId &&
+			other.IdempotencyKey == imp.IdempotencyKey && other.Entry == imp.Entry {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+		}
+	}
+	imp.ID = primitive.NewObjectID()
+	i.imports[imp.ID] = imp
+	return nil
+}
+
+func (i *importRepositoryMock) Update(_ *context.Context, imp *domain.Import) error {
+	i.imports[imp.ID] = imp
+	return nil
+}
+
+func (i *importRepositoryMock) UpdateProgress(_ *context.Context, id primitive.ObjectID, progress *domain.ImportProgress) error {
+	i.progress = append(i.progress, *progress)
+	if imp, ok := i.imports[id]; ok && imp.Status == domain.ImportStatusProcessing {
+		saved := *progress
+		imp.Progress = &saved
+	}
+	return nil
+}
+
+func (i *importRepositoryMock) FindById(_ *context.Context, id string) (*domain.Import, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if imp, ok := i.imports[objID]; ok {
+		return imp, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (i *importRepositoryMock) FindBySchemaId(_ *context.Context, schemaId string) ([]*domain.Import, error) {
+	var imports []*domain.Import
+	for _, imp := range i.imports {
+		if imp.SchemaId.Hex() == schemaId {
+			imports = append(imports, imp)
+		}
+	}
+	return imports, nil
+}
+
+func (i *importRepositoryMock) FindBySourceId(_ *context.Context, sourceId primitive.ObjectID) ([]*domain.Import, error) {
+	var imports []*domain.Import
+	for _, imp := range i.imports {
+		if imp.SourceId == sourceId {
+			imports = append(imports, imp)
+		}
+	}
+	return imports, nil
+}
+
+func (i *importRepositoryMock) FindReplayableByIdempotencyKey(_ *context.Context, schemaId primitive.ObjectID, key string, since, aliveSince time.Time) ([]*domain.Import, error) {
+	return i.findReplayable(func(imp *domain.Import) bool {
+		return imp.SchemaId == schemaId && imp.IdempotencyKey == key
+	}, since, aliveSince)
+}
+
+func (i *importRepositoryMock) FindReplayableByChecksum(_ *context.Context, schemaId primitive.ObjectID, checksum string, since, aliveSince time.Time) ([]*domain.Import, error) {
+	return i.findReplayable(func(imp *domain.Import) bool {
+		return imp.SchemaId == schemaId && imp.Checksum == checksum
+	}, since, aliveSince)
+}
+
+func (i *importRepositoryMock) ReleaseIdempotencyKey(_ *context.Context, schemaId primitive.ObjectID, key string, before time.Time) (bool, error) {
+	released := false
+	for _, imp := range i.imports {
+		if imp.IdempotencyClaimed && imp.SchemaId == schemaId && imp.IdempotencyKey == key && imp.StartedAt.Time().Before(before) {
+			imp.IdempotencyClaimed = false
+			released = true
+		}
+	}
+	return released, nil
+}
+
+func (i *importRepositoryMock) CountProcessing(_ *context.Context, since time.Time) (int64, error) {
+	var count int64
+	for _, imp := range i.imports {
+		if imp.Status == domain.ImportStatusProcessing && !imp.StartedAt.Time().Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (i *importRepositoryMock) CountProcessingBefore(_ *context.Context, id primitive.ObjectID, since time.Time) (int64, error) {
+	var count int64
+	for _, imp := range i.imports {
+		if imp.Status == domain.ImportStatusProcessing && !imp.StartedAt.Time().Before(since) && bytes.Compare(imp.ID[:], id[:]) < 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (i *importRepositoryMock) Delete(_ *context.Context, id primitive.ObjectID) error {
+	delete(i.imports, id)
+	return nil
+}
+
+func (i *importRepositoryMock) FindStale(_ *context.Context, since time.Time) ([]*domain.Import, error) {
+	imports := make([]*domain.Import, 0)
+	for _, imp := range i.imports {
+		if imp.Status == domain.ImportStatusProcessing && imp.StartedAt.Time().Before(since) &&
+			(imp.Progress == nil || imp.Progress.UpdatedAt.Time().Before(since)) {
+			imports = append(imports, imp)
+		}
+	}
+	return imports, nil
+}
+
+func (i *importRepositoryMock) findReplayable(match func(imp *domain.Import) bool, since, aliveSince time.Time) ([]*domain.Import, error) {
+	imports := make([]*domain.Import, 0)
+	for _, imp := range i.imports {
+		alive := !imp.StartedAt.Time().Before(aliveSince) || (imp.Progress != nil && !imp.Progress.UpdatedAt.Time().Before(aliveSince))
+		replayable := imp.Status == domain.ImportStatusCompleted || (imp.Status == domain.ImportStatusProcessing && alive)
+		if match(imp) && replayable && !imp.StartedAt.Time().Before(since) {
+			imports = append(imports, imp)
+		}
+	}
+	return imports, nil
+}
+
+func NewUploadRepositoryMock() *uploadRepositoryMock {
+	return &uploadRepositoryMock{uploads: make(map[primitive.ObjectID]*domain.UploadSession)}
+}
+
+type uploadRepositoryMock struct {
+	uploads map[primitive.ObjectID]*domain.UploadSession
+}
+
+func (u *uploadRepositoryMock) Create(_ *context.Context, upload *domain.UploadSession) error {
+	upload.ID = primitive.NewObjectID()
+	stored := *upload
+	u.uploads[upload.ID] = &stored
+	return nil
+}
+
+func (u *uploadRepositoryMock) Update(_ *context.Context, upload *domain.UploadSession) error {
+	stored := *upload
+	u.uploads[upload.ID] = &stored
+	return nil
+}
+
+func (u *uploadRepositoryMock) FindById(_ *context.Context, id string) (*domain.UploadSession, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload, ok := u.uploads[objID]; ok {
+		found := *upload
+		return &found, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (u *uploadRepositoryMock) AdvanceOffset(_ *context.Context, upload *domain.UploadSession, offset int64, expiresAt time.Time) error {
+	stored := u.uploads[upload.ID]
+	if stored.Offset != upload.Offset {
+		return domain.ErrUploadOffsetMismatch
+	}
+	stored.Offset = offset
+	stored.ExpiresAt = primitive.NewDateTimeFromTime(expiresAt)
+	upload.Offset = offset
+	upload.ExpiresAt = stored.ExpiresAt
+	return nil
+}
+
+func (u *uploadRepositoryMock) FindExpired(_ *context.Context, now time.Time) ([]*domain.UploadSession, error) {
+	var uploads []*domain.UploadSession
+	for _, upload := range u.uploads {
+		if upload.IsExpired(now) {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+func NewObjectRepositoryMock(objects map[string]string) *objectRepositoryMock {
+	return &objectRepositoryMock{objects: objects}
+}
+
+// objectRepositoryMock holds the content of a single bucket by key, using the
+// content itself as ETag.
+type objectRepositoryMock struct {
+	objects map[string]string
+}
+
+func (o *objectRepositoryMock) List(_ *context.Context, bucket, prefix string) ([]*domain.StoredObject, error) {
+	var objects []*domain.StoredObject
+	for key, content := range o.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, &domain.StoredObject{Bucket: bucket, Key: key, ETag: content, Size: int64(len(content))})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (o *objectRepositoryMock) Download(_ *context.Context, object *domain.StoredObject, path string) error {
+	return os.WriteFile(path, []byte(o.objects[object.Key]), 0o600)
+}
+
+func (o *objectRepositoryMock) Move(_ *context.Context, object *domain.StoredObject, key string) error {
+	o.objects[key] = o.objects[object.Key]
+	delete(o.objects, object.Key)
+	return nil
+}
+
+func NewObjectIngestionRepositoryMock() *objectIngestionRepositoryMock {
+	return &objectIngestionRepositoryMock{ingestions: make(map[primitive.ObjectID]*domain.ObjectIngestion)}
+}
+
+type objectIngestionRepositoryMock struct {
+	ingestions map[primitive.ObjectID]*domain.ObjectIngestion
+}
+
+func (o *objectIngestionRepositoryMock) Create(ctx *context.Context, ingestion *domain.ObjectIngestion) error {
+	if _, err := o.FindByObject(ctx, &domain.StoredObject{Bucket: ingestion.Bucket, Key: ingestion.Key, ETag: ingestion.ETag}); err == nil {
+		return domain.ErrObjectClaimed
+	}
+	ingestion.ID = primitive.NewObjectID()
+	stored := *ingestion
+	o.ingestions[ingestion.ID] = &stored
+	return nil
+}
+
+func (o *objectIngestionRepositoryMock) Update(_ *context.Context, ingestion *domain.ObjectIngestion) error {
+	stored := *ingestion
+	o.ingestions[ingestion.ID] = &stored
+	return nil
+}
+
+func (o *objectIngestionRepositoryMock) Retry(ctx *context.Context, ingestion *domain.ObjectIngestion, now time.Time, lease time.Duration) error {
+	stored := o.ingestions[ingestion.ID]
+	if stored.Status != domain.ObjectIngestionStatusFailed && !stored.IsAbandoned(now, lease) {
+		return domain.ErrObjectClaimed
+	}
+	ingestion.Retry()
+	return o.Update(ctx, ingestion)
+}
+
+func (o *objectIngestionRepositoryMock) FindByObject(_ *context.Context, object *domain.StoredObject) (*domain.ObjectIngestion, error) {
+	for _, ingestion := range o.ingestions {
+		if ingestion.Bucket == object.Bucket && ingestion.Key == object.Key && ingestion.ETag == object.ETag {
+			found := *ingestion
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func NewImportSourceRepositoryMock() *importSourceRepositoryMock {
+	return &importSourceRepositoryMock{sources: make(map[primitive.ObjectID]*domain.ImportSource)}
+}
+
+type importSourceRepositoryMock struct {
+	sources map[primitive.ObjectID]*domain.ImportSource
+}
+
+func (i *importSourceRepositoryMock) Create(_ *context.Context, source *domain.ImportSource) error {
+	source.ID = primitive.NewObjectID()
+	stored := *source
+	i.sources[source.ID] = &stored
+	return nil
+}
+
+func (i *importSourceRepositoryMock) Update(_ *context.Context, source *domain.ImportSource) error {
+	if _, ok := i.sources[source.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	stored := *source
+	i.sources[source.ID] = &stored
+	return nil
+}
+
+func (i *importSourceRepositoryMock) Delete(_ *context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := i.sources[objID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(i.sources, objID)
+	return nil
+}
+
+func (i *importSourceRepositoryMock) FindById(_ *context.Context, id string) (*domain.ImportSource, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if source, ok := i.sources[objID]; ok {
+		found := *source
+		return &found, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (i *importSourceRepositoryMock) FindBySchemaId(_ *context.Context, schemaId string) ([]*domain.ImportSource, error) {
+	var sources []*domain.ImportSource
+	for _, source := range i.sources {
+		if source.SchemaId.Hex() == schemaId {
+			found := *source
+			sources = append(sources, &found)
+		}
+	}
+	return sources, nil
+}
+
+func (i *importSourceRepositoryMock) FindDue(_ *context.Context, now time.Time) ([]*domain.ImportSource, error) {
+	var sources []*domain.ImportSource
+	for _, source := range i.sources {
+		if source.Enabled && !source.NextRunAt.Time().After(now) {
+			found := *source
+			sources = append(sources, &found)
+		}
+	}
+	return sources, nil
+}
+
+func (i *importSourceRepositoryMock) ClaimRun(_ *context.Context, source *domain.ImportSource, nextRunAt time.Time) error {
+	stored := i.sources[source.ID]
+	if stored.NextRunAt != source.NextRunAt {
+		return domain.ErrImportInProgress
+	}
+	stored.NextRunAt = primitive.NewDateTimeFromTime(nextRunAt)
+	source.NextRunAt = stored.NextRunAt
+	return nil
+}
+
+func (i *importSourceRepositoryMock) RecordRun(_ *context.Context, source *domain.ImportSource) error {
+	stored := i.sources[source.ID]
+	stored.ETag = source.ETag
+	stored.LastModified = source.LastModified
+	stored.Checksum = source.Checksum
+	stored.LastRunAt = source.LastRunAt
+	stored.LastImportId = source.LastImportId
+	return nil
+}
+
+func NewEventNotifierMock() *eventNotifierMock {
+	return &eventNotifierMock{}
+}
+
+type eventNotifierMock struct {
+	events []*domain.Event
+	// failWith is returned for every event of type failOn
+	failOn   string
+	failWith error
+}
+
+func (e *eventNotifierMock) Wants(_ *context.Context, _ primitive.ObjectID, _ string) (bool, error) {
+	return true, nil
+}
+
+func (e *eventNotifierMock) Notify(_ *context.Context, event *domain.Event) error {
+	if event.Type == e.failOn {
+		return e.failWith
+	}
+	e.events = append(e.events, event)
+	return nil
+}
+
+func NewWebhookRepositoryMock() *webhookRepositoryMock {
+	return &webhookRepositoryMock{webhooks: make(map[primitive.ObjectID]*domain.Webhook)}
+}
+
+type webhookRepositoryMock struct {
+	webhooks map[primitive.ObjectID]*domain.Webhook
+}
+
+func (w *webhookRepositoryMock) Create(_ *context.Context, webhook *domain.Webhook) error {
+	webhook.ID = primitive.NewObjectID()
+	stored := *webhook
+	w.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (w *webhookRepositoryMock) Update(_ *context.Context, webhook *domain.Webhook) error {
+	if _, ok := w.webhooks[webhook.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	stored := *webhook
+	w.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (w *webhookRepositoryMock) Delete(_ *context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := w.webhooks[objID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(w.webhooks, objID)
+	return nil
+}
+
+func (w *webhookRepositoryMock) FindById(_ *context.Context, id string) (*domain.Webhook, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook, ok := w.webhooks[objID]; ok {
+		found := *webhook
+		return &found, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (w *webhookRepositoryMock) FindBySchemaId(_ *context.Context, schemaId string) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	for _, webhook := range w.webhooks {
+		if webhook.SchemaId.Hex() == schemaId {
+			found := *webhook
+			webhooks = append(webhooks, &found)
+		}
+	}
+	return webhooks, nil
+}
+
+func (w *webhookRepositoryMock) FindSubscribed(_ *context.Context, schemaId primitive.ObjectID, event string) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	for _, webhook := range w.webhooks {
+		if webhook.SchemaId == schemaId && webhook.Enabled && slices.Contains(webhook.Events, event) {
+			found := *webhook
+			webhooks = append(webhooks, &found)
+		}
+	}
+	return webhooks, nil
+}
+
+func NewWebhookDeliveryRepositoryMock() *webhookDeliveryRepositoryMock {
+	return &webhookDeliveryRepositoryMock{}
+}
+
+type webhookDeliveryRepositoryMock struct {
+	deliveries []*domain.WebhookDelivery
+}
+
+func (w *webhookDeliveryRepositoryMock) CreateMany(_ *context.Context, deliveries []*domain.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		delivery.ID = primitive.NewObjectID()
+		stored := *delivery
+		w.deliveries = append(w.deliveries, &stored)
+	}
+	return nil
+}
+
+func (w *webhookDeliveryRepositoryMock) Update(_ *context.Context, delivery *domain.WebhookDelivery) error {
+	for i, stored := range w.deliveries {
+		if stored.ID == delivery.ID {
+			updated := *delivery
+			w.deliveries[i] = &updated
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (w *webhookDeliveryRepositoryMock) FindById(_ *context.Context, id string) (*domain.WebhookDelivery, error) {
+	for _, delivery := range w.deliveries {
+		if delivery.ID.Hex() == id {
+			found := *delivery
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (w *webhookDeliveryRepositoryMock) FindByWebhookId(_ *context.Context, webhookId primitive.ObjectID, status string, limit int64) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	for i := len(w.deliveries) - 1; i >= 0 && int64(len(deliveries)) < limit; i-- {
+		delivery := w.deliveries[i]
+		if delivery.WebhookId == webhookId && (status == "" || delivery.Status == status) {
+			found := *delivery
+			deliveries = append(deliveries, &found)
+		}
+	}
+	return deliveries, nil
+}
+
+func (w *webhookDeliveryRepositoryMock) ClaimDue(_ *context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error) {
+	for _, delivery := range w.deliveries {
+		if delivery.Status == domain.WebhookDeliveryStatusPending && !delivery.NextAttemptAt.Time().After(now) {
+			delivery.NextAttemptAt = primitive.NewDateTimeFromTime(now.Add(lease))
+			found := *delivery
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (w *webhookDeliveryRepositoryMock) FindByLeadIds(_ *context.Context, ids []primitive.ObjectID) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	for _, delivery := range w.deliveries {
+		if slices.ContainsFunc(ids, func(id primitive.ObjectID) bool { return strings.Contains(delivery.Payload, id.Hex()) }) {
+			found := *delivery
+			deliveries = append(deliveries, &found)
+		}
+	}
+	return deliveries, nil
+}
+
+func NewOutboxRepositoryMock() *outboxRepositoryMock {
+	return &outboxRepositoryMock{}
+}
+
+type outboxRepositoryMock struct {
+	messages []*domain.OutboxMessage
+}
+
+func (o *outboxRepositoryMock) Create(_ *context.Context, message *domain.OutboxMessage) error {
+	message.ID = primitive.NewObjectID()
+	stored := *message
+	o.messages = append(o.messages, &stored)
+	return nil
+}
+
+func (o *outboxRepositoryMock) Update(_ *context.Context, message *domain.OutboxMessage) error {
+	for i, stored := range o.messages {
+		if stored.ID == message.ID {
+			updated := *message
+			o.messages[i] = &updated
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (o *outboxRepositoryMock) ClaimNext(_ *context.Context, now time.Time, lease time.Duration) (*domain.OutboxMessage, error) {
+	for _, message := range o.messages {
+		if message.Status != domain.OutboxStatusPending {
+			continue
+		}
+		if message.NextAttemptAt.Time().After(now) {
+			return nil, mongo.ErrNoDocuments
+		}
+		message.NextAttemptAt = primitive.NewDateTimeFromTime(now.Add(lease))
+		found := *message
+		return &found, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (o *outboxRepositoryMock) RedactLeads(_ *context.Context, ids []primitive.ObjectID) (int64, error) {
+	var redacted int64
+	for _, message := range o.messages {
+		kept := slices.DeleteFunc(slices.Clone(message.Records), func(record domain.OutboxRecord) bool {
+			return slices.ContainsFunc(ids, func(id primitive.ObjectID) bool { return record.Key == id.Hex() })
+		})
+		if len(kept) < len(message.Records) {
+			message.Records = kept
+			redacted++
+		}
+	}
+	return redacted, nil
+}
+
+func NewExportRepositoryMock() *exportRepositoryMock {
+	return &exportRepositoryMock{}
+}
+
+type exportRepositoryMock struct {
+	exports []*domain.Export
+}
+
+func (e *exportRepositoryMock) Create(_ *context.Context, export *domain.Export) error {
+	export.ID = primitive.NewObjectID()
+	stored := *export
+	e.exports = append(e.exports, &stored)
+	return nil
+}
+
+func (e *exportRepositoryMock) Update(_ *context.Context, export *domain.Export) error {
+	for i, stored := range e.exports {
+		if stored.ID == export.ID {
+			updated := *export
+			e.exports[i] = &updated
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (e *exportRepositoryMock) FindById(_ *context.Context, id string) (*domain.Export, error) {
+	for _, stored := range e.exports {
+		if stored.ID.Hex() == id {
+			found := *stored
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (e *exportRepositoryMock) ClaimNext(_ *context.Context, now time.Time, lease time.Duration) (*domain.Export, error) {
+	for _, stored := range e.exports {
+		stale := stored.Status == domain.ExportStatusRunning && stored.StartedAt.Time().Before(now.Add(-lease))
+		if stored.Status == domain.ExportStatusPending || stale {
+			stored.Status = domain.ExportStatusRunning
+			stored.StartedAt = primitive.NewDateTimeFromTime(now)
+			found := *stored
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (e *exportRepositoryMock) FindFinishedBefore(_ *context.Context, before time.Time) ([]*domain.Export, error) {
+	exports := make([]*domain.Export, 0)
+	for _, stored := range e.exports {
+		if stored.FinishedAt != 0 && stored.FinishedAt.Time().Before(before) {
+			found := *stored
+			exports = append(exports, &found)
+		}
+	}
+	return exports, nil
+}
+
+func (e *exportRepositoryMock) Delete(_ *context.Context, id primitive.ObjectID) error {
+	for i, stored := range e.exports {
+		if stored.ID == id {
+			e.exports = append(e.exports[:i], e.exports[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func NewAPIKeyRepositoryMock() *apiKeyRepositoryMock {
+	return &apiKeyRepositoryMock{}
+}
+
+type apiKeyRepositoryMock struct {
+	keys []*domain.APIKey
+}
+
+func (a *apiKeyRepositoryMock) Create(_ *context.Context, key *domain.APIKey) error {
+	key.ID = primitive.NewObjectID()
+	stored := *key
+	a.keys = append(a.keys, &stored)
+	return nil
+}
+
+func (a *apiKeyRepositoryMock) Update(_ *context.Context, key *domain.APIKey) error {
+	for i, stored := range a.keys {
+		if stored.ID == key.ID {
+			updated := *key
+			a.keys[i] = &updated
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (a *apiKeyRepositoryMock) FindById(_ *context.Context, id string) (*domain.APIKey, error) {
+	for _, stored := range a.keys {
+		if stored.ID.Hex() == id {
+			found := *stored
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (a *apiKeyRepositoryMock) FindByHash(_ *context.Context, hash string) (*domain.APIKey, error) {
+	for _, stored := range a.keys {
+		if stored.Hash == hash {
+			found := *stored
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (a *apiKeyRepositoryMock) FindAll(_ *context.Context) ([]*domain.APIKey, error) {
+	keys := make([]*domain.APIKey, 0, len(a.keys))
+	for _, stored := range a.keys {
+		found := *stored
+		keys = append(keys, &found)
+	}
+	return keys, nil
+}
+
+func NewUsageRepositoryMock() *usageRepositoryMock {
+	return &usageRepositoryMock{rows: make(map[string]int64)}
+}
+
+// usageRepositoryMock counts the rows by tenant and day.
+type usageRepositoryMock struct {
+	rows map[string]int64
+}
+
+func (u *usageRepositoryMock) AddRows(ctx *context.Context, day string, rows int64) error {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	u.rows[tenant+"/"+day] += rows
+	return nil
+}
+
+func (u *usageRepositoryMock) ReserveRows(ctx *context.Context, day string, rows, limit int64) (bool, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	if u.rows[tenant+"/"+day]+rows > limit {
+		return false, nil
+	}
+	u.rows[tenant+"/"+day] += rows
+	return true, nil
+}
+
+func (u *usageRepositoryMock) FindByDay(ctx *context.Context, day string) (*domain.Usage, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	return &domain.Usage{TenantId: tenant, Day: day, Rows: u.rows[tenant+"/"+day]}, nil
+}
+
+func NewEncryptionKeyRepositoryMock() *encryptionKeyRepositoryMock {
+	return &encryptionKeyRepositoryMock{keys: make(map[string]*domain.EncryptionKey)}
+}
+
+// encryptionKeyRepositoryMock keeps the first key stored by each tenant for
+// each purpose.
+type encryptionKeyRepositoryMock struct {
+	keys map[string]*domain.EncryptionKey
+}
+
+func (e *encryptionKeyRepositoryMock) FindOrCreate(ctx *context.Context, key *domain.EncryptionKey) (*domain.EncryptionKey, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	if stored, ok := e.keys[tenant+"/"+key.Purpose]; ok {
+		return stored, nil
+	}
+	key.ID = primitive.NewObjectID()
+	e.keys[tenant+"/"+key.Purpose] = key
+	return key, nil
+}
+
+func NewSuppressionRepositoryMock() *suppressionRepositoryMock {
+	return &suppressionRepositoryMock{suppressions: make(map[string]*domain.Suppression)}
+}
+
+// suppressionRepositoryMock keeps the suppressions by tenant and hash.
+type suppressionRepositoryMock struct {
+	suppressions map[string]*domain.Suppression
+}
+
+func (s *suppressionRepositoryMock) Create(ctx *context.Context, suppression *domain.Suppression) (*domain.Suppression, bool, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	if stored, ok := s.suppressions[tenant+"/"+suppression.Hash]; ok {
+		return stored, false, nil
+	}
+	suppression.ID = primitive.NewObjectID()
+	suppression.TenantId = tenant
+	s.suppressions[tenant+"/"+suppression.Hash] = suppression
+	return suppression, true, nil
+}
+
+func (s *suppressionRepositoryMock) CreateMany(ctx *context.Context, suppressions []*domain.Suppression) (int64, error) {
+	var created int64
+	for _, suppression := range suppressions {
+		if _, ok, _ := s.Create(ctx, suppression); ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (s *suppressionRepositoryMock) FindById(ctx *context.Context, id string) (*domain.Suppression, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	for _, suppression := range s.suppressions {
+		if suppression.TenantId == tenant && suppression.ID.Hex() == id {
+			return suppression, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *suppressionRepositoryMock) FindAll(ctx *context.Context, filter *domain.SuppressionFilter) ([]*domain.Suppression, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	found := make([]*domain.Suppression, 0)
+	for _, suppression := range s.suppressions {
+		if suppression.TenantId != tenant ||
+			(filter.Kind != "" && suppression.Kind != filter.Kind) ||
+			(len(filter.Hashes) > 0 && !slices.Contains(filter.Hashes, suppression.Hash)) ||
+			(filter.Reason != "" && suppression.Reason != filter.Reason) ||
+			(!filter.After.IsZero() && suppression.ID.Hex() >= filter.After.Hex()) {
+			continue
+		}
+		found = append(found, suppression)
+	}
+	slices.SortFunc(found, func(a, b *domain.Suppression) int { return strings.Compare(b.ID.Hex(), a.ID.Hex()) })
+	if filter.Limit > 0 && int64(len(found)) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+	return found, nil
+}
+
+func (s *suppressionRepositoryMock) FindSuppressed(ctx *context.Context, hashes []string) (map[string]bool, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	suppressed := make(map[string]bool)
+	for _, hash := range hashes {
+		if _, ok := s.suppressions[tenant+"/"+hash]; ok {
+			suppressed[hash] = true
+		}
+	}
+	return suppressed, nil
+}
+
+func (s *suppressionRepositoryMock) Delete(ctx *context.Context, id string) error {
+	suppression, err := s.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	delete(s.suppressions, suppression.TenantId+"/"+suppression.Hash)
+	return nil
+}
+
+func NewErasureRepositoryMock() *erasureRepositoryMock {
+	return &erasureRepositoryMock{}
+}
+
+type erasureRepositoryMock struct {
+	erasures []*domain.Erasure
+}
+
+func (e *erasureRepositoryMock) Create(_ *context.Context, erasure *domain.Erasure) error {
+	erasure.ID = primitive.NewObjectID()
+	e.erasures = append(e.erasures, erasure)
+	return nil
+}
+
+func NewTenantRepositoryMock(tenants ...string) *tenantRepositoryMock {
+	return &tenantRepositoryMock{tenants: tenants}
+}
+
+type tenantRepositoryMock struct {
+	tenants []string
+}
+
+func (t *tenantRepositoryMock) FindAll(_ *context.Context) ([]string, error) {
+	return t.tenants, nil
+}
+
+func NewAuditRepositoryMock() *auditRepositoryMock {
+	return &auditRepositoryMock{}
+}
+
+// auditRepositoryMock keeps the entries in the order they were appended. The
+// next staleReads reads of the last chained entry miss the newest one, as if
+// another writer appended it in between.
+type auditRepositoryMock struct {
+	entries    []*domain.AuditEntry
+	staleReads int
+}
+
+func (a *auditRepositoryMock) Create(ctx *context.Context, entry *domain.AuditEntry) error {
+	for _, stored := range a.entries {
+		if entry.Seq != 0 && stored.TenantId == entry.TenantId && stored.Seq == entry.Seq {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+	entry.ID = primitive.NewObjectID()
+	a.entries = append(a.entries, entry)
+	return nil
+}
+
+func (a *auditRepositoryMock) FindLastChained(ctx *context.Context) (*domain.AuditEntry, error) {
+	chained, _ := a.FindChained(ctx, 0, 0)
+	if a.staleReads > 0 && len(chained) > 0 {
+		a.staleReads--
+		chained = chained[:len(chained)-1]
+	}
+	if len(chained) == 0 {
+		return nil, nil
+	}
+	return chained[len(chained)-1], nil
+}
+
+func (a *auditRepositoryMock) FindChained(ctx *context.Context, afterSeq int64, limit int64) ([]*domain.AuditEntry, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	var chained []*domain.AuditEntry
+	for _, entry := range a.entries {
+		if entry.TenantId == tenant && entry.Seq > afterSeq {
+			chained = append(chained, entry)
+		}
+	}
+	sort.Slice(chained, func(i, j int) bool { return chained[i].Seq < chained[j].Seq })
+	if limit > 0 && int64(len(chained)) > limit {
+		chained = chained[:limit]
+	}
+	return chained, nil
+}
+
+func (a *auditRepositoryMock) FindAll(ctx *context.Context, filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	tenant, _ := domain.TenantFromContext(*ctx)
+	var entries []*domain.AuditEntry
+	for i := len(a.entries) - 1; i >= 0; i-- {
+		entry := a.entries[i]
+		if entry.TenantId != tenant ||
+			filter.Actor != "" && entry.Actor != filter.Actor ||
+			filter.Action != "" && entry.Action != filter.Action ||
+			filter.EntityType != "" && entry.EntityType != filter.EntityType ||
+			filter.EntityId != "" && entry.EntityId != filter.EntityId ||
+			filter.RequestId != "" && entry.RequestId != filter.RequestId {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/messaging"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	EventTypeHeader = "event-type"
+	SchemaIdHeader  = "schema-id"
+)
+
+// OutboxOptions configures the broker topics and the relay. Events go to
+// Topic, where {schema_id} is replaced by the ID of the schema, unless Topics
+// names another topic for the schema. A failed publish is retried after
+// Backoff, doubling up to MaxBackoff, until the message is dead after
+// MaxAttempts attempts, and a claimed message is left alone by other relays
+// for Lease.
+type OutboxOptions struct {
+	Topic       string
+	Topics      map[string]string
+	Lease       time.Duration
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+// OutboxService publishes lead and import events to a message broker. Events
+// are first stored in the outbox and then relayed in order, so none is lost
+// while the broker is unavailable.
+type OutboxService struct {
+	OutboxRepository repositories.OutboxRepository
+	Publisher        messaging.EventPublisher
+	Options          OutboxOptions
+}
+
+func NewOutboxService(or repositories.OutboxRepository, publisher messaging.EventPublisher, opts OutboxOptions) *OutboxService {
+	return &OutboxService{
+		OutboxRepository: or,
+		Publisher:        publisher,
+		Options:          opts,
+	}
+}
+
+// Wants reports true for every event, as every event is published.
+func (ob *OutboxService) Wants(_ *context.Context, _ primitive.ObjectID, _ string) (bool, error) {
+	return true, nil
+}
+
+// Notify stores the records of the event in the outbox. A lead.created event
+// becomes one record per lead, keyed by the lead ID, and the other events a
+// single record keyed by the import ID.
+func (ob *OutboxService) Notify(ctx *context.Context, event *domain.Event) error {
+	records, err := outboxRecords(event)
+	if err != nil {
+		return err
+	}
+
+	return ob.OutboxRepository.Create(ctx, domain.NewOutboxMessage(event, ob.topic(event.SchemaId), records))
+}
+
+// RelayPending publishes the pending messages in order and returns how many
+// were published. It stops at the first message that fails, which is retried
+// on a later run, unless that message ran out of attempts and is dead, which
+// lets the later messages through.
+func (ob *OutboxService) RelayPending(ctx *context.Context) (int, error) {
+	published := 0
+	for (*ctx).Err() == nil {
+		message, err := ob.OutboxRepository.ClaimNext(ctx, time.Now(), ob.Options.Lease)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return published, err
+		}
+
+		publishErr := ob.Publisher.Publish(ctx, message.Topic, outboxMessages(message))
+		if publishErr != nil {
+			message.Fail(publishErr, ob.Options.MaxAttempts, ob.backoff(message.Attempts))
+		} else {
+			message.Publish()
+		}
+
+		if err := ob.OutboxRepository.Update(ctx, message); err != nil {
+			return published, err
+		}
+		if message.Status == domain.OutboxStatusDead {
+			log.Printf("Gave up publishing event %s after %d attempts: %s", message.EventId.Hex(), message.Attempts, publishErr)
+			continue
+		}
+		if publishErr != nil {
+			return published, publishErr
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+func (ob *OutboxService) RunRelay(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			published, err := ob.RelayPending(ctx)
+			if err != nil {
+				log.Println("Failed to publish events: ", err)
+			}
+			if published > 0 {
+				log.Printf("Published %d events", published)
+			}
+		}
+	}
+}
+
+func (ob *OutboxService) topic(schemaId primitive.ObjectID) string {
+	if topic, ok := ob.Options.Topics[schemaId.Hex()]; ok {
+		return topic
+	}
+	return strings.ReplaceAll(ob.Options.Topic, "{schema_id}", schemaId.Hex())
+}
+
+// backoff is how long to wait after the given number of earlier attempts.
+func (ob *OutboxService) backoff(attempts int) time.Duration {
+	delay := ob.Options.Backoff
+	for range attempts {
+		delay *= 2
+		if delay >= ob.Options.MaxBackoff {
+			return ob.Options.MaxBackoff
+		}
+	}
+	return delay
+}
+
+func outboxRecords(event *domain.Event) ([]domain.OutboxRecord, error) {
+	if data, ok := event.Data.(domain.LeadsCreatedData); ok {
+		records := make([]domain.OutboxRecord, 0, len(data.Leads))
+		for _, lead := range data.Leads {
+			leadEvent := domain.NewEvent(event.Type, event.SchemaId, domain.LeadCreatedData{ImportId: data.ImportId, Lead: lead})
+			record, err := outboxRecord(leadEvent, leadKey(lead))
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+
+	key := ""
+	if data, ok := event.Data.(domain.ImportEventData); ok {
+		key = data.ImportId.Hex()
+	}
+	record, err := outboxRecord(event, key)
+	if err != nil {
+		return nil, err
+	}
+	return []domain.OutboxRecord{record}, nil
+}
+
+func outboxRecord(event *domain.Event, key string) (domain.OutboxRecord, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return domain.OutboxRecord{}, err
+	}
+
+	return domain.OutboxRecord{ID: event.ID.Hex(), Key: key, Value: string(value)}, nil
+}
+
+func outboxMessages(message *domain.OutboxMessage) []messaging.Message {
+	messages := make([]messaging.Message, 0, len(message.Records))
+	for _, record := range message.Records {
+		messages = append(messages, messaging.Message{
+			ID:    record.ID,
+			Key:   record.Key,
+			Value: []byte(record.Value),
+			Headers: map[string]string{
+				EventTypeHeader: message.Event,
+				SchemaIdHeader:  message.SchemaId.Hex(),
+			},
+		})
+	}
+	return messages
+}
+
+func leadKey(lead primitive.M) string {
+	if id, ok := lead["_id"].(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/messaging"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOutboxService(t *testing.T) {
+	ctx := context.Background()
+	schemaId := primitive.NewObjectID()
+	topic := "leads." + schemaId.Hex()
+
+	newService := func() (*OutboxService, *outboxRepositoryMock, *messaging.MemoryPublisher) {
+		outboxRepository := NewOutboxRepositoryMock()
+		publisher := messaging.NewMemoryPublisher()
+		return NewOutboxService(outboxRepository, publisher, OutboxOptions{
+			Topic:       "leads.{schema_id}",
+			Lease:       time.Minute,
+			Backoff:     time.Second,
+			MaxBackoff:  time.Minute,
+			MaxAttempts: 3,
+		}), outboxRepository, publisher
+	}
+
+	leadsEvent := func(emails ...string) *domain.Event {
+		leads := make([]primitive.M, 0, len(emails))
+		for _, email := range emails {
+			leads = append(leads, primitive.M{"_id": primitive.NewObjectID(), "email": email})
+		}
+		importId := primitive.NewObjectID()
+		return domain.NewEvent(domain.EventLeadCreated, schemaId, domain.LeadsCreatedData{ImportId: &importId, Leads: leads})
+	}
+
+	_ = t.Run("success, each lead is published in order", func(t *testing.T) {
+		// arrange
+		service, outboxRepository, publisher := newService()
+		imp := &domain.Import{ID: primitive.NewObjectID(), SchemaId: schemaId, Status: domain.ImportStatusCompleted}
+		err := errors.Join(
+			service.Notify(&ctx, leadsEvent("a@test.com", "b@test.com")),
+			service.Notify(&ctx, domain.NewImportEvent(imp)),
+		)
+		if err != nil {
+			t.Fatal("Failed to notify events:", err)
+		}
+
+		// act
+		published, err := service.RelayPending(&ctx)
+
+		// assert
+		messages := publisher.Messages(topic)
+		if assert.NoError(t, err) && assert.Len(t, messages, 3) {
+			var lead struct {
+				Type string `json:"type"`
+				Data struct {
+					Lead map[string]any `json:"lead"`
+				} `json:"data"`
+			}
+			_ = json.Unmarshal(messages[0].Value, &lead)
+			_ = assert.Equal(t, 2, published)
+			_ = assert.Equal(t, domain.EventLeadCreated, lead.Type)
+			_ = assert.Equal(t, "a@test.com", lead.Data.Lead["email"])
+			_ = assert.Equal(t, lead.Data.Lead["_id"], messages[0].Key)
+			_ = assert.Equal(t, imp.ID.Hex(), messages[2].Key)
+			_ = assert.Equal(t, domain.EventImportCompleted, messages[2].Headers[EventTypeHeader])
+			_ = assert.Equal(t, domain.OutboxStatusPublished, outboxRepository.messages[1].Status)
+		}
+	})
+
+	_ = t.Run("success, events are kept while the broker is down", func(t *testing.T) {
+		// arrange
+		service, outboxRepository, publisher := newService()
+		publisher.SetErr(errors.New("broker unavailable"))
+		err := errors.Join(
+			service.Notify(&ctx, leadsEvent("a@test.com")),
+			service.Notify(&ctx, leadsEvent("b@test.com")),
+		)
+		if err != nil {
+			t.Fatal("Failed to notify events:", err)
+		}
+
+		// act
+		_, failedErr := service.RelayPending(&ctx)
+		blocked, blockedErr := service.RelayPending(&ctx)
+		publisher.SetErr(nil)
+		outboxRepository.messages[0].NextAttemptAt = primitive.NewDateTimeFromTime(time.Now())
+		published, err := service.RelayPending(&ctx)
+
+		// assert
+		_ = assert.EqualError(t, failedErr, "broker unavailable")
+		_ = assert.NoError(t, blockedErr)
+		_ = assert.Zero(t, blocked)
+		if assert.NoError(t, err) {
+			messages := publisher.Messages(topic)
+			_ = assert.Equal(t, 2, published)
+			_ = assert.Len(t, messages, 2)
+			_ = assert.Contains(t, string(messages[0].Value), "a@test.com")
+			_ = assert.Equal(t, 2, outboxRepository.messages[0].Attempts)
+		}
+	})
+
+	_ = t.Run("success, a message that keeps failing is dead and the later ones go on", func(t *testing.T) {
+		// arrange
+		service, outboxRepository, publisher := newService()
+		publisher.SetErr(errors.New("message too large"))
+		err := errors.Join(
+			service.Notify(&ctx, leadsEvent("a@test.com")),
+			service.Notify(&ctx, leadsEvent("b@test.com")),
+		)
+		if err != nil {
+			t.Fatal("Failed to notify events:", err)
+		}
+		for range 3 {
+			outboxRepository.messages[0].NextAttemptAt = primitive.NewDateTimeFromTime(time.Now())
+			_, _ = service.RelayPending(&ctx)
+		}
+		publisher.SetErr(nil)
+		outboxRepository.messages[1].NextAttemptAt = primitive.NewDateTimeFromTime(time.Now())
+
+		// act
+		published, err := service.RelayPending(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			messages := publisher.Messages(topic)
+			_ = assert.Equal(t, 1, published)
+			_ = assert.Equal(t, domain.OutboxStatusDead, outboxRepository.messages[0].Status)
+			_ = assert.Equal(t, 3, outboxRepository.messages[0].Attempts)
+			_ = assert.Equal(t, "message too large", outboxRepository.messages[0].LastError)
+			if assert.Len(t, messages, 1) {
+				_ = assert.Contains(t, string(messages[0].Value), "b@test.com")
+			}
+		}
+	})
+
+	_ = t.Run("success, schemas can have their own topic", func(t *testing.T) {
+		// arrange
+		service, _, publisher := newService()
+		service.Options.Topics = map[string]string{schemaId.Hex(): "leads.vendor-a"}
+		err := service.Notify(&ctx, leadsEvent("a@test.com"))
+		if err != nil {
+			t.Fatal("Failed to notify event:", err)
+		}
+
+		// act
+		_, err = service.RelayPending(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Len(t, publisher.Messages("leads.vendor-a"), 1)
+			_ = assert.Empty(t, publisher.Messages(topic))
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+// newPublicClient returns the client the servers named by tenants, such as
+// import sources and webhooks, are reached with. It dials them directly, never
+// through a proxy, so the address it checks is the one it connects to, and
+// refuses addresses that are not public unless allowPrivateNetworks is set.
+// Redirects are only followed to HTTPS URLs, failing with redirectErr
+// otherwise. Certificates are verified against rootCAs, the roots of the
+// system when nil.
+func newPublicClient(timeout time.Duration, allowPrivateNetworks bool, rootCAs *x509.CertPool, redirectErr error) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if !allowPrivateNetworks {
+		dialer.Control = denyPrivateAddress
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return redirectErr
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// denyPrivateAddress refuses to connect to the address a host name resolved
+// to when it is loopback, link-local, private or otherwise not public, so a
+// tenant can not reach the internal network of the service.
+func denyPrivateAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", domain.ErrRemoteAddressDenied, host)
+	}
+
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, not reachable from the
+// internet either.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
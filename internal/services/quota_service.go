@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// importRetryAfter is when a caller stopped by the concurrent imports of
+	// its tenant is told to retry, as when they finish is not known.
+	importRetryAfter = 30 * time.Second
+
+	// limiterPruneInterval is how often the request buckets that refilled
+	// completely are dropped, as they are no different from new ones.
+	limiterPruneInterval = time.Minute
+)
+
+// QuotaOptions configures the limits. Defaults applies to the tenants that
+// Tenants does not list. Requests are limited per caller, or per tenant when
+// RateByTenant is set. Imports still processing that neither started nor saved
+// their progress within StaleImportAfter are no longer counted as running.
+type QuotaOptions struct {
+	Defaults         domain.Limits
+	Tenants          map[string]domain.Limits
+	RateByTenant     bool
+	StaleImportAfter time.Duration
+}
+
+// QuotaService enforces the request rate and the ingestion quotas of the
+// tenants. The request buckets are kept by each instance of the service, while
+// the quotas are counted in the database and shared by every instance.
+type QuotaService struct {
+	UsageRepository  repositories.UsageRepository
+	ImportRepository repositories.ImportRepository
+	Options          QuotaOptions
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	prunedAt time.Time
+}
+
+func NewQuotaService(ur repositories.UsageRepository, ir repositories.ImportRepository, opts QuotaOptions) *QuotaService {
+	return &QuotaService{
+		UsageRepository:  ur,
+		ImportRepository: ir,
+		Options:          opts,
+		limiters:         make(map[string]*rate.Limiter),
+	}
+}
+
+// LimitsOf returns the limits of the tenant.
+func (qs *QuotaService) LimitsOf(tenant string) domain.Limits {
+	if limits, ok := qs.Options.Tenants[tenant]; ok {
+		return limits
+	}
+	return qs.Options.Defaults
+}
+
+// AllowRequest takes a request from the bucket of the caller, or of its
+// tenant, and fails with ErrRateLimited when it is empty. Requests without a
+// caller, as when auth is disabled, share the bucket of their client address.
+func (qs *QuotaService) AllowRequest(ctx *context.Context, client string) error {
+	tenant := tenantOfContext(ctx)
+	limits := qs.LimitsOf(tenant)
+	if limits.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	reservation := qs.limiter(qs.bucketOf(ctx, tenant, client), limits, now).ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return &domain.LimitError{Err: domain.ErrRateLimited, RetryAfter: delay}
+	}
+
+	return nil
+}
+
+// CheckFileSize fails with ErrUploadSizeExceeded when the tenant can not
+// upload a file of the given size.
+func (qs *QuotaService) CheckFileSize(ctx *context.Context, size int64) error {
+	limits := qs.LimitsOf(tenantOfContext(ctx))
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return domain.ErrUploadSizeExceeded
+	}
+	return nil
+}
+
+// StartImport checks that the tenant can run the import it just recorded and
+// returns how many leads it can still ingest today, zero meaning no limit. It
+// fails with ErrQuotaExceeded when the tenant runs too many imports already
+// or used up its leads of the day. Only the imports recorded before it are
+// counted, so of the imports started at once the latest are refused rather
+// than all of them, or none.
+func (qs *QuotaService) StartImport(ctx *context.Context, imp *domain.Import) (int64, error) {
+	limits := qs.LimitsOf(tenantOfContext(ctx))
+	now := time.Now()
+
+	if limits.MaxConcurrentImports > 0 {
+		running, err := qs.ImportRepository.CountProcessingBefore(ctx, imp.ID, now.Add(-qs.Options.StaleImportAfter))
+		if err != nil {
+			return 0, err
+		}
+		if running >= int64(limits.MaxConcurrentImports) {
+			return 0, &domain.LimitError{Err: domain.ErrQuotaExceeded, RetryAfter: importRetryAfter}
+		}
+	}
+
+	return qs.remainingRows(ctx, limits, now)
+}
+
+// RowReservation is the leads counted towards the usage of a day before they
+// are written, to be given back with ReleaseRows when they are not.
+type RowReservation struct {
+	day  string
+	rows int64
+}
+
+// ReserveRows counts the leads towards the usage of the day before they are
+// written, and fails with ErrQuotaExceeded when the tenant does not have
+// that many leads left today.
+func (qs *QuotaService) ReserveRows(ctx *context.Context, rows int) (*RowReservation, error) {
+	if rows <= 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	reservation := &RowReservation{day: domain.UsageDay(now), rows: int64(rows)}
+
+	limit := qs.LimitsOf(tenantOfContext(ctx)).MaxRowsPerDay
+	if limit <= 0 {
+		if err := qs.UsageRepository.AddRows(ctx, reservation.day, reservation.rows); err != nil {
+			return nil, err
+		}
+		return reservation, nil
+	}
+
+	reserved, err := qs.UsageRepository.ReserveRows(ctx, reservation.day, reservation.rows, limit)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		return nil, dailyRowsExceeded(now)
+	}
+
+	return reservation, nil
+}
+
+// ReleaseRows gives back the leads reserved for writes that failed.
+func (qs *QuotaService) ReleaseRows(ctx *context.Context, reservation *RowReservation) error {
+	if reservation == nil {
+		return nil
+	}
+	return qs.UsageRepository.AddRows(ctx, reservation.day, -reservation.rows)
+}
+
+// Usage returns what the tenant of the context used of its limits.
+func (qs *QuotaService) Usage(ctx *context.Context) (*domain.TenantUsage, error) {
+	tenant := tenantOfContext(ctx)
+	now := time.Now()
+
+	usage, err := qs.UsageRepository.FindByDay(ctx, domain.UsageDay(now))
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := qs.ImportRepository.CountProcessing(ctx, now.Add(-qs.Options.StaleImportAfter))
+	if err != nil {
+		return nil, err
+	}
+
+	limits := qs.LimitsOf(tenant)
+	report := &domain.TenantUsage{
+		Tenant:         tenant,
+		Limits:         limits,
+		Day:            usage.Day,
+		Rows:           usage.Rows,
+		ResetsAt:       domain.NextUsageDay(now),
+		RunningImports: running,
+	}
+	if bucket, ok := qs.callerBucket(ctx, tenant); ok && limits.RequestsPerSecond > 0 {
+		available := qs.limiter(bucket, limits, now).TokensAt(now)
+		report.RequestsAvailable = &available
+	}
+
+	return report, nil
+}
+
+func (qs *QuotaService) bucketOf(ctx *context.Context, tenant, client string) string {
+	if bucket, ok := qs.callerBucket(ctx, tenant); ok {
+		return bucket
+	}
+	return "client:" + client
+}
+
+// callerBucket returns the bucket of the tenant, or of the caller when
+// requests are limited per caller, which is only known once authenticated.
+func (qs *QuotaService) callerBucket(ctx *context.Context, tenant string) (string, bool) {
+	if qs.Options.RateByTenant {
+		return "tenant:" + tenant, true
+	}
+	if principal, ok := domain.PrincipalFromContext(*ctx); ok {
+		return "caller:" + tenant + "/" + principal.Subject, true
+	}
+	return "", false
+}
+
+// limiter returns the bucket, created full, and drops from time to time the
+// buckets that are full again.
+func (qs *QuotaService) limiter(bucket string, limits domain.Limits, now time.Time) *rate.Limiter {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	if now.Sub(qs.prunedAt) >= limiterPruneInterval {
+		for name, limiter := range qs.limiters {
+			if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+				delete(qs.limiters, name)
+			}
+		}
+		qs.prunedAt = now
+	}
+
+	limiter, ok := qs.limiters[bucket]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limits.RequestsPerSecond), max(limits.Burst, 1))
+		qs.limiters[bucket] = limiter
+	}
+	return limiter
+}
+
+// remainingRows returns how many leads the tenant can still ingest today,
+// zero meaning no limit.
+func (qs *QuotaService) remainingRows(ctx *context.Context, limits domain.Limits, now time.Time) (int64, error) {
+	if limits.MaxRowsPerDay <= 0 {
+		return 0, nil
+	}
+
+	usage, err := qs.UsageRepository.FindByDay(ctx, domain.UsageDay(now))
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := limits.MaxRowsPerDay - usage.Rows
+	if remaining <= 0 {
+		return 0, dailyRowsExceeded(now)
+	}
+
+	return remaining, nil
+}
+
+// dailyRowsExceeded is the error of a tenant that used up its leads of the
+// day, which it can retry once the day is over.
+func dailyRowsExceeded(now time.Time) error {
+	return &domain.LimitError{Err: domain.ErrQuotaExceeded, RetryAfter: domain.NextUsageDay(now).Sub(now)}
+}
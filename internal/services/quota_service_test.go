@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQuotaService_AllowRequest(t *testing.T) {
+	ctx := context.Background()
+	limits := domain.Limits{RequestsPerSecond: 1, Burst: 2}
+
+	callerCtx := func(tenant, subject string) context.Context {
+		principal := &domain.Principal{Subject: subject, Tenant: tenant}
+		return principal.Context(ctx)
+	}
+
+	_ = t.Run("each caller has its own bucket", func(t *testing.T) {
+		// arrange
+		service := NewQuotaService(NewUsageRepositoryMock(), NewImportRepositoryMock(), QuotaOptions{Defaults: limits})
+		first, second := callerCtx("acme", "api-key:1"), callerCtx("acme", "api-key:2")
+
+		// act
+		errs := []error{service.AllowRequest(&first, ""), service.AllowRequest(&first, ""), service.AllowRequest(&first, "")}
+		otherErr := service.AllowRequest(&second, "")
+
+		// assert
+		_ = assert.NoError(t, errs[0])
+		_ = assert.NoError(t, errs[1])
+		_ = assert.ErrorIs(t, errs[2], domain.ErrRateLimited)
+		var limitErr *domain.LimitError
+		if assert.ErrorAs(t, errs[2], &limitErr) {
+			_ = assert.Greater(t, limitErr.RetryAfter, time.Duration(0))
+			_ = assert.LessOrEqual(t, limitErr.RetryAfter, time.Second)
+		}
+		_ = assert.NoError(t, otherErr)
+	})
+
+	_ = t.Run("the callers of a tenant share its bucket", func(t *testing.T) {
+		// arrange
+		service := NewQuotaService(NewUsageRepositoryMock(), NewImportRepositoryMock(), QuotaOptions{Defaults: limits, RateByTenant: true})
+		first, second := callerCtx("acme", "api-key:1"), callerCtx("acme", "api-key:2")
+
+		// act
+		firstErr := service.AllowRequest(&first, "")
+		secondErr := service.AllowRequest(&second, "")
+		thirdErr := service.AllowRequest(&first, "")
+
+		// assert
+		_ = assert.NoError(t, firstErr)
+		_ = assert.NoError(t, secondErr)
+		_ = assert.ErrorIs(t, thirdErr, domain.ErrRateLimited)
+	})
+
+	_ = t.Run("tenant overrides", func(t *testing.T) {
+		// arrange
+		service := NewQuotaService(NewUsageRepositoryMock(), NewImportRepositoryMock(), QuotaOptions{
+			Defaults: limits,
+			Tenants:  map[string]domain.Limits{"acme": {}},
+		})
+		unlimited := callerCtx("acme", "api-key:1")
+
+		// act
+		var errs []error
+		for range 5 {
+			errs = append(errs, service.AllowRequest(&unlimited, ""))
+		}
+
+		// assert
+		for _, err := range errs {
+			_ = assert.NoError(t, err)
+		}
+	})
+}
+
+func TestQuotaService_StartImport(t *testing.T) {
+	ctx := domain.ContextWithTenant(context.Background(), "acme")
+
+	_ = t.Run("leads left today", func(t *testing.T) {
+		// arrange
+		usageRepository := NewUsageRepositoryMock()
+		service := NewQuotaService(usageRepository, NewImportRepositoryMock(), QuotaOptions{Defaults: domain.Limits{MaxRowsPerDay: 10}})
+		_, _ = service.ReserveRows(&ctx, 4)
+
+		// act
+		remaining, err := service.StartImport(&ctx, &domain.Import{ID: primitive.NewObjectID()})
+		_, _ = service.ReserveRows(&ctx, 6)
+		_, exceededErr := service.StartImport(&ctx, &domain.Import{ID: primitive.NewObjectID()})
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, int64(6), remaining)
+		}
+		_ = assert.ErrorIs(t, exceededErr, domain.ErrQuotaExceeded)
+		var limitErr *domain.LimitError
+		if assert.ErrorAs(t, exceededErr, &limitErr) {
+			_ = assert.LessOrEqual(t, limitErr.RetryAfter, 24*time.Hour)
+		}
+	})
+
+	_ = t.Run("imports running", func(t *testing.T) {
+		// arrange
+		running := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing, StartedAt: primitive.NewDateTimeFromTime(time.Now())}
+		stale := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing, StartedAt: primitive.NewDateTimeFromTime(time.Now().Add(-2 * time.Hour))}
+		service := NewQuotaService(NewUsageRepositoryMock(), NewImportRepositoryMock(running, stale), QuotaOptions{
+			Defaults:         domain.Limits{MaxConcurrentImports: 2},
+			Tenants:          map[string]domain.Limits{"globex": {MaxConcurrentImports: 1}},
+			StaleImportAfter: time.Hour,
+		})
+		other := domain.ContextWithTenant(ctx, "globex")
+
+		// act
+		_, allowedErr := service.StartImport(&ctx, &domain.Import{ID: primitive.NewObjectID()})
+		_, exceededErr := service.StartImport(&other, &domain.Import{ID: primitive.NewObjectID()})
+
+		// assert
+		_ = assert.NoError(t, allowedErr)
+		_ = assert.ErrorIs(t, exceededErr, domain.ErrQuotaExceeded)
+	})
+
+	_ = t.Run("imports recorded later are not counted", func(t *testing.T) {
+		// arrange
+		started := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing, StartedAt: primitive.NewDateTimeFromTime(time.Now())}
+		later := &domain.Import{ID: primitive.NewObjectID(), Status: domain.ImportStatusProcessing, StartedAt: primitive.NewDateTimeFromTime(time.Now())}
+		service := NewQuotaService(NewUsageRepositoryMock(), NewImportRepositoryMock(started, later), QuotaOptions{
+			Defaults:         domain.Limits{MaxConcurrentImports: 1},
+			StaleImportAfter: time.Hour,
+		})
+
+		// act
+		_, startedErr := service.StartImport(&ctx, started)
+		_, laterErr := service.StartImport(&ctx, later)
+
+		// assert
+		_ = assert.NoError(t, startedErr)
+		_ = assert.ErrorIs(t, laterErr, domain.ErrQuotaExceeded)
+	})
+}
+
+func TestQuotaService_ReserveRows(t *testing.T) {
+	ctx := domain.ContextWithTenant(context.Background(), "acme")
+	day := "acme/" + domain.UsageDay(time.Now())
+
+	_ = t.Run("leads over the quota are not reserved", func(t *testing.T) {
+		// arrange
+		usageRepository := NewUsageRepositoryMock()
+		service := NewQuotaService(usageRepository, NewImportRepositoryMock(), QuotaOptions{Defaults: domain.Limits{MaxRowsPerDay: 10}})
+
+		// act
+		reservation, err := service.ReserveRows(&ctx, 7)
+		_, exceededErr := service.ReserveRows(&ctx, 4)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.NotNil(t, reservation)
+		_ = assert.ErrorIs(t, exceededErr, domain.ErrQuotaExceeded)
+		_ = assert.Equal(t, int64(7), usageRepository.rows[day])
+	})
+
+	_ = t.Run("released leads can be reserved again", func(t *testing.T) {
+		// arrange
+		usageRepository := NewUsageRepositoryMock()
+		service := NewQuotaService(usageRepository, NewImportRepositoryMock(), QuotaOptions{Defaults: domain.Limits{MaxRowsPerDay: 10}})
+		reservation, _ := service.ReserveRows(&ctx, 7)
+
+		// act
+		releaseErr := service.ReleaseRows(&ctx, reservation)
+		_, err := service.ReserveRows(&ctx, 10)
+
+		// assert
+		_ = assert.NoError(t, releaseErr)
+		_ = assert.NoError(t, err)
+		_ = assert.Equal(t, int64(10), usageRepository.rows[day])
+	})
+}
+
+func TestFileService_Quotas(t *testing.T) {
+	ctx := domain.ContextWithTenant(context.Background(), "acme")
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+	content := "email,phone\na@test.com,1\nb@test.com,2\nc@test.com,3\n"
+
+	newService := func(limits domain.Limits) (*FileService, *leadRepositoryMock, *usageRepositoryMock) {
+		leadRepository := NewLeadRepositoryMock()
+		usageRepository := NewUsageRepositoryMock()
+		importRepository := NewImportRepositoryMock()
+		quotas := NewQuotaService(usageRepository, importRepository, QuotaOptions{Defaults: limits, StaleImportAfter: time.Hour})
+		return NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, importRepository, NewSuppressionRepositoryMock(), NewEventNotifierMock(), quotas, nil, nil,
+			IngestionOptions{BatchSize: 1}), leadRepository, usageRepository
+	}
+
+	_ = t.Run("success, the leads are counted", func(t *testing.T) {
+		// arrange
+		service, _, usageRepository := newService(domain.Limits{MaxRowsPerDay: 3})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imp.Status)
+			_ = assert.Equal(t, int64(3), usageRepository.rows["acme/"+domain.UsageDay(time.Now())])
+		}
+	})
+
+	_ = t.Run("a file over the leads left fails without leads", func(t *testing.T) {
+		// arrange
+		service, leadRepository, usageRepository := newService(domain.Limits{MaxRowsPerDay: 2})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.ErrorIs(t, err, domain.ErrQuotaExceeded) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imp.Status)
+			_ = assert.Empty(t, leadRepository.leads)
+			_ = assert.Empty(t, usageRepository.rows)
+		}
+	})
+
+	_ = t.Run("a failed import gives its leads back", func(t *testing.T) {
+		// arrange
+		service, leadRepository, usageRepository := newService(domain.Limits{MaxRowsPerDay: 3})
+		service.Notifier = &eventNotifierMock{failOn: domain.EventImportCompleted, failWith: assert.AnError}
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.ErrorIs(t, err, assert.AnError) {
+			_ = assert.Equal(t, domain.ImportStatusFailed, imp.Status)
+			_ = assert.Empty(t, leadRepository.leads)
+			_ = assert.Zero(t, usageRepository.rows["acme/"+domain.UsageDay(time.Now())])
+		}
+	})
+
+	_ = t.Run("an import over the running imports is not kept", func(t *testing.T) {
+		// arrange
+		service, leadRepository, _ := newService(domain.Limits{MaxConcurrentImports: 1})
+		importRepository := service.ImportRepository.(*importRepositoryMock)
+		running := &domain.Import{SchemaId: schema.ID, Status: domain.ImportStatusProcessing, StartedAt: primitive.NewDateTimeFromTime(time.Now())}
+		_ = importRepository.Create(&ctx, running)
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrQuotaExceeded)
+		_ = assert.Nil(t, imp)
+		_ = assert.Len(t, importRepository.imports, 1)
+		_ = assert.Empty(t, leadRepository.leads)
+	})
+
+	_ = t.Run("a file over the size limit is refused", func(t *testing.T) {
+		// arrange
+		service, _, _ := newService(domain.Limits{MaxFileSize: 10})
+
+		// act
+		imp, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrUploadSizeExceeded)
+		_ = assert.Nil(t, imp)
+	})
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+)
+
+// RetentionService purges the leads kept for longer than the retention of
+// their schema, in every tenant. Leads under legal hold are kept.
+type RetentionService struct {
+	TenantRepository repositories.TenantRepository
+	SchemaRepository repositories.SchemaRepository
+	LeadRepository   repositories.LeadRepository
+	Audit            *AuditService
+}
+
+func NewRetentionService(tr repositories.TenantRepository, sr repositories.SchemaRepository, lr repositories.LeadRepository, audit *AuditService) *RetentionService {
+	return &RetentionService{
+		TenantRepository: tr,
+		SchemaRepository: sr,
+		LeadRepository:   lr,
+		Audit:            audit,
+	}
+}
+
+// PurgeExpired deletes the leads past the retention of their schema at now,
+// returning how many were deleted. A schema that fails does not stop the
+// others, and its error is returned along with the count.
+func (rs *RetentionService) PurgeExpired(ctx *context.Context, now time.Time) (int64, error) {
+	tenants, err := rs.TenantRepository.FindAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	var errs []error
+	for _, tenant := range tenants {
+		tenantCtx := withTenant(ctx, tenant)
+
+		schemas, err := rs.SchemaRepository.FindWithRetention(tenantCtx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, schema := range schemas {
+			retention := schema.Retention
+			deleted, err := rs.LeadRepository.DeleteExpired(tenantCtx, schema.ID, retention.ExpiryField(), retention.Cutoff(now))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if deleted > 0 {
+				rs.Audit.Record(tenantCtx, domain.AuditActionLeadsPurged, domain.AuditEntitySchema, schema.ID.Hex(), nil,
+					map[string]interface{}{"retention_days": retention.Days, "leads_purged": deleted})
+				log.Printf("Purged %d leads of schema %s of tenant %s past their retention of %d days", deleted, schema.ID.Hex(), tenant, retention.Days)
+			}
+			purged += deleted
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+func (rs *RetentionService) RunPurge(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			purged, err := rs.PurgeExpired(ctx, time.Now())
+			if err != nil {
+				log.Println("Failed to purge expired leads: ", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d expired leads", purged)
+			}
+		}
+	}
+}
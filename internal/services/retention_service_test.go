@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRetentionService_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newLead := func(schemaId primitive.ObjectID, createdAt time.Time, signedUpAt time.Time) *bson.D {
+		return &bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "schema_id", Value: schemaId},
+			{Key: "signed_up_at", Value: signedUpAt.Unix()},
+			{Key: "created_at", Value: primitive.NewDateTimeFromTime(createdAt)},
+		}
+	}
+
+	newService := func(schema *domain.Schema, leads ...*bson.D) (*RetentionService, *leadRepositoryMock) {
+		leadRepository := NewLeadRepositoryMock()
+		leadRepository.leads = leads
+		return NewRetentionService(NewTenantRepositoryMock(domain.DefaultTenant), NewSchemaRepositoryMockWithSchema(schema), leadRepository, nil), leadRepository
+	}
+
+	_ = t.Run("success, counted from created_at", func(t *testing.T) {
+		// arrange
+		schema := &domain.Schema{ID: primitive.NewObjectID(), Retention: &domain.Retention{Days: 365}}
+		expired := newLead(schema.ID, now.AddDate(-2, 0, 0), now)
+		kept := newLead(schema.ID, now.AddDate(0, -6, 0), now.AddDate(-2, 0, 0))
+		otherSchema := newLead(primitive.NewObjectID(), now.AddDate(-2, 0, 0), now)
+		service, leadRepository := newService(schema, expired, kept, otherSchema)
+
+		// act
+		purged, err := service.PurgeExpired(&ctx, now)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Equal(t, int64(1), purged)
+		_ = assert.Equal(t, []*bson.D{kept, otherSchema}, leadRepository.leads)
+	})
+
+	_ = t.Run("success, counted from a datetime field", func(t *testing.T) {
+		// arrange
+		schema := &domain.Schema{ID: primitive.NewObjectID(), Retention: &domain.Retention{Days: 30, Field: "signed_up_at"}}
+		expired := newLead(schema.ID, now, now.AddDate(0, 0, -31))
+		kept := newLead(schema.ID, now.AddDate(-1, 0, 0), now.AddDate(0, 0, -29))
+		service, leadRepository := newService(schema, expired, kept)
+
+		// act
+		purged, err := service.PurgeExpired(&ctx, now)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Equal(t, int64(1), purged)
+		_ = assert.Equal(t, []*bson.D{kept}, leadRepository.leads)
+	})
+
+	_ = t.Run("success, leads under legal hold are kept", func(t *testing.T) {
+		// arrange
+		schema := &domain.Schema{ID: primitive.NewObjectID(), Retention: &domain.Retention{Days: 1}}
+		held := newLead(schema.ID, now.AddDate(-5, 0, 0), now)
+		service, leadRepository := newService(schema, held)
+		heldId := held.Map()["_id"].(primitive.ObjectID)
+		_ = leadRepository.SetLegalHold(&ctx, schema.ID, heldId, true)
+
+		// act
+		purged, err := service.PurgeExpired(&ctx, now)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Zero(t, purged)
+		_ = assert.Len(t, leadRepository.leads, 1)
+	})
+
+	_ = t.Run("success, schemas without retention are kept", func(t *testing.T) {
+		// arrange
+		schema := &domain.Schema{ID: primitive.NewObjectID()}
+		service, leadRepository := newService(schema, newLead(schema.ID, now.AddDate(-50, 0, 0), now))
+
+		// act
+		purged, err := service.PurgeExpired(&ctx, now)
+
+		// assert
+		_ = assert.NoError(t, err)
+		_ = assert.Zero(t, purged)
+		_ = assert.Len(t, leadRepository.leads, 1)
+	})
+}
@@ -7,13 +7,19 @@ import (
 	"github.com/vitortenor/lead-stream-service/internal/repositories"
 )
 
+// SchemaService creates schemas and sets their retention. Sensitive fields are only accepted when
+// Cipher is set, as their leads could not be stored otherwise.
 type SchemaService struct {
 	SchemaRepository repositories.SchemaRepository
+	Cipher           *LeadCipher
+	Audit            *AuditService
 }
 
-func NewSchemaService(sr repositories.SchemaRepository) *SchemaService {
+func NewSchemaService(sr repositories.SchemaRepository, cipher *LeadCipher, audit *AuditService) *SchemaService {
 	return &SchemaService{
 		SchemaRepository: sr,
+		Cipher:           cipher,
+		Audit:            audit,
 	}
 }
 
@@ -28,7 +34,7 @@ func (s *SchemaService) ValidateAndSave(ctx *context.Context, schema *domain.Sch
 		return nil, domain.ErrFieldsNotUnique
 	}
 
-	if !schema.ValidateCreatedAndUpdatedFields() {
+	if !schema.ValidateReservedFields() {
 		return nil, domain.ErrInvalidFieldValues
 	}
 
@@ -36,6 +42,14 @@ func (s *SchemaService) ValidateAndSave(ctx *context.Context, schema *domain.Sch
 		return nil, domain.ErrRequiredFieldsNotPresent
 	}
 
+	if schema.HasSensitiveFields() && s.Cipher == nil {
+		return nil, domain.ErrEncryptionDisabled
+	}
+
+	if !schema.ValidateRetention() {
+		return nil, domain.ErrInvalidRetention
+	}
+
 	err := s.SchemaRepository.Create(ctx, schema)
 	if err != nil {
 		return nil, err
@@ -46,5 +60,38 @@ func (s *SchemaService) ValidateAndSave(ctx *context.Context, schema *domain.Sch
 		return nil, err
 	}
 
+	s.Audit.Record(ctx, domain.AuditActionSchemaCreated, domain.AuditEntitySchema, schema.ID.Hex(), nil,
+		map[string]interface{}{"fields": schema.Fields, "retention": schema.Retention})
+
 	return schema, nil
 }
+
+// UpdateRetention sets how long the leads of the schema are kept, or keeps
+// them indefinitely when retention is nil.
+func (s *SchemaService) UpdateRetention(ctx *context.Context, id string, retention *domain.Retention) (*domain.Schema, error) {
+	schema, err := s.SchemaRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := schema.Retention
+	schema.Retention = retention
+	schema.Normalize()
+	if !schema.ValidateRetention() {
+		return nil, domain.ErrInvalidRetention
+	}
+
+	err = s.SchemaRepository.UpdateRetention(ctx, schema.ID, schema.Retention)
+	if err != nil {
+		return nil, err
+	}
+
+	action := domain.AuditActionSchemaRetentionSet
+	if schema.Retention == nil {
+		action = domain.AuditActionSchemaRetentionDeleted
+	}
+	s.Audit.Record(ctx, action, domain.AuditEntitySchema, id,
+		map[string]interface{}{"retention": before}, map[string]interface{}{"retention": schema.Retention})
+
+	return s.SchemaRepository.FindById(ctx, id)
+}
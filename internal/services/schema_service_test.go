@@ -11,7 +11,7 @@ import (
 
 func TestSchemaService_ValidateAndSave(t *testing.T) {
 	ctx := context.Background()
-	service := NewSchemaService(NewSchemaRepositoryMock())
+	service := NewSchemaService(NewSchemaRepositoryMock(), nil, nil)
 
 	_ = t.Run("success", func(t *testing.T) {
 		// arrange
@@ -192,4 +192,111 @@ func TestSchemaService_ValidateAndSave(t *testing.T) {
 		}
 	})
 
+	_ = t.Run("consent fields are reserved", func(t *testing.T) {
+		// arrange
+		schema := &domain.Schema{Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+			{Name: "Consent_Channel", Type: "string"},
+		}}
+
+		// act
+		_, err := service.ValidateAndSave(&ctx, schema)
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidFieldValues)
+	})
+
+	_ = t.Run("fields set by the service are reserved", func(t *testing.T) {
+		for _, name := range []string{"created_at", "import_id", "schema_id", "message_id"} {
+			// arrange
+			schema := &domain.Schema{Fields: []domain.SchemaField{
+				{Name: "email", Type: "string", Required: true, Unique: true},
+				{Name: "phone", Type: "integer", Required: true, Unique: true},
+				{Name: name, Type: "string"},
+			}}
+
+			// act
+			_, err := service.ValidateAndSave(&ctx, schema)
+
+			// assert
+			_ = assert.ErrorIs(t, err, domain.ErrInvalidFieldValues, name)
+		}
+	})
+
+	_ = t.Run("invalid retention", func(t *testing.T) {
+		// arrange
+		fields := []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+			{Name: "birthday", Type: "date"},
+		}
+		noDays := &domain.Schema{Fields: fields, Retention: &domain.Retention{}}
+		notDatetime := &domain.Schema{Fields: fields, Retention: &domain.Retention{Days: 30, Field: "birthday"}}
+		notField := &domain.Schema{Fields: fields, Retention: &domain.Retention{Days: 30, Field: "signed_up_at"}}
+
+		// act
+		_, noDaysErr := service.ValidateAndSave(&ctx, noDays)
+		_, notDatetimeErr := service.ValidateAndSave(&ctx, notDatetime)
+		_, notFieldErr := service.ValidateAndSave(&ctx, notField)
+
+		// assert
+		_ = assert.ErrorIs(t, noDaysErr, domain.ErrInvalidRetention)
+		_ = assert.ErrorIs(t, notDatetimeErr, domain.ErrInvalidRetention)
+		_ = assert.ErrorIs(t, notFieldErr, domain.ErrInvalidRetention)
+	})
+}
+
+func TestSchemaService_UpdateRetention(t *testing.T) {
+	ctx := context.Background()
+	newSchema := func() *domain.Schema {
+		return &domain.Schema{
+			ID: primitive.NewObjectID(),
+			Fields: []domain.SchemaField{
+				{Name: "email", Type: "string", Required: true, Unique: true},
+				{Name: "phone", Type: "integer", Required: true, Unique: true},
+				{Name: "signed_up_at", Type: "datetime"},
+			},
+		}
+	}
+
+	_ = t.Run("success, counted from a datetime field", func(t *testing.T) {
+		// arrange
+		schema := newSchema()
+		service := NewSchemaService(NewSchemaRepositoryMockWithSchema(schema), nil, nil)
+
+		// act
+		updated, err := service.UpdateRetention(&ctx, schema.ID.Hex(), &domain.Retention{Days: 365, Field: "Signed_Up_At"})
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, &domain.Retention{Days: 365, Field: "signed_up_at"}, updated.Retention)
+		}
+	})
+
+	_ = t.Run("success, removed", func(t *testing.T) {
+		// arrange
+		schema := newSchema()
+		schema.Retention = &domain.Retention{Days: 30}
+		service := NewSchemaService(NewSchemaRepositoryMockWithSchema(schema), nil, nil)
+
+		// act
+		updated, err := service.UpdateRetention(&ctx, schema.ID.Hex(), nil)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Nil(t, updated.Retention)
+		}
+	})
+
+	_ = t.Run("error, schema not found", func(t *testing.T) {
+		// arrange
+		service := NewSchemaService(NewSchemaRepositoryMockWithSchema(newSchema()), nil, nil)
+
+		// act
+		_, err := service.UpdateRetention(&ctx, primitive.NewObjectID().Hex(), &domain.Retention{Days: 30})
+
+		// assert
+		_ = assert.Error(t, err)
+	})
 }
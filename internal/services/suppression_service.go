@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// suppressionBatchSize is how many suppressions of an uploaded list are
+// written at once.
+const suppressionBatchSize = 1000
+
+// SuppressionService keeps the suppression list of the tenant, the emails and
+// phones whose leads are left out of every import.
+type SuppressionService struct {
+	SuppressionRepository repositories.SuppressionRepository
+	// Cipher keys the hashes of the list, which are unkeyed when nil.
+	Cipher *LeadCipher
+}
+
+func NewSuppressionService(spr repositories.SuppressionRepository, cipher *LeadCipher) *SuppressionService {
+	return &SuppressionService{
+		SuppressionRepository: spr,
+		Cipher:                cipher,
+	}
+}
+
+// SuppressionQuery is a query of the suppression list as received. Value is
+// an email or a phone of the Kind, which is looked up by its hash.
+type SuppressionQuery struct {
+	Kind   string
+	Value  string
+	Reason string
+	After  string
+	Limit  int64
+}
+
+// Create suppresses the email or phone value. A value suppressed already keeps
+// its suppression, which is returned with created false.
+func (ss *SuppressionService) Create(ctx *context.Context, kind, value, reason string) (*domain.Suppression, bool, error) {
+	hash, err := ss.Cipher.SuppressionHasher(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	suppression, err := domain.ParseSuppression(hash, kind, value, reason)
+	if err != nil {
+		return nil, false, err
+	}
+	suppression.CreatedBy = callerOf(ctx)
+
+	return ss.SuppressionRepository.Create(ctx, suppression)
+}
+
+// Import suppresses the emails and phones of a CSV with an email column, a
+// phone column or both. Rows without a valid value are rejected and counted
+// instead of failing the whole list.
+func (ss *SuppressionService) Import(ctx *context.Context, r io.Reader, reason string) (*domain.SuppressionImport, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, domain.ErrInvalidSuppression
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, header := range headers {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == domain.SuppressionKindEmail || header == domain.SuppressionKindPhone {
+			columns[header] = i
+		}
+	}
+	if len(columns) == 0 {
+		return nil, domain.ErrInvalidSuppression
+	}
+
+	hash, err := ss.Cipher.SuppressionHasher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.SuppressionImport{}
+	var batch []*domain.Suppression
+	seen := make(map[string]bool)
+	flush := func() error {
+		created, err := ss.SuppressionRepository.CreateMany(ctx, batch)
+		if err != nil {
+			return err
+		}
+		result.Suppressed += created
+		batch, seen = batch[:0], make(map[string]bool)
+		return nil
+	}
+
+	caller := callerOf(ctx)
+	values := int64(0)
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		result.RowsRead++
+
+		suppressions, ok := suppressionsOfRow(hash, record, columns, reason)
+		if !ok {
+			result.RowsRejected++
+			continue
+		}
+
+		for _, suppression := range suppressions {
+			values++
+			// a batch upserting the same hash twice would race with itself
+			if seen[suppression.Hash] {
+				continue
+			}
+			seen[suppression.Hash] = true
+			suppression.CreatedBy = caller
+			batch = append(batch, suppression)
+		}
+
+		if len(batch) >= suppressionBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	result.AlreadyListed = values - result.Suppressed
+	return result, nil
+}
+
+// suppressionsOfRow returns the suppressions of the email and phone of a row,
+// which is rejected when it holds neither or when one is not valid.
+func suppressionsOfRow(hash domain.SuppressionHasher, record []string, columns map[string]int, reason string) ([]*domain.Suppression, bool) {
+	var suppressions []*domain.Suppression
+	for kind, i := range columns {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+
+		suppression, err := domain.ParseSuppression(hash, kind, record[i], reason)
+		if err != nil {
+			return nil, false
+		}
+		suppressions = append(suppressions, suppression)
+	}
+	return suppressions, len(suppressions) > 0
+}
+
+func (ss *SuppressionService) FindById(ctx *context.Context, id string) (*domain.Suppression, error) {
+	return ss.SuppressionRepository.FindById(ctx, id)
+}
+
+func (ss *SuppressionService) List(ctx *context.Context, query SuppressionQuery) ([]*domain.Suppression, error) {
+	hash, err := ss.Cipher.SuppressionHasher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := suppressionFilterFromQuery(hash, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss.SuppressionRepository.FindAll(ctx, filter)
+}
+
+// Delete lifts the suppression, so the leads holding its email or phone are
+// imported again.
+func (ss *SuppressionService) Delete(ctx *context.Context, id string) error {
+	return ss.SuppressionRepository.Delete(ctx, id)
+}
+
+// suppressionFilterFromQuery hashes the value of the query the ways it may
+// have been hashed when suppressed, which requires its kind.
+func suppressionFilterFromQuery(hash domain.SuppressionHasher, query SuppressionQuery) (*domain.SuppressionFilter, error) {
+	filter := &domain.SuppressionFilter{Kind: query.Kind, Reason: query.Reason, Limit: query.Limit}
+
+	if query.Kind != "" && !slices.Contains(domain.SuppressionKinds, query.Kind) {
+		return nil, domain.ErrInvalidSuppression
+	}
+
+	if query.Value != "" {
+		normalized, err := domain.NormalizeSuppressed(query.Kind, query.Value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Hashes = domain.SuppressionHashes(hash, query.Kind, normalized)
+	}
+
+	if query.After != "" {
+		after, err := primitive.ObjectIDFromHex(query.After)
+		if err != nil {
+			return nil, domain.ErrInvalidSuppression
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSuppressionService(t *testing.T) {
+	ctx := domain.ContextWithPrincipal(domain.ContextWithTenant(context.Background(), "acme"),
+		&domain.Principal{Subject: "user-1", Method: domain.AuthMethodJWT})
+
+	_ = t.Run("success, the value is normalized and hashed", func(t *testing.T) {
+		// arrange
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), nil)
+
+		// act
+		suppression, created, err := service.Create(&ctx, domain.SuppressionKindEmail, " Jane@Test.com ", "")
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.True(t, created)
+			_ = assert.Equal(t, domain.UnkeyedSuppressionHash(domain.SuppressionKindEmail, "jane@test.com"), suppression.Hash)
+			_ = assert.Equal(t, domain.SuppressionReasonOptOut, suppression.Reason)
+			_ = assert.Equal(t, "user-1", suppression.CreatedBy)
+		}
+	})
+
+	_ = t.Run("a value suppressed already keeps its suppression", func(t *testing.T) {
+		// arrange
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), nil)
+		first, _, _ := service.Create(&ctx, domain.SuppressionKindPhone, "+55 11 999", domain.SuppressionReasonBounce)
+
+		// act
+		second, created, err := service.Create(&ctx, domain.SuppressionKindPhone, "5511999", domain.SuppressionReasonComplaint)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.False(t, created)
+			_ = assert.Equal(t, first.ID, second.ID)
+			_ = assert.Equal(t, domain.SuppressionReasonBounce, second.Reason)
+		}
+	})
+
+	_ = t.Run("invalid suppression", func(t *testing.T) {
+		// arrange
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), nil)
+
+		// act
+		_, _, kindErr := service.Create(&ctx, "address", "Main Street", "")
+		_, _, valueErr := service.Create(&ctx, domain.SuppressionKindPhone, "no digits", "")
+		_, _, reasonErr := service.Create(&ctx, domain.SuppressionKindEmail, "a@test.com", domain.SuppressionReasonErasure)
+
+		// assert
+		_ = assert.ErrorIs(t, kindErr, domain.ErrInvalidSuppression)
+		_ = assert.ErrorIs(t, valueErr, domain.ErrInvalidSuppression)
+		_ = assert.ErrorIs(t, reasonErr, domain.ErrInvalidSuppression)
+	})
+
+	_ = t.Run("success, a list is imported and its invalid rows counted", func(t *testing.T) {
+		// arrange
+		repository := NewSuppressionRepositoryMock()
+		service := NewSuppressionService(repository, nil)
+		_, _, _ = service.Create(&ctx, domain.SuppressionKindEmail, "c@test.com", "")
+		list := "Name,Email,Phone\nA,a@test.com,1\nB,B@test.com,\nC,c@test.com,abc\nD,,\nE,a@test.com,2\n"
+
+		// act
+		result, err := service.Import(&ctx, strings.NewReader(list), domain.SuppressionReasonComplaint)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 5, result.RowsRead)
+			_ = assert.Equal(t, 2, result.RowsRejected)
+			_ = assert.Equal(t, int64(4), result.Suppressed)
+			_ = assert.Equal(t, int64(1), result.AlreadyListed)
+			_ = assert.Len(t, repository.suppressions, 5)
+		}
+	})
+
+	_ = t.Run("a list without an email or phone column", func(t *testing.T) {
+		// arrange
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), nil)
+
+		// act
+		_, err := service.Import(&ctx, strings.NewReader("name\nJane\n"), "")
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidSuppression)
+	})
+
+	_ = t.Run("success, a value is found by its hash and deleted", func(t *testing.T) {
+		// arrange
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), nil)
+		suppression, _, _ := service.Create(&ctx, domain.SuppressionKindEmail, "jane@test.com", "")
+		_, _, _ = service.Create(&ctx, domain.SuppressionKindEmail, "bob@test.com", "")
+
+		// act
+		found, findErr := service.List(&ctx, SuppressionQuery{Kind: domain.SuppressionKindEmail, Value: "JANE@test.com", Limit: 10})
+		deleteErr := service.Delete(&ctx, suppression.ID.Hex())
+		_, getErr := service.FindById(&ctx, suppression.ID.Hex())
+
+		// assert
+		if assert.NoError(t, findErr) && assert.Len(t, found, 1) {
+			_ = assert.Equal(t, suppression.ID, found[0].ID)
+		}
+		_ = assert.NoError(t, deleteErr)
+		_ = assert.ErrorIs(t, getErr, mongo.ErrNoDocuments)
+	})
+
+	_ = t.Run("success, with encryption the values are hashed with a key of the tenant", func(t *testing.T) {
+		// arrange
+		masterKey, _ := encryption.NewDataKey()
+		keyManager, _ := encryption.NewLocalKeyManager(masterKey)
+		cipher := NewLeadCipher(keyManager, NewEncryptionKeyRepositoryMock())
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), cipher)
+		otherCtx := domain.ContextWithTenant(context.Background(), "globex")
+
+		// act
+		suppression, _, err := service.Create(&ctx, domain.SuppressionKindEmail, "jane@test.com", "")
+		other, _, otherErr := service.Create(&otherCtx, domain.SuppressionKindEmail, "jane@test.com", "")
+
+		// assert
+		if assert.NoError(t, err) && assert.NoError(t, otherErr) {
+			_ = assert.NotEqual(t, domain.UnkeyedSuppressionHash(domain.SuppressionKindEmail, "jane@test.com"), suppression.Hash)
+			_ = assert.NotEqual(t, suppression.Hash, other.Hash)
+		}
+	})
+
+	_ = t.Run("success, suppressions hashed before they were keyed still match", func(t *testing.T) {
+		// arrange
+		masterKey, _ := encryption.NewDataKey()
+		keyManager, _ := encryption.NewLocalKeyManager(masterKey)
+		cipher := NewLeadCipher(keyManager, NewEncryptionKeyRepositoryMock())
+		schema := &domain.Schema{Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		}}
+		repository := NewSuppressionRepositoryMock()
+		legacy, _, _ := NewSuppressionService(repository, nil).Create(&ctx, domain.SuppressionKindEmail, "a@test.com", "")
+		service := NewSuppressionService(repository, cipher)
+		fileService := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), repository, NewEventNotifierMock(), nil, cipher, nil,
+			IngestionOptions{BatchSize: 10})
+
+		// act
+		found, listErr := service.List(&ctx, SuppressionQuery{Kind: domain.SuppressionKindEmail, Value: "a@test.com", Limit: 10})
+		imp, err := processOne(&ctx, fileService, newFile(t, schema.ID.Hex(), "leads.csv", "email,phone\na@test.com,1\n"))
+
+		// assert
+		_ = assert.NoError(t, listErr)
+		if assert.Len(t, found, 1) {
+			_ = assert.Equal(t, legacy.ID, found[0].ID)
+		}
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 0, imp.RowsInserted)
+			_ = assert.Equal(t, 1, imp.RowsSuppressed)
+		}
+	})
+
+	_ = t.Run("a value is not found without its kind", func(t *testing.T) {
+		// arrange
+		service := NewSuppressionService(NewSuppressionRepositoryMock(), nil)
+
+		// act
+		_, err := service.List(&ctx, SuppressionQuery{Value: "jane@test.com", Limit: 10})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidSuppression)
+	})
+
+	_ = t.Run("lifted suppressions are imported again", func(t *testing.T) {
+		// arrange
+		schema := &domain.Schema{Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		}}
+		repository := NewSuppressionRepositoryMock()
+		service := NewSuppressionService(repository, nil)
+		suppression, _, _ := service.Create(&ctx, domain.SuppressionKindEmail, "a@test.com", "")
+		_ = service.Delete(&ctx, suppression.ID.Hex())
+		leadRepository := NewLeadRepositoryMock()
+		fileService := NewFileService(NewSchemaRepositoryMockWithSchema(schema), leadRepository, NewImportRepositoryMock(), repository, NewEventNotifierMock(), nil, nil, nil,
+			IngestionOptions{BatchSize: 10})
+
+		// act
+		imp, err := processOne(&ctx, fileService, newFile(t, schema.ID.Hex(), "leads.csv", "email,phone\na@test.com,1\n"))
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, imp.RowsInserted)
+			_ = assert.Equal(t, 0, imp.RowsSuppressed)
+		}
+	})
+}
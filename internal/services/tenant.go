@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+// withTenant scopes the work a background worker does on behalf of a record
+// to the tenant of the record, the default tenant for records without one.
+func withTenant(ctx *context.Context, tenant string) *context.Context {
+	if tenant == "" {
+		tenant = domain.DefaultTenant
+	}
+	tenantCtx := domain.ContextWithTenant(*ctx, tenant)
+	return &tenantCtx
+}
+
+// tenantOfContext returns the tenant the context was scoped to, the default
+// tenant when it was not.
+func tenantOfContext(ctx *context.Context) string {
+	if tenant, ok := domain.TenantFromContext(*ctx); ok {
+		return tenant
+	}
+	return domain.DefaultTenant
+}
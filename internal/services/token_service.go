@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+const (
+	// tokenLeeway allows for clock skew between the provider and the service.
+	tokenLeeway = 30 * time.Second
+
+	// jwksMinRefresh bounds how often an unknown key ID fetches the key set
+	// again, so forged key IDs can not flood the provider.
+	jwksMinRefresh = 30 * time.Second
+)
+
+// tokenMethods are the asymmetric algorithms accepted, so a token can never
+// be signed with a public key used as a shared secret.
+var tokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// TokenOptions configures bearer tokens. They are checked against the keys of
+// JWKSURL, refreshed every RefreshInterval, or against the PEM PublicKey. The
+// values of the RolesClaim and GroupsClaim claims, dot separated paths such as
+// realm_access.roles, are granted the scopes Roles and Groups map them to.
+type TokenOptions struct {
+	JWKSURL         string
+	PublicKey       string
+	Issuer          string
+	Audience        string
+	RefreshInterval time.Duration
+	RolesClaim      string
+	GroupsClaim     string
+	TenantClaim     string
+	Roles           map[string][]string
+	Groups          map[string][]string
+	Client          *http.Client
+}
+
+type TokenService struct {
+	Options TokenOptions
+	keys    tokenKeys
+	parser  *jwt.Parser
+}
+
+func NewTokenService(opts TokenOptions) (*TokenService, error) {
+	for _, mapping := range []map[string][]string{opts.Roles, opts.Groups} {
+		for name, scopes := range mapping {
+			for _, scope := range scopes {
+				if !slices.Contains(domain.Scopes, scope) {
+					return nil, fmt.Errorf("unknown scope %q granted to %q", scope, name)
+				}
+			}
+		}
+	}
+
+	var keys tokenKeys
+	switch {
+	case opts.JWKSURL != "":
+		client := opts.Client
+		if client == nil {
+			client = &http.Client{Timeout: 10 * time.Second}
+		}
+		keys = &jwksKeys{url: opts.JWKSURL, client: client, interval: opts.RefreshInterval, minRefresh: jwksMinRefresh}
+	case opts.PublicKey != "":
+		key, err := parsePublicKey(opts.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = staticKey{key: key}
+	default:
+		return nil, errors.New("a JWKS URL or a public key is required")
+	}
+
+	parserOpts := []jwt.ParserOption{jwt.WithValidMethods(tokenMethods), jwt.WithExpirationRequired(), jwt.WithLeeway(tokenLeeway)}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	return &TokenService{
+		Options: opts,
+		keys:    keys,
+		parser:  jwt.NewParser(parserOpts...),
+	}, nil
+}
+
+// Authenticate checks the signature and the claims of the token and returns
+// its subject with the scopes of its roles and groups. Invalid tokens are
+// reported as ErrUnauthorized and missing scopes as ErrForbidden.
+func (ts *TokenService) Authenticate(ctx *context.Context, token string, scopes []string) (*domain.Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := ts.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return ts.keys.find(ctx, kid)
+	})
+	if err != nil {
+		return nil, domain.ErrUnauthorized
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, domain.ErrUnauthorized
+	}
+
+	principal := &domain.Principal{
+		Subject: subject,
+		Method:  domain.AuthMethodJWT,
+		Scopes:  ts.grantedScopes(claims),
+	}
+	principal.Name, _ = claims["name"].(string)
+	principal.Tenant = domain.DefaultTenant
+	if ts.Options.TenantClaim != "" {
+		// a token without a valid tenant is refused rather than given the
+		// data of the default tenant
+		principal.Tenant = strings.Join(claimValues(claims, ts.Options.TenantClaim), " ")
+		if domain.ValidateTenant(principal.Tenant) != nil {
+			return nil, domain.ErrUnauthorized
+		}
+	}
+
+	if !principal.HasScopes(scopes) {
+		return nil, domain.ErrForbidden
+	}
+
+	return principal, nil
+}
+
+func (ts *TokenService) grantedScopes(claims jwt.MapClaims) []string {
+	var granted []string
+	for _, source := range []struct {
+		claim    string
+		mappings map[string][]string
+	}{{ts.Options.RolesClaim, ts.Options.Roles}, {ts.Options.GroupsClaim, ts.Options.Groups}} {
+		if source.claim == "" {
+			continue
+		}
+		for _, value := range claimValues(claims, source.claim) {
+			for _, scope := range source.mappings[value] {
+				if !slices.Contains(granted, scope) {
+					granted = append(granted, scope)
+				}
+			}
+		}
+	}
+	return granted
+}
+
+// claimValues follows the dot separated path through the claims. A string is
+// split on spaces, like the scope claim, and a list keeps its strings.
+func claimValues(claims jwt.MapClaims, path string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// tokenKeys finds the key a token was signed with by its key ID.
+type tokenKeys interface {
+	find(ctx *context.Context, kid string) (crypto.PublicKey, error)
+}
+
+type staticKey struct {
+	key crypto.PublicKey
+}
+
+func (sk staticKey) find(_ *context.Context, _ string) (crypto.PublicKey, error) {
+	return sk.key, nil
+}
+
+func parsePublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("the public key is not PEM encoded")
+	}
+
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// jwksKeys caches the key set of the provider. It is fetched again once it is
+// older than the interval, or when a token names a key it does not hold, as
+// after the provider rotated its keys.
+type jwksKeys struct {
+	url        string
+	client     *http.Client
+	interval   time.Duration
+	minRefresh time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	triedAt   time.Time
+}
+
+func (jk *jwksKeys) find(ctx *context.Context, kid string) (crypto.PublicKey, error) {
+	jk.mu.Lock()
+	defer jk.mu.Unlock()
+
+	key, found := jk.lookup(kid)
+	if found && time.Since(jk.fetchedAt) < jk.interval {
+		return key, nil
+	}
+	if !found && time.Since(jk.triedAt) < jk.minRefresh {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	jk.triedAt = time.Now()
+	keys, err := jk.fetch(ctx)
+	if err != nil {
+		// keeps the known keys working while the provider is unavailable
+		if found {
+			return key, nil
+		}
+		return nil, err
+	}
+	jk.keys = keys
+	jk.fetchedAt = time.Now()
+
+	key, found = jk.lookup(kid)
+	if !found {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds the key by its ID, or the only key of a set when the token
+// names none.
+func (jk *jwksKeys) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(jk.keys) == 1 {
+		for _, key := range jk.keys {
+			return key, true
+		}
+	}
+	key, found := jk.keys[kid]
+	return key, found
+}
+
+func (jk *jwksKeys) fetch(ctx *context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(*ctx, http.MethodGet, jk.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := jk.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the key set returned %s", res.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// skips the key types and curves that are not supported
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeKeyInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeKeyInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeKeyInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeKeyInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("the point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeKeyInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+)
+
+// jwksStandIn serves the public keys of its signing keys as a JWKS, the way
+// an OIDC provider does, and counts how often it is fetched.
+type jwksStandIn struct {
+	mu      sync.Mutex
+	keys    map[string]crypto.Signer
+	fetches int
+	server  *httptest.Server
+}
+
+func newJWKSStandIn(t *testing.T) *jwksStandIn {
+	js := &jwksStandIn{keys: make(map[string]crypto.Signer)}
+	js.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		js.mu.Lock()
+		defer js.mu.Unlock()
+		js.fetches++
+
+		keys := make([]map[string]string, 0, len(js.keys))
+		for kid, signer := range js.keys {
+			switch public := signer.Public().(type) {
+			case *rsa.PublicKey:
+				keys = append(keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+					"n": encodeKeyInt(public.N), "e": encodeKeyInt(big.NewInt(int64(public.E)))})
+			case *ecdsa.PublicKey:
+				keys = append(keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+					"x": encodeKeyInt(public.X), "y": encodeKeyInt(public.Y)})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(js.server.Close)
+	return js
+}
+
+func (js *jwksStandIn) addRSAKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Failed to generate RSA key:", err)
+	}
+	js.mu.Lock()
+	js.keys[kid] = key
+	js.mu.Unlock()
+}
+
+func (js *jwksStandIn) addECKey(t *testing.T, kid string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Failed to generate EC key:", err)
+	}
+	js.mu.Lock()
+	js.keys[kid] = key
+	js.mu.Unlock()
+}
+
+func (js *jwksStandIn) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	js.mu.Lock()
+	signer := js.keys[kid]
+	js.mu.Unlock()
+	return signToken(t, signer, kid, claims)
+}
+
+func signToken(t *testing.T, signer crypto.Signer, kid string, claims jwt.MapClaims) string {
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := signer.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(signer)
+	if err != nil {
+		t.Fatal("Failed to sign token:", err)
+	}
+	return signed
+}
+
+func encodeKeyInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func tokenClaims(extra jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":       "user-1",
+		"iss":       "https://id.test",
+		"aud":       "lead-stream-service",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"tenant_id": "acme",
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestTokenService_Authenticate(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(t *testing.T, js *jwksStandIn) *TokenService {
+		service, err := NewTokenService(TokenOptions{
+			JWKSURL:         js.server.URL,
+			Issuer:          "https://id.test",
+			Audience:        "lead-stream-service",
+			RefreshInterval: time.Hour,
+			RolesClaim:      "realm_access.roles",
+			GroupsClaim:     "groups",
+			TenantClaim:     "tenant_id",
+			Roles:           map[string][]string{"lead-admin": {domain.ScopeAdmin}, "lead-reader": {domain.ScopeLeadsRead}},
+			Groups:          map[string][]string{"marketing": {domain.ScopeLeadsUpload}},
+		})
+		if err != nil {
+			t.Fatal("Failed to create token service:", err)
+		}
+		return service
+	}
+
+	_ = t.Run("maps roles, groups and tenant", func(t *testing.T) {
+		// arrange
+		js := newJWKSStandIn(t)
+		js.addRSAKey(t, "rsa-1")
+		service := newService(t, js)
+		token := js.sign(t, "rsa-1", tokenClaims(jwt.MapClaims{
+			"name":         "Ana",
+			"realm_access": map[string]interface{}{"roles": []string{"lead-reader", "offline_access"}},
+			"groups":       []string{"marketing"},
+		}))
+
+		// act
+		principal, err := service.Authenticate(&ctx, token, []string{domain.ScopeLeadsRead, domain.ScopeLeadsUpload})
+		_, forbiddenErr := service.Authenticate(&ctx, token, []string{domain.ScopeSchemaWrite})
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, "user-1", principal.Subject)
+			_ = assert.Equal(t, "Ana", principal.Name)
+			_ = assert.Equal(t, domain.AuthMethodJWT, principal.Method)
+			_ = assert.Equal(t, "acme", principal.Tenant)
+			_ = assert.ElementsMatch(t, []string{domain.ScopeLeadsRead, domain.ScopeLeadsUpload}, principal.Scopes)
+		}
+		_ = assert.ErrorIs(t, forbiddenErr, domain.ErrForbidden)
+	})
+
+	_ = t.Run("refuses tokens without a valid tenant", func(t *testing.T) {
+		// arrange
+		js := newJWKSStandIn(t)
+		js.addRSAKey(t, "rsa-1")
+		service := newService(t, js)
+		claims := tokenClaims(nil)
+		delete(claims, "tenant_id")
+
+		// act
+		_, missingErr := service.Authenticate(&ctx, js.sign(t, "rsa-1", claims), nil)
+		_, invalidErr := service.Authenticate(&ctx, js.sign(t, "rsa-1", tokenClaims(jwt.MapClaims{"tenant_id": "../admin"})), nil)
+
+		// assert
+		_ = assert.ErrorIs(t, missingErr, domain.ErrUnauthorized)
+		_ = assert.ErrorIs(t, invalidErr, domain.ErrUnauthorized)
+	})
+
+	_ = t.Run("fetches the key set again for a rotated key", func(t *testing.T) {
+		// arrange
+		js := newJWKSStandIn(t)
+		js.addRSAKey(t, "rsa-1")
+		service := newService(t, js)
+		service.keys.(*jwksKeys).minRefresh = 0
+		_, err := service.Authenticate(&ctx, js.sign(t, "rsa-1", tokenClaims(nil)), nil)
+		if err != nil {
+			t.Fatal("Failed to authenticate:", err)
+		}
+		js.addECKey(t, "ec-2")
+
+		// act
+		_, rotatedErr := service.Authenticate(&ctx, js.sign(t, "ec-2", tokenClaims(nil)), nil)
+		_, knownErr := service.Authenticate(&ctx, js.sign(t, "rsa-1", tokenClaims(nil)), nil)
+
+		// assert
+		_ = assert.NoError(t, rotatedErr)
+		_ = assert.NoError(t, knownErr)
+		_ = assert.Equal(t, 2, js.fetches)
+	})
+
+	_ = t.Run("rejects invalid tokens", func(t *testing.T) {
+		// arrange
+		js := newJWKSStandIn(t)
+		js.addRSAKey(t, "rsa-1")
+		service := newService(t, js)
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims(nil)).SignedString([]byte("secret"))
+
+		// act
+		_, expiredErr := service.Authenticate(&ctx, js.sign(t, "rsa-1", tokenClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})), nil)
+		_, issuerErr := service.Authenticate(&ctx, js.sign(t, "rsa-1", tokenClaims(jwt.MapClaims{"iss": "https://other.test"})), nil)
+		_, audienceErr := service.Authenticate(&ctx, js.sign(t, "rsa-1", tokenClaims(jwt.MapClaims{"aud": "other"})), nil)
+		_, signatureErr := service.Authenticate(&ctx, signToken(t, other, "rsa-1", tokenClaims(nil)), nil)
+		_, unknownKeyErr := service.Authenticate(&ctx, signToken(t, other, "rsa-9", tokenClaims(nil)), nil)
+		_, hmacErr := service.Authenticate(&ctx, hmac, nil)
+		_, malformedErr := service.Authenticate(&ctx, "not-a-token", nil)
+
+		// assert
+		for _, err := range []error{expiredErr, issuerErr, audienceErr, signatureErr, unknownKeyErr, hmacErr, malformedErr} {
+			_ = assert.ErrorIs(t, err, domain.ErrUnauthorized)
+		}
+	})
+
+	_ = t.Run("static public key", func(t *testing.T) {
+		// arrange
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalPKIXPublicKey(key.Public())
+		service, err := NewTokenService(TokenOptions{
+			PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			RolesClaim: "roles",
+			Roles:      map[string][]string{"writer": {domain.ScopeSchemaWrite}},
+		})
+		if err != nil {
+			t.Fatal("Failed to create token service:", err)
+		}
+
+		// act
+		principal, err := service.Authenticate(&ctx, signToken(t, key, "", tokenClaims(jwt.MapClaims{"roles": "writer"})), []string{domain.ScopeSchemaWrite})
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, []string{domain.ScopeSchemaWrite}, principal.Scopes)
+		}
+	})
+
+	_ = t.Run("unknown scope in the mappings", func(t *testing.T) {
+		// act
+		_, err := NewTokenService(TokenOptions{JWKSURL: "http://localhost", Roles: map[string][]string{"reader": {"leads:delete"}}})
+
+		// assert
+		_ = assert.Error(t, err)
+	})
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UploadOptions configures resumable uploads. Chunks are appended to a file
+// in Dir and open sessions that receive no chunk for Timeout are discarded.
+// Dir is local to the instance unless it is shared, so a session can only be
+// served by the instance that created it otherwise.
+type UploadOptions struct {
+	Dir     string
+	Timeout time.Duration
+}
+
+type UploadService struct {
+	SchemaRepository repositories.SchemaRepository
+	UploadRepository repositories.UploadRepository
+	FileService      *FileService
+	Options          UploadOptions
+
+	locks sync.Map
+}
+
+func NewUploadService(sr repositories.SchemaRepository, ur repositories.UploadRepository, fs *FileService, opts UploadOptions) *UploadService {
+	return &UploadService{
+		SchemaRepository: sr,
+		UploadRepository: ur,
+		FileService:      fs,
+		Options:          opts,
+	}
+}
+
+func (us *UploadService) Create(ctx *context.Context, schemaId string, upload *domain.UploadSession) (*domain.UploadSession, error) {
+	if err := upload.Validate(); err != nil {
+		return nil, err
+	}
+	if us.FileService.Quotas != nil {
+		if err := us.FileService.Quotas.CheckFileSize(ctx, upload.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	schema, err := us.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	upload.SchemaId = schema.ID
+	if upload.Uploader == "" {
+		upload.Uploader = callerOf(ctx)
+	}
+	upload.Status = domain.UploadStatusOpen
+	upload.Offset = 0
+	upload.ExpiresAt = primitive.NewDateTimeFromTime(time.Now().Add(us.Options.Timeout))
+
+	err = us.UploadRepository.Create(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(us.Options.Dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	part, err := os.Create(us.partPath(upload))
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, part.Close()
+}
+
+func (us *UploadService) FindById(ctx *context.Context, id string) (*domain.UploadSession, error) {
+	return us.UploadRepository.FindById(ctx, id)
+}
+
+func (us *UploadService) WriteChunk(ctx *context.Context, id string, offset int64, chunk []byte) (*domain.UploadSession, error) {
+	defer us.lock(id)()
+
+	upload, err := us.findOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := upload.CanWrite(offset, int64(len(chunk))); err != nil {
+		return nil, err
+	}
+
+	part, err := os.OpenFile(us.partPath(upload), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = part.WriteAt(chunk, offset)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.UploadRepository.AdvanceOffset(ctx, upload, offset+int64(len(chunk)), time.Now().Add(us.Options.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// Finalize runs the uploaded file through the ingestion pipeline once every
+// chunk has arrived. A failed import leaves the session open so it can be
+// finalized again until it expires.
+func (us *UploadService) Finalize(ctx *context.Context, id string) ([]*domain.Import, error) {
+	defer us.lock(id)()
+
+	upload, err := us.findOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := upload.CanFinalize(); err != nil {
+		return nil, err
+	}
+
+	file, err := domain.NewLocalFile(upload.SchemaId.Hex(), upload.FileName, us.partPath(upload))
+	if err != nil {
+		return nil, err
+	}
+	file.Uploader = upload.Uploader
+	file.IdempotencyKey = upload.IdempotencyKey
+
+	imports, err := us.FileService.ProcessAndSave(ctx, file)
+	if err != nil {
+		return imports, err
+	}
+
+	for _, imp := range imports {
+		upload.ImportIds = append(upload.ImportIds, imp.ID)
+	}
+	upload.Status = domain.UploadStatusCompleted
+	return imports, us.close(ctx, upload)
+}
+
+func (us *UploadService) Cancel(ctx *context.Context, id string) error {
+	defer us.lock(id)()
+
+	upload, err := us.findOpen(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	upload.Status = domain.UploadStatusCancelled
+	return us.close(ctx, upload)
+}
+
+// CleanupExpired discards every open session past its expiry and returns how
+// many were removed.
+func (us *UploadService) CleanupExpired(ctx *context.Context) (int, error) {
+	uploads, err := us.UploadRepository.FindExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, upload := range uploads {
+		if err := us.expire(ctx, upload.ID.Hex()); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(uploads), nil
+}
+
+func (us *UploadService) RunCleanup(ctx *context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-(*ctx).Done():
+			return
+		case <-ticker.C:
+			removed, err := us.CleanupExpired(ctx)
+			if err != nil {
+				log.Println("Failed to clean up expired uploads: ", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d expired uploads", removed)
+			}
+		}
+	}
+}
+
+// findOpen loads a session and expires it on the spot when it is past its
+// expiry but the cleanup has not run yet.
+func (us *UploadService) findOpen(ctx *context.Context, id string) (*domain.UploadSession, error) {
+	upload, err := us.UploadRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.IsExpired(time.Now()) {
+		upload.Status = domain.UploadStatusExpired
+		if err := us.close(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	if upload.Status != domain.UploadStatusOpen {
+		return nil, domain.ErrUploadClosed
+	}
+
+	return upload, nil
+}
+
+func (us *UploadService) expire(ctx *context.Context, id string) error {
+	defer us.lock(id)()
+
+	_, err := us.findOpen(ctx, id)
+	if errors.Is(err, domain.ErrUploadClosed) {
+		return nil
+	}
+	return err
+}
+
+func (us *UploadService) close(ctx *context.Context, upload *domain.UploadSession) error {
+	if err := os.Remove(us.partPath(upload)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	us.locks.Delete(upload.ID.Hex())
+
+	return us.UploadRepository.Update(ctx, upload)
+}
+
+func (us *UploadService) partPath(upload *domain.UploadSession) string {
+	return filepath.Join(us.Options.Dir, upload.ID.Hex()+".part")
+}
+
+func (us *UploadService) lock(id string) func() {
+	value, _ := us.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
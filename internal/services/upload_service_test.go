@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUploadService(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+	content := []byte("email,phone\na@test.com,1\nb@test.com,2\n")
+
+	newService := func(t *testing.T, timeout time.Duration) (*UploadService, *leadRepositoryMock) {
+		schemaRepository := NewSchemaRepositoryMockWithSchema(schema)
+		leadRepository := NewLeadRepositoryMock()
+		fileService := NewFileService(schemaRepository, leadRepository, NewImportRepositoryMock(), NewSuppressionRepositoryMock(), NewEventNotifierMock(), nil, nil, nil, IngestionOptions{BatchSize: 10})
+		return NewUploadService(schemaRepository, NewUploadRepositoryMock(), fileService,
+			UploadOptions{Dir: t.TempDir(), Timeout: timeout}), leadRepository
+	}
+
+	_ = t.Run("success, chunks are assembled and processed on finalize", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(t, time.Hour)
+		upload, err := service.Create(&ctx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content))})
+		if err != nil {
+			t.Fatal("Failed to create upload:", err)
+		}
+
+		// act
+		_, err = service.WriteChunk(&ctx, upload.ID.Hex(), 0, content[:10])
+		if err != nil {
+			t.Fatal("Failed to write chunk:", err)
+		}
+		written, err := service.WriteChunk(&ctx, upload.ID.Hex(), 10, content[10:])
+		if err != nil {
+			t.Fatal("Failed to write chunk:", err)
+		}
+		imports, err := service.Finalize(&ctx, upload.ID.Hex())
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, imports, 1) {
+			imp := imports[0]
+			_ = assert.Equal(t, int64(len(content)), written.Offset)
+			_ = assert.Equal(t, domain.ImportStatusCompleted, imp.Status)
+			_ = assert.Equal(t, "leads.csv", imp.FileName)
+			_ = assert.Len(t, leadRepository.leads, 2)
+
+			stored, _ := service.FindById(&ctx, upload.ID.Hex())
+			_ = assert.Equal(t, domain.UploadStatusCompleted, stored.Status)
+			_ = assert.Equal(t, []primitive.ObjectID{imp.ID}, stored.ImportIds)
+			_, err := os.Stat(filepath.Join(service.Options.Dir, upload.ID.Hex()+".part"))
+			_ = assert.True(t, os.IsNotExist(err))
+		}
+	})
+
+	_ = t.Run("uploads without an uploader are recorded as the caller's", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t, time.Hour)
+		callerCtx := domain.ContextWithPrincipal(ctx, &domain.Principal{Subject: "user-1", Method: domain.AuthMethodJWT})
+
+		// act
+		upload, err := service.Create(&callerCtx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content))})
+		named, namedErr := service.Create(&callerCtx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content)), Uploader: "crm"})
+
+		// assert
+		if assert.NoError(t, err) && assert.NoError(t, namedErr) {
+			_ = assert.Equal(t, "user-1", upload.Uploader)
+			_ = assert.Equal(t, "crm", named.Uploader)
+		}
+	})
+
+	_ = t.Run("chunk at the wrong offset", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t, time.Hour)
+		upload, _ := service.Create(&ctx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content))})
+
+		// act
+		_, err := service.WriteChunk(&ctx, upload.ID.Hex(), 5, content[5:])
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrUploadOffsetMismatch, err)
+		}
+	})
+
+	_ = t.Run("chunk past the declared size", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t, time.Hour)
+		upload, _ := service.Create(&ctx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: 4})
+
+		// act
+		_, err := service.WriteChunk(&ctx, upload.ID.Hex(), 0, content)
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrUploadSizeExceeded, err)
+		}
+	})
+
+	_ = t.Run("finalize before the last chunk", func(t *testing.T) {
+		// arrange
+		service, leadRepository := newService(t, time.Hour)
+		upload, _ := service.Create(&ctx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content))})
+		_, _ = service.WriteChunk(&ctx, upload.ID.Hex(), 0, content[:10])
+
+		// act
+		_, err := service.Finalize(&ctx, upload.ID.Hex())
+
+		// assert
+		if assert.Error(t, err) {
+			_ = assert.Equal(t, domain.ErrUploadIncomplete, err)
+			_ = assert.Empty(t, leadRepository.leads)
+		}
+	})
+
+	_ = t.Run("accepted chunks push back the expiry", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t, time.Hour)
+		upload, _ := service.Create(&ctx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content))})
+		created := upload.ExpiresAt.Time()
+		time.Sleep(10 * time.Millisecond)
+
+		// act
+		written, err := service.WriteChunk(&ctx, upload.ID.Hex(), 0, content[:10])
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.True(t, written.ExpiresAt.Time().After(created))
+			stored, _ := service.FindById(&ctx, upload.ID.Hex())
+			_ = assert.Equal(t, written.ExpiresAt, stored.ExpiresAt)
+		}
+	})
+
+	_ = t.Run("expired sessions are cleaned up", func(t *testing.T) {
+		// arrange
+		service, _ := newService(t, -time.Minute)
+		upload, _ := service.Create(&ctx, schema.ID.Hex(), &domain.UploadSession{FileName: "leads.csv", Size: int64(len(content))})
+
+		// act
+		removed, err := service.CleanupExpired(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, 1, removed)
+			stored, _ := service.FindById(&ctx, upload.ID.Hex())
+			_ = assert.Equal(t, domain.UploadStatusExpired, stored.Status)
+			_, err := service.WriteChunk(&ctx, upload.ID.Hex(), 0, content)
+			_ = assert.Equal(t, domain.ErrUploadClosed, err)
+		}
+	})
+}
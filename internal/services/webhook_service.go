@@ -0,0 +1,365 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// webhookSecret is the name the secrets of webhooks are sealed under.
+const webhookSecret = "webhook.secret"
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// WebhookOptions configures deliveries. A failed delivery is retried after
+// Backoff, doubling on every failure up to MaxBackoff, and moved to the dead
+// letter state after MaxAttempts. Workers deliveries are sent at once.
+// Subscribers on loopback, link-local or private addresses are only reached
+// when AllowPrivateNetworks is set, and their certificates are verified
+// against RootCAs, the roots of the system when nil.
+type WebhookOptions struct {
+	Timeout     time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Workers     int
+
+	AllowPrivateNetworks bool
+	RootCAs              *x509.CertPool
+}
+
+type WebhookService struct {
+	SchemaRepository          repositories.SchemaRepository
+	WebhookRepository         repositories.WebhookRepository
+	WebhookDeliveryRepository repositories.WebhookDeliveryRepository
+	// Cipher seals the secrets of webhooks, which can not be created when nil.
+	Cipher  *LeadCipher
+	Options WebhookOptions
+
+	client *http.Client
+}
+
+func NewWebhookService(sr repositories.SchemaRepository, wr repositories.WebhookRepository, wdr repositories.WebhookDeliveryRepository, cipher *LeadCipher, opts WebhookOptions) *WebhookService {
+	return &WebhookService{
+		SchemaRepository:          sr,
+		WebhookRepository:         wr,
+		WebhookDeliveryRepository: wdr,
+		Cipher:                    cipher,
+		Options:                   opts,
+		client:                    newPublicClient(opts.Timeout, opts.AllowPrivateNetworks, opts.RootCAs, domain.ErrInvalidWebhook),
+	}
+}
+
+// Create subscribes the webhook, generating its secret when none is given. The
+// secret is stored sealed, and only returned in plain here.
+func (ws *WebhookService) Create(ctx *context.Context, schemaId string, webhook *domain.Webhook) (*domain.Webhook, error) {
+	if err := webhook.Validate(); err != nil {
+		return nil, err
+	}
+
+	schema, err := ws.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := webhook.Secret
+	if secret == "" {
+		secret, err = newWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ws.sealSecret(ctx, webhook, secret); err != nil {
+		return nil, err
+	}
+	webhook.SchemaId = schema.ID
+
+	err = ws.WebhookRepository.Create(ctx, webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+func (ws *WebhookService) FindById(ctx *context.Context, id string) (*domain.Webhook, error) {
+	return ws.WebhookRepository.FindById(ctx, id)
+}
+
+func (ws *WebhookService) FindBySchemaId(ctx *context.Context, schemaId string) ([]*domain.Webhook, error) {
+	_, err := ws.SchemaRepository.FindById(ctx, schemaId)
+	if err != nil {
+		return nil, err
+	}
+
+	return ws.WebhookRepository.FindBySchemaId(ctx, schemaId)
+}
+
+// Update replaces the settings of the webhook, keeping its secret unless a new
+// one is given.
+func (ws *WebhookService) Update(ctx *context.Context, id string, changes *domain.Webhook) (*domain.Webhook, error) {
+	if err := changes.Validate(); err != nil {
+		return nil, err
+	}
+
+	webhook, err := ws.WebhookRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.URL = changes.URL
+	webhook.Events = changes.Events
+	webhook.Enabled = changes.Enabled
+	if changes.Secret != "" {
+		if err := ws.sealSecret(ctx, webhook, changes.Secret); err != nil {
+			return nil, err
+		}
+	}
+
+	err = ws.WebhookRepository.Update(ctx, webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (ws *WebhookService) Delete(ctx *context.Context, id string) error {
+	return ws.WebhookRepository.Delete(ctx, id)
+}
+
+// FindDeliveries returns the newest deliveries of the webhook, only those
+// with the given status unless it is empty.
+func (ws *WebhookService) FindDeliveries(ctx *context.Context, webhookId, status string, limit int64) ([]*domain.WebhookDelivery, error) {
+	webhook, err := ws.WebhookRepository.FindById(ctx, webhookId)
+	if err != nil {
+		return nil, err
+	}
+
+	return ws.WebhookDeliveryRepository.FindByWebhookId(ctx, webhook.ID, status, limit)
+}
+
+// Retry queues a dead delivery again for a new round of attempts.
+func (ws *WebhookService) Retry(ctx *context.Context, deliveryId string) (*domain.WebhookDelivery, error) {
+	delivery, err := ws.WebhookDeliveryRepository.FindById(ctx, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := delivery.Requeue(); err != nil {
+		return nil, err
+	}
+
+	err = ws.WebhookDeliveryRepository.Update(ctx, delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (ws *WebhookService) Wants(ctx *context.Context, schemaId primitive.ObjectID, eventType string) (bool, error) {
+	webhooks, err := ws.WebhookRepository.FindSubscribed(ctx, schemaId, eventType)
+	if err != nil {
+		return false, err
+	}
+
+	return len(webhooks) > 0, nil
+}
+
+// Notify queues a delivery of the event for every webhook subscribed to it.
+func (ws *WebhookService) Notify(ctx *context.Context, event *domain.Event) error {
+	webhooks, err := ws.WebhookRepository.FindSubscribed(ctx, event.SchemaId, event.Type)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]*domain.WebhookDelivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, domain.NewWebhookDelivery(webhook, event, payload))
+	}
+
+	return ws.WebhookDeliveryRepository.CreateMany(ctx, deliveries)
+}
+
+// DeliverDue sends every delivery that is due and returns how many were sent.
+func (ws *WebhookService) DeliverDue(ctx *context.Context) (int, error) {
+	sent := 0
+	for (*ctx).Err() == nil {
+		// the lease outlives the request, so a claimed delivery is only picked
+		// up again if this instance stops before recording the attempt
+		delivery, err := ws.WebhookDeliveryRepository.ClaimDue(ctx, time.Now(), 2*ws.Options.Timeout)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		if err := ws.deliver(ctx, delivery); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func (ws *WebhookService) RunDispatcher(ctx *context.Context, interval time.Duration) {
+	for range max(ws.Options.Workers, 1) {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-(*ctx).Done():
+					return
+				case <-ticker.C:
+					if _, err := ws.DeliverDue(ctx); err != nil {
+						log.Println("Failed to deliver webhooks: ", err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+func (ws *WebhookService) deliver(ctx *context.Context, delivery *domain.WebhookDelivery) error {
+	webhook, err := ws.WebhookRepository.FindById(ctx, delivery.WebhookId.Hex())
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		delivery.Abandon("webhook deleted")
+	case err != nil:
+		return err
+	case !webhook.Enabled:
+		delivery.Abandon("webhook disabled")
+	default:
+		attempt := ws.send(ctx, webhook, delivery)
+		if attempt.Error == "" {
+			delivery.Succeed(attempt)
+		} else {
+			delivery.Fail(attempt, ws.Options.MaxAttempts, ws.backoff(delivery.Failures))
+		}
+	}
+
+	return ws.WebhookDeliveryRepository.Update(ctx, delivery)
+}
+
+func (ws *WebhookService) send(ctx *context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) domain.WebhookAttempt {
+	started := time.Now()
+	attempt := domain.WebhookAttempt{At: primitive.NewDateTimeFromTime(started)}
+
+	secret, err := ws.openSecret(withTenant(ctx, webhook.TenantId), webhook)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(*ctx, http.MethodPost, webhook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(WebhookSignatureHeader, signWebhookPayload(secret, started.Unix(), []byte(delivery.Payload)))
+
+	res, err := ws.client.Do(req)
+	attempt.Duration = time.Since(started)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", res.Status)
+	}
+
+	return attempt
+}
+
+// sealSecret stores the secret of the webhook sealed, so it is never stored in
+// plain.
+func (ws *WebhookService) sealSecret(ctx *context.Context, webhook *domain.Webhook, secret string) error {
+	sealed, err := ws.Cipher.SealSecret(ctx, webhookSecret, secret)
+	if err != nil {
+		return err
+	}
+
+	webhook.Secret = ""
+	webhook.SealedSecret = sealed
+	return nil
+}
+
+// openSecret returns the secret of the webhook, in plain for the webhooks
+// stored before secrets were sealed.
+func (ws *WebhookService) openSecret(ctx *context.Context, webhook *domain.Webhook) (string, error) {
+	if webhook.SealedSecret == nil {
+		return webhook.Secret, nil
+	}
+	return ws.Cipher.OpenSecret(ctx, webhookSecret, webhook.SealedSecret)
+}
+
+// backoff is how long to wait after the given number of earlier failures.
+func (ws *WebhookService) backoff(failures int) time.Duration {
+	delay := ws.Options.Backoff
+	for range failures {
+		delay *= 2
+		if delay >= ws.Options.MaxBackoff {
+			return ws.Options.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// signWebhookPayload signs the timestamp and the payload with HMAC-SHA256, so
+// receivers can check both the sender and that the request is not replayed
+// later. The header reads "t=<unix seconds>,v1=<hex signature>" and the signed
+// content is "<unix seconds>.<payload>".
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
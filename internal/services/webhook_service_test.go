@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vitortenor/lead-stream-service/internal/domain"
+	"github.com/vitortenor/lead-stream-service/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWebhookService(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{ID: primitive.NewObjectID()}
+
+	// every httptest TLS server shares the same certificate
+	certificates := httptest.NewTLSServer(http.NotFoundHandler())
+	roots := x509.NewCertPool()
+	roots.AddCert(certificates.Certificate())
+	certificates.Close()
+
+	newServiceWith := func(opts WebhookOptions) (*WebhookService, *webhookRepositoryMock, *webhookDeliveryRepositoryMock) {
+		webhookRepository := NewWebhookRepositoryMock()
+		deliveryRepository := NewWebhookDeliveryRepositoryMock()
+		opts.Timeout, opts.Backoff, opts.MaxBackoff, opts.Workers, opts.RootCAs = time.Second, time.Minute, time.Hour, 1, roots
+		masterKey, _ := encryption.NewDataKey()
+		keyManager, _ := encryption.NewLocalKeyManager(masterKey)
+		cipher := NewLeadCipher(keyManager, NewEncryptionKeyRepositoryMock())
+		return NewWebhookService(NewSchemaRepositoryMockWithSchema(schema), webhookRepository, deliveryRepository, cipher, opts),
+			webhookRepository, deliveryRepository
+	}
+
+	newService := func(maxAttempts int) (*WebhookService, *webhookRepositoryMock, *webhookDeliveryRepositoryMock) {
+		return newServiceWith(WebhookOptions{MaxAttempts: maxAttempts, AllowPrivateNetworks: true})
+	}
+
+	// serve answers the given status and keeps the requests received
+	serve := func(t *testing.T, status *int, received *[]*http.Request, bodies *[]string) string {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			*received = append(*received, r)
+			*bodies = append(*bodies, string(body))
+			w.WriteHeader(*status)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	// makeDue lets the dispatcher pick up the pending deliveries right away
+	makeDue := func(deliveryRepository *webhookDeliveryRepositoryMock) {
+		for _, delivery := range deliveryRepository.deliveries {
+			delivery.NextAttemptAt = primitive.NewDateTimeFromTime(time.Now().Add(-time.Second))
+		}
+	}
+
+	_ = t.Run("success, subscribed events are delivered signed", func(t *testing.T) {
+		// arrange
+		status := http.StatusOK
+		var received []*http.Request
+		var bodies []string
+		service, webhookRepository, deliveryRepository := newService(3)
+		webhook, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{
+			URL:     serve(t, &status, &received, &bodies),
+			Events:  []string{domain.EventImportCompleted},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		imp := &domain.Import{ID: primitive.NewObjectID(), SchemaId: schema.ID, Status: domain.ImportStatusCompleted}
+
+		// act
+		err = errors.Join(
+			service.Notify(&ctx, domain.NewImportEvent(imp)),
+			service.Notify(&ctx, domain.NewEvent(domain.EventLeadCreated, schema.ID, nil)),
+		)
+		if err != nil {
+			t.Fatal("Failed to notify events:", err)
+		}
+		sent, err := service.DeliverDue(&ctx)
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, received, 1) {
+			signature := received[0].Header.Get(WebhookSignatureHeader)
+			timestamp, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+			_ = assert.Equal(t, 1, sent)
+			_ = assert.True(t, strings.HasPrefix(webhook.Secret, "whsec_"))
+			_ = assert.Equal(t, signWebhookPayload(webhook.Secret, timestamp, []byte(bodies[0])), signature)
+			_ = assert.Empty(t, webhookRepository.webhooks[webhook.ID].Secret)
+			_ = assert.NotNil(t, webhookRepository.webhooks[webhook.ID].SealedSecret)
+			_ = assert.Equal(t, domain.EventImportCompleted, received[0].Header.Get(WebhookEventHeader))
+			_ = assert.Contains(t, bodies[0], imp.ID.Hex())
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusDelivered, deliveryRepository.deliveries[0].Status)
+		}
+	})
+
+	_ = t.Run("success, failed deliveries back off and end up dead", func(t *testing.T) {
+		// arrange
+		status := http.StatusInternalServerError
+		var received []*http.Request
+		var bodies []string
+		service, _, deliveryRepository := newService(2)
+		_, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{
+			URL:     serve(t, &status, &received, &bodies),
+			Secret:  "secret",
+			Events:  []string{domain.EventImportFailed},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		err = service.Notify(&ctx, domain.NewEvent(domain.EventImportFailed, schema.ID, nil))
+		if err != nil {
+			t.Fatal("Failed to notify event:", err)
+		}
+
+		// act
+		_, firstErr := service.DeliverDue(&ctx)
+		retried := *deliveryRepository.deliveries[0]
+		makeDue(deliveryRepository)
+		_, secondErr := service.DeliverDue(&ctx)
+
+		// assert
+		if assert.NoError(t, errors.Join(firstErr, secondErr)) {
+			dead := deliveryRepository.deliveries[0]
+			_ = assert.Len(t, received, 2)
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusPending, retried.Status)
+			_ = assert.WithinDuration(t, time.Now().Add(time.Minute), retried.NextAttemptAt.Time(), 5*time.Second)
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusDead, dead.Status)
+			_ = assert.Len(t, dead.Attempts, 2)
+			_ = assert.Equal(t, http.StatusInternalServerError, dead.Attempts[1].StatusCode)
+		}
+	})
+
+	_ = t.Run("success, dead deliveries are retried", func(t *testing.T) {
+		// arrange
+		status := http.StatusBadGateway
+		var received []*http.Request
+		var bodies []string
+		service, _, deliveryRepository := newService(1)
+		_, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{
+			URL:     serve(t, &status, &received, &bodies),
+			Events:  []string{domain.EventImportFailed},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		err = service.Notify(&ctx, domain.NewEvent(domain.EventImportFailed, schema.ID, nil))
+		if err != nil {
+			t.Fatal("Failed to notify event:", err)
+		}
+		if _, err := service.DeliverDue(&ctx); err != nil {
+			t.Fatal("Failed to deliver:", err)
+		}
+		status = http.StatusNoContent
+
+		// act
+		retried, err := service.Retry(&ctx, deliveryRepository.deliveries[0].ID.Hex())
+		if err != nil {
+			t.Fatal("Failed to retry:", err)
+		}
+		_, err = service.DeliverDue(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusPending, retried.Status)
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusDelivered, deliveryRepository.deliveries[0].Status)
+			_ = assert.Len(t, deliveryRepository.deliveries[0].Attempts, 2)
+		}
+	})
+
+	_ = t.Run("success, deliveries of deleted webhooks are abandoned", func(t *testing.T) {
+		// arrange
+		service, webhookRepository, deliveryRepository := newService(3)
+		webhook, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{
+			URL:     "https://localhost:1",
+			Events:  []string{domain.EventImportFailed},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		err = service.Notify(&ctx, domain.NewEvent(domain.EventImportFailed, schema.ID, nil))
+		if err != nil {
+			t.Fatal("Failed to notify event:", err)
+		}
+		delete(webhookRepository.webhooks, webhook.ID)
+
+		// act
+		_, err = service.DeliverDue(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusDead, deliveryRepository.deliveries[0].Status)
+			_ = assert.Equal(t, "webhook deleted", deliveryRepository.deliveries[0].Attempts[0].Error)
+		}
+	})
+
+	_ = t.Run("error, pending deliveries can not be retried", func(t *testing.T) {
+		// arrange
+		service, _, deliveryRepository := newService(3)
+		_, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{
+			URL:     "https://localhost:1",
+			Events:  []string{domain.EventImportFailed},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		err = service.Notify(&ctx, domain.NewEvent(domain.EventImportFailed, schema.ID, nil))
+		if err != nil {
+			t.Fatal("Failed to notify event:", err)
+		}
+
+		// act
+		_, err = service.Retry(&ctx, deliveryRepository.deliveries[0].ID.Hex())
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrWebhookDeliveryNotDead)
+	})
+
+	_ = t.Run("error, invalid webhook", func(t *testing.T) {
+		// arrange
+		service, _, _ := newService(3)
+
+		// act
+		_, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{URL: "ftp://example.com", Events: []string{"lead.deleted"}})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidWebhook)
+	})
+
+	_ = t.Run("error, webhooks over plain http are refused", func(t *testing.T) {
+		// arrange
+		service, _, _ := newService(3)
+
+		// act
+		_, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{URL: "http://crm.example.com/hooks", Events: []string{domain.EventImportFailed}})
+
+		// assert
+		_ = assert.ErrorIs(t, err, domain.ErrInvalidWebhook)
+	})
+
+	_ = t.Run("error, deliveries to private addresses are refused", func(t *testing.T) {
+		// arrange
+		status := http.StatusOK
+		var received []*http.Request
+		var bodies []string
+		service, _, deliveryRepository := newServiceWith(WebhookOptions{MaxAttempts: 3})
+		_, err := service.Create(&ctx, schema.ID.Hex(), &domain.Webhook{
+			URL:     serve(t, &status, &received, &bodies),
+			Events:  []string{domain.EventImportFailed},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create webhook:", err)
+		}
+		err = service.Notify(&ctx, domain.NewEvent(domain.EventImportFailed, schema.ID, nil))
+		if err != nil {
+			t.Fatal("Failed to notify event:", err)
+		}
+
+		// act
+		_, err = service.DeliverDue(&ctx)
+
+		// assert
+		if assert.NoError(t, err) {
+			_ = assert.Empty(t, received)
+			_ = assert.Equal(t, domain.WebhookDeliveryStatusPending, deliveryRepository.deliveries[0].Status)
+			_ = assert.Contains(t, deliveryRepository.deliveries[0].Attempts[0].Error, domain.ErrRemoteAddressDenied.Error())
+		}
+	})
+}
+
+func TestFileService_Notify(t *testing.T) {
+	ctx := context.Background()
+	schema := &domain.Schema{
+		ID: primitive.NewObjectID(),
+		Fields: []domain.SchemaField{
+			{Name: "email", Type: "string", Required: true, Unique: true},
+			{Name: "phone", Type: "integer", Required: true, Unique: true},
+		},
+	}
+
+	_ = t.Run("success, leads are sent in batches before the import event", func(t *testing.T) {
+		// arrange
+		notifier := NewEventNotifierMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), notifier, nil, nil, nil,
+			IngestionOptions{BatchSize: 2})
+		content := "email,phone\na@test.com,1\nb@test.com,2\nc@test.com,3\n"
+
+		// act
+		_, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.NoError(t, err) && assert.Len(t, notifier.events, 3) {
+			_ = assert.Equal(t, domain.EventLeadCreated, notifier.events[0].Type)
+			_ = assert.Len(t, notifier.events[0].Data.(domain.LeadsCreatedData).Leads, 2)
+			_ = assert.Len(t, notifier.events[1].Data.(domain.LeadsCreatedData).Leads, 1)
+			_ = assert.Equal(t, domain.EventImportCompleted, notifier.events[2].Type)
+		}
+	})
+
+	_ = t.Run("success, failed imports only send the import event", func(t *testing.T) {
+		// arrange
+		notifier := NewEventNotifierMock()
+		service := NewFileService(NewSchemaRepositoryMockWithSchema(schema), NewLeadRepositoryMock(), NewImportRepositoryMock(), NewSuppressionRepositoryMock(), notifier, nil, nil, nil,
+			IngestionOptions{BatchSize: 2})
+		content := "email,phone\na@test.com,\n"
+
+		// act
+		_, err := processOne(&ctx, service, newFile(t, schema.ID.Hex(), "leads.csv", content))
+
+		// assert
+		if assert.Error(t, err) && assert.Len(t, notifier.events, 1) {
+			_ = assert.Equal(t, domain.EventImportFailed, notifier.events[0].Type)
+		}
+	})
+}